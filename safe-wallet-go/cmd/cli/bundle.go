@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"safe-wallet-go/pkg"
+)
+
+// handleShareGroup writes the current group to a bundle with its own
+// password or age recipients
+func handleShareGroup(service *pkg.WalletService, path pkg.Path, scanner *lineReader, file string) {
+	if len(path.GroupIDs) == 0 {
+		fmt.Println("Navigate to the group to share first")
+		return
+	}
+	if file == "" {
+		fmt.Print("Bundle file to write: ")
+		if !scanner.Scan() {
+			return
+		}
+		file = strings.TrimSpace(scanner.Text())
+		if file == "" {
+			fmt.Println("Cancelled")
+			return
+		}
+	}
+	overwrite, ok := confirmOverwrite(scanner, file)
+	if !ok {
+		return
+	}
+
+	fmt.Print("Recipient public keys (age1..., leave empty to use a password): ")
+	if !scanner.Scan() {
+		return
+	}
+	recipients := splitRecipients(scanner.Text())
+
+	var password string
+	if len(recipients) == 0 {
+		fmt.Print("Password for the bundle: ")
+		password = scanner.ReadPassword()
+		if password == "" {
+			fmt.Println("Password cannot be empty")
+			return
+		}
+		fmt.Print("Confirm password: ")
+		if scanner.ReadPassword() != password {
+			fmt.Println("Passwords do not match")
+			return
+		}
+	}
+
+	if err := service.ShareGroup(file, path, password, recipients, overwrite); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Shared the current group as %s\n", file)
+}
+
+// handleImportBundle grafts the groups of a bundle into the current group
+func handleImportBundle(service *pkg.WalletService, path pkg.Path, scanner *lineReader, file string) {
+	if file == "" {
+		fmt.Print("Bundle file to import: ")
+		if !scanner.Scan() {
+			return
+		}
+		file = strings.TrimSpace(scanner.Text())
+		if file == "" {
+			fmt.Println("Cancelled")
+			return
+		}
+	}
+
+	fmt.Print("Identity file (leave empty to use a password): ")
+	if !scanner.Scan() {
+		return
+	}
+	identity := strings.TrimSpace(scanner.Text())
+	var password string
+	if identity == "" {
+		fmt.Print("Password of the bundle: ")
+		password = scanner.ReadPassword()
+	}
+
+	groups, err := pkg.ReadBundle(file, password, identity)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Println("If items of the bundle are already in the wallet:")
+	fmt.Println("  1. Keep both (the imported items get new IDs)")
+	fmt.Println("  2. Replace the existing items (items only the wallet has are kept)")
+	fmt.Print("Choice: ")
+	if !scanner.Scan() {
+		return
+	}
+	var policy pkg.IDConflictPolicy
+	switch strings.TrimSpace(scanner.Text()) {
+	case "1":
+		policy = pkg.ConflictKeepBoth
+	case "2":
+		policy = pkg.ConflictReplace
+	default:
+		fmt.Println("Cancelled")
+		return
+	}
+
+	renamed, err := service.ImportBundle(path, groups, policy)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Imported %d groups from the bundle.", len(groups))
+	if renamed > 0 {
+		fmt.Printf(" %d groups or entries were renamed because the name was taken.", renamed)
+	}
+	fmt.Println(" Save the wallet to keep the import.")
+}
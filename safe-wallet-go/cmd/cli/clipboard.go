@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"safe-wallet-go/pkg"
+)
+
+func handleCopy(service *pkg.WalletService, currentPath pkg.Path, guard *pkg.ClipboardGuard, arg string) {
+	if arg == "" {
+		fmt.Println("Usage: copy <entry> [field]")
+		return
+	}
+
+	entry, fieldName, err := resolveEntryAndField(service, currentPath, arg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	field, ok := selectCopyField(entry, fieldName)
+	if !ok {
+		if fieldName == "" {
+			fmt.Printf("Entry '%s' has no fields to copy\n", entry.Title)
+		} else {
+			fmt.Printf("Entry '%s' has no field '%s'\n", entry.Title, fieldName)
+		}
+		return
+	}
+
+	value, err := service.FieldValue(field)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if err := guard.Copy(value); err != nil {
+		fmt.Printf("Error copying to clipboard: %v\n", err)
+		return
+	}
+
+	if timeout := guard.Timeout(); timeout > 0 {
+		fmt.Printf("Copied '%s' of '%s' to the clipboard (cleared in %s)\n", field.Name, entry.Title, timeout)
+	} else {
+		fmt.Printf("Copied '%s' of '%s' to the clipboard\n", field.Name, entry.Title)
+	}
+}
+
+// resolveEntryAndField splits "<entry path> [field]" into the entry and the
+// field name. Both may contain spaces, so the longest entry path that
+// resolves is used.
+func resolveEntryAndField(service *pkg.WalletService, currentPath pkg.Path, arg string) (*pkg.Entry, string, error) {
+	path, err := service.ResolvePath(currentPath, arg)
+	if err == nil && path.EntryID != "" {
+		entry, err := pkg.FindEntryByPath(service.GetWallet(), path)
+		return entry, "", err
+	}
+
+	for i := strings.LastIndex(arg, " "); i > 0; i = strings.LastIndex(arg[:i], " ") {
+		entryPath, fieldName := strings.TrimSpace(arg[:i]), strings.TrimSpace(arg[i+1:])
+		path, err := service.ResolvePath(currentPath, entryPath)
+		if err != nil || path.EntryID == "" {
+			continue
+		}
+		entry, err := pkg.FindEntryByPath(service.GetWallet(), path)
+		return entry, fieldName, err
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+	return nil, "", fmt.Errorf("'%s' is a group, not an entry", arg)
+}
+
+// selectCopyField returns the named field, or by default the first password,
+// then the first PIN, then the first field of the entry
+func selectCopyField(entry *pkg.Entry, fieldName string) (pkg.EntryField, bool) {
+	if fieldName != "" {
+		for _, field := range entry.Fields {
+			if strings.EqualFold(field.Name, fieldName) {
+				return field, true
+			}
+		}
+		return pkg.EntryField{}, false
+	}
+
+	for _, fieldType := range []pkg.FieldType{pkg.FieldTypePassword, pkg.FieldTypePIN} {
+		for _, field := range entry.Fields {
+			if field.Type == fieldType {
+				return field, true
+			}
+		}
+	}
+	if len(entry.Fields) > 0 {
+		return entry.Fields[0], true
+	}
+	return pkg.EntryField{}, false
+}
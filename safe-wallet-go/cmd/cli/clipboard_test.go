@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"safe-wallet-go/pkg"
+)
+
+func TestHandleCopy(t *testing.T) {
+	service := newTestService(t)
+	root := pkg.Path{GroupIDs: []string{}}
+
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"Email/Work Mail", "hunter2"},
+		{"Email/Work Mail username", "alice"},
+		{"Email/Work Mail recovery code", "1234"},
+		{"Email/Work Mail PASSWORD", "hunter2"},
+	}
+	for _, test := range tests {
+		clipboard := &pkg.MemoryClipboard{}
+		guard := pkg.NewClipboardGuard(clipboard, 0)
+		handleCopy(service, root, guard, test.arg)
+		if text, _ := clipboard.Text(); text != test.want {
+			t.Errorf("copy %s: clipboard = %q, want %q", test.arg, text, test.want)
+		}
+	}
+
+	clipboard := &pkg.MemoryClipboard{}
+	guard := pkg.NewClipboardGuard(clipboard, 0)
+	for _, arg := range []string{"Email", "Email/Work Mail pin", "Email/Missing"} {
+		handleCopy(service, root, guard, arg)
+		if text, _ := clipboard.Text(); text != "" {
+			t.Errorf("copy %s: clipboard = %q, want nothing copied", arg, text)
+		}
+	}
+}
+
+func TestHandleCopyClearsAfterTimeout(t *testing.T) {
+	service := newTestService(t)
+	clipboard := &pkg.MemoryClipboard{}
+	guard := pkg.NewClipboardGuard(clipboard, 20*time.Millisecond)
+	cleared := make(chan struct{})
+	guard.OnCleared = func() { close(cleared) }
+
+	handleCopy(service, pkg.Path{GroupIDs: []string{}}, guard, "Email/Work Mail")
+	if text, _ := clipboard.Text(); text != "hunter2" {
+		t.Fatalf("clipboard after copy = %q", text)
+	}
+
+	select {
+	case <-cleared:
+	case <-time.After(5 * time.Second):
+		t.Fatal("clipboard not cleared after the timeout")
+	}
+	if text, _ := clipboard.Text(); text != "" {
+		t.Errorf("clipboard after the timeout = %q", text)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"safe-wallet-go/pkg"
+)
+
+// exportFormatNames describes the export formats for the format prompt
+var exportFormatNames = map[pkg.ExportFormat]string{
+	pkg.ExportWallet:     "Encrypted wallet file with its own password",
+	pkg.ExportJSON:       "JSON (plaintext)",
+	pkg.ExportCSV:        "CSV with a group path column (plaintext)",
+	pkg.ExportKeePassXML: "KeePass 2 XML (plaintext)",
+}
+
+// handleExport exports the wallet or the current group to a file
+func handleExport(service *pkg.WalletService, path pkg.Path, scanner *lineReader, file string) {
+	fmt.Println("Export format:")
+	for i, format := range pkg.ExportFormats {
+		fmt.Printf("  %d. %s\n", i+1, exportFormatNames[format])
+	}
+	fmt.Print("Format: ")
+	if !scanner.Scan() {
+		return
+	}
+	choice, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+	if err != nil || choice < 1 || choice > len(pkg.ExportFormats) {
+		fmt.Println("Cancelled")
+		return
+	}
+	options := pkg.ExportOptions{Format: pkg.ExportFormats[choice-1]}
+
+	if len(path.GroupIDs) > 0 {
+		fmt.Print("Export only the current group? (y/n): ")
+		if !scanner.Scan() {
+			return
+		}
+		if strings.ToLower(strings.TrimSpace(scanner.Text())) == "y" {
+			options.Path = path
+		}
+	}
+
+	if file == "" {
+		fmt.Print("File to write: ")
+		if !scanner.Scan() {
+			return
+		}
+		file = strings.TrimSpace(scanner.Text())
+		if file == "" {
+			fmt.Println("Cancelled")
+			return
+		}
+	}
+	overwrite, ok := confirmOverwrite(scanner, file)
+	if !ok {
+		return
+	}
+	options.Overwrite = overwrite
+
+	if options.Format.IsPlaintext() {
+		fmt.Println("WARNING: The file will contain all passwords unencrypted.")
+		fmt.Print("Type EXPORT to confirm: ")
+		if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "EXPORT" {
+			fmt.Println("Cancelled")
+			return
+		}
+		options.ConfirmPlaintext = true
+	} else {
+		fmt.Print("Password for the exported wallet: ")
+		options.Password = scanner.ReadPassword()
+		if options.Password == "" {
+			fmt.Println("Password cannot be empty")
+			return
+		}
+		fmt.Print("Confirm password: ")
+		if scanner.ReadPassword() != options.Password {
+			fmt.Println("Passwords do not match")
+			return
+		}
+	}
+
+	if err := service.Export(file, options); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Exported to %s\n", file)
+}
+
+// confirmOverwrite asks before a file is replaced. It reports whether the
+// file exists and may be overwritten, and whether to go on at all.
+func confirmOverwrite(scanner *lineReader, file string) (overwrite bool, ok bool) {
+	if _, err := os.Stat(file); err != nil {
+		return false, true
+	}
+	fmt.Printf("%s already exists. Overwrite it? (yes/no): ", file)
+	if !scanner.Scan() || strings.TrimSpace(strings.ToLower(scanner.Text())) != "yes" {
+		fmt.Println("Cancelled")
+		return false, false
+	}
+	return true, true
+}
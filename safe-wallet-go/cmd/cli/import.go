@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"safe-wallet-go/pkg"
+)
+
+// handleImport imports a KeePass database or the export of another password
+// manager as a new group in the current group
+func handleImport(service *pkg.WalletService, path pkg.Path, scanner *lineReader, file string) {
+	if file == "" {
+		fmt.Print("File to import (.kdbx, Bitwarden .json, 1Password .1pux/.csv, LastPass .csv): ")
+		if !scanner.Scan() {
+			return
+		}
+		file = strings.TrimSpace(scanner.Text())
+		if file == "" {
+			fmt.Println("Cancelled")
+			return
+		}
+	}
+
+	importer, err := pkg.DetectImporter(file)
+	if err != nil {
+		fmt.Printf("Could not detect the format (%v). Choose one:\n", err)
+		for i, candidate := range pkg.Importers {
+			fmt.Printf("  %d. %s\n", i+1, candidate.Name())
+		}
+		fmt.Print("Format: ")
+		if !scanner.Scan() {
+			return
+		}
+		choice, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil || choice < 1 || choice > len(pkg.Importers) {
+			fmt.Println("Cancelled")
+			return
+		}
+		importer = pkg.Importers[choice-1]
+	}
+
+	var options pkg.ImportOptions
+	if importer.NeedsPassword() {
+		fmt.Print("Master password of the file (leave empty for none): ")
+		options.Password = scanner.ReadPassword()
+
+		fmt.Print("Keyfile (leave empty for none): ")
+		if !scanner.Scan() {
+			return
+		}
+		options.KeyFilePath = strings.TrimSpace(scanner.Text())
+	}
+
+	fmt.Printf("Reading %s...\n", importer.Name())
+	group, err := importer.Import(file, options)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	groups, entries := pkg.CountItems(group)
+	fmt.Printf("Import %d groups and %d entries as group '%s'? (y/n): ", groups, entries, group.Name)
+	if !scanner.Scan() || strings.ToLower(strings.TrimSpace(scanner.Text())) != "y" {
+		fmt.Println("Cancelled")
+		return
+	}
+
+	renamed, err := service.ImportGroup(path, group, nil)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Imported into group '%s'.", group.Name)
+	if renamed > 0 {
+		fmt.Printf(" %d groups or entries were renamed because the name was taken.", renamed)
+	}
+	fmt.Println(" Save the wallet to keep the import.")
+}
+
+// handleImportBrowser imports the logins exported by Chrome, Firefox or
+// Safari into the current group, skipping or merging logins the wallet
+// already has
+func handleImportBrowser(service *pkg.WalletService, path pkg.Path, scanner *lineReader, file string) {
+	if len(path.GroupIDs) == 0 {
+		fmt.Println("Change to the group to import the logins into first")
+		return
+	}
+	if file == "" {
+		fmt.Print("Password CSV exported by Chrome, Firefox or Safari: ")
+		if !scanner.Scan() {
+			return
+		}
+		file = strings.TrimSpace(scanner.Text())
+		if file == "" {
+			fmt.Println("Cancelled")
+			return
+		}
+	}
+
+	entries, err := pkg.ReadBrowserCSV(file)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	summary, err := service.ImportLogins(path, entries)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+
+	fmt.Printf("\n=== Import Summary ===\n")
+	printSummaryTitles("Created", summary.Created)
+	printSummaryTitles("Merged into existing entries", summary.Merged)
+	printSummaryTitles("Skipped as duplicates", summary.Skipped)
+	if len(summary.Created)+len(summary.Merged) > 0 {
+		fmt.Println("Save the wallet to keep the import.")
+	}
+}
+
+func printSummaryTitles(heading string, titles []string) {
+	fmt.Printf("%s: %d\n", heading, len(titles))
+	for _, title := range titles {
+		fmt.Printf("  - %s\n", title)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// maxHistory is the number of commands kept in the session history
+const maxHistory = 500
+
+// lineReader reads lines from stdin. On a terminal it supports line editing,
+// tab completion and command history; otherwise it reads plain lines, which
+// keeps piped input working.
+type lineReader struct {
+	scanner  *bufio.Scanner // used when stdin is not a terminal
+	terminal *term.Terminal // used when stdin is a terminal
+	fd       int
+	history  *commandHistory
+	text     string
+
+	// complete returns the completed line and, if the completion is
+	// ambiguous, the candidates to show
+	complete func(line string) (string, []string)
+	// beforeRead and afterRead are called around every read, e.g. to run
+	// the idle timer of the session while waiting. The read fails if
+	// either returns false.
+	beforeRead func(isCommand bool) bool
+	afterRead  func(isCommand bool) bool
+}
+
+func newLineReader() *lineReader {
+	r := &lineReader{
+		history: &commandHistory{},
+		fd:      int(os.Stdin.Fd()),
+	}
+
+	if term.IsTerminal(r.fd) && term.IsTerminal(int(os.Stdout.Fd())) {
+		r.terminal = term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}, "")
+		r.terminal.History = r.history
+		r.terminal.AutoCompleteCallback = r.autoComplete
+	} else {
+		r.scanner = bufio.NewScanner(os.Stdin)
+	}
+
+	return r
+}
+
+// Scan reads the next line of input, e.g. an answer to a prompt. The line
+// is not added to the command history.
+func (r *lineReader) Scan() bool {
+	line, ok := r.readLine("", false)
+	r.text = line
+	return ok
+}
+
+// Text returns the line read by the last call to Scan
+func (r *lineReader) Text() string {
+	return r.text
+}
+
+// ReadCommand shows the prompt and reads a command line, with tab
+// completion, and records it in the command history
+func (r *lineReader) ReadCommand(prompt string) (string, bool) {
+	line, ok := r.readLine(prompt, true)
+	if ok && r.terminal == nil {
+		r.history.Add(line)
+	}
+	return line, ok
+}
+
+// ReadPassword reads a line without echoing it on a terminal
+func (r *lineReader) ReadPassword() string {
+	if r.terminal == nil {
+		if r.Scan() {
+			return strings.TrimSpace(r.Text())
+		}
+		return ""
+	}
+
+	if !r.startRead(false) {
+		return ""
+	}
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		r.endRead(false)
+		return ""
+	}
+	defer term.Restore(r.fd, state)
+
+	password, err := r.terminal.ReadPassword("")
+	if !r.endRead(false) || err != nil {
+		return ""
+	}
+	return strings.TrimSpace(password)
+}
+
+// startRead calls beforeRead, if set
+func (r *lineReader) startRead(isCommand bool) bool {
+	return r.beforeRead == nil || r.beforeRead(isCommand)
+}
+
+// endRead calls afterRead, if set
+func (r *lineReader) endRead(isCommand bool) bool {
+	return r.afterRead == nil || r.afterRead(isCommand)
+}
+
+// Notify prints a message; on a terminal it is shown above the line that is
+// currently being edited
+func (r *lineReader) Notify(message string) {
+	if r.terminal != nil {
+		fmt.Fprintf(r.terminal, "%s\n", message)
+		return
+	}
+	fmt.Println(message)
+}
+
+// readLine reads one line; isCommand enables completion and history
+func (r *lineReader) readLine(prompt string, isCommand bool) (string, bool) {
+	if !r.startRead(isCommand) {
+		return "", false
+	}
+	line, ok := r.read(prompt, isCommand)
+	if !r.endRead(isCommand) {
+		return "", false
+	}
+	return line, ok
+}
+
+// read reads one line without calling beforeRead and afterRead
+func (r *lineReader) read(prompt string, isCommand bool) (string, bool) {
+	r.history.recording = isCommand
+
+	if r.terminal == nil {
+		fmt.Print(prompt)
+		if !r.scanner.Scan() {
+			return "", false
+		}
+		return r.scanner.Text(), true
+	}
+
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", false
+	}
+	defer term.Restore(r.fd, state)
+
+	r.terminal.SetPrompt(prompt)
+	defer r.terminal.SetPrompt("")
+	if !isCommand {
+		callback := r.terminal.AutoCompleteCallback
+		r.terminal.AutoCompleteCallback = nil
+		defer func() { r.terminal.AutoCompleteCallback = callback }()
+	}
+
+	line, err := r.terminal.ReadLine()
+	if err != nil && err != term.ErrPasteIndicator {
+		return "", false
+	}
+	return line, true
+}
+
+// autoComplete is the terminal callback that completes the line on Tab
+func (r *lineReader) autoComplete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || r.complete == nil || pos != len(line) {
+		return "", 0, false
+	}
+
+	completed, candidates := r.complete(line)
+	if len(candidates) > 1 && completed == line {
+		fmt.Fprintf(r.terminal, "%s\n", strings.Join(candidates, "  "))
+	}
+	return completed, len(completed), true
+}
+
+// commandHistory is the bounded in-memory command history of the session
+type commandHistory struct {
+	entries   []string // oldest first
+	recording bool     // only command lines are recorded
+}
+
+// Add records a command, skipping prompt answers, empty lines and
+// immediate repeats
+func (h *commandHistory) Add(entry string) {
+	entry = strings.TrimSpace(entry)
+	if !h.recording || entry == "" {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == entry {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+}
+
+// Len returns the number of recorded commands
+func (h *commandHistory) Len() int {
+	return len(h.entries)
+}
+
+// At returns a command, 0 being the most recent one
+func (h *commandHistory) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"safe-wallet-go/pkg"
+)
+
+// chooseNewKeyFile asks for an optional keyfile for a new wallet and offers
+// to generate it if the file does not exist yet. It returns "" for none.
+func chooseNewKeyFile(reader *lineReader, path string) (string, error) {
+	if path == "" {
+		fmt.Print("Keyfile to require in addition to the password (leave empty for none): ")
+		if !reader.Scan() {
+			return "", nil
+		}
+		path = strings.TrimSpace(reader.Text())
+		if path == "" {
+			return "", nil
+		}
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	fmt.Printf("Keyfile '%s' does not exist. Generate a new random keyfile? (y/n): ", path)
+	if !reader.Scan() || strings.ToLower(strings.TrimSpace(reader.Text())) != "y" {
+		return "", fmt.Errorf("keyfile '%s' does not exist", path)
+	}
+	if err := pkg.GenerateKeyFile(path); err != nil {
+		return "", err
+	}
+	fmt.Println("Keyfile generated. Keep a backup, the wallet cannot be opened without it.")
+	return path, nil
+}
+
+// askKeyFile returns the keyfile needed to open the wallet, asking for it if
+// a key slot uses one and none was given with -keyfile
+func askKeyFile(reader *lineReader, storage pkg.Storage, filepath string, path string) (string, error) {
+	header, err := pkg.ReadWalletHeaderFrom(storage, filepath)
+	if err != nil {
+		return "", err
+	}
+	if !header.UsesKeyFile() || path != "" {
+		return path, nil
+	}
+
+	if header.RequiresKeyFile() {
+		fmt.Print("This wallet requires a keyfile. Path to keyfile: ")
+	} else {
+		fmt.Print("Path to keyfile (leave empty to unlock with a password only): ")
+	}
+	if !reader.Scan() {
+		return "", pkg.ErrKeyFileRequired
+	}
+	path = strings.TrimSpace(reader.Text())
+	if path == "" && header.RequiresKeyFile() {
+		return "", pkg.ErrKeyFileRequired
+	}
+	return path, nil
+}
+
+// useKeyFile sets the keyfile on the service if there is one
+func useKeyFile(service *pkg.WalletService, path string) error {
+	if path == "" {
+		return nil
+	}
+	return service.SetKeyFile(path)
+}
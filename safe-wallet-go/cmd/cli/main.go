@@ -1,54 +1,157 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"safe-wallet-go/pkg"
 )
 
 func main() {
+	clipboardName := flag.String("clipboard", "auto", "clipboard backend: auto, wayland, xclip, xsel, pbcopy, osc52 or memory")
+	clipboardTimeout := flag.Duration("clipboard-timeout", 30*time.Second, "clear copied secrets from the clipboard after this long (0 keeps them)")
+	keyFilePath := flag.String("keyfile", "", "keyfile required in addition to the password")
+	recoverFlag := flag.Bool("recover", false, "unlock with the recovery key instead of the password")
+	sharesFlag := flag.Bool("shares", false, "unlock with key shares created by the split command")
+	identityPath := flag.String("identity", "", "unlock with an age identity file instead of the password")
+	recipientsFlag := flag.String("recipients", "", "comma separated age recipients to encrypt a new wallet to instead of a password")
+	lockTimeout := flag.Duration("lock-timeout", 5*time.Minute, "lock the wallet after this long without input (0 never locks)")
+	webDAVURL := flag.String("webdav", "", "URL of a WebDAV directory, e.g. on Nextcloud, to keep the wallet in instead of the local disk")
+	webDAVUser := flag.String("webdav-user", "", "WebDAV username, the password is asked for or read from "+webDAVPasswordEnv)
+	webDAVCache := flag.String("webdav-cache", "", "directory for the offline copy of a WebDAV wallet (default: the user cache directory)")
+	s3Endpoint := flag.String("s3-endpoint", "", "URL of an S3-compatible service, e.g. http://localhost:9000 for MinIO, to keep the wallet in a bucket")
+	s3Region := flag.String("s3-region", "us-east-1", "region of the S3 bucket")
+	s3Bucket := flag.String("s3-bucket", "", "S3 bucket to keep the wallet in")
+	s3Prefix := flag.String("s3-prefix", "", "prefix of the wallet objects in the S3 bucket, e.g. team/")
+	s3AccessKey := flag.String("s3-access-key", "", "S3 access key (default: "+s3AccessKeyEnv+"), the secret key is asked for or read from "+s3SecretKeyEnv)
+	flag.Parse()
+
 	filepath := "wallet.dat"
+	reader := newLineReader()
+
+	storage, err := openStorage(reader, storageOptions{
+		webDAVURL:   *webDAVURL,
+		webDAVUser:  *webDAVUser,
+		webDAVCache: *webDAVCache,
+		s3Endpoint:  *s3Endpoint,
+		s3Region:    *s3Region,
+		s3Bucket:    *s3Bucket,
+		s3Prefix:    *s3Prefix,
+		s3AccessKey: *s3AccessKey,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Non-interactive scripting commands, e.g. "get Work/AWS/Console Password"
+	if flag.NArg() > 0 {
+		os.Exit(runScriptCommand(storage, filepath, *keyFilePath, *identityPath, reader, flag.Args()))
+	}
 
-	// Step 1: Handle password
-	var password string
-	if !pkg.WalletExists(filepath) {
+	clipboard, err := pkg.NewClipboard(*clipboardName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	guard := pkg.NewClipboardGuard(clipboard, *clipboardTimeout)
+	defer guard.Clear()
+
+	// Step 1: Handle password and keyfile, the recovery key, key shares or
+	// an identity file
+	var password, recoveryKey string
+	var shares []string
+	keyFile := *keyFilePath
+	creating := !pkg.WalletExistsIn(storage, filepath)
+	if creating && *recipientsFlag != "" {
+		fmt.Println("=== Safe Wallet - New Wallet ===")
+		fmt.Println("The wallet is encrypted to the given recipients and has no password.")
+		keyFile = ""
+	} else if creating {
 		fmt.Println("=== Safe Wallet - New Wallet ===")
 		fmt.Print("Create a password for your new wallet: ")
-		password = readPassword()
+		password = reader.ReadPassword()
 		if password == "" {
 			log.Fatal("Password cannot be empty")
 		}
 		fmt.Print("Confirm password: ")
-		confirmPassword := readPassword()
+		confirmPassword := reader.ReadPassword()
 		if password != confirmPassword {
 			log.Fatal("Passwords do not match")
 		}
+		if keyFile, err = chooseNewKeyFile(reader, keyFile); err != nil {
+			log.Fatal(err)
+		}
+	} else if *identityPath != "" {
+		fmt.Println("=== Safe Wallet - Identity File ===")
+		keyFile = ""
+	} else if *sharesFlag {
+		fmt.Println("=== Safe Wallet - Key Shares ===")
+		if shares = readShares(reader); shares == nil {
+			log.Fatal("No shares entered")
+		}
+		keyFile = ""
+	} else if *recoverFlag {
+		fmt.Println("=== Safe Wallet - Recovery ===")
+		fmt.Print("Enter your recovery key: ")
+		recoveryKey = reader.ReadPassword()
+		keyFile = ""
 	} else {
 		fmt.Println("=== Safe Wallet ===")
+		if keyFile, err = askKeyFile(reader, storage, filepath, keyFile); err != nil {
+			log.Fatal("Failed to load wallet: ", err)
+		}
 		fmt.Print("Enter your wallet password: ")
-		password = readPassword()
+		password = reader.ReadPassword()
 	}
 
 	// Initialize service
-	service := pkg.NewWalletService(filepath, password)
+	service := pkg.NewWalletServiceWithStorage(storage, filepath, password)
+	defer service.Close()
+	if err := useKeyFile(service, keyFile); err != nil {
+		log.Fatal(err)
+	}
 
 	// Load or create wallet
-	if !pkg.WalletExists(filepath) {
+	if creating && *recipientsFlag != "" {
+		if err := service.CreateNewForRecipients(splitRecipients(*recipientsFlag)); err != nil {
+			log.Fatal("Failed to create wallet: ", err)
+		}
+		fmt.Println("Wallet created successfully!")
+		fmt.Println("Any recipient's identity file unlocks it with -identity.")
+	} else if creating {
 		fmt.Println("Creating new wallet...")
 		if err := service.CreateNew(); err != nil {
 			log.Fatal("Failed to create wallet:", err)
 		}
 		fmt.Println("Wallet created successfully!")
+		fmt.Println("\nThis is your recovery key. It unlocks the wallet if you forget the password.")
+		showRecoverySheet(filepath, service.TakeRecoveryKey(), reader)
+	} else if *identityPath != "" {
+		if err := service.UnlockWithIdentityFile(*identityPath); err != nil {
+			log.Fatal("Failed to load wallet: ", err)
+		}
+		fmt.Println("Wallet unlocked with the identity file.")
+	} else if *sharesFlag {
+		if err := service.UnlockWithShares(shares); err != nil {
+			log.Fatal("Failed to load wallet: ", err)
+		}
+		fmt.Println("Wallet unlocked with key shares.")
+	} else if *recoverFlag {
+		if err := service.UnlockWithRecoveryKey(recoveryKey); err != nil {
+			log.Fatal("Failed to load wallet: ", err)
+		}
+		fmt.Println("Wallet unlocked with the recovery key.")
+		fmt.Println("Add a new password with 'add-slot' and replace the recovery key with 'recovery-kit'.")
 	} else {
 		if err := service.Load(); err != nil {
 			log.Fatal("Failed to load wallet: ", err)
 		}
 		fmt.Println("Wallet loaded successfully!")
 	}
+	printOfflineNotice(storage)
 
 	// Start at root (empty path)
 	currentPath := pkg.Path{GroupIDs: []string{}}
@@ -57,17 +160,59 @@ func main() {
 	fmt.Println("\nWelcome to Safe Wallet!")
 	displayMenu()
 
+	sess := newSession(service, guard, reader, *lockTimeout, keyFile)
+	switch {
+	case *identityPath != "":
+		sess.unlockType = pkg.SlotTypeRecipient
+		sess.identityFile = *identityPath
+	case *recipientsFlag != "" && creating:
+		sess.unlockType = pkg.SlotTypeRecipient
+	case *sharesFlag:
+		sess.unlockType = pkg.SlotTypeShamir
+	case *recoverFlag:
+		sess.unlockType = pkg.SlotTypeRecovery
+	}
+
+	// Tab completion of commands and group/entry names
+	reader.complete = func(line string) (string, []string) {
+		completed, candidates := line, []string(nil)
+		sess.WithService(func(service *pkg.WalletService) {
+			completed, candidates = completeLine(service, currentPath, line)
+		})
+		return completed, candidates
+	}
+
+	// unlock requires the master password again after the session was
+	// locked, at the command prompt or at a prompt of the previous command
+	unlock := func() bool {
+		if !sess.IsLocked() {
+			return true
+		}
+		if !sess.Unlock() {
+			fmt.Println("Goodbye!")
+			return false
+		}
+		currentPath = existingPath(service, currentPath)
+		return true
+	}
+
 	// Main CLI loop
-	scanner := bufio.NewScanner(os.Stdin)
 	for {
+		if !unlock() {
+			return
+		}
 		displayCurrentLocation(service, currentPath)
 
-		fmt.Print("\nEnter command (type 'help' for menu): ")
-		if !scanner.Scan() {
+		fmt.Println()
+		line, ok := reader.ReadCommand("Enter command (type 'help' for menu): ")
+		if !ok {
 			break
 		}
+		if !unlock() {
+			return
+		}
 
-		command := strings.TrimSpace(scanner.Text())
+		command, arg := splitCommand(line)
 		if command == "" {
 			continue
 		}
@@ -76,34 +221,88 @@ func main() {
 		case "help", "h", "?":
 			displayMenu()
 		case "1", "cg", "create-group":
-			handleCreateGroup(service, currentPath, scanner)
+			handleCreateGroup(service, currentPath, reader)
 		case "2", "ce", "create-entry":
-			handleCreateEntry(service, currentPath, scanner)
+			handleCreateEntry(service, currentPath, reader)
 		case "3", "l", "list":
 			handleList(service, currentPath)
+		case "ls":
+			handleListPath(service, currentPath, arg)
 		case "4", "s", "show":
-			handleShowEntry(service, currentPath, scanner)
+			if arg != "" {
+				handleShowEntryByPath(service, currentPath, arg)
+			} else {
+				handleShowEntry(service, currentPath, reader)
+			}
 		case "5", "ug", "update-group":
-			handleUpdateGroup(service, currentPath, scanner)
+			handleUpdateGroup(service, currentPath, reader)
 		case "6", "ue", "update-entry":
-			handleUpdateEntry(service, currentPath, scanner)
+			handleUpdateEntry(service, currentPath, reader)
 		case "7", "dg", "delete-group":
-			handleDeleteGroup(service, currentPath, scanner)
+			handleDeleteGroup(service, currentPath, reader)
 		case "8", "de", "delete-entry":
-			handleDeleteEntry(service, currentPath, scanner)
+			handleDeleteEntry(service, currentPath, reader)
 		case "9", "f", "forward":
-			currentPath = handleTraverseForward(service, currentPath, scanner)
-		case "10", "b", "back":
+			currentPath = handleTraverseForward(service, currentPath, reader)
+		case "10", "b", "back", "..":
 			currentPath = handleTraverseBackward(service, currentPath)
 		case "11", "se", "search":
-			handleSearchEntry(service, scanner)
+			handleSearchEntry(service, reader)
 		case "12", "t", "tree":
 			handleDisplayTree(service, currentPath)
 		case "13", "n", "navigate":
-			currentPath = handleNavigateIntoGroup(service, currentPath, scanner)
+			currentPath = handleNavigateIntoGroup(service, currentPath, reader)
 		case "14", "r", "root":
 			currentPath = pkg.Path{GroupIDs: []string{}}
 			fmt.Println("Returned to root")
+		case "cd":
+			currentPath = handleChangeGroup(service, currentPath, arg)
+		case "pwd":
+			handlePrintWorkingGroup(service, currentPath)
+		case "history":
+			handleHistory(reader)
+		case "copy", "cp":
+			handleCopy(service, currentPath, guard, arg)
+		case "passwd":
+			handleChangePassword(service, reader)
+		case "slots":
+			handleListSlots(service)
+		case "add-slot":
+			handleAddSlot(service, reader)
+		case "revoke-slot":
+			handleRevokeSlot(service, reader, arg)
+		case "rotate-key":
+			handleRotateKey(service, reader)
+		case "recovery-kit":
+			handleRecoveryKit(service, filepath, reader)
+		case "split":
+			handleSplitKey(service, reader)
+		case "add-recipient":
+			handleAddRecipient(service, reader, arg)
+		case "import":
+			handleImport(service, currentPath, reader, arg)
+		case "import-browser":
+			handleImportBrowser(service, currentPath, reader, arg)
+		case "export":
+			handleExport(service, currentPath, reader, arg)
+		case "share-group":
+			handleShareGroup(service, currentPath, reader, arg)
+		case "import-bundle":
+			handleImportBundle(service, currentPath, reader, arg)
+		case "storage":
+			handleStorage(service, reader, arg)
+		case "backups":
+			handleBackups(service, storage, reader, arg)
+			currentPath = existingPath(service, currentPath)
+		case "lock":
+			if sess.Lock() {
+				fmt.Println("Wallet locked. Changes that were not saved are lost.")
+				if !sess.WaitForUser() || !sess.Unlock() {
+					fmt.Println("Goodbye!")
+					return
+				}
+				currentPath = existingPath(service, currentPath)
+			}
 		case "15", "save":
 			if err := service.Save(); err != nil {
 				fmt.Printf("Error saving wallet: %v\n", err)
@@ -123,12 +322,12 @@ func main() {
 	}
 }
 
-func readPassword() string {
-	scanner := bufio.NewScanner(os.Stdin)
-	if scanner.Scan() {
-		return strings.TrimSpace(scanner.Text())
-	}
-	return ""
+// splitCommand splits an input line into the command and the rest of the
+// line, which is kept intact so name paths may contain spaces
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	command, arg, _ := strings.Cut(line, " ")
+	return command, strings.TrimSpace(arg)
 }
 
 func displayCurrentLocation(service *pkg.WalletService, path pkg.Path) {
@@ -171,9 +370,34 @@ func displayMenu() {
 	fmt.Println("  14 (r)  - Return to Root")
 	fmt.Println("  15      - Save Wallet")
 	fmt.Println("  16 (q)  - Quit")
+	fmt.Println("\nShell commands (paths like Work/AWS/Console, /Personal, ..):")
+	fmt.Println("  cd [path]   - Change to a group (root if no path)")
+	fmt.Println("  ls [path]   - List a group, or an entry with masked values")
+	fmt.Println("  pwd         - Print the current group path")
+	fmt.Println("  ..          - Go up one level")
+	fmt.Println("  show <path> - Show an entry")
+	fmt.Println("  history     - Show the commands entered this session")
+	fmt.Println("  copy <entry> [field] - Copy a field (default: password) to the clipboard")
+	fmt.Println("  lock        - Lock the wallet until the password is entered again")
+	fmt.Println("  passwd      - Change the password of the slot you unlocked with")
+	fmt.Println("  slots       - List the key slots that can unlock the wallet")
+	fmt.Println("  add-slot    - Add a key slot with another password")
+	fmt.Println("  revoke-slot [id] - Revoke a key slot")
+	fmt.Println("  rotate-key  - Encrypt the wallet again with a new data key")
+	fmt.Println("  recovery-kit - Generate a new recovery key and print the recovery sheet")
+	fmt.Println("  split       - Split a new unlock key into N shares, K of which unlock the wallet")
+	fmt.Println("  add-recipient [age1...] - Add an age recipient whose identity file unlocks the wallet")
+	fmt.Println("  import [file] - Import a KeePass, Bitwarden, 1Password or LastPass file into the current group")
+	fmt.Println("  import-browser [file.csv] - Import Chrome, Firefox or Safari logins into the current group")
+	fmt.Println("  export [file] - Export the wallet or the current group (encrypted, JSON, CSV or KeePass XML)")
+	fmt.Println("  share-group [file] - Share the current group as a bundle with its own password or recipients")
+	fmt.Println("  import-bundle [file] - Import a shared bundle into the current group")
+	fmt.Println("  storage [file|sync] - Store the wallet as one file or as a git-friendly directory with a file per entry")
+	fmt.Println("  backups [enable] - List and restore earlier versions of a wallet in a versioned S3 bucket")
+	fmt.Println("  Tab completes commands and names, Up/Down recall earlier commands.")
 }
 
-func handleCreateGroup(service *pkg.WalletService, path pkg.Path, scanner *bufio.Scanner) {
+func handleCreateGroup(service *pkg.WalletService, path pkg.Path, scanner *lineReader) {
 	fmt.Print("Enter group name: ")
 	if !scanner.Scan() {
 		return
@@ -201,7 +425,7 @@ func handleCreateGroup(service *pkg.WalletService, path pkg.Path, scanner *bufio
 	}
 }
 
-func handleCreateEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio.Scanner) {
+func handleCreateEntry(service *pkg.WalletService, path pkg.Path, scanner *lineReader) {
 	if len(path.GroupIDs) == 0 {
 		fmt.Println("Cannot create entry at root. Please navigate to a group first.")
 		return
@@ -359,13 +583,7 @@ func handleList(service *pkg.WalletService, path pkg.Path) {
 		fmt.Println("\nEntries:")
 		for i, entry := range entries {
 			fmt.Printf("  %d. %s (ID: %s)\n", i+1, entry.Title, entry.ID)
-			for _, field := range entry.Fields {
-				value := field.Value
-				if field.Type == pkg.FieldTypePassword || field.Type == pkg.FieldTypePIN {
-					value = "******"
-				}
-				fmt.Printf("     %s: %s\n", field.Name, value)
-			}
+			printMaskedFields(entry, "     ")
 		}
 	} else {
 		if len(path.GroupIDs) > 0 {
@@ -374,7 +592,7 @@ func handleList(service *pkg.WalletService, path pkg.Path) {
 	}
 }
 
-func handleShowEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio.Scanner) {
+func handleShowEntry(service *pkg.WalletService, path pkg.Path, scanner *lineReader) {
 	if len(path.GroupIDs) == 0 {
 		fmt.Println("No entries at root level.")
 		return
@@ -412,17 +630,68 @@ func handleShowEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio.S
 		return
 	}
 
-	entry := group.Entries[entryNum-1]
+	displayEntryDetails(service, group.Entries[entryNum-1])
+}
+
+func handleShowEntryByPath(service *pkg.WalletService, currentPath pkg.Path, namePath string) {
+	path, err := service.ResolvePath(currentPath, namePath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if path.EntryID == "" {
+		fmt.Printf("'%s' is a group, not an entry\n", namePath)
+		return
+	}
+
+	entry, err := pkg.FindEntryByPath(service.GetWallet(), path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	displayEntryDetails(service, *entry)
+}
+
+// printMaskedFields prints the fields of the entry with sensitive values
+// masked, they are only revealed by show and copy
+func printMaskedFields(entry pkg.Entry, indent string) {
+	for _, field := range entry.Fields {
+		value := field.Value
+		if field.Type.IsSensitive() {
+			value = "******"
+		}
+		fmt.Printf("%s%s: %s\n", indent, field.Name, value)
+	}
+}
 
+func displayEntryDetails(service *pkg.WalletService, entry pkg.Entry) {
 	fmt.Printf("\n--- Entry Details: %s ---\n", entry.Title)
 	fmt.Printf("  ID: %s\n", entry.ID)
 	for _, field := range entry.Fields {
-		fmt.Printf("  %s: %s\n", field.Name, field.Value)
+		value, err := service.FieldValue(field)
+		if err != nil {
+			value = fmt.Sprintf("<%v>", err)
+		}
+		fmt.Printf("  %s: %s\n", field.Name, value)
 	}
 	fmt.Println("---------------------------")
 }
 
-func handleUpdateGroup(service *pkg.WalletService, path pkg.Path, scanner *bufio.Scanner) {
+func handleChangeGroup(service *pkg.WalletService, currentPath pkg.Path, namePath string) pkg.Path {
+	if namePath == "" {
+		return pkg.Path{GroupIDs: []string{}}
+	}
+
+	path, err := service.ResolveGroupPath(currentPath, namePath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return currentPath
+	}
+
+	return path
+}
+
+func handleUpdateGroup(service *pkg.WalletService, path pkg.Path, scanner *lineReader) {
 	if len(path.GroupIDs) == 0 {
 		fmt.Println("Cannot update root groups directly.")
 		return
@@ -462,7 +731,7 @@ func handleUpdateGroup(service *pkg.WalletService, path pkg.Path, scanner *bufio
 	}
 }
 
-func handleUpdateEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio.Scanner) {
+func handleUpdateEntry(service *pkg.WalletService, path pkg.Path, scanner *lineReader) {
 	if len(path.GroupIDs) == 0 {
 		fmt.Println("No entries at root level.")
 		return
@@ -500,7 +769,10 @@ func handleUpdateEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio
 		return
 	}
 
-	entry := &group.Entries[entryNum-1]
+	// The entry in the wallet is only changed by UpdateEntry, which checks
+	// the edited copy first
+	entry := group.Entries[entryNum-1]
+	updated := pkg.Entry{ID: entry.ID, Title: entry.Title}
 	entryPath := pkg.Path{
 		GroupIDs: path.GroupIDs,
 		EntryID:  entry.ID,
@@ -512,7 +784,7 @@ func handleUpdateEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio
 	fmt.Print("Enter new title (press Enter to keep current): ")
 	if scanner.Scan() {
 		if newTitle := strings.TrimSpace(scanner.Text()); newTitle != "" {
-			entry.Title = newTitle
+			updated.Title = newTitle
 		}
 	}
 
@@ -521,7 +793,11 @@ func handleUpdateEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio
 	var updatedFields []pkg.EntryField
 	for _, field := range entry.Fields {
 		fmt.Printf("\nField: '%s' (Type: %s)\n", field.Name, field.Type)
-		fmt.Printf("  Current Value: '%s'\n", field.Value)
+		value, err := service.FieldValue(field)
+		if err != nil {
+			value = fmt.Sprintf("<%v>", err)
+		}
+		fmt.Printf("  Current Value: '%s'\n", value)
 		fmt.Print("Action [(K)eep, (E)dit Field, (D)elete Field]: ")
 		if !scanner.Scan() {
 			updatedFields = append(updatedFields, field)
@@ -579,7 +855,7 @@ func handleUpdateEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio
 			updatedFields = append(updatedFields, field)
 		}
 	}
-	entry.Fields = updatedFields
+	updated.Fields = updatedFields
 
 	// Add new fields
 	fmt.Println("\n--- Add New Fields ---")
@@ -619,10 +895,10 @@ func handleUpdateEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio
 			}
 		}
 
-		entry.Fields = append(entry.Fields, pkg.EntryField{Name: fieldName, Value: fieldValue, Type: fieldType})
+		updated.Fields = append(updated.Fields, pkg.EntryField{Name: fieldName, Value: fieldValue, Type: fieldType})
 	}
 
-	if err := service.UpdateEntry(entryPath, *entry); err != nil {
+	if err := service.UpdateEntry(entryPath, updated); err != nil {
 		fmt.Printf("Error updating entry: %v\n", err)
 		return
 	}
@@ -633,7 +909,7 @@ func handleUpdateEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio
 	}
 }
 
-func handleDeleteGroup(service *pkg.WalletService, path pkg.Path, scanner *bufio.Scanner) {
+func handleDeleteGroup(service *pkg.WalletService, path pkg.Path, scanner *lineReader) {
 	// List groups at current location
 	var groups []pkg.Group
 	var parentPath pkg.Path
@@ -704,7 +980,7 @@ func handleDeleteGroup(service *pkg.WalletService, path pkg.Path, scanner *bufio
 	}
 }
 
-func handleDeleteEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio.Scanner) {
+func handleDeleteEntry(service *pkg.WalletService, path pkg.Path, scanner *lineReader) {
 	if len(path.GroupIDs) == 0 {
 		fmt.Println("No entries at root level.")
 		return
@@ -774,7 +1050,7 @@ func handleDeleteEntry(service *pkg.WalletService, path pkg.Path, scanner *bufio
 	}
 }
 
-func handleTraverseForward(service *pkg.WalletService, currentPath pkg.Path, scanner *bufio.Scanner) pkg.Path {
+func handleTraverseForward(service *pkg.WalletService, currentPath pkg.Path, scanner *lineReader) pkg.Path {
 	// Get groups and entries one level down from current location
 	var groups []pkg.Group
 	if len(currentPath.GroupIDs) == 0 {
@@ -849,7 +1125,7 @@ func handleTraverseBackward(service *pkg.WalletService, currentPath pkg.Path) pk
 	return parentPath
 }
 
-func handleSearchEntry(service *pkg.WalletService, scanner *bufio.Scanner) {
+func handleSearchEntry(service *pkg.WalletService, scanner *lineReader) {
 	fmt.Print("Enter search term: ")
 	if !scanner.Scan() {
 		return
@@ -860,24 +1136,7 @@ func handleSearchEntry(service *pkg.WalletService, scanner *bufio.Scanner) {
 		return
 	}
 
-	var foundEntries []pkg.PathInfo
-	service.TraverseForward(func(info pkg.PathInfo) bool {
-		if info.IsEntry && info.Entry != nil {
-			// Search in title
-			if strings.Contains(strings.ToLower(info.Entry.Title), searchTerm) {
-				foundEntries = append(foundEntries, info)
-				return true
-			}
-			// Search in fields
-			for _, field := range info.Entry.Fields {
-				if strings.Contains(strings.ToLower(field.Name), searchTerm) || strings.Contains(strings.ToLower(field.Value), searchTerm) {
-					foundEntries = append(foundEntries, info)
-					return true // Found a match, no need to check other fields for this entry
-				}
-			}
-		}
-		return true
-	})
+	foundEntries := service.SearchEntries(searchTerm)
 
 	if len(foundEntries) == 0 {
 		fmt.Printf("No entries found matching '%s'\n", searchTerm)
@@ -889,12 +1148,14 @@ func handleSearchEntry(service *pkg.WalletService, scanner *bufio.Scanner) {
 		fmt.Printf("  %d. %s (ID: %s)\n", i+1, info.Entry.Title, info.Entry.ID)
 		for _, field := range info.Entry.Fields {
 			value := field.Value
-			if field.Type == pkg.FieldTypePassword || field.Type == pkg.FieldTypePIN {
+			if field.Type.IsSensitive() {
 				value = "******"
 			}
 			fmt.Printf("     %s: %s\n", field.Name, value)
 		}
-		fmt.Printf("     Path: %v\n", info.Path.GroupIDs)
+		if namePath, err := service.FormatPath(info.Path); err == nil {
+			fmt.Printf("     Path: %s\n", namePath)
+		}
 	}
 }
 
@@ -1031,7 +1292,7 @@ func handleDisplayTree(service *pkg.WalletService, currentPath pkg.Path) {
 	fmt.Println()
 }
 
-func handleNavigateIntoGroup(service *pkg.WalletService, currentPath pkg.Path, scanner *bufio.Scanner) pkg.Path {
+func handleNavigateIntoGroup(service *pkg.WalletService, currentPath pkg.Path, scanner *lineReader) pkg.Path {
 	var groups []pkg.Group
 	if len(currentPath.GroupIDs) == 0 {
 		groups = service.GetWallet().Groups
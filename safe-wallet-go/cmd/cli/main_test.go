@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"safe-wallet-go/pkg"
+)
+
+func TestHandleUpdateEntryKeepsEntryWhenRejected(t *testing.T) {
+	service := newTestService(t)
+	path, err := service.ResolvePath(pkg.Path{}, "/Email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := &pkg.Entry{Title: "Home Mail", Fields: []pkg.EntryField{
+		{Name: "username", Value: "carol", Type: pkg.FieldTypeGeneral},
+	}}
+	if err := service.AddEntry(path, home); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rename it to the title of the other entry, edit its field and add one
+	input := "2\nWork Mail\ne\n\nbob\n\nnote\nhello\ng\n\n"
+	reader := &lineReader{scanner: bufio.NewScanner(strings.NewReader(input)), history: &commandHistory{}}
+	output := captureStdout(t, func() { handleUpdateEntry(service, path, reader) })
+	if !strings.Contains(output, "entry title already exists") {
+		t.Fatalf("update was not rejected:\n%s", output)
+	}
+
+	entry, err := pkg.FindEntryByPath(service.GetWallet(), pkg.Path{GroupIDs: path.GroupIDs, EntryID: home.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Title != "Home Mail" || len(entry.Fields) != 1 || entry.Fields[0].Value != "carol" {
+		t.Errorf("rejected update changed the entry: %+v", entry)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"safe-wallet-go/pkg"
+)
+
+// splitRecipients returns the recipients of a comma or space separated list
+func splitRecipients(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+func handleAddRecipient(service *pkg.WalletService, scanner *lineReader, recipient string) {
+	if recipient == "" {
+		fmt.Print("Recipient public key (age1..., leave empty to generate a new identity file): ")
+		if !scanner.Scan() {
+			return
+		}
+		recipient = strings.TrimSpace(scanner.Text())
+	}
+
+	if recipient == "" {
+		fmt.Print("Path for the new identity file: ")
+		if !scanner.Scan() {
+			return
+		}
+		path := strings.TrimSpace(scanner.Text())
+		if path == "" {
+			fmt.Println("Cancelled")
+			return
+		}
+		generated, err := pkg.GenerateIdentityFile(path)
+		if err != nil {
+			fmt.Printf("Error generating identity file: %v\n", err)
+			return
+		}
+		fmt.Printf("Identity file written to %s. Hand it to the recipient over a secure channel.\n", path)
+		recipient = generated
+	}
+
+	fmt.Print("Label for the new slot (leave empty to use the recipient): ")
+	if !scanner.Scan() {
+		return
+	}
+	label := strings.TrimSpace(scanner.Text())
+
+	slot, err := service.AddRecipientSlot(label, recipient)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Recipient '%s' added (%s)\n", slot.Label, slot.ID)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"safe-wallet-go/pkg"
+)
+
+// showRecoverySheet prints the recovery sheet and offers to save it to a file
+func showRecoverySheet(filepath string, recoveryKey string, scanner *lineReader) {
+	sheet := pkg.RecoverySheet(filepath, recoveryKey, time.Now())
+	fmt.Println()
+	fmt.Println(sheet)
+
+	fmt.Print("Save the recovery sheet to a file for printing? Enter a path (leave empty to skip): ")
+	if !scanner.Scan() {
+		return
+	}
+	path := strings.TrimSpace(scanner.Text())
+	if path == "" {
+		return
+	}
+	if err := os.WriteFile(path, []byte(sheet), 0600); err != nil {
+		fmt.Printf("Error saving recovery sheet: %v\n", err)
+		return
+	}
+	fmt.Printf("Recovery sheet saved to %s. Print it and delete the file.\n", path)
+}
+
+func handleRecoveryKit(service *pkg.WalletService, filepath string, scanner *lineReader) {
+	if service.HasRecoveryKey() {
+		fmt.Print("A new recovery kit revokes the current recovery key. Continue? (y/n): ")
+		if !scanner.Scan() || strings.ToLower(strings.TrimSpace(scanner.Text())) != "y" {
+			fmt.Println("Cancelled")
+			return
+		}
+	}
+
+	recoveryKey, err := service.RotateRecoveryKey()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	showRecoverySheet(filepath, recoveryKey, scanner)
+}
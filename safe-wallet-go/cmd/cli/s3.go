@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"safe-wallet-go/pkg"
+)
+
+// The S3 keys are read from the variables the AWS tools use
+const (
+	s3AccessKeyEnv = "AWS_ACCESS_KEY_ID"
+	s3SecretKeyEnv = "AWS_SECRET_ACCESS_KEY"
+)
+
+// openS3Storage returns the storage for the S3 bucket
+func openS3Storage(reader *lineReader, options storageOptions) (pkg.Storage, error) {
+	accessKey := options.s3AccessKey
+	if accessKey == "" {
+		accessKey = os.Getenv(s3AccessKeyEnv)
+	}
+	secretKey, ok := os.LookupEnv(s3SecretKeyEnv)
+	if !ok && accessKey != "" {
+		fmt.Fprintf(os.Stderr, "S3 secret key for %s: ", accessKey)
+		secretKey = reader.ReadPassword()
+	}
+	return pkg.NewS3Storage(pkg.S3Config{
+		Endpoint:  options.s3Endpoint,
+		Region:    options.s3Region,
+		Bucket:    options.s3Bucket,
+		Prefix:    options.s3Prefix,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+}
+
+// handleBackups lists the earlier versions of the wallet kept by the
+// storage and restores one of them, or enables versioning on an S3 bucket
+func handleBackups(service *pkg.WalletService, storage pkg.Storage, scanner *lineReader, arg string) {
+	s3, isS3 := storage.(*pkg.S3Storage)
+	if strings.EqualFold(arg, "enable") {
+		if !isS3 {
+			fmt.Println("Error: versioning can only be enabled on an S3 bucket")
+			return
+		}
+		if err := s3.EnableVersioning(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Println("Versioning is enabled, every save now keeps the previous version as a backup.")
+		return
+	}
+
+	backups, err := service.Backups()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups yet.")
+		if isS3 {
+			fmt.Println("If versioning is disabled on the bucket, enable it with 'backups enable'.")
+		}
+		return
+	}
+
+	fmt.Println("Backups, newest first:")
+	for i, backup := range backups {
+		fmt.Printf("%d. %s  %d bytes\n", i+1, backup.ModTime.Local().Format("2006-01-02 15:04:05"), backup.Size)
+	}
+	fmt.Print("Restore backup number (leave empty to keep the current wallet): ")
+	if !scanner.Scan() {
+		return
+	}
+	choice := strings.TrimSpace(scanner.Text())
+	if choice == "" {
+		return
+	}
+	number, err := strconv.Atoi(choice)
+	if err != nil || number < 1 || number > len(backups) {
+		fmt.Println("Invalid backup number")
+		return
+	}
+
+	fmt.Print("Replace all groups and entries with the backup? Unsaved changes are lost. (yes/no): ")
+	if !scanner.Scan() {
+		return
+	}
+	if strings.TrimSpace(strings.ToLower(scanner.Text())) != "yes" {
+		fmt.Println("Restore cancelled")
+		return
+	}
+	if err := service.RestoreBackup(backups[number-1].ID); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Println("The backup was restored and saved. The replaced version is kept as a backup.")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"safe-wallet-go/pkg"
+)
+
+// runScriptCommand runs a single non-interactive command and returns the
+// process exit code. Results go to stdout, prompts and errors to stderr.
+// With an identity file no password is asked for.
+func runScriptCommand(storage pkg.Storage, filepath string, keyFile string, identityFile string, reader *lineReader, args []string) int {
+	if len(args) == 0 {
+		printScriptUsage()
+		return 2
+	}
+
+	if !pkg.WalletExistsIn(storage, filepath) {
+		fmt.Fprintln(os.Stderr, "Error: wallet file does not exist")
+		return 1
+	}
+
+	service, err := openScriptWallet(storage, filepath, keyFile, identityFile, reader)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer service.Close()
+
+	root := pkg.Path{GroupIDs: []string{}}
+
+	switch args[0] {
+	case "show":
+		if len(args) != 2 {
+			printScriptUsage()
+			return 2
+		}
+		return scriptShow(service, root, args[1])
+	case "get":
+		if len(args) != 3 {
+			printScriptUsage()
+			return 2
+		}
+		return scriptGet(service, root, args[1], args[2])
+	case "ls":
+		namePath := "/"
+		if len(args) > 1 {
+			namePath = args[1]
+		}
+		return scriptList(service, root, namePath)
+	default:
+		printScriptUsage()
+		return 2
+	}
+}
+
+// openScriptWallet unlocks the wallet with the identity file, or with the
+// password read from the reader and the keyfile
+func openScriptWallet(storage pkg.Storage, filepath string, keyFile string, identityFile string, reader *lineReader) (*pkg.WalletService, error) {
+	if identityFile != "" {
+		service := pkg.NewWalletServiceWithStorage(storage, filepath, "")
+		if err := service.UnlockWithIdentityFile(identityFile); err != nil {
+			service.Close()
+			return nil, fmt.Errorf("failed to load wallet: %v", err)
+		}
+		return service, nil
+	}
+
+	header, err := pkg.ReadWalletHeaderFrom(storage, filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load wallet: %v", err)
+	}
+	if header.RequiresKeyFile() && keyFile == "" {
+		return nil, errors.New("wallet requires a keyfile, use -keyfile")
+	}
+
+	fmt.Fprint(os.Stderr, "Enter your wallet password: ")
+	service := pkg.NewWalletServiceWithStorage(storage, filepath, reader.ReadPassword())
+	if err := useKeyFile(service, keyFile); err != nil {
+		service.Close()
+		return nil, err
+	}
+	if err := service.Load(); err != nil {
+		service.Close()
+		return nil, fmt.Errorf("failed to load wallet: %v", err)
+	}
+	return service, nil
+}
+
+func printScriptUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  cli                      - start the interactive wallet")
+	fmt.Fprintln(os.Stderr, "  cli show <path>          - print all fields of an entry")
+	fmt.Fprintln(os.Stderr, "  cli get <path> <field>   - print a single field value")
+	fmt.Fprintln(os.Stderr, "  cli ls [path]            - list groups and entries of a group")
+	fmt.Fprintln(os.Stderr, "Paths are slash-separated names, e.g. Work/AWS/Console (escape '/' in names as '\\/').")
+	fmt.Fprintln(os.Stderr, "With -identity <file> the wallet is unlocked with an age identity instead of the password.")
+}
+
+// scriptResolveEntry resolves a name path that must point to an entry
+func scriptResolveEntry(service *pkg.WalletService, base pkg.Path, namePath string) (*pkg.Entry, bool) {
+	path, err := service.ResolvePath(base, namePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, false
+	}
+	if path.EntryID == "" {
+		fmt.Fprintf(os.Stderr, "Error: '%s' is a group, not an entry\n", namePath)
+		return nil, false
+	}
+
+	entry, err := pkg.FindEntryByPath(service.GetWallet(), path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, false
+	}
+	return entry, true
+}
+
+func scriptShow(service *pkg.WalletService, base pkg.Path, namePath string) int {
+	entry, ok := scriptResolveEntry(service, base, namePath)
+	if !ok {
+		return 1
+	}
+
+	fmt.Printf("Title: %s\n", entry.Title)
+	for _, field := range entry.Fields {
+		value, err := service.FieldValue(field)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%s: %s\n", field.Name, value)
+	}
+	return 0
+}
+
+func scriptGet(service *pkg.WalletService, base pkg.Path, namePath string, fieldName string) int {
+	entry, ok := scriptResolveEntry(service, base, namePath)
+	if !ok {
+		return 1
+	}
+
+	for _, field := range entry.Fields {
+		if field.Name == fieldName {
+			value, err := service.FieldValue(field)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			fmt.Println(value)
+			return 0
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: entry '%s' has no field '%s'\n", entry.Title, fieldName)
+	return 1
+}
+
+func scriptList(service *pkg.WalletService, base pkg.Path, namePath string) int {
+	path, err := service.ResolveGroupPath(base, namePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var groups []pkg.Group
+	var entries []pkg.Entry
+	if len(path.GroupIDs) == 0 {
+		groups = service.GetWallet().Groups
+	} else {
+		group, err := pkg.FindGroupByPath(service.GetWallet(), path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		groups = group.Groups
+		entries = group.Entries
+	}
+
+	for _, group := range groups {
+		fmt.Println(pkg.EscapeName(group.Name) + "/")
+	}
+	for _, entry := range entries {
+		fmt.Println(pkg.EscapeName(entry.Title))
+	}
+	return 0
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"safe-wallet-go/pkg"
+)
+
+// maxUnlockAttempts is the number of wrong passwords accepted before exiting
+const maxUnlockAttempts = 3
+
+// session locks the wallet after the CLI has been idle at a prompt for
+// longer than the timeout, and unlocks it again with the master password
+type session struct {
+	mu      sync.Mutex
+	service *pkg.WalletService
+	guard   *pkg.ClipboardGuard
+	reader  *lineReader
+	timeout time.Duration
+	timer   *time.Timer
+	// keyFile is read again on every unlock, "" if the wallet has none
+	keyFile string
+	// unlockType is the kind of secret asked for on unlock, a password by default
+	unlockType pkg.SlotType
+	// identityFile is read again on unlock with a recipient slot, it is asked
+	// for if it is "" or cannot be read
+	identityFile string
+	// unlocking is set while Unlock reads the secret, which is the only
+	// input read while the wallet is locked
+	unlocking bool
+}
+
+// newSession returns a session that runs the idle timer while the reader
+// waits for input
+func newSession(service *pkg.WalletService, guard *pkg.ClipboardGuard, reader *lineReader, timeout time.Duration, keyFile string) *session {
+	s := &session{
+		service: service,
+		guard:   guard,
+		reader:  reader,
+		timeout: timeout,
+		keyFile: keyFile,
+	}
+	reader.beforeRead = s.beforeRead
+	reader.afterRead = s.afterRead
+	return s
+}
+
+// beforeRead starts the idle timer when a prompt waits for input. Once the
+// wallet has been locked in the middle of a command, its remaining prompts
+// are not read: the command fails on the locked wallet and the next
+// command unlocks it.
+func (s *session) beforeRead(isCommand bool) bool {
+	if s.unlocking {
+		return true
+	}
+	if !isCommand && s.IsLocked() {
+		return false
+	}
+	s.startIdleTimer()
+	return true
+}
+
+// afterRead stops the idle timer. An answer typed after the wallet was
+// locked is dropped, as the command it belongs to cannot go on.
+func (s *session) afterRead(isCommand bool) bool {
+	if s.unlocking {
+		return true
+	}
+	s.stopIdleTimer()
+	return isCommand || !s.IsLocked()
+}
+
+// startIdleTimer starts counting idle time while waiting for input
+func (s *session) startIdleTimer() {
+	if s.timeout <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var timer *time.Timer
+	timer = time.AfterFunc(s.timeout, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// The timer may have fired while stopIdleTimer waited for mu, the
+		// line that was entered then must not find the wallet locked
+		if s.timer != timer {
+			return
+		}
+		s.timer = nil
+		if s.lockLocked() {
+			s.reader.Notify("Session locked after inactivity. Changes that were not saved are lost.")
+		}
+	})
+	s.timer = timer
+}
+
+// stopIdleTimer stops counting idle time once a line has been entered
+func (s *session) stopIdleTimer() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopIdleTimerLocked()
+}
+
+// stopIdleTimerLocked stops the idle timer with mu held. A timer that has
+// already fired does nothing once it gets mu.
+func (s *session) stopIdleTimerLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// Lock wipes the in-memory wallet. It reports false if it was already
+// locked.
+func (s *session) Lock() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lockLocked()
+}
+
+// lockLocked locks without saving: every command saves its own changes, so
+// only changes whose save failed are still in memory, and writing them
+// behind the user's back could overwrite newer changes from elsewhere. A
+// lock that depended on a save would leave the wallet open instead.
+func (s *session) lockLocked() bool {
+	if s.service.IsLocked() {
+		return false
+	}
+	s.guard.Clear()
+	s.service.Lock()
+	return true
+}
+
+// IsLocked reports whether the wallet has to be unlocked before the next command
+func (s *session) IsLocked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.service.IsLocked()
+}
+
+// Unlock asks for the master password, or the recovery key, key shares or
+// identity file if the session was started with -recover, -shares or
+// -identity, until the wallet is unlocked. The keyfile, if any, has to be
+// readable again. A session opened with an identity file reads it again
+// without asking, and asks for its path if that fails.
+// It returns false if the user gave up or entered too many wrong passwords.
+func (s *session) Unlock() bool {
+	s.unlocking = true
+	defer func() { s.unlocking = false }()
+	identityFile := s.identityFile
+	for attempt := 1; attempt <= maxUnlockAttempts; attempt++ {
+		var err error
+		switch s.unlockType {
+		case pkg.SlotTypeRecipient:
+			path := identityFile
+			identityFile = ""
+			if path == "" {
+				fmt.Print("Session locked. Path to your identity file: ")
+				if !s.reader.Scan() {
+					return false
+				}
+				path = strings.TrimSpace(s.reader.Text())
+			} else {
+				fmt.Printf("Session locked. Reading the identity file '%s' again.\n", path)
+			}
+			if path == "" {
+				return false
+			}
+			s.mu.Lock()
+			err = s.service.UnlockWithIdentityFile(path)
+			s.mu.Unlock()
+
+		case pkg.SlotTypeShamir:
+			fmt.Println("Session locked. Enter the key shares.")
+			shares := readShares(s.reader)
+			if shares == nil {
+				return false
+			}
+			s.mu.Lock()
+			err = s.service.UnlockWithShares(shares)
+			s.mu.Unlock()
+
+		case pkg.SlotTypeRecovery:
+			fmt.Print("Session locked. Enter your recovery key: ")
+			recoveryKey := s.reader.ReadPassword()
+			if recoveryKey == "" {
+				return false
+			}
+			s.mu.Lock()
+			err = s.service.UnlockWithRecoveryKey(recoveryKey)
+			s.mu.Unlock()
+
+		default:
+			fmt.Print("Session locked. Enter your wallet password: ")
+			password := s.reader.ReadPassword()
+			if password == "" {
+				return false
+			}
+			s.mu.Lock()
+			if err = useKeyFile(s.service, s.keyFile); err == nil {
+				err = s.service.Unlock(password)
+			}
+			s.mu.Unlock()
+		}
+
+		if err == nil {
+			fmt.Println("Wallet unlocked.")
+			return true
+		}
+		fmt.Printf("Error: %v\n", err)
+	}
+
+	fmt.Println("Too many failed attempts.")
+	return false
+}
+
+// WaitForUser waits for Enter before a session that unlocks without asking
+// for a secret is unlocked after the lock command, so the wallet stays
+// locked while the user is away. It returns false at the end of the input.
+func (s *session) WaitForUser() bool {
+	if s.unlockType != pkg.SlotTypeRecipient || s.identityFile == "" {
+		return true
+	}
+	s.unlocking = true
+	defer func() { s.unlocking = false }()
+	fmt.Print("Press Enter to unlock: ")
+	return s.reader.Scan()
+}
+
+// WithService runs fn unless the wallet is locked, e.g. for tab completion
+// while the idle timer is running
+func (s *session) WithService(fn func(service *pkg.WalletService)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.service.IsLocked() {
+		fn(s.service)
+	}
+}
+
+// existingPath returns the path, or the root if the group no longer exists
+// in the reloaded wallet
+func existingPath(service *pkg.WalletService, path pkg.Path) pkg.Path {
+	if len(path.GroupIDs) == 0 {
+		return path
+	}
+	if _, err := pkg.FindGroupByPath(service.GetWallet(), path); err != nil {
+		return pkg.Path{GroupIDs: []string{}}
+	}
+	return path
+}
+
+func handleChangePassword(service *pkg.WalletService, reader *lineReader) {
+	fmt.Print("Current password: ")
+	current := reader.ReadPassword()
+	fmt.Print("New password: ")
+	password := reader.ReadPassword()
+	if password == "" {
+		fmt.Println("Password cannot be empty")
+		return
+	}
+	fmt.Print("Confirm new password: ")
+	if reader.ReadPassword() != password {
+		fmt.Println("Passwords do not match")
+		return
+	}
+
+	if err := service.ChangePassword(current, password); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Println("Password changed.")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"safe-wallet-go/pkg"
+)
+
+// newIdentitySession returns a session opened with a new identity file,
+// as with -identity, for a wallet with the password "password"
+func newIdentitySession(t *testing.T, input string) (*session, *pkg.WalletService) {
+	t.Helper()
+	service := newTestService(t)
+	identityFile := filepath.Join(t.TempDir(), "identity.txt")
+	recipient, err := pkg.GenerateIdentityFile(identityFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.AddRecipientSlot("laptop", recipient); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := &lineReader{scanner: bufio.NewScanner(strings.NewReader(input)), history: &commandHistory{}}
+	sess := newSession(service, pkg.NewClipboardGuard(&pkg.MemoryClipboard{}, 0), reader, 0, "")
+	sess.unlockType = pkg.SlotTypeRecipient
+	sess.identityFile = identityFile
+	return sess, service
+}
+
+// revokePasswordSlots leaves only the recipient slot
+func revokePasswordSlots(t *testing.T, service *pkg.WalletService) {
+	t.Helper()
+	for _, slot := range service.ListSlots() {
+		if slot.Type == pkg.SlotTypePassword {
+			if err := service.RevokeSlot(slot.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestIdentitySessionUnlockReadsIdentityFile(t *testing.T) {
+	// The wallet also has a password, which is not asked for
+	sess, service := newIdentitySession(t, "")
+	sess.Lock()
+	var unlocked bool
+	output := captureStdout(t, func() { unlocked = sess.Unlock() })
+	if !unlocked || service.IsLocked() {
+		t.Fatalf("the identity file did not unlock the session:\n%s", output)
+	}
+	if strings.Contains(output, "password:") {
+		t.Errorf("a session opened with an identity file asked for a password:\n%s", output)
+	}
+
+	// The identity file is read again, so a removed file does not unlock it
+	identityFile := sess.identityFile
+	sess.identityFile = filepath.Join(t.TempDir(), "missing.txt")
+	sess.Lock()
+	captureStdout(t, func() { unlocked = sess.Unlock() })
+	if unlocked || !service.IsLocked() {
+		t.Error("the session unlocked without the identity file")
+	}
+
+	// Its path is asked for then
+	sess.reader.scanner = bufio.NewScanner(strings.NewReader(identityFile + "\n"))
+	output = captureStdout(t, func() { unlocked = sess.Unlock() })
+	if !unlocked || service.IsLocked() {
+		t.Fatalf("the identity file that was entered did not unlock the session:\n%s", output)
+	}
+}
+
+func TestIdentitySessionWithoutPasswordUnlocks(t *testing.T) {
+	sess, service := newIdentitySession(t, "")
+	revokePasswordSlots(t, service)
+	sess.Lock()
+	var unlocked bool
+	output := captureStdout(t, func() { unlocked = sess.Unlock() })
+	if !unlocked || service.IsLocked() {
+		t.Fatalf("the identity file did not unlock the session:\n%s", output)
+	}
+}
+
+func TestIdleTimerStoppedAfterFiring(t *testing.T) {
+	service := newTestService(t)
+	reader := &lineReader{scanner: bufio.NewScanner(strings.NewReader("")), history: &commandHistory{}}
+	sess := newSession(service, pkg.NewClipboardGuard(&pkg.MemoryClipboard{}, 0), reader, time.Millisecond, "")
+
+	// The timer fires while a command is being entered and waits for mu,
+	// which stopIdleTimer holds
+	sess.startIdleTimer()
+	sess.mu.Lock()
+	time.Sleep(50 * time.Millisecond)
+	sess.stopIdleTimerLocked()
+	sess.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if service.IsLocked() {
+		t.Error("a stopped idle timer locked the wallet")
+	}
+}
+
+func TestIdleTimerLocks(t *testing.T) {
+	service := newTestService(t)
+	reader := &lineReader{scanner: bufio.NewScanner(strings.NewReader("")), history: &commandHistory{}}
+	sess := newSession(service, pkg.NewClipboardGuard(&pkg.MemoryClipboard{}, 0), reader, time.Millisecond, "")
+
+	captureStdout(t, func() {
+		sess.startIdleTimer()
+		time.Sleep(50 * time.Millisecond)
+	})
+	sess.stopIdleTimer()
+	if !service.IsLocked() {
+		t.Error("the idle timer did not lock the wallet")
+	}
+}
+
+func TestIdleTimerLocksAtPrompts(t *testing.T) {
+	service := newTestService(t)
+	input, write := io.Pipe()
+	defer write.Close()
+	reader := &lineReader{scanner: bufio.NewScanner(input), history: &commandHistory{}}
+	sess := newSession(service, pkg.NewClipboardGuard(&pkg.MemoryClipboard{}, 0), reader, 10*time.Millisecond, "")
+
+	// A command waits at one of its prompts, e.g. for a new entry title
+	scanned := make(chan bool)
+	output := captureStdout(t, func() {
+		go func() { scanned <- reader.Scan() }()
+		time.Sleep(100 * time.Millisecond)
+	})
+	if !sess.IsLocked() {
+		t.Fatal("the idle timer did not lock the wallet at a prompt")
+	}
+	if !strings.Contains(output, "Session locked") {
+		t.Errorf("no notice that the session locked:\n%s", output)
+	}
+
+	// The answer is dropped, and so are the next prompts of the command
+	go write.Write([]byte("title\nanswer\n"))
+	if <-scanned {
+		t.Errorf("the answer %q was returned to the command after the wallet locked", reader.Text())
+	}
+	if reader.Scan() {
+		t.Error("a prompt of the command was read after the wallet locked")
+	}
+
+	// The command prompt is still read, the next command unlocks the wallet
+	if _, ok := reader.ReadCommand(""); !ok {
+		t.Error("the command prompt was not read after the wallet locked")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"safe-wallet-go/pkg"
+)
+
+// readShares asks for shares until as many as the threshold stored in the
+// first share have been entered. It returns nil if the user gave up.
+func readShares(scanner *lineReader) []string {
+	var shares []string
+	threshold := 0
+	for threshold == 0 || len(shares) < threshold {
+		if threshold == 0 {
+			fmt.Print("Enter share 1: ")
+		} else {
+			fmt.Printf("Enter share %d of %d: ", len(shares)+1, threshold)
+		}
+		share := strings.TrimSpace(scanner.ReadPassword())
+		if share == "" {
+			return nil
+		}
+
+		if threshold == 0 {
+			k, err := pkg.ShareThreshold(share)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			threshold = k
+		}
+		shares = append(shares, share)
+	}
+	return shares
+}
+
+func handleSplitKey(service *pkg.WalletService, scanner *lineReader) {
+	fmt.Print("Number of shares to create: ")
+	if !scanner.Scan() {
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+	if err != nil {
+		fmt.Println("Invalid number")
+		return
+	}
+
+	fmt.Print("Number of shares needed to unlock: ")
+	if !scanner.Scan() {
+		return
+	}
+	k, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+	if err != nil {
+		fmt.Println("Invalid number")
+		return
+	}
+
+	fmt.Print("Label for the new slot (leave empty for \"K of N shares\"): ")
+	if !scanner.Scan() {
+		return
+	}
+	label := strings.TrimSpace(scanner.Text())
+
+	shares, err := service.AddShamirSlot(label, n, k)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Printf("\nAny %d of these %d shares unlock the wallet (cli -shares).\n", k, n)
+	fmt.Println("Give each share to a different person. They are not stored anywhere.")
+	for i, share := range shares {
+		fmt.Printf("\n  Share %d: %s\n", i+1, share)
+	}
+	fmt.Println("\nRevoke the slot with 'revoke-slot' if shares are lost or compromised.")
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"safe-wallet-go/pkg"
+)
+
+// shellCommands are the command names offered by tab completion
+var shellCommands = []string{
+	"help", "create-group", "create-entry", "list", "show", "update-group",
+	"update-entry", "delete-group", "delete-entry", "forward", "back",
+	"search", "tree", "navigate", "root", "save", "quit", "exit",
+	"cd", "ls", "pwd", "history", "copy", "lock", "passwd",
+	"slots", "add-slot", "revoke-slot", "rotate-key", "recovery-kit", "split", "add-recipient",
+	"import", "import-browser", "export", "share-group", "import-bundle",
+	"storage", "backups",
+}
+
+// pathCommands are the commands whose argument is a name path
+var pathCommands = map[string]bool{
+	"cd":   true,
+	"ls":   true,
+	"show": true,
+	"s":    true,
+	"4":    true,
+	"copy": true,
+	"cp":   true,
+}
+
+// completeLine completes the command name or name path argument at the end
+// of line. It returns the completed line and all candidates that matched.
+func completeLine(service *pkg.WalletService, currentPath pkg.Path, line string) (string, []string) {
+	command, arg, hasArg := strings.Cut(line, " ")
+	if !hasArg {
+		return completeFrom(line, "", matchingPrefix(shellCommands, command), " ")
+	}
+
+	if !pathCommands[strings.ToLower(command)] {
+		return line, nil
+	}
+
+	prefix := command + " "
+	arg = strings.TrimLeft(arg, " ")
+	prefix += line[len(prefix) : len(line)-len(arg)]
+
+	// Split the argument into the group part and the partial last name
+	dir, partial := "", arg
+	if i := lastSeparator(arg); i >= 0 {
+		dir, partial = arg[:i+1], arg[i+1:]
+	}
+
+	groupPath, err := service.ResolvePath(currentPath, dir)
+	if err != nil || groupPath.EntryID != "" {
+		return line, nil
+	}
+
+	var names []string
+	wallet := service.GetWallet()
+	groups := wallet.Groups
+	var entries []pkg.Entry
+	if len(groupPath.GroupIDs) > 0 {
+		group, err := pkg.FindGroupByPath(wallet, groupPath)
+		if err != nil {
+			return line, nil
+		}
+		groups, entries = group.Groups, group.Entries
+	}
+	for _, group := range groups {
+		names = append(names, pkg.EscapeName(group.Name)+string(pkg.NamePathSeparator))
+	}
+	if strings.ToLower(command) != "cd" {
+		for _, entry := range entries {
+			names = append(names, pkg.EscapeName(entry.Title))
+		}
+	}
+	sort.Strings(names)
+
+	return completeFrom(partial, prefix+dir, matchingPrefix(names, partial), "")
+}
+
+// completeFrom replaces partial with the single candidate, or with the
+// longest prefix shared by all candidates. suffix is appended after a
+// unique candidate that does not end with a separator.
+func completeFrom(partial, before string, candidates []string, suffix string) (string, []string) {
+	if len(candidates) == 0 {
+		return before + partial, nil
+	}
+	if len(candidates) == 1 {
+		completed := candidates[0]
+		if !strings.HasSuffix(completed, string(pkg.NamePathSeparator)) {
+			completed += suffix
+		}
+		return before + completed, candidates
+	}
+	return before + commonPrefix(candidates), candidates
+}
+
+// matchingPrefix returns the names that start with prefix
+func matchingPrefix(names []string, prefix string) []string {
+	var matches []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+// commonPrefix returns the longest prefix shared by all strings
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// lastSeparator returns the index of the last unescaped separator in s, or -1
+func lastSeparator(s string) int {
+	last := -1
+	escaped := false
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == pkg.NamePathSeparator:
+			last = i
+		}
+	}
+	return last
+}
+
+func handlePrintWorkingGroup(service *pkg.WalletService, currentPath pkg.Path) {
+	namePath, err := service.FormatPath(currentPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Println(namePath)
+}
+
+func handleListPath(service *pkg.WalletService, currentPath pkg.Path, namePath string) {
+	path, err := service.ResolvePath(currentPath, namePath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if path.EntryID != "" {
+		entry, err := pkg.FindEntryByPath(service.GetWallet(), path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("\n%s (ID: %s)\n", entry.Title, entry.ID)
+		printMaskedFields(*entry, "  ")
+		fmt.Println("\nUse 'show' to reveal the values or 'copy' to copy one.")
+		return
+	}
+	handleList(service, path)
+}
+
+func handleHistory(reader *lineReader) {
+	history := reader.history
+	if history.Len() == 0 {
+		fmt.Println("No commands in history.")
+		return
+	}
+	for i := history.Len() - 1; i >= 0; i-- {
+		fmt.Printf("  %3d  %s\n", history.Len()-i, history.At(i))
+	}
+}
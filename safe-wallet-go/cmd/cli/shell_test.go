@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"safe-wallet-go/pkg"
+)
+
+// captureStdout returns what f prints to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-output
+}
+
+// newTestService returns a wallet with the group Email, which holds the
+// entry Work Mail with a username, a PIN and a password
+func newTestService(t *testing.T) *pkg.WalletService {
+	t.Helper()
+	service := pkg.NewWalletServiceWithStorage(pkg.NewMemoryStorage(), "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	group := &pkg.Group{Name: "Email"}
+	if err := service.AddGroup(pkg.Path{}, group); err != nil {
+		t.Fatal(err)
+	}
+	entry := &pkg.Entry{Title: "Work Mail", Fields: []pkg.EntryField{
+		{Name: "username", Value: "alice", Type: pkg.FieldTypeGeneral},
+		{Name: "recovery code", Value: "1234", Type: pkg.FieldTypePIN},
+		{Name: "password", Value: "hunter2", Type: pkg.FieldTypePassword},
+	}}
+	if err := service.AddEntry(pkg.Path{GroupIDs: []string{group.ID}}, entry); err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestHandleListPathMasksEntry(t *testing.T) {
+	service := newTestService(t)
+	root := pkg.Path{GroupIDs: []string{}}
+
+	output := captureStdout(t, func() {
+		handleListPath(service, root, "Email/Work Mail")
+	})
+	if !strings.Contains(output, "username: alice") {
+		t.Errorf("ls of an entry does not list its fields:\n%s", output)
+	}
+	for _, secret := range []string{"hunter2", "1234"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("ls of an entry reveals %q:\n%s", secret, output)
+		}
+	}
+	if !strings.Contains(output, "password: ******") || !strings.Contains(output, "recovery code: ******") {
+		t.Errorf("ls of an entry does not mask the sensitive fields:\n%s", output)
+	}
+
+	output = captureStdout(t, func() {
+		handleListPath(service, root, "Email")
+	})
+	if !strings.Contains(output, "Work Mail") || strings.Contains(output, "hunter2") {
+		t.Errorf("ls of a group:\n%s", output)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"safe-wallet-go/pkg"
+)
+
+func handleListSlots(service *pkg.WalletService) {
+	slots := service.ListSlots()
+	fmt.Printf("\n=== Key Slots (%d) ===\n", len(slots))
+	for _, slot := range slots {
+		marker := ""
+		if slot.ID == service.CurrentSlotID() {
+			marker = " (unlocked with)"
+		}
+		fmt.Printf("  %s  %-20s %-20s created %s%s\n", slot.ID, slot.Label, slot.Description(), slot.Created.Format("2006-01-02"), marker)
+	}
+}
+
+func handleAddSlot(service *pkg.WalletService, scanner *lineReader) {
+	fmt.Print("Label for the new slot (e.g. Recovery passphrase): ")
+	if !scanner.Scan() {
+		return
+	}
+	label := strings.TrimSpace(scanner.Text())
+
+	fmt.Print("Password for the new slot: ")
+	password := scanner.ReadPassword()
+	if password == "" {
+		fmt.Println("Password cannot be empty")
+		return
+	}
+	fmt.Print("Confirm password: ")
+	if scanner.ReadPassword() != password {
+		fmt.Println("Passwords do not match")
+		return
+	}
+
+	fmt.Print("Keyfile to require as well (leave empty for none): ")
+	if !scanner.Scan() {
+		return
+	}
+	keyFile := strings.TrimSpace(scanner.Text())
+
+	slot, err := service.AddPasswordSlot(label, password, keyFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Key slot '%s' added (%s)\n", slot.Label, slot.ID)
+}
+
+func handleRevokeSlot(service *pkg.WalletService, scanner *lineReader, id string) {
+	if id == "" {
+		handleListSlots(service)
+		fmt.Print("\nID of the slot to revoke: ")
+		if !scanner.Scan() {
+			return
+		}
+		id = strings.TrimSpace(scanner.Text())
+	}
+
+	if id == service.CurrentSlotID() {
+		fmt.Print("This is the slot you unlocked with. Revoke it anyway? (y/n): ")
+	} else {
+		fmt.Printf("Revoke key slot '%s'? (y/n): ", id)
+	}
+	if !scanner.Scan() || strings.ToLower(strings.TrimSpace(scanner.Text())) != "y" {
+		fmt.Println("Cancelled")
+		return
+	}
+
+	if err := service.RevokeSlot(id); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Println("Key slot revoked. Run 'rotate-key' if its secret may have been used to copy the wallet.")
+}
+
+func handleRotateKey(service *pkg.WalletService, scanner *lineReader) {
+	fmt.Print("Encrypt the wallet again with a new data key? Other programs that have it open must unlock it again. (y/n): ")
+	if !scanner.Scan() || strings.ToLower(strings.TrimSpace(scanner.Text())) != "y" {
+		fmt.Println("Cancelled")
+		return
+	}
+	if err := service.RotateDataKey(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Println("The wallet was encrypted again with a new data key.")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"safe-wallet-go/pkg"
+)
+
+// storageOptions are the flags that choose where the wallet is kept
+type storageOptions struct {
+	webDAVURL   string
+	webDAVUser  string
+	webDAVCache string
+	s3Endpoint  string
+	s3Region    string
+	s3Bucket    string
+	s3Prefix    string
+	s3AccessKey string
+}
+
+// openStorage returns the storage of the wallet: a WebDAV server or an S3
+// bucket if one is given, the local disk otherwise
+func openStorage(reader *lineReader, options storageOptions) (pkg.Storage, error) {
+	switch {
+	case options.webDAVURL != "" && options.s3Endpoint != "":
+		return nil, errors.New("the wallet can be kept on WebDAV or S3, not both")
+	case options.webDAVURL != "":
+		return openWebDAVStorage(reader, options)
+	case options.s3Endpoint != "":
+		return openS3Storage(reader, options)
+	}
+	return pkg.FileStorage{}, nil
+}
+
+// handleStorage shows how the wallet is stored or converts it to a single
+// file or a sync directory with a file per entry
+func handleStorage(service *pkg.WalletService, scanner *lineReader, format string) {
+	current := service.StorageFormat()
+	if format == "" {
+		fmt.Printf("The wallet is stored as: %s\n", current)
+		fmt.Print("Convert to (file, sync, leave empty to keep): ")
+		if !scanner.Scan() {
+			return
+		}
+		format = strings.TrimSpace(scanner.Text())
+		if format == "" {
+			return
+		}
+	}
+
+	target := pkg.StorageFormat(strings.ToLower(format))
+	if target == current {
+		fmt.Printf("The wallet is already stored as: %s\n", current)
+		return
+	}
+	if err := service.ConvertStorage(target); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if target == pkg.StorageSyncDir {
+		fmt.Println("The wallet is now a directory with a file per entry. Unsaved changes were saved.")
+		fmt.Println("Commit the whole directory to share the wallet with git.")
+	} else {
+		fmt.Println("The wallet is now a single file. Unsaved changes were saved.")
+	}
+}
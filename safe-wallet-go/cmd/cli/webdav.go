@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"safe-wallet-go/pkg"
+)
+
+// webDAVPasswordEnv holds the WebDAV password, so scripts need not type it
+const webDAVPasswordEnv = "SAFE_WALLET_WEBDAV_PASSWORD"
+
+// openWebDAVStorage returns the storage for the WebDAV directory
+func openWebDAVStorage(reader *lineReader, options storageOptions) (pkg.Storage, error) {
+	password, ok := os.LookupEnv(webDAVPasswordEnv)
+	if !ok && options.webDAVUser != "" {
+		fmt.Fprintf(os.Stderr, "WebDAV password for %s: ", options.webDAVUser)
+		password = reader.ReadPassword()
+	}
+	cacheDir := options.webDAVCache
+	if cacheDir == "" {
+		if userCache, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(userCache, "safe-wallet", "webdav")
+		}
+	}
+	return pkg.NewWebDAVStorage(pkg.WebDAVConfig{
+		URL:      options.webDAVURL,
+		Username: options.webDAVUser,
+		Password: password,
+		CacheDir: cacheDir,
+	})
+}
+
+// printOfflineNotice tells that the wallet came from the cache
+func printOfflineNotice(storage pkg.Storage) {
+	if webDAV, ok := storage.(*pkg.WebDAVStorage); ok && webDAV.Offline() {
+		fmt.Println("The WebDAV server is unreachable, the wallet was opened from the offline cache.")
+		fmt.Println("Changes cannot be saved until the server is reachable again.")
+	}
+}
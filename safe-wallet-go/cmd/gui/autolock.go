@@ -0,0 +1,185 @@
+package main
+
+import (
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+const (
+	// autoLockPreference stores the idle time in minutes before locking, 0 disables it
+	autoLockPreference = "autoLockMinutes"
+	defaultAutoLock    = 5
+	// lockOnFocusLossPreference locks the vault when the window loses focus or is minimized
+	lockOnFocusLossPreference = "lockOnFocusLoss"
+)
+
+// activityMonitor wraps the main content or the content of a dialog and
+// reports mouse movement over it as user activity. Child widgets that handle
+// hover events themselves take precedence, so it only complements the other
+// activity sources.
+type activityMonitor struct {
+	widget.BaseWidget
+	content    fyne.CanvasObject
+	onActivity func()
+}
+
+func newActivityMonitor(content fyne.CanvasObject, onActivity func()) *activityMonitor {
+	m := &activityMonitor{content: content, onActivity: onActivity}
+	m.ExtendBaseWidget(m)
+	return m
+}
+
+func (m *activityMonitor) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(m.content)
+}
+
+func (m *activityMonitor) MouseIn(*desktop.MouseEvent) {
+	m.onActivity()
+}
+
+func (m *activityMonitor) MouseMoved(*desktop.MouseEvent) {
+	m.onActivity()
+}
+
+func (m *activityMonitor) MouseOut() {}
+
+// watched makes typing into the inputs of the content, and moving the mouse
+// over it, count as activity. The canvas only sees the keys typed while no
+// widget has the focus, and dialogs are overlays outside the main content.
+func (va *VaultApp) watched(content fyne.CanvasObject) fyne.CanvasObject {
+	watchInput(content, va.recordActivity)
+	return newActivityMonitor(content, va.recordActivity)
+}
+
+// watchedItems makes typing into the inputs of a form dialog count as activity
+func (va *VaultApp) watchedItems(items []*widget.FormItem) []*widget.FormItem {
+	for _, item := range items {
+		watchInput(item.Widget, va.recordActivity)
+	}
+	return items
+}
+
+// watchInput chains onChange to the OnChanged handlers of the entries,
+// selects and checks in the object. It has to be called once their own
+// handlers are set.
+func watchInput(object fyne.CanvasObject, onChange func()) {
+	switch o := object.(type) {
+	case *widget.Entry:
+		previous := o.OnChanged
+		o.OnChanged = func(text string) {
+			onChange()
+			if previous != nil {
+				previous(text)
+			}
+		}
+	case *widget.SelectEntry:
+		watchInput(&o.Entry, onChange)
+	case *widget.Select:
+		previous := o.OnChanged
+		o.OnChanged = func(selected string) {
+			onChange()
+			if previous != nil {
+				previous(selected)
+			}
+		}
+	case *widget.Check:
+		previous := o.OnChanged
+		o.OnChanged = func(checked bool) {
+			onChange()
+			if previous != nil {
+				previous(checked)
+			}
+		}
+	case *widget.RadioGroup:
+		previous := o.OnChanged
+		o.OnChanged = func(selected string) {
+			onChange()
+			if previous != nil {
+				previous(selected)
+			}
+		}
+	case *widget.Form:
+		for _, item := range o.Items {
+			watchInput(item.Widget, onChange)
+		}
+	case *widget.Card:
+		watchInput(o.Content, onChange)
+	case *container.Scroll:
+		watchInput(o.Content, onChange)
+	case *container.Split:
+		watchInput(o.Leading, onChange)
+		watchInput(o.Trailing, onChange)
+	case *fyne.Container:
+		for _, child := range o.Objects {
+			watchInput(child, onChange)
+		}
+	}
+}
+
+// setupAutoLock starts tracking user input and locks the vault when idle
+func (va *VaultApp) setupAutoLock() {
+	va.recordActivity()
+
+	canvas := va.mainWindow.Canvas()
+	canvas.SetOnTypedKey(func(*fyne.KeyEvent) {
+		va.recordActivity()
+	})
+	canvas.SetOnTypedRune(func(rune) {
+		va.recordActivity()
+	})
+
+	va.app.Lifecycle().SetOnExitedForeground(func() {
+		if va.service != nil && va.app.Preferences().BoolWithFallback(lockOnFocusLossPreference, false) {
+			va.lock()
+		}
+	})
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			fyne.Do(va.checkIdle)
+		}
+	}()
+}
+
+// recordActivity resets the idle timer
+func (va *VaultApp) recordActivity() {
+	va.lastActivity = time.Now()
+}
+
+// checkIdle locks the vault if it has been idle for longer than the configured period
+func (va *VaultApp) checkIdle() {
+	if va.service == nil {
+		return
+	}
+
+	minutes := va.app.Preferences().IntWithFallback(autoLockPreference, defaultAutoLock)
+	if minutes <= 0 {
+		return
+	}
+
+	if time.Since(va.lastActivity) >= time.Duration(minutes)*time.Minute {
+		va.lock()
+	}
+}
+
+// lock closes all dialogs, wipes the unlocked wallet and returns to the unlock screen
+func (va *VaultApp) lock() {
+	overlays := va.mainWindow.Canvas().Overlays()
+	for overlays.Top() != nil {
+		overlays.Remove(overlays.Top())
+	}
+
+	va.clipboardGuard.Clear()
+	va.service.Close()
+	va.service = nil
+	va.currentPath = pkg.Path{GroupIDs: []string{}}
+	va.showUnlockScreen()
+}
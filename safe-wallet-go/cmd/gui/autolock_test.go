@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/test"
+	"fyne.io/fyne/v2/widget"
+)
+
+func TestTypingInFocusedEntryRecordsActivity(t *testing.T) {
+	va := newTestVaultApp(t)
+	entry := widget.NewEntry()
+	var typed string
+	entry.OnChanged = func(text string) { typed = text }
+	dialog.NewCustom("Edit", "Close", va.watched(container.NewVBox(entry)), va.mainWindow).Show()
+
+	// The focused entry gets the keys, the canvas handlers do not see them
+	test.Type(entry, "a")
+	if va.lastActivity.IsZero() {
+		t.Error("typing into a focused entry of a dialog did not reset the idle timer")
+	}
+	if typed != "a" {
+		t.Errorf("OnChanged of the entry got %q, want %q", typed, "a")
+	}
+}
+
+func TestWatchedItemsRecordActivity(t *testing.T) {
+	va := newTestVaultApp(t)
+	check := widget.NewCheck("Remember", nil)
+	selection := widget.NewSelect([]string{"One", "Two"}, nil)
+	va.watchedItems([]*widget.FormItem{
+		widget.NewFormItem("", check),
+		widget.NewFormItem("Choice", selection),
+	})
+
+	check.SetChecked(true)
+	if va.lastActivity.IsZero() {
+		t.Error("checking a box did not reset the idle timer")
+	}
+	va.lastActivity = time.Time{}
+	selection.SetSelected("Two")
+	if va.lastActivity.IsZero() {
+		t.Error("selecting an option did not reset the idle timer")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+// showBackupsDialog lists the earlier versions of the vault kept by the
+// storage with buttons to restore them
+func (va *VaultApp) showBackupsDialog() {
+	va.recordActivity()
+
+	backups, err := va.service.Backups()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("error listing backups: %v", err), va.mainWindow)
+		return
+	}
+
+	var d dialog.Dialog
+	backupList := container.NewVBox()
+	for _, backup := range backups {
+		saved := backup.ModTime.Local().Format("2006-01-02 15:04:05")
+
+		restoreBtn := widget.NewButton("Restore", func() {
+			message := fmt.Sprintf("Replace all groups and entries with the backup saved %s? Unsaved changes are lost.\n\n"+
+				"The current version is kept as a backup.", saved)
+			dialog.ShowConfirm("Restore Backup", message, func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := va.service.RestoreBackup(backup.ID); err != nil {
+					dialog.ShowError(fmt.Errorf("error restoring backup: %v", err), va.mainWindow)
+					return
+				}
+				d.Hide()
+				va.currentPath = pkg.Path{GroupIDs: []string{}}
+				va.treeWidget.UnselectAll()
+				va.refreshUI()
+				dialog.ShowInformation("Backup Restored", "The vault was restored from the backup saved "+saved+".", va.mainWindow)
+			}, va.mainWindow)
+		})
+		restoreBtn.Importance = widget.DangerImportance
+
+		details := widget.NewLabel(fmt.Sprintf("Saved %s, %d bytes", saved, backup.Size))
+		backupList.Add(container.NewBorder(nil, nil, nil, restoreBtn, details))
+		backupList.Add(widget.NewSeparator())
+	}
+	if len(backups) == 0 {
+		backupList.Add(widget.NewLabel("No backups yet."))
+	}
+
+	var bottom fyne.CanvasObject
+	if s3, ok := va.storage.(*pkg.S3Storage); ok {
+		bottom = widget.NewButton("Enable Versioning", func() {
+			if err := s3.EnableVersioning(); err != nil {
+				dialog.ShowError(fmt.Errorf("error enabling versioning: %v", err), va.mainWindow)
+				return
+			}
+			dialog.ShowInformation("Versioning Enabled", "Every save now keeps the previous version of the vault as a backup.", va.mainWindow)
+		})
+	}
+
+	content := container.NewBorder(
+		widget.NewLabel("Earlier versions of the vault kept by the storage, newest first."),
+		bottom, nil, nil,
+		container.NewVScroll(backupList),
+	)
+
+	d = dialog.NewCustom("Backups", "Close", va.watched(content), va.mainWindow)
+	d.Resize(fyne.NewSize(550, 400))
+	d.Show()
+}
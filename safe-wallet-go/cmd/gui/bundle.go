@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+// showShareGroupDialog writes the current group to a bundle with its own
+// password or age recipients
+func (va *VaultApp) showShareGroupDialog() {
+	va.recordActivity()
+	path := pkg.Path{GroupIDs: va.currentPath.GroupIDs}
+
+	recipientsEntry := widget.NewEntry()
+	recipientsEntry.SetPlaceHolder("age1... (separate several with spaces)")
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Password for the bundle")
+	confirmEntry := widget.NewPasswordEntry()
+	confirmEntry.SetPlaceHolder("Confirm password")
+	fileEntry, filePicker := va.newExportFilePicker("Path of the bundle")
+
+	d := dialog.NewForm("Share Group", "Share", "Cancel", va.watchedItems([]*widget.FormItem{
+		widget.NewFormItem("File", filePicker),
+		widget.NewFormItem("Recipients", recipientsEntry),
+		widget.NewFormItem("Password", passwordEntry),
+		widget.NewFormItem("Confirm", confirmEntry),
+	}), func(ok bool) {
+		if !ok {
+			return
+		}
+		va.recordActivity()
+
+		recipients := strings.Fields(strings.ReplaceAll(recipientsEntry.Text, ",", " "))
+		if len(recipients) == 0 && passwordEntry.Text == "" {
+			dialog.ShowError(errors.New("enter recipients or a password"), va.mainWindow)
+			return
+		}
+		if passwordEntry.Text != confirmEntry.Text {
+			dialog.ShowError(errors.New("passwords do not match"), va.mainWindow)
+			return
+		}
+
+		file := strings.TrimSpace(fileEntry.Text)
+		if file == "" {
+			dialog.ShowError(errors.New("choose the file to write the bundle to"), va.mainWindow)
+			return
+		}
+		va.confirmOverwrite(file, func(overwrite bool) {
+			if err := va.service.ShareGroup(file, path, passwordEntry.Text, recipients, overwrite); err != nil {
+				dialog.ShowError(fmt.Errorf("error sharing: %v", err), va.mainWindow)
+				return
+			}
+			dialog.ShowInformation("Group Shared", fmt.Sprintf("Shared as %s", file), va.mainWindow)
+		})
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(550, 350))
+	d.Show()
+}
+
+// showImportBundleDialog grafts the groups of a bundle into the current group
+func (va *VaultApp) showImportBundleDialog() {
+	va.recordActivity()
+
+	fileEntry, filePicker := va.newKeyFilePicker("Path to the bundle", false)
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Password of the bundle")
+	identityEntry, identityPicker := va.newKeyFilePicker("Identity file (instead of a password)", false)
+
+	const keepBoth, replace = "Keep both", "Replace existing items"
+	conflictRadio := widget.NewRadioGroup([]string{keepBoth, replace}, nil)
+	conflictRadio.SetSelected(keepBoth)
+
+	d := dialog.NewForm("Import Shared Bundle", "Import", "Cancel", va.watchedItems([]*widget.FormItem{
+		widget.NewFormItem("File", filePicker),
+		widget.NewFormItem("Password", passwordEntry),
+		widget.NewFormItem("Identity", identityPicker),
+		widget.NewFormItem("Existing items", conflictRadio),
+	}), func(ok bool) {
+		if !ok {
+			return
+		}
+		va.recordActivity()
+
+		groups, err := pkg.ReadBundle(strings.TrimSpace(fileEntry.Text), passwordEntry.Text, strings.TrimSpace(identityEntry.Text))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error reading bundle: %v", err), va.mainWindow)
+			return
+		}
+		policy := pkg.ConflictKeepBoth
+		if conflictRadio.Selected == replace {
+			policy = pkg.ConflictReplace
+		}
+		renamed, err := va.service.ImportBundle(va.currentPath, groups, policy)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error importing: %v", err), va.mainWindow)
+			return
+		}
+		if err := va.service.Save(); err != nil {
+			dialog.ShowError(fmt.Errorf("error saving: %v", err), va.mainWindow)
+			return
+		}
+		va.refreshTree()
+		message := fmt.Sprintf("Imported %d groups into:\n%s", len(groups), va.getBreadcrumbText())
+		if renamed > 0 {
+			message += fmt.Sprintf("\n%d groups or entries were renamed because the name was taken.", renamed)
+		}
+		dialog.ShowInformation("Import Complete", message, va.mainWindow)
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(600, 300))
+	d.Show()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+
+	"safe-wallet-go/pkg"
+)
+
+const (
+	// clipboardTimeoutPreference stores the clipboard timeout in seconds, 0 disables clearing
+	clipboardTimeoutPreference = "clipboardTimeoutSeconds"
+	defaultClipboardTimeout    = 30
+)
+
+// fyneClipboard adapts the Fyne clipboard to pkg.Clipboard. It must only be
+// used on the Fyne main thread.
+type fyneClipboard struct {
+	clipboard fyne.Clipboard
+}
+
+func (c *fyneClipboard) SetText(text string) error {
+	c.clipboard.SetContent(text)
+	return nil
+}
+
+func (c *fyneClipboard) Text() (string, error) {
+	return c.clipboard.Content(), nil
+}
+
+func (va *VaultApp) setupClipboard() {
+	seconds := va.app.Preferences().IntWithFallback(clipboardTimeoutPreference, defaultClipboardTimeout)
+	va.clipboardGuard = pkg.NewClipboardGuard(&fyneClipboard{clipboard: va.app.Clipboard()}, time.Duration(seconds)*time.Second)
+	va.clipboardGuard.Dispatch = fyne.Do
+	va.clipboardGuard.OnCleared = func() {
+		if va.service != nil {
+			va.updateStatus()
+		}
+	}
+}
+
+// copyToClipboard copies a field value and shows the clear countdown in the status bar
+func (va *VaultApp) copyToClipboard(name string, value string) {
+	va.recordActivity()
+
+	if err := va.clipboardGuard.Copy(value); err != nil {
+		dialog.ShowError(fmt.Errorf("error copying to clipboard: %v", err), va.mainWindow)
+		return
+	}
+
+	message := name + " copied to clipboard"
+	if timeout := va.clipboardGuard.Timeout(); timeout > 0 {
+		message += fmt.Sprintf("\nIt will be cleared in %s", timeout)
+		va.startClipboardCountdown()
+	}
+	va.updateStatus()
+	dialog.ShowInformation("Copied", message, va.mainWindow)
+}
+
+// startClipboardCountdown refreshes the status bar every second until the
+// clipboard has been cleared
+func (va *VaultApp) startClipboardCountdown() {
+	if va.clipboardCountdown {
+		return
+	}
+	va.clipboardCountdown = true
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			done := false
+			fyne.DoAndWait(func() {
+				if va.service != nil {
+					va.updateStatus()
+				}
+				if va.clipboardGuard.Remaining() == 0 {
+					va.clipboardCountdown = false
+					done = true
+				}
+			})
+			if done {
+				return
+			}
+		}
+	}()
+}
+
+// getClipboardStatusText returns the countdown shown in the status bar
+func (va *VaultApp) getClipboardStatusText() string {
+	if va.clipboardGuard == nil {
+		return ""
+	}
+	remaining := va.clipboardGuard.Remaining()
+	if remaining == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" | Clipboard clears in %ds", int(math.Ceil(remaining.Seconds())))
+}
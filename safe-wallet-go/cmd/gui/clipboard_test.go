@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/test"
+	"fyne.io/fyne/v2/widget"
+)
+
+func newTestVaultApp(t *testing.T) *VaultApp {
+	t.Helper()
+	va := &VaultApp{app: test.NewTempApp(t)}
+	va.mainWindow = test.NewWindow(widget.NewLabel("vault"))
+	t.Cleanup(va.mainWindow.Close)
+	return va
+}
+
+// setupTestClipboard sets up the clipboard with a timeout of one second.
+// The test driver runs fyne.Do on the calling goroutine, so the clear is
+// serialized with the test by a mutex that stands in for the main thread.
+// The returned functions use the clipboard on that thread.
+func setupTestClipboard(va *VaultApp) (content func() string, setContent func(string)) {
+	va.app.Preferences().SetInt(clipboardTimeoutPreference, 1)
+	va.setupClipboard()
+
+	var mainThread sync.Mutex
+	va.clipboardGuard.Dispatch = func(fn func()) {
+		mainThread.Lock()
+		defer mainThread.Unlock()
+		fn()
+	}
+	clipboard := va.app.Clipboard()
+	content = func() string {
+		mainThread.Lock()
+		defer mainThread.Unlock()
+		return clipboard.Content()
+	}
+	setContent = func(text string) {
+		mainThread.Lock()
+		defer mainThread.Unlock()
+		clipboard.SetContent(text)
+	}
+	return content, setContent
+}
+
+func TestClipboardClearedAfterTimeout(t *testing.T) {
+	va := newTestVaultApp(t)
+	content, _ := setupTestClipboard(va)
+
+	if err := va.clipboardGuard.Copy("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(); got != "hunter2" {
+		t.Fatalf("clipboard = %q, want the copied secret", got)
+	}
+	if status := va.getClipboardStatusText(); !strings.Contains(status, "Clipboard clears in 1s") {
+		t.Errorf("status = %q, want the countdown", status)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for content() != "" && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := content(); got != "" {
+		t.Errorf("clipboard = %q after the timeout, want it cleared", got)
+	}
+	if status := va.getClipboardStatusText(); status != "" {
+		t.Errorf("status = %q after the timeout, want no countdown", status)
+	}
+}
+
+func TestClipboardKeepsTextCopiedElsewhere(t *testing.T) {
+	va := newTestVaultApp(t)
+	content, setContent := setupTestClipboard(va)
+
+	if err := va.clipboardGuard.Copy("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	setContent("copied by another program")
+	time.Sleep(1500 * time.Millisecond)
+	if got := content(); got != "copied by another program" {
+		t.Errorf("clipboard = %q, want the text copied elsewhere kept", got)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+// exportFormatNames describes the export formats in the format selection
+var exportFormatNames = map[pkg.ExportFormat]string{
+	pkg.ExportWallet:     "Encrypted wallet file",
+	pkg.ExportJSON:       "JSON (plaintext)",
+	pkg.ExportCSV:        "CSV (plaintext)",
+	pkg.ExportKeePassXML: "KeePass 2 XML (plaintext)",
+}
+
+// showExportDialog exports the vault or the current group to a file
+func (va *VaultApp) showExportDialog() {
+	va.recordActivity()
+
+	formats := make(map[string]pkg.ExportFormat)
+	var formatNames []string
+	for _, format := range pkg.ExportFormats {
+		formats[exportFormatNames[format]] = format
+		formatNames = append(formatNames, exportFormatNames[format])
+	}
+
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Password for the exported wallet")
+	confirmEntry := widget.NewPasswordEntry()
+	confirmEntry.SetPlaceHolder("Confirm password")
+	plaintextCheck := widget.NewCheck("I understand the file will contain all passwords unencrypted", nil)
+
+	formatSelect := widget.NewSelect(formatNames, func(name string) {
+		if formats[name].IsPlaintext() {
+			passwordEntry.Disable()
+			confirmEntry.Disable()
+			plaintextCheck.Enable()
+		} else {
+			passwordEntry.Enable()
+			confirmEntry.Enable()
+			plaintextCheck.SetChecked(false)
+			plaintextCheck.Disable()
+		}
+	})
+	formatSelect.SetSelected(exportFormatNames[pkg.ExportWallet])
+
+	const wholeVault, currentGroup = "Whole vault", "Current group"
+	scopes := []string{wholeVault}
+	if len(va.currentPath.GroupIDs) > 0 {
+		scopes = append(scopes, currentGroup)
+	}
+	scopeRadio := widget.NewRadioGroup(scopes, nil)
+	scopeRadio.SetSelected(wholeVault)
+	fileEntry, filePicker := va.newExportFilePicker("Path of the export file")
+
+	d := dialog.NewForm("Export", "Export", "Cancel", va.watchedItems([]*widget.FormItem{
+		widget.NewFormItem("Format", formatSelect),
+		widget.NewFormItem("Export", scopeRadio),
+		widget.NewFormItem("File", filePicker),
+		widget.NewFormItem("Password", passwordEntry),
+		widget.NewFormItem("Confirm", confirmEntry),
+		widget.NewFormItem("", plaintextCheck),
+	}), func(ok bool) {
+		if !ok {
+			return
+		}
+		va.recordActivity()
+
+		options := pkg.ExportOptions{Format: formats[formatSelect.Selected]}
+		if scopeRadio.Selected == currentGroup {
+			options.Path = pkg.Path{GroupIDs: va.currentPath.GroupIDs}
+		}
+		if options.Format.IsPlaintext() {
+			if !plaintextCheck.Checked {
+				dialog.ShowError(pkg.ErrPlaintextNotConfirmed, va.mainWindow)
+				return
+			}
+			options.ConfirmPlaintext = true
+		} else {
+			if passwordEntry.Text == "" {
+				dialog.ShowError(errors.New("password cannot be empty"), va.mainWindow)
+				return
+			}
+			if passwordEntry.Text != confirmEntry.Text {
+				dialog.ShowError(errors.New("passwords do not match"), va.mainWindow)
+				return
+			}
+			options.Password = passwordEntry.Text
+		}
+
+		file := strings.TrimSpace(fileEntry.Text)
+		if file == "" {
+			dialog.ShowError(errors.New("choose the file to export to"), va.mainWindow)
+			return
+		}
+		va.confirmOverwrite(file, func(overwrite bool) {
+			options.Overwrite = overwrite
+			if err := va.service.Export(file, options); err != nil {
+				dialog.ShowError(fmt.Errorf("error exporting: %v", err), va.mainWindow)
+				return
+			}
+			dialog.ShowInformation("Export Complete", fmt.Sprintf("Exported to %s", file), va.mainWindow)
+		})
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(550, 400))
+	d.Show()
+}
+
+// newExportFilePicker returns an entry for the path of a file to write with
+// a button to browse for its folder. Unlike the save dialog, browsing does
+// not create or truncate the file, so nothing is touched until the export
+// is confirmed.
+func (va *VaultApp) newExportFilePicker(placeholder string) (*widget.Entry, fyne.CanvasObject) {
+	pathEntry := widget.NewEntry()
+	pathEntry.SetPlaceHolder(placeholder)
+
+	browseBtn := widget.NewButton("Folder...", func() {
+		dialog.ShowFolderOpen(func(folder fyne.ListableURI, err error) {
+			if err != nil || folder == nil {
+				return
+			}
+			name := filepath.Base(strings.TrimSpace(pathEntry.Text))
+			if name == "." || name == string(filepath.Separator) {
+				name = "export"
+			}
+			pathEntry.SetText(filepath.Join(folder.Path(), name))
+		}, va.mainWindow)
+	})
+
+	return pathEntry, container.NewBorder(nil, nil, nil, browseBtn, pathEntry)
+}
+
+// confirmOverwrite calls write at once for a new file and asks first when
+// the file exists. write is told whether the file may be replaced.
+func (va *VaultApp) confirmOverwrite(file string, write func(overwrite bool)) {
+	if _, err := os.Stat(file); err != nil {
+		write(false)
+		return
+	}
+	dialog.ShowConfirm("Replace File?", fmt.Sprintf("%s already exists. Replace it?", file), func(ok bool) {
+		if ok {
+			write(true)
+		}
+	}, va.mainWindow)
+}
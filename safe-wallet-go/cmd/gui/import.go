@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+// showImportWizard imports a KeePass database or the export of another
+// password manager into the current group in two steps: open the file, then
+// review what will be imported
+func (va *VaultApp) showImportWizard() {
+	va.recordActivity()
+
+	var d dialog.Dialog
+	content := container.NewStack()
+
+	fileEntry, filePicker := va.newKeyFilePicker("Path to the file to import", false)
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("Master password of the file")
+	keyFileEntry, keyFilePicker := va.newKeyFilePicker("Keyfile (optional)", false)
+
+	var formatNames []string
+	for _, importer := range pkg.Importers {
+		formatNames = append(formatNames, importer.Name())
+	}
+	formatSelect := widget.NewSelect(formatNames, func(name string) {
+		importer, err := pkg.FindImporter(name)
+		if err == nil && importer.NeedsPassword() {
+			passwordEntry.Enable()
+			keyFileEntry.Enable()
+		} else {
+			passwordEntry.Disable()
+			keyFileEntry.Disable()
+		}
+	})
+	formatSelect.PlaceHolder = "Choose the format"
+	passwordEntry.Disable()
+	keyFileEntry.Disable()
+
+	fileEntry.OnChanged = func(path string) {
+		if importer, err := pkg.DetectImporter(strings.TrimSpace(path)); err == nil {
+			formatSelect.SetSelected(importer.Name())
+		}
+	}
+
+	var showOpenStep func()
+	showReviewStep := func(group *pkg.Group) {
+		groups, entries := pkg.CountItems(group)
+		summary := widget.NewLabel(fmt.Sprintf(
+			"'%s' contains %d groups and %d entries.\n\nIt will be imported as a new group into:\n%s\n\n"+
+				"Names that already exist in the vault get a number appended.",
+			group.Name, groups, entries, va.getBreadcrumbText()))
+		summary.Wrapping = fyne.TextWrapWord
+
+		backBtn := widget.NewButton("Back", showOpenStep)
+		importBtn := widget.NewButton("Import", func() {
+			va.recordActivity()
+			renamed, err := va.service.ImportGroup(va.currentPath, group, nil)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("error importing: %v", err), va.mainWindow)
+				return
+			}
+			if err := va.service.Save(); err != nil {
+				dialog.ShowError(fmt.Errorf("error saving: %v", err), va.mainWindow)
+				return
+			}
+			d.Hide()
+			va.refreshTree()
+			message := fmt.Sprintf("Imported %d groups and %d entries into '%s'.", groups, entries, group.Name)
+			if renamed > 0 {
+				message += fmt.Sprintf("\n%d groups or entries were renamed because the name was taken.", renamed)
+			}
+			dialog.ShowInformation("Import Complete", message, va.mainWindow)
+		})
+		importBtn.Importance = widget.HighImportance
+
+		content.Objects = []fyne.CanvasObject{container.NewBorder(
+			widget.NewLabelWithStyle("Step 2 of 2: Review", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			container.NewHBox(layout.NewSpacer(), backBtn, importBtn),
+			nil, nil,
+			summary,
+		)}
+		content.Refresh()
+	}
+
+	showOpenStep = func() {
+		nextBtn := widget.NewButton("Next", func() {
+			va.recordActivity()
+			path := strings.TrimSpace(fileEntry.Text)
+			if path == "" {
+				dialog.ShowError(fmt.Errorf("choose a file to import"), va.mainWindow)
+				return
+			}
+			importer, err := pkg.FindImporter(formatSelect.Selected)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("choose the format of the file"), va.mainWindow)
+				return
+			}
+			var options pkg.ImportOptions
+			if importer.NeedsPassword() {
+				options = pkg.ImportOptions{Password: passwordEntry.Text, KeyFilePath: strings.TrimSpace(keyFileEntry.Text)}
+			}
+			group, err := importer.Import(path, options)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("error reading file: %v", err), va.mainWindow)
+				return
+			}
+			showReviewStep(group)
+		})
+		nextBtn.Importance = widget.HighImportance
+
+		form := widget.NewForm(
+			widget.NewFormItem("File", filePicker),
+			widget.NewFormItem("Format", formatSelect),
+			widget.NewFormItem("Password", passwordEntry),
+			widget.NewFormItem("Keyfile", keyFilePicker),
+		)
+		browserBtn := widget.NewButton("Browser Passwords...", func() {
+			d.Hide()
+			va.showBrowserImportDialog()
+		})
+		bundleBtn := widget.NewButton("Shared Bundle...", func() {
+			d.Hide()
+			va.showImportBundleDialog()
+		})
+
+		content.Objects = []fyne.CanvasObject{container.NewBorder(
+			widget.NewLabelWithStyle("Step 1 of 2: Open the file", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			container.NewHBox(browserBtn, bundleBtn, layout.NewSpacer(), nextBtn),
+			nil, nil,
+			container.NewVBox(form),
+		)}
+		content.Refresh()
+	}
+
+	showOpenStep()
+	d = dialog.NewCustom("Import", "Cancel", va.watched(content), va.mainWindow)
+	d.Resize(fyne.NewSize(600, 350))
+	d.Show()
+}
+
+// showBrowserImportDialog imports the logins exported by Chrome, Firefox or
+// Safari into a chosen group and reports what was created, merged and skipped
+func (va *VaultApp) showBrowserImportDialog() {
+	va.recordActivity()
+
+	fileEntry, filePicker := va.newKeyFilePicker("Password CSV exported by Chrome, Firefox or Safari", false)
+
+	var groupNames []string
+	groupPaths := make(map[string]pkg.Path)
+	va.service.TraverseForward(func(info pkg.PathInfo) bool {
+		if !info.IsEntry {
+			if name, err := va.service.FormatPath(info.Path); err == nil {
+				groupNames = append(groupNames, name)
+				groupPaths[name] = info.Path
+			}
+		}
+		return true
+	})
+	groupSelect := widget.NewSelect(groupNames, nil)
+	groupSelect.PlaceHolder = "Choose the target group"
+	if current, err := va.service.FormatPath(va.currentPath); err == nil && len(va.currentPath.GroupIDs) > 0 {
+		groupSelect.SetSelected(current)
+	}
+
+	d := dialog.NewForm("Import Browser Passwords", "Import", "Cancel", va.watchedItems([]*widget.FormItem{
+		widget.NewFormItem("File", filePicker),
+		widget.NewFormItem("Target group", groupSelect),
+	}), func(ok bool) {
+		if !ok {
+			return
+		}
+		va.recordActivity()
+
+		target, found := groupPaths[groupSelect.Selected]
+		if !found {
+			dialog.ShowError(fmt.Errorf("choose a group to import the logins into"), va.mainWindow)
+			return
+		}
+		entries, err := pkg.ReadBrowserCSV(strings.TrimSpace(fileEntry.Text))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error reading file: %v", err), va.mainWindow)
+			return
+		}
+		summary, err := va.service.ImportLogins(target, entries)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error importing: %v", err), va.mainWindow)
+		}
+		if err := va.service.Save(); err != nil {
+			dialog.ShowError(fmt.Errorf("error saving: %v", err), va.mainWindow)
+			return
+		}
+		va.refreshTree()
+		va.showImportSummary(summary)
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(600, 250))
+	d.Show()
+}
+
+// showImportSummary lists the created, merged and skipped entries of an import
+func (va *VaultApp) showImportSummary(summary pkg.ImportSummary) {
+	list := container.NewVBox()
+	addSection := func(heading string, titles []string) {
+		list.Add(widget.NewLabelWithStyle(fmt.Sprintf("%s: %d", heading, len(titles)), fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+		for _, title := range titles {
+			list.Add(widget.NewLabel("  " + title))
+		}
+	}
+	addSection("Created", summary.Created)
+	addSection("Merged into existing entries", summary.Merged)
+	addSection("Skipped as duplicates", summary.Skipped)
+
+	d := dialog.NewCustom("Import Summary", "Close", va.watched(container.NewVScroll(list)), va.mainWindow)
+	d.Resize(fyne.NewSize(450, 400))
+	d.Show()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+// newKeyFilePicker returns an entry for the keyfile path with a button to
+// browse for it and, when creating a vault, one to generate a new keyfile
+func (va *VaultApp) newKeyFilePicker(placeholder string, allowGenerate bool) (*widget.Entry, fyne.CanvasObject) {
+	pathEntry := widget.NewEntry()
+	pathEntry.SetPlaceHolder(placeholder)
+
+	browseBtn := widget.NewButton("Browse...", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+			pathEntry.SetText(reader.URI().Path())
+		}, va.mainWindow)
+	})
+	buttons := container.NewHBox(browseBtn)
+
+	if allowGenerate {
+		generateBtn := widget.NewButton("Generate...", func() {
+			dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil || writer == nil {
+					return
+				}
+				if err := pkg.WriteKeyFile(writer); err != nil {
+					writer.Close()
+					dialog.ShowError(fmt.Errorf("error generating keyfile: %v", err), va.mainWindow)
+					return
+				}
+				if err := writer.Close(); err != nil {
+					dialog.ShowError(fmt.Errorf("error generating keyfile: %v", err), va.mainWindow)
+					return
+				}
+				pathEntry.SetText(writer.URI().Path())
+				dialog.ShowInformation("Keyfile Generated",
+					"Keep a backup of the keyfile, the vault cannot be opened without it.", va.mainWindow)
+			}, va.mainWindow)
+		})
+		buttons.Add(generateBtn)
+	}
+
+	return pathEntry, container.NewBorder(nil, nil, nil, buttons, pathEntry)
+}
+
+// newServiceWithKeyFile creates a wallet service for the password and the
+// keyfile at path, if one was chosen
+func (va *VaultApp) newServiceWithKeyFile(password string, path string) (*pkg.WalletService, error) {
+	service := pkg.NewWalletServiceWithStorage(va.storage, va.filepath, password)
+	path = strings.TrimSpace(path)
+	if path != "" {
+		if err := service.SetKeyFile(path); err != nil {
+			service.Close()
+			return nil, err
+		}
+	}
+	va.keyFilePath = path
+	return service, nil
+}
@@ -17,11 +17,15 @@ import (
 	"safe-wallet-go/pkg"
 )
 
+// maskedValue is shown in place of sealed field values
+const maskedValue = "••••••••"
+
 // VaultApp is the main application structure
 type VaultApp struct {
 	app         fyne.App
 	mainWindow  fyne.Window
 	service     *pkg.WalletService
+	storage     pkg.Storage
 	filepath    string
 	currentPath pkg.Path
 
@@ -31,6 +35,15 @@ type VaultApp struct {
 	searchEntry  *widget.Entry
 	statusLabel  *widget.Label
 	breadcrumbs  *widget.Label
+
+	// Clipboard
+	clipboardGuard     *pkg.ClipboardGuard
+	clipboardCountdown bool
+
+	// Auto-lock
+	lastActivity time.Time
+	// keyFilePath is the keyfile used for the last unlock, offered again after locking
+	keyFilePath string
 }
 
 func NewVaultApp() *VaultApp {
@@ -39,6 +52,7 @@ func NewVaultApp() *VaultApp {
 
 	return &VaultApp{
 		app:         myApp,
+		storage:     pkg.FileStorage{},
 		filepath:    "wallet.dat",
 		currentPath: pkg.Path{GroupIDs: []string{}},
 	}
@@ -49,8 +63,17 @@ func (va *VaultApp) Run() {
 	va.mainWindow.Resize(fyne.NewSize(1200, 700))
 	va.mainWindow.CenterOnScreen()
 
+	va.setupClipboard()
+	va.mainWindow.SetOnClosed(func() {
+		va.clipboardGuard.Clear()
+		if va.service != nil {
+			va.service.Close()
+		}
+	})
+	va.setupAutoLock()
+
 	// Show unlock screen first
-	va.showUnlockScreen()
+	va.connectStorage("", va.showUnlockScreen)
 
 	va.mainWindow.ShowAndRun()
 }
@@ -62,7 +85,7 @@ func (va *VaultApp) showUnlockScreen() {
 
 	var content *fyne.Container
 
-	if !pkg.WalletExists(va.filepath) {
+	if !pkg.WalletExistsIn(va.storage, va.filepath) {
 		// Create new wallet
 		subtitle := widget.NewLabel("Create a new vault")
 		subtitle.Alignment = fyne.TextAlignCenter
@@ -73,6 +96,8 @@ func (va *VaultApp) showUnlockScreen() {
 		confirmEntry := widget.NewPasswordEntry()
 		confirmEntry.SetPlaceHolder("Confirm Password")
 
+		keyFileEntry, keyFilePicker := va.newKeyFilePicker("Keyfile (optional)", true)
+
 		createVault := func() {
 			if passwordEntry.Text == "" {
 				dialog.ShowError(fmt.Errorf("password cannot be empty"), va.mainWindow)
@@ -84,19 +109,29 @@ func (va *VaultApp) showUnlockScreen() {
 				return
 			}
 
-			va.service = pkg.NewWalletService(va.filepath, passwordEntry.Text)
-			if err := va.service.CreateNew(); err != nil {
+			service, err := va.newServiceWithKeyFile(passwordEntry.Text, keyFileEntry.Text)
+			if err != nil {
+				dialog.ShowError(err, va.mainWindow)
+				return
+			}
+			if err := service.CreateNew(); err != nil {
+				service.Close()
 				dialog.ShowError(fmt.Errorf("failed to create wallet: %v", err), va.mainWindow)
 				return
 			}
+			va.service = service
 
-			dialog.ShowInformation("Success", "Wallet created successfully!", va.mainWindow)
 			va.showMainInterface()
+			va.showRecoverySheetDialog(service.TakeRecoveryKey())
+			dialog.ShowInformation("Success", "Wallet created successfully!\n\nKeep the recovery kit somewhere safe, it unlocks the vault if you forget the password.", va.mainWindow)
 		}
 
 		createBtn := widget.NewButton("Create Vault", createVault)
 		createBtn.Importance = widget.HighImportance
 
+		storageBtn := widget.NewButton("Vault Storage...", va.showStorageDialog)
+		storageBtn.Importance = widget.LowImportance
+
 		// Allow Enter key to submit
 		passwordEntry.OnSubmitted = func(s string) {
 			confirmEntry.FocusGained()
@@ -114,7 +149,9 @@ func (va *VaultApp) showUnlockScreen() {
 					widget.NewSeparator(),
 					passwordEntry,
 					confirmEntry,
+					keyFilePicker,
 					createBtn,
+					storageBtn,
 				),
 			),
 			layout.NewSpacer(),
@@ -130,17 +167,37 @@ func (va *VaultApp) showUnlockScreen() {
 		passwordEntry := widget.NewPasswordEntry()
 		passwordEntry.SetPlaceHolder("Master Password")
 
+		// Only ask for a keyfile if a key slot uses one
+		form := container.NewVBox(passwordEntry)
+		keyFileEntry := widget.NewEntry()
+		if header, err := pkg.ReadWalletHeaderFrom(va.storage, va.filepath); err == nil && header.UsesKeyFile() {
+			placeholder := "Keyfile"
+			if !header.RequiresKeyFile() {
+				placeholder = "Keyfile (if your password uses one)"
+			}
+			var keyFilePicker fyne.CanvasObject
+			keyFileEntry, keyFilePicker = va.newKeyFilePicker(placeholder, false)
+			keyFileEntry.SetText(va.keyFilePath)
+			form.Add(keyFilePicker)
+		}
+
 		unlockVault := func() {
 			if passwordEntry.Text == "" {
 				dialog.ShowError(fmt.Errorf("password cannot be empty"), va.mainWindow)
 				return
 			}
 
-			va.service = pkg.NewWalletService(va.filepath, passwordEntry.Text)
-			if err := va.service.Load(); err != nil {
+			service, err := va.newServiceWithKeyFile(passwordEntry.Text, keyFileEntry.Text)
+			if err != nil {
+				dialog.ShowError(err, va.mainWindow)
+				return
+			}
+			if err := service.Load(); err != nil {
+				service.Close()
 				dialog.ShowError(fmt.Errorf("failed to load wallet: %v", err), va.mainWindow)
 				return
 			}
+			va.service = service
 
 			va.showMainInterface()
 		}
@@ -148,6 +205,18 @@ func (va *VaultApp) showUnlockScreen() {
 		unlockBtn := widget.NewButton("Unlock Vault", unlockVault)
 		unlockBtn.Importance = widget.HighImportance
 
+		recoveryBtn := widget.NewButton("Use Recovery Key", va.showRecoveryUnlockDialog)
+		recoveryBtn.Importance = widget.LowImportance
+
+		sharesBtn := widget.NewButton("Use Key Shares", va.showSharesUnlockDialog)
+		sharesBtn.Importance = widget.LowImportance
+
+		identityBtn := widget.NewButton("Use Identity File", va.showIdentityUnlockDialog)
+		identityBtn.Importance = widget.LowImportance
+
+		storageBtn := widget.NewButton("Vault Storage...", va.showStorageDialog)
+		storageBtn.Importance = widget.LowImportance
+
 		// Allow Enter key to submit
 		passwordEntry.OnSubmitted = func(s string) {
 			unlockVault()
@@ -160,8 +229,10 @@ func (va *VaultApp) showUnlockScreen() {
 					title,
 					subtitle,
 					widget.NewSeparator(),
-					passwordEntry,
+					form,
 					unlockBtn,
+					container.NewGridWithColumns(3, recoveryBtn, sharesBtn, identityBtn),
+					storageBtn,
 				),
 			),
 			layout.NewSpacer(),
@@ -175,6 +246,8 @@ func (va *VaultApp) showUnlockScreen() {
 }
 
 func (va *VaultApp) showMainInterface() {
+	va.recordActivity()
+
 	// Create toolbar
 	toolbar := va.createToolbar()
 
@@ -214,7 +287,7 @@ func (va *VaultApp) showMainInterface() {
 		split,
 	)
 
-	va.mainWindow.SetContent(content)
+	va.mainWindow.SetContent(va.watched(content))
 }
 
 func (va *VaultApp) createToolbar() *widget.Toolbar {
@@ -232,10 +305,22 @@ func (va *VaultApp) createToolbar() *widget.Toolbar {
 		widget.NewToolbarAction(theme.ViewRefreshIcon(), func() {
 			va.refreshTree()
 		}),
+		widget.NewToolbarAction(theme.DownloadIcon(), func() {
+			va.showImportWizard()
+		}),
+		widget.NewToolbarAction(theme.UploadIcon(), func() {
+			va.showExportDialog()
+		}),
 		widget.NewToolbarSeparator(),
 		widget.NewToolbarAction(theme.SearchIcon(), func() {
 			va.showSearchDialog()
 		}),
+		widget.NewToolbarAction(theme.SettingsIcon(), func() {
+			va.showSettingsDialog()
+		}),
+		widget.NewToolbarAction(theme.AccountIcon(), func() {
+			va.showSecurityDialog()
+		}),
 		widget.NewToolbarSpacer(),
 		widget.NewToolbarAction(theme.HomeIcon(), func() {
 			va.currentPath = pkg.Path{GroupIDs: []string{}}
@@ -309,6 +394,7 @@ func (va *VaultApp) createTreeWidget() *widget.Tree {
 	)
 
 	tree.OnSelected = func(uid widget.TreeNodeID) {
+		va.recordActivity()
 		if uid == "" {
 			va.currentPath = pkg.Path{GroupIDs: []string{}}
 			va.showGroupDetails(nil)
@@ -451,8 +537,11 @@ func (va *VaultApp) showGroupDetails(group *pkg.Group) {
 		deleteBtn := widget.NewButtonWithIcon("Delete", theme.DeleteIcon(), func() {
 			va.confirmDeleteGroup()
 		})
+		shareBtn := widget.NewButtonWithIcon("Share", theme.MailSendIcon(), func() {
+			va.showShareGroupDialog()
+		})
 		deleteBtn.Importance = widget.DangerImportance
-		buttons = container.NewHBox(editBtn, deleteBtn)
+		buttons = container.NewHBox(editBtn, shareBtn, deleteBtn)
 	}
 
 	details := container.NewVBox(
@@ -468,6 +557,8 @@ func (va *VaultApp) showGroupDetails(group *pkg.Group) {
 }
 
 func (va *VaultApp) showEntryDetails(entry pkg.Entry, groupPath pkg.Path) {
+	va.recordActivity()
+
 	// Update current path and breadcrumbs when viewing an entry
 	va.currentPath = groupPath
 	va.updateBreadcrumbs()
@@ -483,34 +574,38 @@ func (va *VaultApp) showEntryDetails(entry pkg.Entry, groupPath pkg.Path) {
 
 		var valueWidget fyne.CanvasObject
 
-		if field.Type == pkg.FieldTypePassword || field.Type == pkg.FieldTypePIN {
-			// Use a label instead of entry for better scrolling
-			valueLabel := widget.NewLabel(field.Value)
-			if field.Type == pkg.FieldTypePassword || field.Type == pkg.FieldTypePIN {
-				// Show as dots initially
-				valueLabel.SetText(strings.Repeat("•", len(field.Value)))
-			}
+		if field.Type.IsSensitive() {
+			// The value stays sealed until it is shown or copied
+			valueLabel := widget.NewLabel(maskedValue)
 
-			showBtn := widget.NewButtonWithIcon("", theme.VisibilityIcon(), func(lbl *widget.Label, val string, isHidden *bool) func() {
+			showBtn := widget.NewButtonWithIcon("", theme.VisibilityIcon(), func(lbl *widget.Label, field pkg.EntryField) func() {
 				hidden := true
-				isHidden = &hidden
 				return func() {
-					if *isHidden {
-						lbl.SetText(val)
-						*isHidden = false
-					} else {
-						lbl.SetText(strings.Repeat("•", len(val)))
-						*isHidden = true
+					if !hidden {
+						lbl.SetText(maskedValue)
+						hidden = true
+						return
+					}
+					value, err := va.service.FieldValue(field)
+					if err != nil {
+						dialog.ShowError(err, va.mainWindow)
+						return
 					}
+					lbl.SetText(value)
+					hidden = false
 				}
-			}(valueLabel, field.Value, nil))
+			}(valueLabel, field))
 
-			copyBtn := widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func(val string, name string) func() {
+			copyBtn := widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func(field pkg.EntryField) func() {
 				return func() {
-					va.mainWindow.Clipboard().SetContent(val)
-					dialog.ShowInformation("Copied", name+" copied to clipboard", va.mainWindow)
+					value, err := va.service.FieldValue(field)
+					if err != nil {
+						dialog.ShowError(err, va.mainWindow)
+						return
+					}
+					va.copyToClipboard(field.Name, value)
 				}
-			}(field.Value, field.Name))
+			}(field))
 
 			valueWidget = container.NewBorder(nil, nil, nil,
 				container.NewHBox(showBtn, copyBtn), valueLabel)
@@ -521,8 +616,7 @@ func (va *VaultApp) showEntryDetails(entry pkg.Entry, groupPath pkg.Path) {
 
 			copyBtn := widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func(val string, name string) func() {
 				return func() {
-					va.mainWindow.Clipboard().SetContent(val)
-					dialog.ShowInformation("Copied", name+" copied to clipboard", va.mainWindow)
+					va.copyToClipboard(name, val)
 				}
 			}(field.Value, field.Name))
 
@@ -610,7 +704,7 @@ func (va *VaultApp) showAddGroupDialog() {
 		OnCancel: func() {},
 	}
 
-	d := dialog.NewCustom("Add New Group", "Close", form, va.mainWindow)
+	d := dialog.NewCustom("Add New Group", "Close", va.watched(form), va.mainWindow)
 	d.Resize(fyne.NewSize(400, 200))
 	d.Show()
 }
@@ -708,6 +802,7 @@ func (va *VaultApp) showAddEntryDialog() {
 				}
 			}
 		}
+		watchInput(fieldsContainer, va.recordActivity)
 		fieldsContainer.Refresh()
 	}
 
@@ -729,7 +824,7 @@ func (va *VaultApp) showAddEntryDialog() {
 		scrollFields,
 	)
 
-	d := dialog.NewCustomConfirm("Add New Entry", "Create", "Cancel", content, func(ok bool) {
+	d := dialog.NewCustomConfirm("Add New Entry", "Create", "Cancel", va.watched(content), func(ok bool) {
 		if !ok {
 			return
 		}
@@ -797,11 +892,11 @@ func (va *VaultApp) showAddCustomFieldDialog(fields *[]pkg.EntryField, fieldsCon
 		}
 	}
 
-	d := dialog.NewForm("Add Field", "Add", "Cancel", []*widget.FormItem{
+	d := dialog.NewForm("Add Field", "Add", "Cancel", va.watchedItems([]*widget.FormItem{
 		widget.NewFormItem("Name*", nameEntry),
 		widget.NewFormItem("Value*", valueEntry),
 		widget.NewFormItem("Type", typeSelect),
-	}, func(ok bool) {
+	}), func(ok bool) {
 		if !ok {
 			return
 		}
@@ -940,7 +1035,7 @@ func (va *VaultApp) showEditGroupDialog(group pkg.Group) {
 		OnCancel: func() {},
 	}
 
-	d := dialog.NewCustom("Edit Group", "Close", form, va.mainWindow)
+	d := dialog.NewCustom("Edit Group", "Close", va.watched(form), va.mainWindow)
 	d.Resize(fyne.NewSize(400, 200))
 	d.Show()
 }
@@ -949,9 +1044,13 @@ func (va *VaultApp) showEditEntryDialog(entry pkg.Entry, groupPath pkg.Path) {
 	titleEntry := widget.NewEntry()
 	titleEntry.SetText(entry.Title)
 
+	// Sealed values are revealed for editing, saving seals them again
+	editedFields, err := va.service.RevealFields(entry.Fields)
+	if err != nil {
+		dialog.ShowError(err, va.mainWindow)
+		return
+	}
 	fieldsContainer := container.NewVBox()
-	editedFields := make([]pkg.EntryField, len(entry.Fields))
-	copy(editedFields, entry.Fields)
 
 	// Store the original entry ID
 	originalEntryID := entry.ID
@@ -1039,6 +1138,7 @@ func (va *VaultApp) showEditEntryDialog(entry pkg.Entry, groupPath pkg.Path) {
 
 			fieldsContainer.Add(fieldBox)
 		}
+		watchInput(fieldsContainer, va.recordActivity)
 		fieldsContainer.Refresh()
 	}
 
@@ -1067,7 +1167,7 @@ func (va *VaultApp) showEditEntryDialog(entry pkg.Entry, groupPath pkg.Path) {
 		scrollFields,
 	)
 
-	d := dialog.NewCustomConfirm("Edit Entry", "Save", "Cancel", content, func(ok bool) {
+	d := dialog.NewCustomConfirm("Edit Entry", "Save", "Cancel", va.watched(content), func(ok bool) {
 		if !ok {
 			return
 		}
@@ -1198,30 +1298,12 @@ func (va *VaultApp) showSearchDialog() {
 		}
 
 		searchResults = nil
-		searchTerm := strings.ToLower(s)
-
-		va.service.TraverseForward(func(info pkg.PathInfo) bool {
-			if info.IsEntry && info.Entry != nil {
-				if strings.Contains(strings.ToLower(info.Entry.Title), searchTerm) {
-					searchResults = append(searchResults, struct {
-						entry pkg.Entry
-						path  pkg.Path
-					}{*info.Entry, info.Path})
-					return true
-				}
-				for _, field := range info.Entry.Fields {
-					if strings.Contains(strings.ToLower(field.Name), searchTerm) ||
-						strings.Contains(strings.ToLower(field.Value), searchTerm) {
-						searchResults = append(searchResults, struct {
-							entry pkg.Entry
-							path  pkg.Path
-						}{*info.Entry, info.Path})
-						return true
-					}
-				}
-			}
-			return true
-		})
+		for _, info := range va.service.SearchEntries(s) {
+			searchResults = append(searchResults, struct {
+				entry pkg.Entry
+				path  pkg.Path
+			}{*info.Entry, info.Path})
+		}
 
 		resultsList.Length = func() int { return len(searchResults) }
 		resultsList.UpdateItem = func(id widget.ListItemID, obj fyne.CanvasObject) {
@@ -1284,7 +1366,7 @@ func (va *VaultApp) showSearchDialog() {
 		resultsList,
 	)
 
-	currentDialog = dialog.NewCustom("Search", "Close", content, va.mainWindow)
+	currentDialog = dialog.NewCustom("Search", "Close", va.watched(content), va.mainWindow)
 	currentDialog.Resize(fyne.NewSize(600, 500))
 	currentDialog.Show()
 }
@@ -1321,9 +1403,7 @@ func (va *VaultApp) lockVault() {
 		"Are you sure you want to lock the vault?",
 		func(ok bool) {
 			if ok {
-				va.service = nil
-				va.currentPath = pkg.Path{GroupIDs: []string{}}
-				va.showUnlockScreen()
+				va.lock()
 			}
 		}, va.mainWindow)
 }
@@ -1354,6 +1434,7 @@ func (va *VaultApp) navigateBack() {
 }
 
 func (va *VaultApp) refreshTree() {
+	va.recordActivity()
 	va.treeWidget.Refresh()
 	va.updateBreadcrumbs()
 	va.updateStatus()
@@ -1399,8 +1480,7 @@ func (va *VaultApp) getBreadcrumbText() string {
 }
 
 func (va *VaultApp) getStatusText() string {
-	wallet := va.service.GetWallet()
-	if wallet == nil {
+	if va.service == nil || va.service.GetWallet() == nil {
 		return "No wallet loaded"
 	}
 
@@ -1416,7 +1496,7 @@ func (va *VaultApp) getStatusText() string {
 		return true
 	})
 
-	return fmt.Sprintf("Vault unlocked | Groups: %d | Entries: %d", totalGroups, totalEntries)
+	return fmt.Sprintf("Vault unlocked | Groups: %d | Entries: %d", totalGroups, totalEntries) + va.getStorageStatusText() + va.getClipboardStatusText()
 }
 
 func generatePassword(length int) string {
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+// showIdentityUnlockDialog unlocks the vault with an age identity file
+func (va *VaultApp) showIdentityUnlockDialog() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		path := reader.URI().Path()
+		reader.Close()
+
+		service := pkg.NewWalletServiceWithStorage(va.storage, va.filepath, "")
+		if err := service.UnlockWithIdentityFile(path); err != nil {
+			service.Close()
+			dialog.ShowError(fmt.Errorf("failed to unlock wallet: %v", err), va.mainWindow)
+			return
+		}
+		va.service = service
+		va.keyFilePath = ""
+		va.showMainInterface()
+	}, va.mainWindow)
+}
+
+// showAddRecipientDialog adds a slot for an age recipient, either pasted or
+// generated together with a new identity file
+func (va *VaultApp) showAddRecipientDialog() {
+	labelEntry := widget.NewEntry()
+	labelEntry.SetPlaceHolder("e.g. Alice's laptop")
+	recipientEntry := widget.NewEntry()
+	recipientEntry.SetPlaceHolder("age1...")
+
+	generateBtn := widget.NewButton("Generate...", func() {
+		dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			recipient, err := pkg.WriteIdentity(writer)
+			if err != nil {
+				writer.Close()
+				dialog.ShowError(fmt.Errorf("error generating identity file: %v", err), va.mainWindow)
+				return
+			}
+			if err := writer.Close(); err != nil {
+				dialog.ShowError(fmt.Errorf("error generating identity file: %v", err), va.mainWindow)
+				return
+			}
+			recipientEntry.SetText(recipient)
+			dialog.ShowInformation("Identity File Generated",
+				"Hand the identity file to the recipient over a secure channel.", va.mainWindow)
+		}, va.mainWindow)
+	})
+	recipientField := container.NewBorder(nil, nil, nil, generateBtn, recipientEntry)
+
+	d := dialog.NewForm("Add Recipient", "Add", "Cancel", va.watchedItems([]*widget.FormItem{
+		widget.NewFormItem("Label", labelEntry),
+		widget.NewFormItem("Recipient", recipientField),
+	}), func(ok bool) {
+		if !ok {
+			return
+		}
+		va.recordActivity()
+
+		if _, err := va.service.AddRecipientSlot(labelEntry.Text, recipientEntry.Text); err != nil {
+			dialog.ShowError(fmt.Errorf("error adding recipient: %v", err), va.mainWindow)
+			return
+		}
+		va.showSlotsDialog()
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(650, 250))
+	d.Show()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+// showRecoverySheetDialog shows the printable recovery sheet with a button
+// to save it as a text file
+func (va *VaultApp) showRecoverySheetDialog(recoveryKey string) {
+	sheet := pkg.RecoverySheet(filepath.Base(va.filepath), recoveryKey, time.Now())
+
+	sheetLabel := widget.NewLabel(sheet)
+	sheetLabel.TextStyle = fyne.TextStyle{Monospace: true}
+
+	saveBtn := widget.NewButton("Save for Printing...", func() {
+		saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			if _, err := writer.Write([]byte(sheet)); err != nil {
+				writer.Close()
+				dialog.ShowError(fmt.Errorf("error saving recovery sheet: %v", err), va.mainWindow)
+				return
+			}
+			if err := writer.Close(); err != nil {
+				dialog.ShowError(fmt.Errorf("error saving recovery sheet: %v", err), va.mainWindow)
+				return
+			}
+			dialog.ShowInformation("Saved", "Print the recovery sheet and delete the file.", va.mainWindow)
+		}, va.mainWindow)
+		saveDialog.SetFileName("recovery-kit.txt")
+		saveDialog.Show()
+	})
+
+	content := container.NewBorder(nil, saveBtn, nil, nil, container.NewScroll(sheetLabel))
+
+	d := dialog.NewCustom("Recovery Kit", "Done", va.watched(content), va.mainWindow)
+	d.Resize(fyne.NewSize(700, 550))
+	d.Show()
+}
+
+// showRecoveryUnlockDialog unlocks the vault with the recovery key
+func (va *VaultApp) showRecoveryUnlockDialog() {
+	keyEntry := widget.NewPasswordEntry()
+	keyEntry.SetPlaceHolder("XXXXX-XXXXX-...")
+
+	d := dialog.NewForm("Use Recovery Key", "Unlock", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("Recovery key", keyEntry),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		service := pkg.NewWalletServiceWithStorage(va.storage, va.filepath, "")
+		if err := service.UnlockWithRecoveryKey(keyEntry.Text); err != nil {
+			service.Close()
+			dialog.ShowError(fmt.Errorf("failed to unlock wallet: %v", err), va.mainWindow)
+			return
+		}
+		va.service = service
+		va.keyFilePath = ""
+
+		va.showMainInterface()
+		dialog.ShowConfirm("Unlocked with Recovery Key",
+			"Add a new password slot now? Afterwards, generate a new recovery kit from the Security dialog.",
+			func(ok bool) {
+				if ok {
+					va.showAddSlotDialog()
+				}
+			}, va.mainWindow)
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(600, 200))
+	d.Show()
+}
+
+// rotateRecoveryKey replaces the recovery key after confirmation and shows the new sheet
+func (va *VaultApp) rotateRecoveryKey() {
+	rotate := func() {
+		recoveryKey, err := va.service.RotateRecoveryKey()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error generating recovery key: %v", err), va.mainWindow)
+			return
+		}
+		va.showRecoverySheetDialog(recoveryKey)
+	}
+
+	if !va.service.HasRecoveryKey() {
+		rotate()
+		return
+	}
+	dialog.ShowConfirm("New Recovery Kit",
+		"A new recovery kit revokes the current recovery key. Continue?",
+		func(ok bool) {
+			if ok {
+				rotate()
+			}
+		}, va.mainWindow)
+}
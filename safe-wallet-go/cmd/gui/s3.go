@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+const (
+	// s3EndpointPreference stores the URL of the S3-compatible service
+	s3EndpointPreference  = "s3Endpoint"
+	s3RegionPreference    = "s3Region"
+	s3BucketPreference    = "s3Bucket"
+	s3PrefixPreference    = "s3Prefix"
+	s3AccessKeyPreference = "s3AccessKey"
+)
+
+// The S3 keys are read from the variables the AWS tools use, as for the
+// CLI. The secret key is otherwise asked for when the vault is opened; it
+// is never saved.
+const (
+	s3AccessKeyEnv = "AWS_ACCESS_KEY_ID"
+	s3SecretKeyEnv = "AWS_SECRET_ACCESS_KEY"
+)
+
+// s3AccessKey returns the access key in the preferences, or the one in the
+// environment if none is set
+func s3AccessKey(prefs fyne.Preferences) string {
+	if accessKey := prefs.String(s3AccessKeyPreference); accessKey != "" {
+		return accessKey
+	}
+	return os.Getenv(s3AccessKeyEnv)
+}
+
+// newS3Storage returns the storage for the S3 bucket in the preferences,
+// signing with the secret key
+func newS3Storage(prefs fyne.Preferences, secretKey string) (pkg.Storage, error) {
+	return pkg.NewS3Storage(pkg.S3Config{
+		Endpoint:  prefs.String(s3EndpointPreference),
+		Region:    prefs.String(s3RegionPreference),
+		Bucket:    prefs.String(s3BucketPreference),
+		Prefix:    prefs.String(s3PrefixPreference),
+		AccessKey: s3AccessKey(prefs),
+		SecretKey: secretKey,
+	})
+}
+
+// newS3Form returns the form for the S3 bucket, a function that stores it
+// in the preferences and the entry of the secret key, which is only used
+// until the app quits
+func newS3Form(prefs fyne.Preferences) (*widget.Form, func(), *widget.Entry) {
+	endpointEntry := widget.NewEntry()
+	endpointEntry.SetText(prefs.String(s3EndpointPreference))
+	endpointEntry.SetPlaceHolder("http://localhost:9000")
+	regionEntry := widget.NewEntry()
+	regionEntry.SetText(prefs.String(s3RegionPreference))
+	regionEntry.SetPlaceHolder("us-east-1")
+	bucketEntry := widget.NewEntry()
+	bucketEntry.SetText(prefs.String(s3BucketPreference))
+	prefixEntry := widget.NewEntry()
+	prefixEntry.SetText(prefs.String(s3PrefixPreference))
+	prefixEntry.SetPlaceHolder("Optional, e.g. team/")
+	accessKeyEntry := widget.NewEntry()
+	accessKeyEntry.SetText(prefs.String(s3AccessKeyPreference))
+	accessKeyEntry.SetPlaceHolder("Optional, default " + s3AccessKeyEnv)
+	secretKeyEntry := widget.NewPasswordEntry()
+
+	hint := widget.NewLabel("The secret key is not saved, it is read from " + s3SecretKeyEnv +
+		" or asked for each time the vault is opened. " +
+		"Enable versioning on the bucket to keep every saved version of the vault as a backup.")
+	hint.Wrapping = fyne.TextWrapWord
+
+	form := widget.NewForm(
+		widget.NewFormItem("Endpoint", endpointEntry),
+		widget.NewFormItem("Region", regionEntry),
+		widget.NewFormItem("Bucket", bucketEntry),
+		widget.NewFormItem("Prefix", prefixEntry),
+		widget.NewFormItem("Access key", accessKeyEntry),
+		widget.NewFormItem("Secret key", secretKeyEntry),
+		widget.NewFormItem("", hint),
+	)
+	return form, func() {
+		prefs.SetString(s3EndpointPreference, strings.TrimSpace(endpointEntry.Text))
+		prefs.SetString(s3RegionPreference, strings.TrimSpace(regionEntry.Text))
+		prefs.SetString(s3BucketPreference, strings.TrimSpace(bucketEntry.Text))
+		prefs.SetString(s3PrefixPreference, strings.TrimSpace(prefixEntry.Text))
+		prefs.SetString(s3AccessKeyPreference, strings.TrimSpace(accessKeyEntry.Text))
+	}, secretKeyEntry
+}
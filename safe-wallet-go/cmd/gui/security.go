@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showSecurityDialog offers the operations on the keys that unlock the vault
+func (va *VaultApp) showSecurityDialog() {
+	var d dialog.Dialog
+
+	changePasswordBtn := widget.NewButton("Change Password", func() {
+		d.Hide()
+		va.showChangePasswordDialog()
+	})
+	slotsBtn := widget.NewButton("Unlock Slots", func() {
+		d.Hide()
+		va.showSlotsDialog()
+	})
+	recoveryBtn := widget.NewButton("New Recovery Kit", func() {
+		d.Hide()
+		va.rotateRecoveryKey()
+	})
+	splitBtn := widget.NewButton("Split Into Shares", func() {
+		d.Hide()
+		va.showSplitKeyDialog()
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("Manage how the vault can be unlocked"),
+		changePasswordBtn,
+		slotsBtn,
+		recoveryBtn,
+		splitBtn,
+	)
+
+	d = dialog.NewCustom("Security", "Close", va.watched(content), va.mainWindow)
+	d.Resize(fyne.NewSize(350, 300))
+	d.Show()
+}
+
+// showSlotsDialog lists the key slots with buttons to revoke them or add another
+func (va *VaultApp) showSlotsDialog() {
+	va.recordActivity()
+
+	var d dialog.Dialog
+	slotList := container.NewVBox()
+
+	for _, slot := range va.service.ListSlots() {
+		details := slot.Description() + ", created " + slot.Created.Format("2006-01-02")
+		if slot.ID == va.service.CurrentSlotID() {
+			details += " (unlocked with)"
+		}
+
+		label := widget.NewLabel(slot.Label)
+		label.TextStyle = fyne.TextStyle{Bold: true}
+
+		revokeBtn := widget.NewButton("Revoke", func() {
+			message := fmt.Sprintf("Revoke the key slot '%s'? It will no longer unlock the vault.", slot.Label)
+			if slot.ID == va.service.CurrentSlotID() {
+				message += "\n\nThis is the slot you unlocked with."
+			}
+			dialog.ShowConfirm("Revoke Key Slot", message, func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := va.service.RevokeSlot(slot.ID); err != nil {
+					dialog.ShowError(fmt.Errorf("error revoking slot: %v", err), va.mainWindow)
+					return
+				}
+				d.Hide()
+				va.showSlotsDialog()
+			}, va.mainWindow)
+		})
+		revokeBtn.Importance = widget.DangerImportance
+
+		slotList.Add(container.NewBorder(nil, nil, nil, revokeBtn,
+			container.NewVBox(label, widget.NewLabel(details))))
+		slotList.Add(widget.NewSeparator())
+	}
+
+	addBtn := widget.NewButton("Add Password Slot", func() {
+		d.Hide()
+		va.showAddSlotDialog()
+	})
+	addBtn.Importance = widget.HighImportance
+	addRecipientBtn := widget.NewButton("Add Recipient", func() {
+		d.Hide()
+		va.showAddRecipientDialog()
+	})
+	rotateBtn := widget.NewButton("Rotate Data Key", func() {
+		message := "Encrypt the vault again with a new data key? A key copied with a revoked slot no longer opens it. Other programs that have the vault open must unlock it again."
+		dialog.ShowConfirm("Rotate Data Key", message, func(ok bool) {
+			if !ok {
+				return
+			}
+			va.recordActivity()
+			if err := va.service.RotateDataKey(); err != nil {
+				dialog.ShowError(fmt.Errorf("error rotating the data key: %v", err), va.mainWindow)
+			}
+		}, va.mainWindow)
+	})
+
+	content := container.NewBorder(
+		widget.NewLabel("Each slot unlocks the vault on its own. Changing slots does not re-encrypt the vault."),
+		container.NewGridWithColumns(3, addBtn, addRecipientBtn, rotateBtn), nil, nil,
+		container.NewVScroll(slotList),
+	)
+
+	d = dialog.NewCustom("Unlock Slots", "Close", va.watched(content), va.mainWindow)
+	d.Resize(fyne.NewSize(600, 450))
+	d.Show()
+}
+
+func (va *VaultApp) showAddSlotDialog() {
+	labelEntry := widget.NewEntry()
+	labelEntry.SetPlaceHolder("e.g. Recovery passphrase")
+	passwordEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+	keyFileEntry, keyFilePicker := va.newKeyFilePicker("Keyfile (optional)", true)
+
+	d := dialog.NewForm("Add Password Slot", "Add", "Cancel", va.watchedItems([]*widget.FormItem{
+		widget.NewFormItem("Label", labelEntry),
+		widget.NewFormItem("Password", passwordEntry),
+		widget.NewFormItem("Confirm", confirmEntry),
+		widget.NewFormItem("Keyfile", keyFilePicker),
+	}), func(ok bool) {
+		if !ok {
+			return
+		}
+		va.recordActivity()
+
+		if passwordEntry.Text == "" {
+			dialog.ShowError(fmt.Errorf("password cannot be empty"), va.mainWindow)
+			return
+		}
+		if passwordEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("passwords do not match"), va.mainWindow)
+			return
+		}
+
+		if _, err := va.service.AddPasswordSlot(labelEntry.Text, passwordEntry.Text, keyFileEntry.Text); err != nil {
+			dialog.ShowError(fmt.Errorf("error adding slot: %v", err), va.mainWindow)
+			return
+		}
+		va.showSlotsDialog()
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(500, 300))
+	d.Show()
+}
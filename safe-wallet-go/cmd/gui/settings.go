@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+func (va *VaultApp) showSettingsDialog() {
+	prefs := va.app.Preferences()
+
+	clipboardEntry := widget.NewEntry()
+	clipboardEntry.SetText(strconv.Itoa(prefs.IntWithFallback(clipboardTimeoutPreference, defaultClipboardTimeout)))
+	clipboardEntry.SetPlaceHolder("Seconds, 0 to never clear")
+
+	autoLockEntry := widget.NewEntry()
+	autoLockEntry.SetText(strconv.Itoa(prefs.IntWithFallback(autoLockPreference, defaultAutoLock)))
+	autoLockEntry.SetPlaceHolder("Minutes, 0 to never lock")
+
+	focusLossCheck := widget.NewCheck("Lock when the window loses focus or is minimized", nil)
+	focusLossCheck.SetChecked(prefs.BoolWithFallback(lockOnFocusLossPreference, false))
+
+	storageBtn := widget.NewButton("Vault Storage...", va.showStorageDialog)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Clear clipboard after (s)", clipboardEntry),
+		widget.NewFormItem("Auto-lock after (min)", autoLockEntry),
+		widget.NewFormItem("", focusLossCheck),
+		widget.NewFormItem("Storage", storageBtn),
+	}
+	if _, ok := va.storage.(pkg.VersionedStorage); ok {
+		items = append(items, widget.NewFormItem("Backups", widget.NewButton("Backups...", va.showBackupsDialog)))
+	}
+
+	d := dialog.NewForm("Settings", "Save", "Cancel", va.watchedItems(items), func(ok bool) {
+		if !ok {
+			return
+		}
+
+		clipboardText := strings.TrimSpace(clipboardEntry.Text)
+		if clipboardText == "" || !pkg.IsNumeric(clipboardText) {
+			dialog.ShowError(fmt.Errorf("clipboard timeout must be a number of seconds"), va.mainWindow)
+			return
+		}
+		clipboardSeconds, _ := strconv.Atoi(clipboardText)
+
+		autoLockText := strings.TrimSpace(autoLockEntry.Text)
+		if autoLockText == "" || !pkg.IsNumeric(autoLockText) {
+			dialog.ShowError(fmt.Errorf("auto-lock period must be a number of minutes"), va.mainWindow)
+			return
+		}
+		autoLockMinutes, _ := strconv.Atoi(autoLockText)
+
+		prefs.SetInt(clipboardTimeoutPreference, clipboardSeconds)
+		va.clipboardGuard.SetTimeout(time.Duration(clipboardSeconds) * time.Second)
+		prefs.SetInt(autoLockPreference, autoLockMinutes)
+		prefs.SetBool(lockOnFocusLossPreference, focusLossCheck.Checked)
+		va.recordActivity()
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(450, 250))
+	d.Show()
+}
+
+func (va *VaultApp) showChangePasswordDialog() {
+	currentEntry := widget.NewPasswordEntry()
+	newEntry := widget.NewPasswordEntry()
+	confirmEntry := widget.NewPasswordEntry()
+
+	d := dialog.NewForm("Change Master Password", "Change", "Cancel", va.watchedItems([]*widget.FormItem{
+		widget.NewFormItem("Current password", currentEntry),
+		widget.NewFormItem("New password", newEntry),
+		widget.NewFormItem("Confirm", confirmEntry),
+	}), func(ok bool) {
+		if !ok {
+			return
+		}
+		va.recordActivity()
+
+		if newEntry.Text == "" {
+			dialog.ShowError(fmt.Errorf("password cannot be empty"), va.mainWindow)
+			return
+		}
+		if newEntry.Text != confirmEntry.Text {
+			dialog.ShowError(fmt.Errorf("passwords do not match"), va.mainWindow)
+			return
+		}
+
+		if err := va.service.ChangePassword(currentEntry.Text, newEntry.Text); err != nil {
+			dialog.ShowError(fmt.Errorf("error changing password: %v", err), va.mainWindow)
+			return
+		}
+		dialog.ShowInformation("Password Changed", "The vault now unlocks with the new password.", va.mainWindow)
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(400, 250))
+	d.Show()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+// showSharesUnlockDialog unlocks the vault with K shares, entered one per line
+func (va *VaultApp) showSharesUnlockDialog() {
+	sharesEntry := widget.NewMultiLineEntry()
+	sharesEntry.SetPlaceHolder("One share per line")
+	sharesEntry.Wrapping = fyne.TextWrapOff
+	sharesEntry.SetMinRowsVisible(5)
+
+	statusLabel := widget.NewLabel("Enter the first share")
+
+	var d dialog.Dialog
+	unlockBtn := widget.NewButton("Unlock", nil)
+	unlockBtn.Importance = widget.HighImportance
+	unlockBtn.Disable()
+
+	sharesEntry.OnChanged = func(text string) {
+		shares := splitShares(text)
+		if len(shares) == 0 {
+			statusLabel.SetText("Enter the first share")
+			unlockBtn.Disable()
+			return
+		}
+		threshold, err := pkg.ShareThreshold(shares[0])
+		if err != nil {
+			statusLabel.SetText(fmt.Sprintf("Share 1: %v", err))
+			unlockBtn.Disable()
+			return
+		}
+		statusLabel.SetText(fmt.Sprintf("%d of %d shares entered", len(shares), threshold))
+		if len(shares) >= threshold {
+			unlockBtn.Enable()
+		} else {
+			unlockBtn.Disable()
+		}
+	}
+
+	unlockBtn.OnTapped = func() {
+		service := pkg.NewWalletServiceWithStorage(va.storage, va.filepath, "")
+		if err := service.UnlockWithShares(splitShares(sharesEntry.Text)); err != nil {
+			service.Close()
+			dialog.ShowError(fmt.Errorf("failed to unlock wallet: %v", err), va.mainWindow)
+			return
+		}
+		d.Hide()
+		va.service = service
+		va.keyFilePath = ""
+		va.showMainInterface()
+	}
+
+	content := container.NewBorder(
+		widget.NewLabel("Each keyholder enters their share, any K of them unlock the vault."),
+		container.NewVBox(statusLabel, unlockBtn),
+		nil, nil,
+		sharesEntry,
+	)
+
+	d = dialog.NewCustom("Unlock with Key Shares", "Cancel", content, va.mainWindow)
+	d.Resize(fyne.NewSize(700, 400))
+	d.Show()
+}
+
+// splitShares returns the non-empty lines of the text
+func splitShares(text string) []string {
+	var shares []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			shares = append(shares, line)
+		}
+	}
+	return shares
+}
+
+func (va *VaultApp) showSplitKeyDialog() {
+	sharesEntry := widget.NewEntry()
+	sharesEntry.SetText("5")
+	thresholdEntry := widget.NewEntry()
+	thresholdEntry.SetText("3")
+	labelEntry := widget.NewEntry()
+	labelEntry.SetPlaceHolder("e.g. Break-glass team")
+
+	d := dialog.NewForm("Split Into Shares", "Create", "Cancel", va.watchedItems([]*widget.FormItem{
+		widget.NewFormItem("Number of shares", sharesEntry),
+		widget.NewFormItem("Shares to unlock", thresholdEntry),
+		widget.NewFormItem("Label", labelEntry),
+	}), func(ok bool) {
+		if !ok {
+			return
+		}
+		va.recordActivity()
+
+		n, err := strconv.Atoi(strings.TrimSpace(sharesEntry.Text))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("number of shares must be a number"), va.mainWindow)
+			return
+		}
+		k, err := strconv.Atoi(strings.TrimSpace(thresholdEntry.Text))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("shares to unlock must be a number"), va.mainWindow)
+			return
+		}
+
+		shares, err := va.service.AddShamirSlot(labelEntry.Text, n, k)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error splitting key: %v", err), va.mainWindow)
+			return
+		}
+		va.showSharesDialog(shares, k)
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(450, 250))
+	d.Show()
+}
+
+// showSharesDialog lists new shares, each with a button to save it for its keyholder
+func (va *VaultApp) showSharesDialog(shares []string, threshold int) {
+	list := container.NewVBox()
+	for i, share := range shares {
+		label := widget.NewLabel(fmt.Sprintf("Share %d: %s", i+1, share))
+		label.TextStyle = fyne.TextStyle{Monospace: true}
+
+		number := i + 1
+		saveBtn := widget.NewButton("Save...", func() {
+			saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil || writer == nil {
+					return
+				}
+				text := fmt.Sprintf("Safe Wallet key share %d (%d shares unlock the wallet)\n\n%s\n", number, threshold, share)
+				if _, err := writer.Write([]byte(text)); err != nil {
+					writer.Close()
+					dialog.ShowError(fmt.Errorf("error saving share: %v", err), va.mainWindow)
+					return
+				}
+				if err := writer.Close(); err != nil {
+					dialog.ShowError(fmt.Errorf("error saving share: %v", err), va.mainWindow)
+				}
+			}, va.mainWindow)
+			saveDialog.SetFileName(fmt.Sprintf("share-%d.txt", number))
+			saveDialog.Show()
+		})
+
+		list.Add(container.NewBorder(nil, nil, nil, saveBtn, label))
+	}
+
+	content := container.NewBorder(
+		widget.NewLabel(fmt.Sprintf("Any %d of these shares unlock the vault. Give each to a different person, they are not stored anywhere.", threshold)),
+		nil, nil, nil,
+		container.NewVScroll(list),
+	)
+
+	d := dialog.NewCustom("Key Shares", "Done", va.watched(content), va.mainWindow)
+	d.Resize(fyne.NewSize(900, 450))
+	d.Show()
+}
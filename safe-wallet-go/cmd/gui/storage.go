@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+// storageBackendPreference stores where the vault is kept, one of the
+// backends below
+const storageBackendPreference = "storageBackend"
+
+const (
+	localBackend  = "local"
+	webDAVBackend = "webdav"
+	s3Backend     = "s3"
+)
+
+// storageBackendLabels name the backends in the storage dialog
+var storageBackendLabels = map[string]string{
+	localBackend:  "This computer",
+	webDAVBackend: "WebDAV server",
+	s3Backend:     "S3 bucket",
+}
+
+// storageBackend returns the backend the vault is kept on. Vaults set up
+// before there was a choice are on WebDAV if a URL is stored.
+func storageBackend(prefs fyne.Preferences) string {
+	backend := prefs.String(storageBackendPreference)
+	if backend == "" && prefs.String(webDAVURLPreference) != "" {
+		return webDAVBackend
+	}
+	if backend == "" {
+		return localBackend
+	}
+	return backend
+}
+
+// storageSecret returns what to ask for to open the storage in the
+// preferences, the WebDAV password or the S3 secret key, and the environment
+// variable that may hold it. The prompt is empty if nothing is needed.
+func storageSecret(prefs fyne.Preferences) (prompt string, env string) {
+	switch storageBackend(prefs) {
+	case webDAVBackend:
+		if user := prefs.String(webDAVUserPreference); user != "" {
+			return "WebDAV password for " + user, webDAVPasswordEnv
+		}
+	case s3Backend:
+		if accessKey := s3AccessKey(prefs); accessKey != "" {
+			return "S3 secret key for " + accessKey, s3SecretKeyEnv
+		}
+	}
+	return "", ""
+}
+
+// setupStorage chooses where the vault is kept from the preferences. secret
+// is the WebDAV password or the S3 secret key.
+func (va *VaultApp) setupStorage(secret string) error {
+	prefs := va.app.Preferences()
+	var storage pkg.Storage
+	var err error
+	switch storageBackend(prefs) {
+	case webDAVBackend:
+		storage, err = newWebDAVStorage(prefs, secret)
+	case s3Backend:
+		storage, err = newS3Storage(prefs, secret)
+	default:
+		storage = pkg.FileStorage{}
+	}
+	if err != nil {
+		va.storage = pkg.FileStorage{}
+		return err
+	}
+	va.storage = storage
+	return nil
+}
+
+// connectStorage sets up the storage in the preferences and then calls
+// done. Unless secret is given, the WebDAV password or the S3 secret key is
+// read from the environment or asked for. If that fails the vault on this
+// computer is used.
+func (va *VaultApp) connectStorage(secret string, done func()) {
+	connect := func(secret string) {
+		err := va.setupStorage(secret)
+		done()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error setting up storage, using the local vault: %v", err), va.mainWindow)
+		}
+	}
+
+	prompt, env := storageSecret(va.app.Preferences())
+	if secret == "" && prompt != "" {
+		secret = os.Getenv(env)
+	}
+	if secret != "" || prompt == "" {
+		connect(secret)
+		return
+	}
+
+	secretEntry := widget.NewPasswordEntry()
+	d := dialog.NewForm("Vault Storage", "Connect", "Cancel", va.watchedItems([]*widget.FormItem{
+		widget.NewFormItem(prompt, secretEntry),
+	}), func(ok bool) {
+		if !ok {
+			va.storage = pkg.FileStorage{}
+			done()
+			dialog.ShowInformation("Vault Storage", "No "+prompt+" was given, the vault on this computer is used.", va.mainWindow)
+			return
+		}
+		connect(secretEntry.Text)
+	}, va.mainWindow)
+	d.Resize(fyne.NewSize(450, 150))
+	d.Show()
+	va.mainWindow.Canvas().Focus(secretEntry)
+}
+
+// showStorageDialog chooses where the vault is kept and configures the
+// WebDAV server or S3 bucket
+func (va *VaultApp) showStorageDialog() {
+	prefs := va.app.Preferences()
+
+	webDAVForm, saveWebDAV, webDAVPassword := newWebDAVForm(prefs)
+	s3Form, saveS3, s3SecretKey := newS3Form(prefs)
+	localHint := widget.NewLabel("The vault is kept in a file on this computer.")
+	localHint.Wrapping = fyne.TextWrapWord
+
+	forms := map[string]fyne.CanvasObject{
+		localBackend:  localHint,
+		webDAVBackend: webDAVForm,
+		s3Backend:     s3Form,
+	}
+	backends := []string{localBackend, webDAVBackend, s3Backend}
+	labels := make([]string, len(backends))
+	for i, backend := range backends {
+		labels[i] = storageBackendLabels[backend]
+	}
+
+	selected := storageBackend(prefs)
+	backendRadio := widget.NewRadioGroup(labels, func(label string) {
+		for _, backend := range backends {
+			if storageBackendLabels[backend] == label {
+				selected = backend
+				forms[backend].Show()
+			} else {
+				forms[backend].Hide()
+			}
+		}
+	})
+	backendRadio.Horizontal = true
+	backendRadio.Required = true
+	backendRadio.SetSelected(storageBackendLabels[selected])
+
+	content := container.NewVBox(backendRadio, widget.NewSeparator(), localHint, webDAVForm, s3Form)
+
+	d := dialog.NewCustomConfirm("Vault Storage", "Save", "Cancel", va.watched(content), func(ok bool) {
+		if !ok {
+			return
+		}
+		prefs.SetString(storageBackendPreference, selected)
+		saveWebDAV()
+		saveS3()
+		secrets := map[string]string{webDAVBackend: webDAVPassword.Text, s3Backend: s3SecretKey.Text}
+		va.connectStorage(secrets[selected], func() {
+			if va.service == nil {
+				va.showUnlockScreen()
+			} else {
+				dialog.ShowInformation("Vault Storage", "The storage is used the next time the vault is unlocked.", va.mainWindow)
+			}
+		})
+	}, va.mainWindow)
+
+	d.Resize(fyne.NewSize(600, 450))
+	d.Show()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStorageSecret(t *testing.T) {
+	va := newTestVaultApp(t)
+	prefs := va.app.Preferences()
+	t.Setenv(s3AccessKeyEnv, "")
+
+	tests := []struct {
+		name        string
+		backend     string
+		user        string
+		accessKey   string
+		envKey      string
+		wantPrompt  string
+		wantEnvName string
+	}{
+		{"local", localBackend, "", "", "", "", ""},
+		{"webdav", webDAVBackend, "alice", "", "", "WebDAV password for alice", webDAVPasswordEnv},
+		{"webdav without user", webDAVBackend, "", "", "", "", ""},
+		{"s3", s3Backend, "", "AKIAEXAMPLE", "", "S3 secret key for AKIAEXAMPLE", s3SecretKeyEnv},
+		{"s3 access key from the environment", s3Backend, "", "", "AKIAENV", "S3 secret key for AKIAENV", s3SecretKeyEnv},
+		{"s3 without access key", s3Backend, "", "", "", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prefs.SetString(storageBackendPreference, test.backend)
+			prefs.SetString(webDAVUserPreference, test.user)
+			prefs.SetString(s3AccessKeyPreference, test.accessKey)
+			t.Setenv(s3AccessKeyEnv, test.envKey)
+
+			prompt, env := storageSecret(prefs)
+			if prompt != test.wantPrompt || env != test.wantEnvName {
+				t.Errorf("storageSecret = %q, %q, want %q, %q", prompt, env, test.wantPrompt, test.wantEnvName)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+
+	"safe-wallet-go/pkg"
+)
+
+const (
+	// webDAVURLPreference stores the WebDAV directory of the vault
+	webDAVURLPreference  = "webDAVURL"
+	webDAVUserPreference = "webDAVUser"
+)
+
+// webDAVPasswordEnv holds the WebDAV password, as for the CLI. Otherwise it
+// is asked for when the vault is opened; it is never saved.
+const webDAVPasswordEnv = "SAFE_WALLET_WEBDAV_PASSWORD"
+
+// newWebDAVStorage returns the storage for the WebDAV directory in the
+// preferences, logging in with the password
+func newWebDAVStorage(prefs fyne.Preferences, password string) (pkg.Storage, error) {
+	var cacheDir string
+	if userCache, err := os.UserCacheDir(); err == nil {
+		cacheDir = filepath.Join(userCache, "safe-wallet", "webdav")
+	}
+	return pkg.NewWebDAVStorage(pkg.WebDAVConfig{
+		URL:      prefs.String(webDAVURLPreference),
+		Username: prefs.String(webDAVUserPreference),
+		Password: password,
+		CacheDir: cacheDir,
+	})
+}
+
+// newWebDAVForm returns the form for the WebDAV server, a function that
+// stores it in the preferences and the entry of the password, which is only
+// used until the app quits
+func newWebDAVForm(prefs fyne.Preferences) (*widget.Form, func(), *widget.Entry) {
+	urlEntry := widget.NewEntry()
+	urlEntry.SetText(prefs.String(webDAVURLPreference))
+	urlEntry.SetPlaceHolder("https://cloud.example.com/remote.php/dav/files/alice/")
+	userEntry := widget.NewEntry()
+	userEntry.SetText(prefs.String(webDAVUserPreference))
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder("App password")
+
+	hint := widget.NewLabel("The password is not saved, it is read from " + webDAVPasswordEnv +
+		" or asked for each time the vault is opened. A copy of the encrypted vault is kept for unlocking it offline.")
+	hint.Wrapping = fyne.TextWrapWord
+
+	form := widget.NewForm(
+		widget.NewFormItem("WebDAV URL", urlEntry),
+		widget.NewFormItem("Username", userEntry),
+		widget.NewFormItem("Password", passwordEntry),
+		widget.NewFormItem("", hint),
+	)
+	return form, func() {
+		prefs.SetString(webDAVURLPreference, strings.TrimSpace(urlEntry.Text))
+		prefs.SetString(webDAVUserPreference, strings.TrimSpace(userEntry.Text))
+	}, passwordEntry
+}
+
+// getStorageStatusText notes in the status bar that the vault came from the
+// offline cache
+func (va *VaultApp) getStorageStatusText() string {
+	if webDAV, ok := va.storage.(*pkg.WebDAVStorage); ok && webDAV.Offline() {
+		return " | Offline copy, changes cannot be saved"
+	}
+	return ""
+}
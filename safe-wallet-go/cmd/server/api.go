@@ -0,0 +1,522 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"safe-wallet-go/pkg"
+)
+
+// maxRequestBody limits the size of request bodies
+const maxRequestBody = 1 << 20
+
+// apiServer serves the wallet over HTTP. WalletService is not safe for
+// concurrent use, so every request holds mu.
+type apiServer struct {
+	mu      sync.Mutex
+	service *pkg.WalletService
+	tokens  []apiToken
+}
+
+// apiPath is a pkg.Path in responses
+type apiPath struct {
+	GroupIDs []string `json:"group_ids"`
+	EntryID  string   `json:"entry_id,omitempty"`
+}
+
+// apiItem is a group or entry in a listing
+type apiItem struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Path   string  `json:"path"`
+	IDPath apiPath `json:"id_path"`
+}
+
+type apiGroup struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	IDPath  apiPath   `json:"id_path"`
+	Groups  []apiItem `json:"groups"`
+	Entries []apiItem `json:"entries"`
+}
+
+type apiEntry struct {
+	ID     string     `json:"id"`
+	Title  string     `json:"title"`
+	Path   string     `json:"path"`
+	IDPath apiPath    `json:"id_path"`
+	Fields []apiField `json:"fields"`
+}
+
+type apiField struct {
+	Name  string        `json:"name"`
+	Value string        `json:"value"`
+	Type  pkg.FieldType `json:"type"`
+}
+
+// apiChange is the body of POST and PUT requests. POST to a group adds the
+// group or entry to it, PUT replaces the group or entry at the path.
+type apiChange struct {
+	Group *struct {
+		Name string `json:"name"`
+	} `json:"group"`
+	Entry *struct {
+		Title  string     `json:"title"`
+		Fields []apiField `json:"fields"`
+	} `json:"entry"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// resolver finds the group or entry a request addresses
+type resolver func(service *pkg.WalletService, r *http.Request) (pkg.Path, error)
+
+func newAPIServer(service *pkg.WalletService, tokens []apiToken) *apiServer {
+	return &apiServer{service: service, tokens: tokens}
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/names/{path...}", s.authorize(s.itemHandler(resolveNamePath)))
+	mux.Handle("/v1/paths/{ids...}", s.authorize(s.itemHandler(resolveIDPath)))
+	mux.Handle("GET /v1/search", s.authorize(http.HandlerFunc(s.handleSearch)))
+	return mux
+}
+
+// authorize lets requests through whose bearer token has the scope of the
+// method: read for GET, write for everything else
+func (s *apiServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		token, found := findToken(s.tokens, strings.TrimSpace(bearer))
+		if !ok || !found {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="safe-wallet"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or unknown bearer token"))
+			return
+		}
+
+		scope := scopeWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = scopeRead
+		}
+		if !token.hasScope(scope) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("token '%s' lacks the %s scope", token.Name, scope))
+			return
+		}
+
+		log.Printf("%s %s %s", token.Name, r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// itemHandler serves the group or entry found by resolve
+func (s *apiServer) itemHandler(resolve resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		unlock, err := s.refresh()
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		defer unlock()
+
+		path, err := resolve(s.service, r)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGet(w, r, path)
+		case http.MethodPost:
+			s.handleCreate(w, r, path)
+		case http.MethodPut:
+			s.handleUpdate(w, r, path)
+		case http.MethodDelete:
+			s.handleDelete(w, path)
+		default:
+			w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		}
+	}
+}
+
+// resolveNamePath resolves a name path like Work/AWS/Console, with '/' in
+// names escaped as '\/'
+func resolveNamePath(service *pkg.WalletService, r *http.Request) (pkg.Path, error) {
+	root := pkg.Path{GroupIDs: []string{}}
+	return service.ResolvePath(root, "/"+r.PathValue("path"))
+}
+
+// resolveIDPath resolves the group IDs of a pkg.Path, optionally followed
+// by the ID of an entry in the last group
+func resolveIDPath(service *pkg.WalletService, r *http.Request) (pkg.Path, error) {
+	ids := []string{}
+	for _, id := range strings.Split(r.PathValue("ids"), "/") {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	wallet := service.GetWallet()
+	path := pkg.Path{GroupIDs: ids}
+	if len(ids) == 0 {
+		return path, nil
+	}
+	if _, err := pkg.FindGroupByPath(wallet, path); err == nil {
+		return path, nil
+	}
+	path = pkg.Path{GroupIDs: ids[:len(ids)-1], EntryID: ids[len(ids)-1]}
+	if _, err := pkg.FindEntryByPath(wallet, path); err == nil {
+		return path, nil
+	}
+	return pkg.Path{}, errors.New("no group or entry at the path")
+}
+
+func (s *apiServer) handleGet(w http.ResponseWriter, r *http.Request, path pkg.Path) {
+	if path.EntryID == "" {
+		if r.URL.Query().Has("field") {
+			writeError(w, http.StatusBadRequest, errors.New("fields can only be read from entries"))
+			return
+		}
+		group, err := s.groupJSON(path)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, group)
+		return
+	}
+
+	entry, err := s.entryJSON(path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if r.URL.Query().Has("field") {
+		name := r.URL.Query().Get("field")
+		for _, field := range entry.Fields {
+			if field.Name == name {
+				writeJSON(w, http.StatusOK, field)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, fmt.Errorf("entry '%s' has no field '%s'", entry.Title, name))
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func (s *apiServer) handleCreate(w http.ResponseWriter, r *http.Request, path pkg.Path) {
+	if path.EntryID != "" {
+		writeError(w, http.StatusBadRequest, errors.New("groups and entries can only be added to a group"))
+		return
+	}
+	change, err := readChange(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var created pkg.Path
+	if change.Group != nil {
+		group := &pkg.Group{Name: strings.TrimSpace(change.Group.Name)}
+		if group.Name == "" {
+			writeError(w, http.StatusBadRequest, errors.New("group name cannot be empty"))
+			return
+		}
+		if err := s.service.AddGroup(path, group); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		created = pkg.Path{GroupIDs: append(append([]string{}, path.GroupIDs...), group.ID)}
+	} else {
+		entry, err := entryFromChange(change)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.service.AddEntry(path, entry); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		created = pkg.Path{GroupIDs: path.GroupIDs, EntryID: entry.ID}
+	}
+
+	if !s.save(w) {
+		return
+	}
+	s.writeItem(w, http.StatusCreated, created)
+}
+
+func (s *apiServer) handleUpdate(w http.ResponseWriter, r *http.Request, path pkg.Path) {
+	change, err := readChange(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if path.EntryID == "" {
+		if change.Group == nil {
+			writeError(w, http.StatusBadRequest, errors.New("the path is a group, send a group"))
+			return
+		}
+		name := strings.TrimSpace(change.Group.Name)
+		if name == "" {
+			writeError(w, http.StatusBadRequest, errors.New("group name cannot be empty"))
+			return
+		}
+		if err := s.service.UpdateGroup(path, pkg.Group{Name: name}); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		if change.Entry == nil {
+			writeError(w, http.StatusBadRequest, errors.New("the path is an entry, send an entry"))
+			return
+		}
+		entry, err := entryFromChange(change)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.service.UpdateEntry(path, *entry); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if !s.save(w) {
+		return
+	}
+	s.writeItem(w, http.StatusOK, path)
+}
+
+func (s *apiServer) handleDelete(w http.ResponseWriter, path pkg.Path) {
+	var err error
+	if path.EntryID == "" {
+		err = s.service.DeleteGroup(path)
+	} else {
+		err = s.service.DeleteEntry(path)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !s.save(w) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSearch lists the entries matching the q parameter
+func (s *apiServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.refresh()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer unlock()
+
+	results := []apiItem{}
+	for _, info := range s.service.SearchEntries(r.URL.Query().Get("q")) {
+		item, err := s.itemJSON(info.Path, info.Entry.ID, info.Entry.Title)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		results = append(results, item)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// refresh takes the storage lock, so that the CLI and the GUI cannot write
+// the wallet while a request is served, and loads the wallet again if they
+// changed it. The returned function releases the lock.
+func (s *apiServer) refresh() (func(), error) {
+	unlock, err := s.service.LockStorage()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.service.Refresh(); err != nil {
+		unlock()
+		return nil, fmt.Errorf("cannot reload the changed wallet: %v", err)
+	}
+	return func() {
+		if err := unlock(); err != nil {
+			log.Printf("Error unlocking the wallet: %v", err)
+		}
+	}, nil
+}
+
+// save saves the wallet, writing an error response if that fails. A change
+// that could not be saved is dropped by loading the wallet again.
+func (s *apiServer) save(w http.ResponseWriter) bool {
+	if err := s.service.Save(); err != nil {
+		if loadErr := s.service.Load(); loadErr != nil {
+			log.Printf("Error reloading the wallet: %v", loadErr)
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, pkg.ErrRemoteChanged) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, fmt.Errorf("error saving wallet: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeItem writes the group or entry at the path
+func (s *apiServer) writeItem(w http.ResponseWriter, status int, path pkg.Path) {
+	var item any
+	var err error
+	if path.EntryID == "" {
+		item, err = s.groupJSON(path)
+	} else {
+		item, err = s.entryJSON(path)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, status, item)
+}
+
+func (s *apiServer) groupJSON(path pkg.Path) (*apiGroup, error) {
+	wallet := s.service.GetWallet()
+	result := &apiGroup{Path: "/", IDPath: toAPIPath(path), Groups: []apiItem{}, Entries: []apiItem{}}
+	groups := wallet.Groups
+	var entries []pkg.Entry
+	if len(path.GroupIDs) > 0 {
+		group, err := pkg.FindGroupByPath(wallet, path)
+		if err != nil {
+			return nil, err
+		}
+		if result.Path, err = s.service.FormatPath(path); err != nil {
+			return nil, err
+		}
+		result.ID, result.Name = group.ID, group.Name
+		groups, entries = group.Groups, group.Entries
+	}
+
+	for _, group := range groups {
+		childPath := pkg.Path{GroupIDs: append(append([]string{}, path.GroupIDs...), group.ID)}
+		item, err := s.itemJSON(childPath, group.ID, group.Name)
+		if err != nil {
+			return nil, err
+		}
+		result.Groups = append(result.Groups, item)
+	}
+	for _, entry := range entries {
+		item, err := s.itemJSON(pkg.Path{GroupIDs: path.GroupIDs, EntryID: entry.ID}, entry.ID, entry.Title)
+		if err != nil {
+			return nil, err
+		}
+		result.Entries = append(result.Entries, item)
+	}
+	return result, nil
+}
+
+func (s *apiServer) entryJSON(path pkg.Path) (*apiEntry, error) {
+	entry, err := pkg.FindEntryByPath(s.service.GetWallet(), path)
+	if err != nil {
+		return nil, err
+	}
+	namePath, err := s.service.FormatPath(path)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := s.service.RevealFields(entry.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &apiEntry{ID: entry.ID, Title: entry.Title, Path: namePath, IDPath: toAPIPath(path), Fields: []apiField{}}
+	for _, field := range fields {
+		result.Fields = append(result.Fields, apiField{Name: field.Name, Value: field.Value, Type: field.Type})
+	}
+	return result, nil
+}
+
+func (s *apiServer) itemJSON(path pkg.Path, id string, name string) (apiItem, error) {
+	namePath, err := s.service.FormatPath(path)
+	if err != nil {
+		return apiItem{}, err
+	}
+	return apiItem{ID: id, Name: name, Path: namePath, IDPath: toAPIPath(path)}, nil
+}
+
+func toAPIPath(path pkg.Path) apiPath {
+	groupIDs := path.GroupIDs
+	if groupIDs == nil {
+		groupIDs = []string{}
+	}
+	return apiPath{GroupIDs: groupIDs, EntryID: path.EntryID}
+}
+
+// readChange decodes the body of a POST or PUT request, which must hold
+// either a group or an entry
+func readChange(w http.ResponseWriter, r *http.Request) (*apiChange, error) {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	var change apiChange
+	if err := decoder.Decode(&change); err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+	if (change.Group == nil) == (change.Entry == nil) {
+		return nil, errors.New(`the body must hold either "group" or "entry"`)
+	}
+	return &change, nil
+}
+
+// entryFromChange builds the entry of a request, checking its fields
+func entryFromChange(change *apiChange) (*pkg.Entry, error) {
+	if change.Entry == nil {
+		return nil, errors.New(`the body must hold an "entry"`)
+	}
+	entry := &pkg.Entry{Title: strings.TrimSpace(change.Entry.Title), Fields: []pkg.EntryField{}}
+	if entry.Title == "" {
+		return nil, errors.New("entry title cannot be empty")
+	}
+	for _, field := range change.Entry.Fields {
+		if field.Name == "" {
+			return nil, errors.New("field name cannot be empty")
+		}
+		switch field.Type {
+		case "":
+			field.Type = pkg.FieldTypeGeneral
+		case pkg.FieldTypeGeneral, pkg.FieldTypePassword:
+		case pkg.FieldTypePIN:
+			if !pkg.IsNumeric(field.Value) {
+				return nil, fmt.Errorf("PIN field '%s' must be numeric", field.Name)
+			}
+		default:
+			return nil, fmt.Errorf("unknown type '%s' of field '%s'", field.Type, field.Name)
+		}
+		entry.Fields = append(entry.Fields, pkg.EntryField{Name: field.Name, Value: field.Value, Type: field.Type})
+	}
+	return entry, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
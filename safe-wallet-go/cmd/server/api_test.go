@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"safe-wallet-go/pkg"
+)
+
+const (
+	readToken  = tokenPrefix + "read"
+	writeToken = tokenPrefix + "write"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testWallet holds the IDs of the test wallet: the group Work with the
+// subgroup a/b, which holds the entry "..", and the entry Mail in Work
+type testWallet struct {
+	work, slashed, dots, mail string
+}
+
+// newTestAPI serves a wallet in memory with a read-only and a read-write token
+func newTestAPI(t *testing.T) (*httptest.Server, testWallet) {
+	t.Helper()
+	service := pkg.NewWalletServiceWithStorage(pkg.NewMemoryStorage(), "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(service.Close)
+
+	var ids testWallet
+	work := &pkg.Group{Name: "Work"}
+	if err := service.AddGroup(pkg.Path{}, work); err != nil {
+		t.Fatal(err)
+	}
+	slashed := &pkg.Group{Name: "a/b"}
+	if err := service.AddGroup(pkg.Path{GroupIDs: []string{work.ID}}, slashed); err != nil {
+		t.Fatal(err)
+	}
+	dots := &pkg.Entry{Title: "..", Fields: []pkg.EntryField{{Name: "Note", Value: "dots", Type: pkg.FieldTypeGeneral}}}
+	if err := service.AddEntry(pkg.Path{GroupIDs: []string{work.ID, slashed.ID}}, dots); err != nil {
+		t.Fatal(err)
+	}
+	mail := &pkg.Entry{Title: "Mail", Fields: []pkg.EntryField{
+		{Name: "Username", Value: "alice", Type: pkg.FieldTypeGeneral},
+		{Name: "Password", Value: "hunter2", Type: pkg.FieldTypePassword},
+	}}
+	if err := service.AddEntry(pkg.Path{GroupIDs: []string{work.ID}}, mail); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+	ids.work, ids.slashed, ids.dots, ids.mail = work.ID, slashed.ID, dots.ID, mail.ID
+
+	tokens := []apiToken{
+		{Name: "reader", Hash: hashToken(readToken), Scopes: []string{scopeRead}},
+		{Name: "writer", Hash: hashToken(writeToken), Scopes: []string{scopeRead, scopeWrite}},
+	}
+	server := httptest.NewServer(newAPIServer(service, tokens).routes())
+	t.Cleanup(server.Close)
+	return server, ids
+}
+
+// request sends a request with the bearer token, if any, and decodes the
+// JSON response into result unless it is nil
+func request(t *testing.T, server *httptest.Server, method, path, token, body string, result any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPIRejectsMissingAndUnknownTokens(t *testing.T) {
+	server, _ := newTestAPI(t)
+	headers := []string{"", "Bearer", "Basic " + readToken, "Bearer " + tokenPrefix + "unknown", "Bearer  "}
+	for _, header := range headers {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/names/Work", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d, want %d", header, resp.StatusCode, http.StatusUnauthorized)
+		}
+		if resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q: no WWW-Authenticate header", header)
+		}
+	}
+}
+
+func TestAPIReadTokenCannotWrite(t *testing.T) {
+	server, _ := newTestAPI(t)
+	requests := []struct{ method, path, body string }{
+		{http.MethodPost, "/v1/names/Work", `{"group": {"name": "New"}}`},
+		{http.MethodPut, "/v1/names/Work/Mail", `{"entry": {"title": "Mail"}}`},
+		{http.MethodDelete, "/v1/names/Work/Mail", ""},
+	}
+	for _, r := range requests {
+		if status := request(t, server, r.method, r.path, readToken, r.body, nil); status != http.StatusForbidden {
+			t.Errorf("%s %s: status %d, want %d", r.method, r.path, status, http.StatusForbidden)
+		}
+	}
+
+	// The entry is still there and readable
+	var entry apiEntry
+	if status := request(t, server, http.MethodGet, "/v1/names/Work/Mail", readToken, "", &entry); status != http.StatusOK {
+		t.Fatalf("GET after the refused writes: status %d", status)
+	}
+	if entry.Title != "Mail" {
+		t.Errorf("title = %q, want Mail", entry.Title)
+	}
+}
+
+func TestAPINamePathResolvesEscapedNames(t *testing.T) {
+	server, ids := newTestAPI(t)
+
+	// a/b is written a\/b and the entry ".." is written \.\. in a name path
+	var entry apiEntry
+	status := request(t, server, http.MethodGet, "/v1/names/Work/a%5C%2Fb/%5C.%5C.", readToken, "", &entry)
+	if status != http.StatusOK {
+		t.Fatalf("status %d, want %d", status, http.StatusOK)
+	}
+	if entry.ID != ids.dots || entry.Title != ".." {
+		t.Errorf("entry = %s %q, want %s %q", entry.ID, entry.Title, ids.dots, "..")
+	}
+	if want := `/Work/a\/b/\.\.`; entry.Path != want {
+		t.Errorf("path = %q, want %q", entry.Path, want)
+	}
+
+	var group apiGroup
+	if status := request(t, server, http.MethodGet, "/v1/names/Work/a%5C%2Fb", readToken, "", &group); status != http.StatusOK {
+		t.Fatalf("group: status %d, want %d", status, http.StatusOK)
+	}
+	if group.ID != ids.slashed || len(group.Entries) != 1 {
+		t.Errorf("group = %+v, want a/b with one entry", group)
+	}
+
+	if status := request(t, server, http.MethodGet, "/v1/names/Work/a/b", readToken, "", nil); status != http.StatusNotFound {
+		t.Errorf("unescaped a/b: status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestAPIIDPathResolvesGroupsAndEntries(t *testing.T) {
+	server, ids := newTestAPI(t)
+
+	var group apiGroup
+	if status := request(t, server, http.MethodGet, "/v1/paths/"+ids.work, readToken, "", &group); status != http.StatusOK {
+		t.Fatalf("group: status %d, want %d", status, http.StatusOK)
+	}
+	if group.Name != "Work" || len(group.Groups) != 1 || len(group.Entries) != 1 {
+		t.Errorf("group = %+v, want Work with a group and an entry", group)
+	}
+
+	var entry apiEntry
+	if status := request(t, server, http.MethodGet, "/v1/paths/"+ids.work+"/"+ids.mail, readToken, "", &entry); status != http.StatusOK {
+		t.Fatalf("entry: status %d, want %d", status, http.StatusOK)
+	}
+	if entry.Title != "Mail" || entry.IDPath.EntryID != ids.mail {
+		t.Errorf("entry = %+v, want Mail", entry)
+	}
+	if len(entry.Fields) != 2 || entry.Fields[1].Value != "hunter2" {
+		t.Errorf("fields = %+v, want the revealed password", entry.Fields)
+	}
+
+	if status := request(t, server, http.MethodGet, "/v1/paths/"+ids.mail, readToken, "", nil); status != http.StatusNotFound {
+		t.Errorf("entry outside its group: status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestAPIField(t *testing.T) {
+	server, ids := newTestAPI(t)
+
+	var field apiField
+	if status := request(t, server, http.MethodGet, "/v1/names/Work/Mail?field=Password", readToken, "", &field); status != http.StatusOK {
+		t.Fatalf("status %d, want %d", status, http.StatusOK)
+	}
+	if field.Value != "hunter2" || field.Type != pkg.FieldTypePassword {
+		t.Errorf("field = %+v, want the password", field)
+	}
+
+	if status := request(t, server, http.MethodGet, "/v1/names/Work/Mail?field=PIN", readToken, "", nil); status != http.StatusNotFound {
+		t.Errorf("missing field: status %d, want %d", status, http.StatusNotFound)
+	}
+	for _, path := range []string{"/v1/names/Work?field=Password", "/v1/paths/" + ids.work + "?field=Password"} {
+		if status := request(t, server, http.MethodGet, path, readToken, "", nil); status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", path, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAPIWrite(t *testing.T) {
+	server, _ := newTestAPI(t)
+
+	var created apiEntry
+	body := `{"entry": {"title": "VPN", "fields": [{"name": "PIN", "value": "1234", "type": "pin"}]}}`
+	if status := request(t, server, http.MethodPost, "/v1/names/Work", writeToken, body, &created); status != http.StatusCreated {
+		t.Fatalf("POST: status %d, want %d", status, http.StatusCreated)
+	}
+	if created.Path != "/Work/VPN" {
+		t.Errorf("path = %q, want /Work/VPN", created.Path)
+	}
+
+	body = `{"entry": {"title": "VPN", "fields": [{"name": "PIN", "value": "12a4", "type": "pin"}]}}`
+	if status := request(t, server, http.MethodPut, "/v1/names/Work/VPN", writeToken, body, nil); status != http.StatusBadRequest {
+		t.Errorf("PUT with a non-numeric PIN: status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	if status := request(t, server, http.MethodDelete, "/v1/names/Work/VPN", writeToken, "", nil); status != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d, want %d", status, http.StatusNoContent)
+	}
+	if status := request(t, server, http.MethodGet, "/v1/names/Work/VPN", writeToken, "", nil); status != http.StatusNotFound {
+		t.Errorf("GET after DELETE: status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestAPINoticesChangesByOtherPrograms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.dat")
+	service := pkg.NewWalletService(path, "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(service.Close)
+	tokens := []apiToken{{Name: "reader", Hash: hashToken(readToken), Scopes: []string{scopeRead}}}
+	server := httptest.NewServer(newAPIServer(service, tokens).routes())
+	t.Cleanup(server.Close)
+	if status := request(t, server, http.MethodGet, "/v1/names/", readToken, "", nil); status != http.StatusOK {
+		t.Fatalf("GET: status %d, want %d", status, http.StatusOK)
+	}
+
+	// Another program adds a group and the file keeps its modification time
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := pkg.NewWalletService(path, "password")
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.AddGroup(pkg.Path{}, &pkg.Group{Name: "Home"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := request(t, server, http.MethodGet, "/v1/names/Home", readToken, "", nil); status != http.StatusOK {
+		t.Errorf("GET of the added group: status %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestAPIHoldsTheStorageLock(t *testing.T) {
+	storage := pkg.NewMemoryStorage()
+	service := pkg.NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(service.Close)
+	tokens := []apiToken{{Name: "reader", Hash: hashToken(readToken), Scopes: []string{scopeRead}}}
+	server := httptest.NewServer(newAPIServer(service, tokens).routes())
+	t.Cleanup(server.Close)
+
+	unlock, err := storage.Lock("wallet.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := request(t, server, http.MethodGet, "/v1/names/", readToken, "", nil); status != http.StatusServiceUnavailable {
+		t.Errorf("GET while another program writes: status %d, want %d", status, http.StatusServiceUnavailable)
+	}
+	unlock()
+	if status := request(t, server, http.MethodGet, "/v1/names/", readToken, "", nil); status != http.StatusOK {
+		t.Errorf("GET after the write: status %d, want %d", status, http.StatusOK)
+	}
+	if _, err := storage.Lock("wallet.dat"); err != nil {
+		t.Errorf("lock kept after the request: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"safe-wallet-go/pkg"
+)
+
+func main() {
+	walletPath := flag.String("wallet", "wallet.dat", "wallet file or sync directory to serve")
+	addr := flag.String("addr", "127.0.0.1:8420", "loopback address and port to listen on")
+	tokensPath := flag.String("tokens", "", "file holding the API tokens (default: the wallet path with .tokens appended)")
+	keyFilePath := flag.String("keyfile", "", "keyfile required in addition to the password")
+	identityPath := flag.String("identity", "", "unlock with an age identity file instead of the password")
+	addTokenName := flag.String("add-token", "", "create a token with this name, print it and exit")
+	scopesFlag := flag.String("scopes", scopeRead, "comma separated scopes of the token created by -add-token: read, write")
+	revokeTokenName := flag.String("revoke-token", "", "revoke the token with this name and exit")
+	listTokensFlag := flag.Bool("list-tokens", false, "list the tokens and exit")
+	flag.Parse()
+
+	if *tokensPath == "" {
+		*tokensPath = *walletPath + ".tokens"
+	}
+
+	switch {
+	case *addTokenName != "":
+		scopes, err := parseScopes(*scopesFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		token, err := addToken(*tokensPath, *addTokenName, scopes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "Token '%s' with scopes %s, shown only once:\n", *addTokenName, strings.Join(scopes, ","))
+		fmt.Println(token)
+		fmt.Fprintln(os.Stderr, "Restart a running server to use it.")
+		return
+	case *revokeTokenName != "":
+		if err := revokeToken(*tokensPath, *revokeTokenName); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Token '%s' revoked. Restart a running server to stop accepting it.\n", *revokeTokenName)
+		return
+	case *listTokensFlag:
+		tokens, err := loadTokens(*tokensPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, t := range tokens {
+			fmt.Printf("%s  %s  created %s\n", t.Name, strings.Join(t.Scopes, ","), t.Created.Local().Format("2006-01-02"))
+		}
+		return
+	}
+
+	if err := checkLoopback(*addr); err != nil {
+		log.Fatal(err)
+	}
+	tokens, err := loadTokens(*tokensPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(tokens) == 0 {
+		log.Fatalf("No API tokens in %s, create one with -add-token <name> -scopes read", *tokensPath)
+	}
+	if !pkg.WalletExists(*walletPath) {
+		log.Fatalf("Wallet %s does not exist, create it with the CLI or the GUI", *walletPath)
+	}
+
+	service, err := openWallet(*walletPath, *keyFilePath, *identityPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer service.Close()
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           newAPIServer(service, tokens).routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	log.Printf("Serving %s on http://%s with %d tokens", *walletPath, *addr, len(tokens))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Print(err)
+		return
+	}
+	log.Print("Wallet locked, server stopped")
+}
+
+// checkLoopback refuses addresses other programs on the network could reach
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %s: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("address %s is not a loopback address, the API only serves this machine", addr)
+}
+
+// openWallet unlocks the wallet with the identity file, or with the password
+// and the keyfile
+func openWallet(walletPath string, keyFile string, identityFile string) (*pkg.WalletService, error) {
+	if identityFile != "" {
+		service := pkg.NewWalletService(walletPath, "")
+		if err := service.UnlockWithIdentityFile(identityFile); err != nil {
+			service.Close()
+			return nil, fmt.Errorf("failed to load wallet: %v", err)
+		}
+		return service, nil
+	}
+
+	header, err := pkg.ReadWalletHeader(walletPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load wallet: %v", err)
+	}
+	if header.RequiresKeyFile() && keyFile == "" {
+		return nil, errors.New("wallet requires a keyfile, use -keyfile")
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return nil, err
+	}
+	service := pkg.NewWalletService(walletPath, password)
+	if keyFile != "" {
+		if err := service.SetKeyFile(keyFile); err != nil {
+			service.Close()
+			return nil, err
+		}
+	}
+	if err := service.Load(); err != nil {
+		service.Close()
+		return nil, fmt.Errorf("failed to load wallet: %v", err)
+	}
+	return service, nil
+}
+
+// readPassword reads the password from the terminal without echo, or the
+// first line of stdin when it is not a terminal
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Enter your wallet password: ")
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("no password on stdin")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
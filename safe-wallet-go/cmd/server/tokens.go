@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Scopes a token can be given. Reading entries and fields needs scopeRead,
+// adding, changing and deleting groups and entries needs scopeWrite.
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+// tokenPrefix starts every token, so secret scanners can recognize them
+const tokenPrefix = "swt_"
+
+// apiToken is a bearer token as stored in the tokens file. Only the SHA-256
+// hash of the token is kept, the token itself is shown once when created.
+type apiToken struct {
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+// hasScope reports whether the token was given the scope
+func (t apiToken) hasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// loadTokens reads the tokens file. A missing file holds no tokens.
+func loadTokens(path string) ([]apiToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var tokens []apiToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid tokens file %s: %v", path, err)
+	}
+	return tokens, nil
+}
+
+// saveTokens writes the tokens file, readable by the owner only
+func saveTokens(path string, tokens []apiToken) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600) // 0600 = rw-------
+}
+
+// parseScopes parses a comma separated list of scopes
+func parseScopes(s string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		switch scope {
+		case "":
+			continue
+		case scopeRead, scopeWrite:
+			scopes = append(scopes, scope)
+		default:
+			return nil, fmt.Errorf("unknown scope '%s', use read or write", scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("a token needs at least one scope, read or write")
+	}
+	return scopes, nil
+}
+
+// addToken creates a token with the name and scopes, stores its hash in the
+// tokens file and returns the token
+func addToken(path string, name string, scopes []string) (string, error) {
+	tokens, err := loadTokens(path)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range tokens {
+		if t.Name == name {
+			return "", fmt.Errorf("a token named '%s' already exists", name)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	tokens = append(tokens, apiToken{
+		Name:    name,
+		Hash:    hashToken(token),
+		Scopes:  scopes,
+		Created: time.Now().UTC(),
+	})
+	if err := saveTokens(path, tokens); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// revokeToken removes the token with the name from the tokens file
+func revokeToken(path string, name string) error {
+	tokens, err := loadTokens(path)
+	if err != nil {
+		return err
+	}
+	for i, t := range tokens {
+		if t.Name == name {
+			return saveTokens(path, append(tokens[:i], tokens[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no token named '%s'", name)
+}
+
+// findToken returns the stored token matching the bearer token. Every
+// stored hash is compared, in constant time.
+func findToken(tokens []apiToken, token string) (apiToken, bool) {
+	hash := []byte(hashToken(token))
+	var found apiToken
+	ok := false
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+			found, ok = t, true
+		}
+	}
+	return found, ok
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"read", []string{scopeRead}},
+		{" Read , WRITE ", []string{scopeRead, scopeWrite}},
+		{"write,,", []string{scopeWrite}},
+		{"", nil},
+		{" , ", nil},
+		{"read,admin", nil},
+	}
+	for _, test := range tests {
+		scopes, err := parseScopes(test.input)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("parseScopes(%q) = %v, want an error", test.input, scopes)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(scopes, test.want) {
+			t.Errorf("parseScopes(%q) = %v, %v, want %v", test.input, scopes, err, test.want)
+		}
+	}
+}
+
+func TestFindToken(t *testing.T) {
+	tokens := []apiToken{
+		{Name: "reader", Hash: hashToken(readToken), Scopes: []string{scopeRead}},
+		{Name: "writer", Hash: hashToken(writeToken), Scopes: []string{scopeWrite}},
+	}
+	if token, ok := findToken(tokens, writeToken); !ok || token.Name != "writer" {
+		t.Errorf("findToken(writeToken) = %q, %v, want writer", token.Name, ok)
+	}
+	for _, token := range []string{"", tokenPrefix, readToken + "x", hashToken(readToken)} {
+		if found, ok := findToken(tokens, token); ok {
+			t.Errorf("findToken(%q) found %q", token, found.Name)
+		}
+	}
+	if _, ok := findToken(nil, readToken); ok {
+		t.Error("findToken without tokens found one")
+	}
+}
+
+func TestAddAndRevokeToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.dat.tokens")
+
+	first, err := addToken(path, "ci", []string{scopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(first, tokenPrefix) {
+		t.Errorf("token %q does not start with %q", first, tokenPrefix)
+	}
+	if _, err := addToken(path, "ci", []string{scopeWrite}); err == nil {
+		t.Error("a second token named ci was created")
+	}
+	second, err := addToken(path, "backup", []string{scopeRead, scopeWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := loadTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range tokens {
+		if strings.Contains(token.Hash, first) || strings.Contains(token.Hash, second) {
+			t.Fatal("the tokens file holds a token")
+		}
+	}
+	if found, ok := findToken(tokens, second); !ok || found.Name != "backup" || !found.hasScope(scopeWrite) {
+		t.Errorf("findToken(second) = %+v, %v, want backup with write", found, ok)
+	}
+
+	if err := revokeToken(path, "ci"); err != nil {
+		t.Fatal(err)
+	}
+	if err := revokeToken(path, "ci"); err == nil {
+		t.Error("revoking ci twice succeeded")
+	}
+	if tokens, err = loadTokens(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findToken(tokens, first); ok {
+		t.Error("the revoked token is still accepted")
+	}
+	if _, ok := findToken(tokens, second); !ok {
+		t.Error("revoking ci removed the backup token")
+	}
+}
@@ -2,7 +2,11 @@ module safe-wallet-go
 
 go 1.25.5
 
-require golang.org/x/crypto v0.46.0
+require (
+	golang.org/x/crypto v0.46.0
+	golang.org/x/sys v0.39.0
+	golang.org/x/term v0.38.0
+)
 
 require (
 	fyne.io/fyne/v2 v2.7.1
@@ -35,7 +39,6 @@ require (
 	github.com/yuin/goldmark v1.7.8 // indirect
 	golang.org/x/image v0.24.0 // indirect
 	golang.org/x/net v0.47.0 // indirect
-	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/text v0.32.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,297 @@
+package pkg
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// X25519 identities and recipients in the format of age
+// (https://age-encryption.org/v1), so keys made by age-keygen work and the
+// data key is wrapped into an age X25519 stanza. The wallet is not an age
+// file, only the keys and the stanza format are shared with age.
+
+const (
+	recipientPrefix = "age"
+	identityPrefix  = "AGE-SECRET-KEY-"
+	// x25519Label is the HKDF info of age X25519 stanzas
+	x25519Label = "age-encryption.org/v1/X25519"
+	// maxIdentityFileSize bounds the identity file read into memory
+	maxIdentityFileSize = 1 << 16
+)
+
+// GenerateIdentity returns a new X25519 identity and its recipient
+func GenerateIdentity() (identity string, recipient string, err error) {
+	scalar := make([]byte, curve25519.ScalarSize)
+	defer Wipe(scalar)
+	if _, err := io.ReadFull(rand.Reader, scalar); err != nil {
+		return "", "", err
+	}
+	public, err := curve25519.X25519(scalar, curve25519.Basepoint)
+	if err != nil {
+		return "", "", err
+	}
+	identity = strings.ToUpper(bech32Encode(strings.ToLower(identityPrefix), scalar))
+	return identity, bech32Encode(recipientPrefix, public), nil
+}
+
+// GenerateIdentityFile writes a new identity file in the format of
+// age-keygen and returns its recipient. Existing files are not overwritten.
+func GenerateIdentityFile(path string) (string, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	recipient, err := WriteIdentity(file)
+	if err != nil {
+		file.Close()
+		return "", err
+	}
+	return recipient, file.Close()
+}
+
+// WriteIdentity writes a new identity file to w and returns its recipient
+func WriteIdentity(w io.Writer) (string, error) {
+	identity, recipient, err := GenerateIdentity()
+	if err != nil {
+		return "", err
+	}
+	if _, err := fmt.Fprintf(w, "# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), recipient, identity); err != nil {
+		return "", err
+	}
+	return recipient, nil
+}
+
+// ParseRecipient checks an age1... recipient and returns its public key
+func ParseRecipient(recipient string) ([]byte, error) {
+	hrp, public, err := bech32Decode(strings.TrimSpace(recipient))
+	if err != nil || hrp != recipientPrefix || len(public) != curve25519.PointSize {
+		return nil, fmt.Errorf("invalid recipient %q", recipient)
+	}
+	return public, nil
+}
+
+// ReadIdentityFile reads the AGE-SECRET-KEY-1... lines of an identity file.
+// The scalars of all identities are returned back to back.
+func ReadIdentityFile(path string) (*SecureBuffer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var scalars []byte
+	scanner := bufio.NewScanner(io.LimitReader(file, maxIdentityFileSize))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hrp, scalar, err := bech32Decode(line)
+		if err != nil || hrp != strings.ToLower(identityPrefix) || len(scalar) != curve25519.ScalarSize {
+			Wipe(scalars)
+			return nil, fmt.Errorf("line %d is not an X25519 identity", number)
+		}
+		scalars = append(scalars, scalar...)
+		Wipe(scalar)
+	}
+	if err := scanner.Err(); err != nil {
+		Wipe(scalars)
+		return nil, err
+	}
+	if len(scalars) == 0 {
+		Wipe(scalars)
+		return nil, errors.New("no identities found")
+	}
+	return NewSecureBufferFrom(scalars), nil
+}
+
+// wrapToRecipient wraps the key into an age X25519 stanza and returns the
+// ephemeral share and the body. The stanza does not name its slot, the HMAC
+// of the slot table keeps it from being moved to another slot.
+func wrapToRecipient(public []byte, key []byte) ([]byte, []byte, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	defer Wipe(ephemeral)
+	if _, err := io.ReadFull(rand.Reader, ephemeral); err != nil {
+		return nil, nil, err
+	}
+	share, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := curve25519.X25519(ephemeral, public)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer Wipe(shared)
+
+	aead, err := x25519StanzaAEAD(shared, share, public)
+	if err != nil {
+		return nil, nil, err
+	}
+	return share, aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), key, nil), nil
+}
+
+// unwrapWithIdentity opens an age X25519 stanza with the scalar of the
+// identity
+func unwrapWithIdentity(scalar []byte, share []byte, body []byte) (*SecureBuffer, error) {
+	public, err := curve25519.X25519(scalar, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(scalar, share)
+	if err != nil {
+		return nil, errors.New("invalid recipient stanza")
+	}
+	defer Wipe(shared)
+
+	aead, err := x25519StanzaAEAD(shared, share, public)
+	if err != nil {
+		return nil, err
+	}
+	key, err := aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), body, nil)
+	if err != nil {
+		return nil, errors.New("invalid recipient stanza")
+	}
+	return NewSecureBufferFrom(key), nil
+}
+
+// x25519StanzaAEAD derives the wrapping cipher of a stanza from the shared
+// secret, salted with the ephemeral share and the recipient
+func x25519StanzaAEAD(shared []byte, share []byte, public []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte(nil), share...), public...)
+	wrapKey := make([]byte, chacha20poly1305.KeySize)
+	defer Wipe(wrapKey)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(x25519Label)), wrapKey); err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(wrapKey)
+}
+
+// bech32Charset is the alphabet of BIP 173
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// bech32Encode encodes data with the human readable part in lower case.
+// Unlike BIP 173 there is no length limit, as in age.
+func bech32Encode(hrp string, data []byte) string {
+	values := convertBits(data, 8, 5, true)
+	checksum := bech32Checksum(hrp, values)
+
+	var encoded strings.Builder
+	encoded.WriteString(hrp)
+	encoded.WriteByte('1')
+	for _, v := range append(values, checksum...) {
+		encoded.WriteByte(bech32Charset[v])
+	}
+	Wipe(values)
+	return encoded.String()
+}
+
+// bech32Decode returns the lower case human readable part and the data of
+// a bech32 string in either case
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	s = strings.ToLower(s)
+	separator := strings.LastIndexByte(s, '1')
+	if separator < 1 || separator+7 > len(s) {
+		return "", nil, errors.New("invalid separator position")
+	}
+	hrp := s[:separator]
+
+	values := make([]byte, 0, len(s)-separator-1)
+	for _, c := range s[separator+1:] {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return "", nil, errors.New("invalid character")
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32ExpandHRP(hrp), values...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+
+	data := convertBits(values[:len(values)-6], 5, 8, false)
+	Wipe(values)
+	if data == nil {
+		return "", nil, errors.New("invalid padding")
+	}
+	return hrp, data, nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	checksum := uint32(1)
+	for _, v := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range bech32Generator {
+			if (top>>i)&1 == 1 {
+				checksum ^= g
+			}
+		}
+	}
+	return checksum
+}
+
+func bech32ExpandHRP(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32Checksum(hrp string, values []byte) []byte {
+	input := append(bech32ExpandHRP(hrp), values...)
+	input = append(input, 0, 0, 0, 0, 0, 0)
+	polymod := bech32Polymod(input) ^ 1
+	Wipe(input)
+
+	checksum := make([]byte, 6)
+	for i := range checksum {
+		checksum[i] = byte(polymod>>(5*(5-i))) & 31
+	}
+	return checksum
+}
+
+// convertBits regroups the bits of data from groups of from bits into groups
+// of to bits. Without pad, leftover bits must be zero padding or nil is
+// returned.
+func convertBits(data []byte, from uint, to uint, pad bool) []byte {
+	var result []byte
+	acc, bits := uint32(0), uint(0)
+	maxValue := uint32(1)<<to - 1
+	for _, b := range data {
+		acc = acc<<from | uint32(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			result = append(result, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad && bits > 0 {
+		result = append(result, byte(acc<<(to-bits)&maxValue))
+	} else if !pad && (bits >= from || acc<<(to-bits)&maxValue != 0) {
+		Wipe(result)
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,171 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// The identity with the scalar 0x42... and its recipient, as used in the
+// tests of age
+const (
+	testIdentity  = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+	testRecipient = "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj"
+	testPublicKey = "132c442be010fbd57e72603328aa76e71fccc1503aae219327d14d9c9993f472"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBech32Checksums(t *testing.T) {
+	// Valid checksums from BIP 173
+	valid := []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqc8247j",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	}
+	for _, s := range valid {
+		s = strings.ToLower(s)
+		separator := strings.LastIndexByte(s, '1')
+		values := bech32ExpandHRP(s[:separator])
+		for _, c := range s[separator+1:] {
+			values = append(values, byte(strings.IndexRune(bech32Charset, c)))
+		}
+		if bech32Polymod(values) != 1 {
+			t.Errorf("checksum of %q does not verify", s)
+		}
+	}
+
+	// Invalid strings from BIP 173, and one in mixed case
+	invalid := []string{
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"A1G7SGD8",
+		"10a06t8",
+		"1qzzfhee",
+		"A12uEL5L",
+	}
+	for _, s := range invalid {
+		if _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("bech32Decode(%q) succeeded", s)
+		}
+	}
+}
+
+func TestBech32Data(t *testing.T) {
+	hrp, data, err := bech32Decode("abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mustHex(t, "00443214c74254b635cf84653a56d7c675be77df")
+	if hrp != "abcdef" || !bytes.Equal(data, want) {
+		t.Errorf("bech32Decode = %q, %x", hrp, data)
+	}
+	if encoded := bech32Encode("abcdef", want); encoded != "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw" {
+		t.Errorf("bech32Encode = %q", encoded)
+	}
+}
+
+func TestAgeKeys(t *testing.T) {
+	scalar := bytes.Repeat([]byte{0x42}, curve25519.ScalarSize)
+	if identity := strings.ToUpper(bech32Encode(strings.ToLower(identityPrefix), scalar)); identity != testIdentity {
+		t.Errorf("identity = %s, want %s", identity, testIdentity)
+	}
+	public, err := ParseRecipient(testRecipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(public, mustHex(t, testPublicKey)) {
+		t.Errorf("ParseRecipient = %x", public)
+	}
+	if recipient := bech32Encode(recipientPrefix, public); recipient != testRecipient {
+		t.Errorf("recipient = %s", recipient)
+	}
+
+	for _, bad := range []string{
+		"",
+		testIdentity,
+		strings.Replace(testRecipient, "age1", "agf1", 1),
+		testRecipient[:len(testRecipient)-1] + "q",
+		bech32Encode(recipientPrefix, public[:31]),
+	} {
+		if _, err := ParseRecipient(bad); err == nil {
+			t.Errorf("ParseRecipient(%q) succeeded", bad)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	content := "# created: 2026-01-01T00:00:00Z\n# public key: " + testRecipient + "\n" + testIdentity + "\n\n" + testIdentity + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	identities, err := ReadIdentityFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer identities.Destroy()
+	if !bytes.Equal(identities.Bytes(), append(append([]byte(nil), scalar...), scalar...)) {
+		t.Errorf("ReadIdentityFile = %x", identities.Bytes())
+	}
+
+	if err := os.WriteFile(path, []byte(testIdentity+"\n"+testRecipient+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadIdentityFile(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ReadIdentityFile of a file with a recipient = %v", err)
+	}
+}
+
+func TestX25519Stanza(t *testing.T) {
+	// The stanza age writes for the file key 00 01 .. 1f from the ephemeral
+	// scalar 0x07..., computed with an independent implementation of
+	// RFC 7748, RFC 5869 and RFC 8439
+	scalar := bytes.Repeat([]byte{0x42}, curve25519.ScalarSize)
+	share := mustHex(t, "13be4feaeaf204c7fd3358fc9c00721881d174278128227ec674f37f7fe97b6d")
+	fileKey := mustHex(t, "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	body := mustHex(t, "d541f80275d1b0af9795ecd43ce0d7b8f3dded2c2f5e87f95eaffb6486ae7d155629bded2865004f8793ee501ec257b5")
+
+	key, err := unwrapWithIdentity(scalar, share, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key.Bytes(), fileKey) {
+		t.Errorf("unwrapWithIdentity = %x", key.Bytes())
+	}
+	key.Destroy()
+
+	other := bytes.Repeat([]byte{0x43}, curve25519.ScalarSize)
+	if _, err := unwrapWithIdentity(other, share, body); err == nil {
+		t.Error("stanza opened with another identity")
+	}
+
+	share, body, err = wrapToRecipient(mustHex(t, testPublicKey), fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err = unwrapWithIdentity(scalar, share, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Destroy()
+	if !bytes.Equal(key.Bytes(), fileKey) {
+		t.Errorf("round trip = %x", key.Bytes())
+	}
+}
@@ -0,0 +1,301 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"hash"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Argon2d (RFC 9106, version 0x13) for KeePass databases, whose default key
+// derivation golang.org/x/crypto/argon2 does not offer. It is only used to
+// open KDBX 4 files, wallets never derive keys with it.
+
+const (
+	argon2Version     = 0x13
+	argon2SyncPoints  = 4
+	argon2BlockLength = 128
+	// argon2TypeD selects data-dependent addressing
+	argon2TypeD = 0
+	// argon2TypeID only switches to data-dependent addressing halfway
+	// through the first pass. It is kept so the tests can check the shared
+	// code against golang.org/x/crypto/argon2.
+	argon2TypeID = 2
+)
+
+type argon2Block [argon2BlockLength]uint64
+
+// argon2dKey derives a key with Argon2d. memory is in KiB.
+func argon2dKey(password []byte, salt []byte, time uint32, memory uint32, threads uint8, keyLen uint32) []byte {
+	return argon2Key(argon2TypeD, password, salt, nil, nil, time, memory, threads, keyLen)
+}
+
+// argon2Key derives a key with the optional secret key and associated data
+// of RFC 9106, which KeePass databases do not use
+func argon2Key(mode int, password []byte, salt []byte, secret []byte, data []byte, time uint32, memory uint32, threads uint8, keyLen uint32) []byte {
+	if time < 1 || threads < 1 {
+		panic("argon2: time and threads must be at least 1")
+	}
+	h0 := argon2InitHash(mode, password, salt, secret, data, time, memory, uint32(threads), keyLen)
+	defer Wipe(h0[:])
+
+	lanes := uint32(threads)
+	if memory < 2*argon2SyncPoints*lanes {
+		memory = 2 * argon2SyncPoints * lanes
+	}
+	memory = memory / (argon2SyncPoints * lanes) * (argon2SyncPoints * lanes)
+
+	blocks := argon2InitBlocks(&h0, memory, lanes)
+	argon2ProcessBlocks(mode, blocks, time, memory, lanes)
+	key := argon2ExtractKey(blocks, memory, lanes, keyLen)
+	for i := range blocks {
+		blocks[i] = argon2Block{}
+	}
+	return key
+}
+
+// argon2InitHash computes H0 with room for the block and lane counters
+func argon2InitHash(mode int, password []byte, salt []byte, secret []byte, data []byte, time uint32, memory uint32, lanes uint32, keyLen uint32) [blake2b.Size + 8]byte {
+	var h0 [blake2b.Size + 8]byte
+	h, _ := blake2b.New512(nil)
+	writeUint32 := func(v uint32) {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], v)
+		h.Write(buf[:])
+	}
+	writeUint32(lanes)
+	writeUint32(keyLen)
+	writeUint32(memory)
+	writeUint32(time)
+	writeUint32(argon2Version)
+	writeUint32(uint32(mode))
+	writeUint32(uint32(len(password)))
+	h.Write(password)
+	writeUint32(uint32(len(salt)))
+	h.Write(salt)
+	writeUint32(uint32(len(secret)))
+	h.Write(secret)
+	writeUint32(uint32(len(data)))
+	h.Write(data)
+	h.Sum(h0[:0])
+	return h0
+}
+
+// argon2InitBlocks fills the first two blocks of every lane from H0
+func argon2InitBlocks(h0 *[blake2b.Size + 8]byte, memory uint32, lanes uint32) []argon2Block {
+	var buf [1024]byte
+	defer Wipe(buf[:])
+	blocks := make([]argon2Block, memory)
+	for lane := uint32(0); lane < lanes; lane++ {
+		start := lane * (memory / lanes)
+		binary.LittleEndian.PutUint32(h0[blake2b.Size+4:], lane)
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0[blake2b.Size:], i)
+			argon2Hash(buf[:], h0[:])
+			for j := range blocks[start+i] {
+				blocks[start+i][j] = binary.LittleEndian.Uint64(buf[j*8:])
+			}
+		}
+	}
+	return blocks
+}
+
+func argon2ProcessBlocks(mode int, blocks []argon2Block, time uint32, memory uint32, lanes uint32) {
+	laneLength := memory / lanes
+	segmentLength := laneLength / argon2SyncPoints
+
+	processSegment := func(pass uint32, slice uint32, lane uint32) {
+		var addresses, input, zero argon2Block
+		independent := mode == argon2TypeID && pass == 0 && slice < argon2SyncPoints/2
+		if independent {
+			input[0] = uint64(pass)
+			input[1] = uint64(lane)
+			input[2] = uint64(slice)
+			input[3] = uint64(memory)
+			input[4] = uint64(time)
+			input[5] = uint64(mode)
+		}
+
+		index := uint32(0)
+		if pass == 0 && slice == 0 {
+			// The first two blocks come from H0
+			index = 2
+			if independent {
+				input[6]++
+				argon2Compress(&addresses, &input, &zero, false)
+				argon2Compress(&addresses, &addresses, &zero, false)
+			}
+		}
+
+		offset := lane*laneLength + slice*segmentLength + index
+		for ; index < segmentLength; index, offset = index+1, offset+1 {
+			prev := offset - 1
+			if index == 0 && slice == 0 {
+				prev += laneLength
+			}
+			var random uint64
+			if independent {
+				if index%argon2BlockLength == 0 {
+					input[6]++
+					argon2Compress(&addresses, &input, &zero, false)
+					argon2Compress(&addresses, &addresses, &zero, false)
+				}
+				random = addresses[index%argon2BlockLength]
+			} else {
+				random = blocks[prev][0]
+			}
+			ref := argon2RefIndex(random, laneLength, segmentLength, lanes, pass, slice, lane, index)
+			argon2Compress(&blocks[offset], &blocks[prev], &blocks[ref], true)
+		}
+	}
+
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < lanes; lane++ {
+				wg.Add(1)
+				go func(lane uint32) {
+					defer wg.Done()
+					processSegment(pass, slice, lane)
+				}(lane)
+			}
+			wg.Wait()
+		}
+	}
+}
+
+// argon2RefIndex maps the pseudo-random value to the reference block
+func argon2RefIndex(random uint64, laneLength uint32, segmentLength uint32, lanes uint32, pass uint32, slice uint32, lane uint32, index uint32) uint32 {
+	refLane := uint32(random>>32) % lanes
+	if pass == 0 && slice == 0 {
+		refLane = lane
+	}
+
+	area, start := 3*segmentLength, ((slice+1)%argon2SyncPoints)*segmentLength
+	if lane == refLane {
+		area += index
+	}
+	if pass == 0 {
+		area, start = slice*segmentLength, 0
+		if slice == 0 || lane == refLane {
+			area += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		area--
+	}
+
+	x := random & 0xFFFFFFFF
+	x = (x * x) >> 32
+	x = (x * uint64(area)) >> 32
+	return refLane*laneLength + uint32((uint64(start)+uint64(area)-(x+1))%uint64(laneLength))
+}
+
+func argon2ExtractKey(blocks []argon2Block, memory uint32, lanes uint32, keyLen uint32) []byte {
+	laneLength := memory / lanes
+	final := blocks[memory-1]
+	for lane := uint32(0); lane < lanes-1; lane++ {
+		for i, v := range blocks[lane*laneLength+laneLength-1] {
+			final[i] ^= v
+		}
+	}
+
+	var buf [1024]byte
+	defer Wipe(buf[:])
+	for i, v := range final {
+		binary.LittleEndian.PutUint64(buf[i*8:], v)
+	}
+	key := make([]byte, keyLen)
+	argon2Hash(key, buf[:])
+	return key
+}
+
+// argon2Hash is the variable length hash H' built from BLAKE2b
+func argon2Hash(out []byte, in []byte) {
+	var h hash.Hash
+	if len(out) < blake2b.Size {
+		h, _ = blake2b.New(len(out), nil)
+	} else {
+		h, _ = blake2b.New512(nil)
+	}
+	var buf [blake2b.Size]byte
+	binary.LittleEndian.PutUint32(buf[:4], uint32(len(out)))
+	h.Write(buf[:4])
+	h.Write(in)
+	if len(out) <= blake2b.Size {
+		h.Sum(out[:0])
+		return
+	}
+
+	outLen := len(out)
+	h.Sum(buf[:0])
+	copy(out, buf[:32])
+	out = out[32:]
+	for len(out) > blake2b.Size {
+		h.Reset()
+		h.Write(buf[:])
+		h.Sum(buf[:0])
+		copy(out, buf[:32])
+		out = out[32:]
+	}
+	if outLen%blake2b.Size > 0 {
+		r := (outLen+31)/32 - 2
+		h, _ = blake2b.New(outLen-32*r, nil)
+	} else {
+		h.Reset()
+	}
+	h.Write(buf[:])
+	h.Sum(out[:0])
+}
+
+// argon2Compress is the compression function G. With xor the result is
+// combined with the previous contents of out, as in passes after the first.
+func argon2Compress(out *argon2Block, in1 *argon2Block, in2 *argon2Block, xor bool) {
+	var t argon2Block
+	for i := range t {
+		t[i] = in1[i] ^ in2[i]
+	}
+	for i := 0; i < argon2BlockLength; i += 16 {
+		argon2Permute(&t[i], &t[i+1], &t[i+2], &t[i+3], &t[i+4], &t[i+5], &t[i+6], &t[i+7],
+			&t[i+8], &t[i+9], &t[i+10], &t[i+11], &t[i+12], &t[i+13], &t[i+14], &t[i+15])
+	}
+	for i := 0; i < argon2BlockLength/8; i += 2 {
+		argon2Permute(&t[i], &t[i+1], &t[16+i], &t[16+i+1], &t[32+i], &t[32+i+1], &t[48+i], &t[48+i+1],
+			&t[64+i], &t[64+i+1], &t[80+i], &t[80+i+1], &t[96+i], &t[96+i+1], &t[112+i], &t[112+i+1])
+	}
+	for i := range t {
+		if xor {
+			out[i] ^= in1[i] ^ in2[i] ^ t[i]
+		} else {
+			out[i] = in1[i] ^ in2[i] ^ t[i]
+		}
+	}
+}
+
+// argon2Permute is the BLAKE2b round P with multiplications
+func argon2Permute(v0, v1, v2, v3, v4, v5, v6, v7, v8, v9, v10, v11, v12, v13, v14, v15 *uint64) {
+	argon2Mix(v0, v4, v8, v12)
+	argon2Mix(v1, v5, v9, v13)
+	argon2Mix(v2, v6, v10, v14)
+	argon2Mix(v3, v7, v11, v15)
+	argon2Mix(v0, v5, v10, v15)
+	argon2Mix(v1, v6, v11, v12)
+	argon2Mix(v2, v7, v8, v13)
+	argon2Mix(v3, v4, v9, v14)
+}
+
+func argon2Mix(a, b, c, d *uint64) {
+	*a += *b + 2*uint64(uint32(*a))*uint64(uint32(*b))
+	*d ^= *a
+	*d = *d>>32 | *d<<32
+	*c += *d + 2*uint64(uint32(*c))*uint64(uint32(*d))
+	*b ^= *c
+	*b = *b>>24 | *b<<40
+	*a += *b + 2*uint64(uint32(*a))*uint64(uint32(*b))
+	*d ^= *a
+	*d = *d>>16 | *d<<48
+	*c += *d + 2*uint64(uint32(*c))*uint64(uint32(*d))
+	*b ^= *c
+	*b = *b>>63 | *b<<1
+}
@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestArgon2RFC9106(t *testing.T) {
+	// Test vectors of RFC 9106 section 5
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+
+	vectors := []struct {
+		name string
+		mode int
+		tag  string
+	}{
+		{"Argon2d", argon2TypeD, "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"},
+		{"Argon2id", argon2TypeID, "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659"},
+	}
+	for _, v := range vectors {
+		tag := argon2Key(v.mode, password, salt, secret, data, 3, 32, 4, 32)
+		if got := hex.EncodeToString(tag); got != v.tag {
+			t.Errorf("%s = %s, want %s", v.name, got, v.tag)
+		}
+	}
+}
+
+func TestArgon2IDMatchesXCrypto(t *testing.T) {
+	// The code shared with Argon2d is checked against the Argon2id of
+	// golang.org/x/crypto/argon2 for several memory and lane counts,
+	// including memory that is rounded down and keys longer than a hash
+	params := []struct {
+		time, memory uint32
+		threads      uint8
+		keyLen       uint32
+	}{
+		{1, 8, 1, 32},
+		{2, 64, 1, 16},
+		{3, 100, 2, 32},
+		{1, 256, 4, 64},
+		{2, 1024, 3, 100},
+	}
+	for _, p := range params {
+		want := argon2.IDKey([]byte("password"), []byte("somesalt"), p.time, p.memory, p.threads, p.keyLen)
+		got := argon2Key(argon2TypeID, []byte("password"), []byte("somesalt"), nil, nil, p.time, p.memory, p.threads, p.keyLen)
+		if !bytes.Equal(got, want) {
+			t.Errorf("t=%d m=%d p=%d len=%d: %x, want %x", p.time, p.memory, p.threads, p.keyLen, got, want)
+		}
+	}
+}
+
+func TestArgon2dKey(t *testing.T) {
+	// argon2dKey is Argon2d without a secret key or associated data
+	password, salt := []byte("password"), []byte("somesalt")
+	key := argon2dKey(password, salt, 2, 64, 2, 32)
+	if want := argon2Key(argon2TypeD, password, salt, nil, nil, 2, 64, 2, 32); !bytes.Equal(key, want) {
+		t.Errorf("argon2dKey = %x, want %x", key, want)
+	}
+	if other := argon2dKey(password, []byte("othersalt"), 2, 64, 2, 32); bytes.Equal(key, other) {
+		t.Error("argon2dKey does not depend on the salt")
+	}
+	if id := argon2.IDKey(password, salt, 2, 64, 2, 32); bytes.Equal(key, id) {
+		t.Error("argon2dKey returned the Argon2id key")
+	}
+}
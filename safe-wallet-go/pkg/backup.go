@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"errors"
+	"time"
+)
+
+// VersionedStorage is a Storage that keeps the earlier versions of a file
+// when it is overwritten, such as a bucket with versioning enabled
+type VersionedStorage interface {
+	Storage
+	// Versions lists the versions of the file, newest first
+	Versions(name string) ([]FileVersion, error)
+	// ReadVersion returns the content of a version of the file
+	ReadVersion(name string, id string) ([]byte, error)
+}
+
+// FileVersion describes a version of a file in a VersionedStorage
+type FileVersion struct {
+	ID      string
+	ModTime time.Time
+	Size    int64
+	// Latest is set for the current content of the file
+	Latest bool
+}
+
+// Backups lists the earlier versions of the wallet kept by the storage,
+// newest first. The current version is not included.
+func (ws *WalletService) Backups() ([]FileVersion, error) {
+	storage, err := ws.versionedStorage()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := storage.Versions(ws.filepath)
+	if err != nil {
+		return nil, err
+	}
+	var backups []FileVersion
+	for _, version := range versions {
+		if !version.Latest {
+			backups = append(backups, version)
+		}
+	}
+	return backups, nil
+}
+
+// RestoreBackup replaces the groups with those of an earlier version and
+// saves the wallet. The key slots stay as they are, so slots revoked since
+// the backup was made do not come back.
+func (ws *WalletService) RestoreBackup(id string) error {
+	if ws.key == nil {
+		return errors.New("wallet is locked")
+	}
+	storage, err := ws.versionedStorage()
+	if err != nil {
+		return err
+	}
+	encrypted, err := storage.ReadVersion(ws.filepath, id)
+	if err != nil {
+		return err
+	}
+	header, _, err := parseWalletHeader(encrypted)
+	if err != nil {
+		return err
+	}
+	if header.Version != currentFormatVersion {
+		return errors.New("backup is in an older format and cannot be restored")
+	}
+	wallet, err := decryptWallet(encrypted, func(encrypted []byte) ([]byte, error) {
+		return decryptWithKey(encrypted, ws.key.Bytes())
+	})
+	if err != nil {
+		return errors.New("backup is encrypted with another data key and cannot be restored")
+	}
+
+	previous := ws.wallet
+	if err := ws.setWallet(wallet); err != nil {
+		return err
+	}
+	if err := ws.Save(); err != nil {
+		ws.wallet = previous
+		return err
+	}
+	return nil
+}
+
+// versionedStorage returns the storage if it keeps versions of the wallet
+func (ws *WalletService) versionedStorage() (VersionedStorage, error) {
+	storage, ok := ws.storage.(VersionedStorage)
+	if !ok {
+		return nil, errors.New("the storage of the wallet does not keep backups")
+	}
+	if isSyncDir(ws.storage, ws.filepath) {
+		return nil, errors.New("backups of a sync directory are kept per file, restore them with the tools of the storage")
+	}
+	return storage, nil
+}
@@ -0,0 +1,170 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Bitwarden item types
+const (
+	bitwardenLogin      = 1
+	bitwardenSecureNote = 2
+	bitwardenCard       = 3
+	bitwardenIdentity   = 4
+)
+
+// Bitwarden custom field types
+const (
+	bitwardenFieldHidden = 1
+	bitwardenFieldLinked = 3
+)
+
+// bitwardenExport is an unencrypted Bitwarden JSON export
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []struct {
+		FolderID string `json:"folderId"`
+		Type     int    `json:"type"`
+		Name     string `json:"name"`
+		Notes    string `json:"notes"`
+		Fields   []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+			Type  int    `json:"type"`
+		} `json:"fields"`
+		Login *struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			TOTP     string `json:"totp"`
+			URIs     []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+		} `json:"login"`
+		Card *struct {
+			CardholderName string `json:"cardholderName"`
+			Brand          string `json:"brand"`
+			Number         string `json:"number"`
+			ExpMonth       string `json:"expMonth"`
+			ExpYear        string `json:"expYear"`
+			Code           string `json:"code"`
+		} `json:"card"`
+		Identity map[string]interface{} `json:"identity"`
+	} `json:"items"`
+}
+
+// bitwardenIdentityFields are the identity properties in the order they are imported
+var bitwardenIdentityFields = []struct {
+	key  string
+	name string
+}{
+	{"title", "Title"}, {"firstName", "First Name"}, {"middleName", "Middle Name"},
+	{"lastName", "Last Name"}, {"company", "Company"}, {"email", "Email"},
+	{"phone", "Phone"}, {"address1", "Address"}, {"address2", "Address 2"},
+	{"address3", "Address 3"}, {"city", "City"}, {"state", "State"},
+	{"postalCode", "Postal Code"}, {"country", "Country"}, {"username", "Username"},
+	{"ssn", "SSN"}, {"passportNumber", "Passport Number"}, {"licenseNumber", "License Number"},
+}
+
+// bitwardenImporter imports the unencrypted JSON export of Bitwarden
+type bitwardenImporter struct{}
+
+func (bitwardenImporter) Name() string {
+	return "Bitwarden JSON"
+}
+
+func (bitwardenImporter) NeedsPassword() bool {
+	return false
+}
+
+func (bitwardenImporter) Detect(filename string, head []byte) bool {
+	head = bytes.TrimSpace(head)
+	return bytes.HasPrefix(head, []byte("{")) &&
+		(bytes.Contains(head, []byte(`"encrypted"`)) || bytes.Contains(head, []byte(`"items"`)))
+}
+
+// Import maps Bitwarden folders, where "/" separates nested folders, to groups
+func (bitwardenImporter) Import(path string, options ImportOptions) (*Group, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var export bitwardenExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid Bitwarden export: %v", err)
+	}
+	if export.Encrypted {
+		return nil, errors.New("encrypted Bitwarden exports cannot be imported, export as unencrypted JSON")
+	}
+
+	folders := make(map[string][]string)
+	for _, folder := range export.Folders {
+		folders[folder.ID] = strings.Split(folder.Name, "/")
+	}
+
+	items := make([]importItem, 0, len(export.Items))
+	for _, source := range export.Items {
+		item := importItem{folder: folders[source.FolderID], title: source.Name}
+		switch source.Type {
+		case bitwardenLogin:
+			item.kind = "Password"
+			if login := source.Login; login != nil {
+				item.field("Username", login.Username, FieldTypeGeneral)
+				item.field("Password", login.Password, FieldTypePassword)
+				for i, uri := range login.URIs {
+					name := "URL"
+					if i > 0 {
+						name = fmt.Sprintf("URL %d", i+1)
+					}
+					item.field(name, uri.URI, FieldTypeGeneral)
+				}
+				item.field("TOTP", login.TOTP, FieldTypePassword)
+			}
+			item.field("Notes", source.Notes, FieldTypeGeneral)
+		case bitwardenSecureNote:
+			item.kind = "Note"
+			item.field("Note", source.Notes, FieldTypeGeneral)
+		case bitwardenCard:
+			item.kind = "Credit Card"
+			if card := source.Card; card != nil {
+				item.field("Cardholder Name", card.CardholderName, FieldTypeGeneral)
+				item.field("Card Number", card.Number, FieldTypeGeneral)
+				if card.ExpMonth != "" || card.ExpYear != "" {
+					item.field("Expiration Date", fmt.Sprintf("%s/%s", card.ExpMonth, card.ExpYear), FieldTypeGeneral)
+				}
+				item.field("CVV", card.Code, FieldTypePIN)
+				item.field("Brand", card.Brand, FieldTypeGeneral)
+			}
+			item.field("Notes", source.Notes, FieldTypeGeneral)
+		case bitwardenIdentity:
+			for _, identityField := range bitwardenIdentityFields {
+				if value, ok := source.Identity[identityField.key].(string); ok {
+					item.field(identityField.name, value, FieldTypeGeneral)
+				}
+			}
+			item.field("Notes", source.Notes, FieldTypeGeneral)
+		default:
+			item.field("Notes", source.Notes, FieldTypeGeneral)
+		}
+
+		for _, field := range source.Fields {
+			switch field.Type {
+			case bitwardenFieldLinked:
+				continue
+			case bitwardenFieldHidden:
+				item.field(field.Name, field.Value, FieldTypePassword)
+			default:
+				item.field(field.Name, field.Value, FieldTypeGeneral)
+			}
+		}
+		items = append(items, item)
+	}
+	return buildImportGroup("Bitwarden", items), nil
+}
@@ -0,0 +1,247 @@
+package pkg
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ImportSummary lists the titles of the entries an import created, skipped
+// as duplicates and merged into existing entries
+type ImportSummary struct {
+	Created []string
+	Skipped []string
+	Merged  []string
+}
+
+// ReadBrowserCSV reads the saved logins exported by Chrome (name, url,
+// username, password, note), Firefox (url, username, password, ...) or
+// Safari (Title, URL, Username, Password, Notes, OTPAuth) as entries made
+// from the "Password" template
+func ReadBrowserCSV(path string) ([]Entry, error) {
+	header, records, err := readImportCSV(path)
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.ToLower(column)] = i
+	}
+	for _, required := range []string{"url", "username", "password"} {
+		if _, ok := columns[required]; !ok {
+			return nil, errors.New("not a browser password export, the url, username and password columns are missing")
+		}
+	}
+
+	// value returns the first of the columns the export has
+	value := func(record []string, names ...string) string {
+		for _, column := range names {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return record[i]
+			}
+		}
+		return ""
+	}
+
+	var entries []Entry
+	for _, record := range records {
+		item := importItem{kind: "Password", title: value(record, "name", "title")}
+		if strings.TrimSpace(item.title) == "" {
+			item.title = loginHost(value(record, "url"))
+		}
+		item.field("Username", value(record, "username"), FieldTypeGeneral)
+		item.field("Password", value(record, "password"), FieldTypePassword)
+		item.field("URL", value(record, "url"), FieldTypeGeneral)
+		item.field("Notes", value(record, "note", "notes"), FieldTypeGeneral)
+		item.field("TOTP", value(record, "otpauth"), FieldTypePassword)
+		entries = append(entries, importEntry(item))
+	}
+	return entries, nil
+}
+
+// ImportLogins adds browser logins to the group at the target path. A login
+// with the URL and username of an existing entry anywhere in the wallet is
+// skipped if it brings nothing new. Otherwise it is merged: missing fields
+// are added and a changed value, like a password or notes, replaces the old
+// one, which is kept as e.g. "Previous Password". Titles that are taken get
+// a numbered suffix. The logins are imported into a copy of the wallet, so
+// if any of them fails the wallet is left as it was.
+func (ws *WalletService) ImportLogins(target Path, entries []Entry) (ImportSummary, error) {
+	var summary ImportSummary
+	if ws.wallet == nil {
+		return summary, errors.New("wallet not loaded")
+	}
+	if len(target.GroupIDs) == 0 {
+		return summary, errors.New("choose a group to import the logins into")
+	}
+	if _, err := FindGroupByPath(ws.wallet, target); err != nil {
+		return summary, err
+	}
+
+	err := ws.changeCopy(func() error {
+		var err error
+		summary, err = ws.importLogins(target, entries)
+		return err
+	})
+	if err != nil {
+		return ImportSummary{}, err
+	}
+	return summary, nil
+}
+
+// importLogins adds the logins as ImportLogins describes, leaving the
+// wallet changed in part if one of them fails
+func (ws *WalletService) importLogins(target Path, entries []Entry) (ImportSummary, error) {
+	var summary ImportSummary
+
+	// Existing entries by URL and username
+	existing := make(map[string]string)
+	var walkErr error
+	ws.TraverseForward(func(info PathInfo) bool {
+		if !info.IsEntry {
+			return true
+		}
+		key, err := ws.loginKey(info.Entry.Fields)
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		if key != "" {
+			existing[key] = info.Entry.ID
+		}
+		return true
+	})
+	if walkErr != nil {
+		return summary, walkErr
+	}
+
+	for _, entry := range entries {
+		key, err := ws.loginKey(entry.Fields)
+		if err != nil {
+			return summary, err
+		}
+
+		if id, ok := existing[key]; ok && key != "" {
+			title, merged, err := ws.mergeLogin(id, entry)
+			if err != nil {
+				return summary, err
+			}
+			if merged {
+				summary.Merged = append(summary.Merged, title)
+			} else {
+				summary.Skipped = append(summary.Skipped, title)
+			}
+			continue
+		}
+
+		title := entry.Title
+		for n := 2; checkEntryTitleExists(ws.wallet, entry.Title, ""); n++ {
+			entry.Title = NumberedRename(title, n)
+		}
+		entry.ID = ""
+		if err := ws.AddEntry(target, &entry); err != nil {
+			return summary, err
+		}
+		if key != "" {
+			existing[key] = entry.ID
+		}
+		summary.Created = append(summary.Created, entry.Title)
+	}
+	return summary, nil
+}
+
+// mergeLogin merges an imported login into the existing entry. It returns
+// the title of the entry and whether the login added anything.
+func (ws *WalletService) mergeLogin(id string, login Entry) (string, bool, error) {
+	path, entry, err := ws.FindEntryByID(id)
+	if err != nil {
+		return "", false, err
+	}
+	fields, err := ws.RevealFields(entry.Fields)
+	if err != nil {
+		return "", false, err
+	}
+
+	changed := false
+	for _, imported := range login.Fields {
+		current := findField(fields, imported.Name)
+		switch {
+		case current == nil:
+			fields = append(fields, imported)
+			changed = true
+		case current.Value == imported.Value:
+		case strings.EqualFold(imported.Name, "URL") && normalizeLoginURL(current.Value) == normalizeLoginURL(imported.Value):
+		default:
+			previousName := "Previous " + current.Name
+			if previous := findField(fields, previousName); previous != nil {
+				previous.Value = current.Value
+			} else {
+				fields = append(fields, EntryField{Name: previousName, Value: current.Value, Type: current.Type})
+				// The append may have moved the fields
+				current = findField(fields, imported.Name)
+			}
+			current.Value = imported.Value
+			changed = true
+		}
+	}
+	if !changed {
+		return entry.Title, false, nil
+	}
+
+	updated := *entry
+	updated.Fields = fields
+	if err := ws.UpdateEntry(path, updated); err != nil {
+		return "", false, err
+	}
+	return updated.Title, true, nil
+}
+
+// loginKey returns the normalized URL and username of a login, or "" if
+// the entry has no URL
+func (ws *WalletService) loginKey(fields []EntryField) (string, error) {
+	var rawURL, username string
+	for _, field := range fields {
+		name := strings.ToLower(field.Name)
+		if name != "url" && name != "username" {
+			continue
+		}
+		value, err := ws.FieldValue(field)
+		if err != nil {
+			return "", err
+		}
+		if name == "url" {
+			rawURL = value
+		} else {
+			username = value
+		}
+	}
+	if rawURL == "" {
+		return "", nil
+	}
+	return normalizeLoginURL(rawURL) + "\n" + username, nil
+}
+
+// normalizeLoginURL returns the URL as logins are compared: in lower case,
+// without surrounding spaces and trailing slashes
+func normalizeLoginURL(rawURL string) string {
+	return strings.TrimRight(strings.ToLower(strings.TrimSpace(rawURL)), "/")
+}
+
+// findField returns the field with the name, ignoring case
+func findField(fields []EntryField, name string) *EntryField {
+	for i := range fields {
+		if strings.EqualFold(fields[i].Name, name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// loginHost returns the host of a login URL to use as its title
+func loginHost(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+	return strings.TrimPrefix(parsed.Hostname(), "www.")
+}
@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadBrowserCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []Entry
+	}{
+		{
+			name: "Chrome",
+			csv: "name,url,username,password,note\n" +
+				"Mail,https://mail.example/,alice,hunter2,work\n",
+			want: []Entry{importEntryOf("Mail",
+				general("Username", "alice"),
+				password("Password", "hunter2"),
+				general("URL", "https://mail.example/"),
+				general("Notes", "work"),
+			)},
+		},
+		{
+			name: "Firefox",
+			csv: "\"url\",\"username\",\"password\",\"httpRealm\",\"formActionOrigin\",\"guid\",\"timeCreated\",\"timeLastUsed\",\"timePasswordChanged\"\n" +
+				"\"https://www.forum.example/login\",\"bob\",\" pw \",,\"https://www.forum.example\",\"{1}\",\"1\",\"2\",\"3\"\n",
+			want: []Entry{importEntryOf("forum.example",
+				general("Username", "bob"),
+				password("Password", " pw "),
+				general("URL", "https://www.forum.example/login"),
+			)},
+		},
+		{
+			name: "Safari",
+			csv: "Title,URL,Username,Password,Notes,OTPAuth\n" +
+				"Bank (bob),https://bank.example,bob,secret,  ,otpauth://totp/bank\n",
+			want: []Entry{importEntryOf("Bank (bob)",
+				general("Username", "bob"),
+				password("Password", "secret"),
+				general("URL", "https://bank.example"),
+				password("TOTP", "otpauth://totp/bank"),
+			)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := ReadBrowserCSV(writeImportFixture(t, "passwords.csv", test.csv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range entries {
+				entries[i].ID = ""
+			}
+			if !reflect.DeepEqual(entries, test.want) {
+				t.Errorf("ReadBrowserCSV =\n%+v\nwant\n%+v", entries, test.want)
+			}
+		})
+	}
+
+	if _, err := ReadBrowserCSV(writeImportFixture(t, "passwords.csv", "name,url,password\nMail,https://mail.example,x\n")); err == nil {
+		t.Error("a CSV without a username column was read")
+	}
+}
+
+// revealedEntry returns the entry with the title and its fields in plaintext
+func revealedEntry(t *testing.T, service *WalletService, title string) Entry {
+	t.Helper()
+	var found *Entry
+	service.TraverseForward(func(info PathInfo) bool {
+		if info.IsEntry && info.Entry.Title == title {
+			found = info.Entry
+			return false
+		}
+		return true
+	})
+	if found == nil {
+		t.Fatalf("no entry %s", title)
+	}
+	fields, err := service.RevealFields(found.Fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Entry{Title: found.Title, Fields: fields}
+}
+
+func TestImportLogins(t *testing.T) {
+	service := newTestWallet(t)
+	target := addTestGroup(t, service, Path{}, &Group{Name: "Logins"})
+	mail := importEntryOf("Mail",
+		general("Username", "alice"),
+		password("Password", "hunter2"),
+		general("URL", "https://mail.example"),
+		general("Notes", "work"),
+	)
+	addTestEntry(t, service, target, &mail)
+
+	logins := []Entry{
+		// The same login with the URL written differently brings nothing new
+		importEntryOf("Mail", general("Username", "alice"), password("Password", "hunter2"), general("URL", "HTTPS://Mail.example/")),
+		// A new password and notes are merged, keeping the old values
+		importEntryOf("Mail", general("Username", "alice"), password("Password", "new"), general("URL", "https://mail.example"), general("Notes", "home")),
+		// Another user of the site is a new entry with a free title
+		importEntryOf("Mail", general("Username", "carol"), password("Password", "c"), general("URL", "https://mail.example")),
+		// and a duplicate within the import is skipped
+		importEntryOf("Mail", general("Username", "carol"), password("Password", "c"), general("URL", "https://mail.example/")),
+		// A login without a URL is never a duplicate
+		importEntryOf("Router", password("Password", "admin")),
+	}
+	summary, err := service.ImportLogins(target, logins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ImportSummary{
+		Created: []string{"Mail (2)", "Router"},
+		Skipped: []string{"Mail", "Mail (2)"},
+		Merged:  []string{"Mail"},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+
+	merged := revealedEntry(t, service, "Mail")
+	wantMerged := importEntryOf("Mail",
+		general("Username", "alice"),
+		password("Password", "new"),
+		general("URL", "https://mail.example"),
+		general("Notes", "home"),
+		password("Previous Password", "hunter2"),
+		general("Previous Notes", "work"),
+	)
+	if !reflect.DeepEqual(merged, wantMerged) {
+		t.Errorf("merged entry =\n%+v\nwant\n%+v", merged, wantMerged)
+	}
+
+	// Importing the merged login again skips it
+	summary, err = service.ImportLogins(target, logins[1:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(summary.Skipped, []string{"Mail"}) || len(summary.Merged) != 0 {
+		t.Errorf("summary of the second import = %+v, want Mail skipped", summary)
+	}
+}
+
+func TestImportLoginsFailureKeepsWallet(t *testing.T) {
+	service := newTestWallet(t)
+	target := addTestGroup(t, service, Path{}, &Group{Name: "Logins"})
+	mail := importEntryOf("Mail", general("Username", "alice"), general("URL", "https://mail.example"))
+	addTestEntry(t, service, target, &mail)
+	before := walletOutline(service)
+
+	// The URL of the second login cannot be read, after the first was added
+	broken := EntryField{Name: "URL", Type: FieldTypePassword, sealed: []byte("not a sealed value")}
+	logins := []Entry{
+		importEntryOf("Forum", general("Username", "bob"), general("URL", "https://forum.example")),
+		{Title: "Broken", Fields: []EntryField{broken}},
+	}
+	if _, err := service.ImportLogins(target, logins); err == nil {
+		t.Fatal("ImportLogins with an unreadable login succeeded")
+	}
+	if got := walletOutline(service); !reflect.DeepEqual(got, before) {
+		t.Errorf("wallet after the failed import = %v, want %v", got, before)
+	}
+	if results := service.SearchEntries("forum"); len(results) != 0 {
+		t.Error("the index holds the login of the failed import")
+	}
+}
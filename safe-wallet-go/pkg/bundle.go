@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// IDConflictPolicy decides what happens to items of a bundle whose IDs
+// already exist in the wallet
+type IDConflictPolicy int
+
+const (
+	// ConflictKeepBoth gives the items of the bundle new IDs, so the
+	// existing items are kept next to them
+	ConflictKeepBoth IDConflictPolicy = iota
+	// ConflictReplace merges the bundle into the existing items, e.g. to
+	// take back a subtree that was handed out and updated. Existing groups
+	// stay where they are, entries of the bundle replace the ones with their
+	// IDs and items that only the wallet has are kept.
+	ConflictReplace
+)
+
+// ShareGroup writes the group at path and everything below it to a
+// standalone wallet file, a bundle, that the password and the age recipients
+// unlock. Either may be empty, but not both. An existing file is only
+// replaced with overwrite.
+func (ws *WalletService) ShareGroup(filepath string, path Path, password string, recipients []string, overwrite bool) error {
+	if len(path.GroupIDs) == 0 || path.EntryID != "" {
+		return errors.New("choose a group to share")
+	}
+	return ws.Export(filepath, ExportOptions{
+		Format:     ExportWallet,
+		Path:       path,
+		Password:   password,
+		Recipients: recipients,
+		Overwrite:  overwrite,
+	})
+}
+
+// ReadBundle opens a bundle with the password or, if identityFile is set,
+// with an age identity file and returns its groups
+func ReadBundle(filepath string, password string, identityFile string) ([]Group, error) {
+	bundle := NewWalletService(filepath, password)
+	defer bundle.Close()
+
+	var err error
+	if identityFile != "" {
+		err = bundle.UnlockWithIdentityFile(identityFile)
+	} else {
+		err = bundle.Load()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return openedGroups(bundle.wallet.Groups, bundle.fieldKey.Bytes())
+}
+
+// ImportBundle grafts the groups of a bundle into the group at target, or
+// at the root if target is empty. IDs that exist in the wallet are handled
+// by the policy and names that are taken get a numbered suffix. It returns
+// the number of renamed items. If any of the bundle fails, e.g. because it
+// repeats an ID, the wallet is left as it was.
+func (ws *WalletService) ImportBundle(target Path, groups []Group, policy IDConflictPolicy) (int, error) {
+	if ws.wallet == nil {
+		return 0, errors.New("wallet not loaded")
+	}
+	if len(target.GroupIDs) > 0 {
+		if _, err := FindGroupByPath(ws.wallet, target); err != nil {
+			return 0, err
+		}
+	}
+	if policy != ConflictKeepBoth && policy != ConflictReplace {
+		return 0, errors.New("unknown ID conflict policy")
+	}
+
+	renamed := 0
+	err := ws.changeCopy(func() error {
+		if policy == ConflictReplace {
+			seen := make(map[string]bool)
+			for i := range groups {
+				n, err := ws.mergeBundleGroup(target, &groups[i], seen)
+				if err != nil {
+					return err
+				}
+				renamed += n
+			}
+			return nil
+		}
+
+		for i := range groups {
+			ws.assignNewIDs(&groups[i], make(map[string]bool))
+		}
+		for i := range groups {
+			n, err := ws.ImportGroup(target, &groups[i], nil)
+			if err != nil {
+				return err
+			}
+			renamed += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return renamed, nil
+}
+
+// assignNewIDs gives the groups and entries whose IDs are taken in the
+// wallet, or earlier in the bundle, new IDs
+func (ws *WalletService) assignNewIDs(group *Group, seen map[string]bool) {
+	if seen[group.ID] || checkGroupIDExists(ws.wallet, group.ID) {
+		group.ID = generateGroupID()
+	}
+	seen[group.ID] = true
+	for i := range group.Entries {
+		entry := &group.Entries[i]
+		if seen[entry.ID] || checkEntryIDExists(ws.wallet, entry.ID) {
+			entry.ID = generateEntryID()
+		}
+		seen[entry.ID] = true
+	}
+	for i := range group.Groups {
+		ws.assignNewIDs(&group.Groups[i], seen)
+	}
+}
+
+// mergeBundleGroup merges a group of a bundle into the wallet. A group
+// whose ID exists stays where it is and takes the name from the bundle,
+// otherwise it is added to parent. Entries whose IDs exist are replaced, and
+// moved into the group if they are elsewhere. Groups and entries that are
+// not in the bundle are left alone. It returns the number of renamed items.
+func (ws *WalletService) mergeBundleGroup(parent Path, group *Group, seen map[string]bool) (int, error) {
+	if group.ID != "" {
+		if seen[group.ID] {
+			return 0, fmt.Errorf("the bundle repeats the ID %s", group.ID)
+		}
+		seen[group.ID] = true
+	}
+
+	renamed := 0
+	unique := func(name string, id string, exists func(*Wallet, string, string) bool) string {
+		candidate := name
+		for n := 2; exists(ws.wallet, candidate, id); n++ {
+			candidate = NumberedRename(name, n)
+		}
+		if candidate != name {
+			renamed++
+		}
+		return candidate
+	}
+
+	path, err := GetPathToGroup(ws.wallet, group.ID)
+	if err == nil {
+		name := unique(group.Name, group.ID, checkGroupNameExists)
+		if err := ws.UpdateGroup(path, Group{Name: name}); err != nil {
+			return 0, err
+		}
+	} else {
+		added := &Group{ID: group.ID, Name: unique(group.Name, "", checkGroupNameExists)}
+		if err := ws.AddGroup(parent, added); err != nil {
+			return 0, err
+		}
+		path = copyPath(parent)
+		path.GroupIDs = append(path.GroupIDs, added.ID)
+	}
+
+	for i := range group.Entries {
+		entry := group.Entries[i]
+		if entry.ID != "" {
+			if seen[entry.ID] {
+				return 0, fmt.Errorf("the bundle repeats the ID %s", entry.ID)
+			}
+			seen[entry.ID] = true
+		}
+		existing, err := GetPathToEntry(ws.wallet, entry.ID)
+		if err == nil && existing.GroupIDs[len(existing.GroupIDs)-1] == path.GroupIDs[len(path.GroupIDs)-1] {
+			entry.Title = unique(entry.Title, entry.ID, checkEntryTitleExists)
+			if err := ws.UpdateEntry(existing, entry); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err == nil {
+			if err := ws.DeleteEntry(existing); err != nil {
+				return 0, err
+			}
+		}
+		entry.Title = unique(entry.Title, "", checkEntryTitleExists)
+		if err := ws.AddEntry(path, &entry); err != nil {
+			return 0, err
+		}
+	}
+
+	for i := range group.Groups {
+		n, err := ws.mergeBundleGroup(path, &group.Groups[i], seen)
+		if err != nil {
+			return 0, err
+		}
+		renamed += n
+	}
+	return renamed, nil
+}
@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+// addSharedGroup adds the group Shared holding the entry Router with the
+// password "old" and returns both
+func addSharedGroup(t *testing.T, service *WalletService) (*Group, *Entry) {
+	t.Helper()
+	shared := &Group{Name: "Shared"}
+	sharedPath := addTestGroup(t, service, Path{}, shared)
+	router := &Entry{Title: "Router", Fields: []EntryField{{Name: "Password", Value: "old", Type: FieldTypePassword}}}
+	addTestEntry(t, service, sharedPath, router)
+	return shared, router
+}
+
+func TestImportBundleReplace(t *testing.T) {
+	service := newTestWallet(t)
+	shared, router := addSharedGroup(t, service)
+	addTestGroup(t, service, Path{}, &Group{Name: "Home"})
+
+	// The bundle is the shared group as handed out and updated since
+	bundle := []Group{{
+		ID:   shared.ID,
+		Name: "Shared",
+		Entries: []Entry{
+			{ID: router.ID, Title: "Router", Fields: []EntryField{{Name: "Password", Value: "new", Type: FieldTypePassword}}},
+			{Title: "Printer"},
+		},
+	}}
+	renamed, err := service.ImportBundle(Path{}, bundle, ConflictReplace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed != 0 {
+		t.Errorf("renamed = %d, want 0", renamed)
+	}
+	if want := []string{"Shared/", "Router", "Printer", "Home/"}; !reflect.DeepEqual(walletOutline(service), want) {
+		t.Errorf("wallet = %v, want %v", walletOutline(service), want)
+	}
+	_, entry, err := service.FindEntryByID(router.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := service.FieldValue(entry.Fields[0]); value != "new" {
+		t.Errorf("password = %q, want the one from the bundle", value)
+	}
+}
+
+func TestImportBundleReplaceKeepsWalletOnlyItems(t *testing.T) {
+	service := newTestWallet(t)
+	shared, router := addSharedGroup(t, service)
+	addTestGroup(t, service, Path{}, &Group{Name: "Home"})
+	sharedPath := Path{GroupIDs: []string{shared.ID}}
+	addTestEntry(t, service, sharedPath, &Entry{Title: "Staging"})
+	lab := &Group{Name: "Lab"}
+	nas := &Entry{Title: "NAS"}
+	addTestEntry(t, service, addTestGroup(t, service, sharedPath, lab), nas)
+
+	// The bundle was handed out before Staging was added, and the entry NAS
+	// has since been moved out of Lab
+	bundle := []Group{{
+		ID:      shared.ID,
+		Name:    "Shared",
+		Entries: []Entry{{ID: router.ID, Title: "Router"}, {ID: nas.ID, Title: "NAS"}},
+		Groups:  []Group{{ID: lab.ID, Name: "Lab", Entries: []Entry{{Title: "Switch"}}}},
+	}}
+	if _, err := service.ImportBundle(Path{}, bundle, ConflictReplace); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Shared/", "Router", "Staging", "NAS", "Lab/", "Switch", "Home/"}
+	if got := walletOutline(service); !reflect.DeepEqual(got, want) {
+		t.Errorf("wallet = %v, want %v", got, want)
+	}
+}
+
+func TestImportBundleReplaceFailureKeepsWallet(t *testing.T) {
+	service := newTestWallet(t)
+	shared, router := addSharedGroup(t, service)
+	addTestGroup(t, service, Path{}, &Group{Name: "Home"})
+	before := walletOutline(service)
+	wallet := service.GetWallet()
+
+	// The second group repeats the ID of the first, which fails only after
+	// the first has been merged
+	bundle := []Group{
+		{ID: shared.ID, Name: "Shared", Entries: []Entry{{ID: router.ID, Title: "Router"}}},
+		{ID: shared.ID, Name: "Other"},
+	}
+	if _, err := service.ImportBundle(Path{}, bundle, ConflictReplace); err == nil {
+		t.Fatal("ImportBundle of a bundle with a repeated ID succeeded")
+	}
+	if got := walletOutline(service); !reflect.DeepEqual(got, before) {
+		t.Errorf("wallet after the failed import = %v, want %v", got, before)
+	}
+	if service.GetWallet() != wallet {
+		t.Error("the wallet was replaced")
+	}
+	_, entry, err := service.FindEntryByID(router.ID)
+	if err != nil {
+		t.Fatalf("the replaced entry is gone: %v", err)
+	}
+	if value, _ := service.FieldValue(entry.Fields[0]); value != "old" {
+		t.Errorf("password = %q, want %q", value, "old")
+	}
+}
+
+func TestImportBundleKeepBoth(t *testing.T) {
+	service := newTestWallet(t)
+	shared, router := addSharedGroup(t, service)
+	addTestGroup(t, service, Path{}, &Group{Name: "Home"})
+
+	bundle := []Group{{ID: shared.ID, Name: "Shared", Entries: []Entry{{ID: router.ID, Title: "Router"}}}}
+	renamed, err := service.ImportBundle(Path{}, bundle, ConflictKeepBoth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed != 2 {
+		t.Errorf("renamed = %d, want 2", renamed)
+	}
+	if want := []string{"Shared/", "Router", "Home/", "Shared (2)/", "Router (2)"}; !reflect.DeepEqual(walletOutline(service), want) {
+		t.Errorf("wallet = %v, want %v", walletOutline(service), want)
+	}
+	if bundle[0].ID == shared.ID || bundle[0].Entries[0].ID == router.ID {
+		t.Error("the imported items kept the IDs of existing ones")
+	}
+	if _, _, err := service.FindEntryByID(router.ID); err != nil {
+		t.Errorf("the existing entry is gone: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClipboardUnreadable is returned by clipboards that can only be written,
+// such as OSC 52 terminal escapes
+var ErrClipboardUnreadable = errors.New("clipboard cannot be read")
+
+// Clipboard is a system clipboard backend
+type Clipboard interface {
+	// SetText replaces the clipboard content
+	SetText(text string) error
+	// Text returns the clipboard content, or ErrClipboardUnreadable
+	Text() (string, error)
+}
+
+// CommandClipboard uses external helper programs such as wl-copy or xclip
+type CommandClipboard struct {
+	CopyCommand  []string // reads the new content from stdin
+	PasteCommand []string // writes the content to stdout, may be empty
+}
+
+// SetText replaces the clipboard content by running the copy command
+func (c *CommandClipboard) SetText(text string) error {
+	cmd := exec.Command(c.CopyCommand[0], c.CopyCommand[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %v", c.CopyCommand[0], err)
+	}
+	return nil
+}
+
+// Text returns the clipboard content by running the paste command
+func (c *CommandClipboard) Text() (string, error) {
+	if len(c.PasteCommand) == 0 {
+		return "", ErrClipboardUnreadable
+	}
+	var out bytes.Buffer
+	cmd := exec.Command(c.PasteCommand[0], c.PasteCommand[1:]...)
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %v", c.PasteCommand[0], err)
+	}
+	return out.String(), nil
+}
+
+// OSC52Clipboard sets the clipboard of the terminal emulator through the
+// OSC 52 escape sequence, which also works over SSH. It cannot be read.
+type OSC52Clipboard struct {
+	Out io.Writer
+}
+
+// SetText writes the OSC 52 sequence that replaces the clipboard content
+func (c *OSC52Clipboard) SetText(text string) error {
+	_, err := fmt.Fprintf(c.Out, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
+
+// Text always fails because terminals do not reliably answer OSC 52 queries
+func (c *OSC52Clipboard) Text() (string, error) {
+	return "", ErrClipboardUnreadable
+}
+
+// MemoryClipboard is an in-process clipboard, used as a stand-in for the
+// system clipboard in tests and when no clipboard is available
+type MemoryClipboard struct {
+	mu   sync.Mutex
+	text string
+}
+
+// SetText replaces the clipboard content
+func (c *MemoryClipboard) SetText(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.text = text
+	return nil
+}
+
+// Text returns the clipboard content
+func (c *MemoryClipboard) Text() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.text, nil
+}
+
+// NewClipboard returns the clipboard backend with the given name: "wayland",
+// "xclip", "xsel", "pbcopy", "osc52", "memory", or "auto" to detect one
+func NewClipboard(name string) (Clipboard, error) {
+	switch name {
+	case "", "auto":
+		return DetectClipboard(), nil
+	case "wayland":
+		return &CommandClipboard{CopyCommand: []string{"wl-copy"}, PasteCommand: []string{"wl-paste", "--no-newline"}}, nil
+	case "xclip":
+		return &CommandClipboard{CopyCommand: []string{"xclip", "-selection", "clipboard"}, PasteCommand: []string{"xclip", "-selection", "clipboard", "-o"}}, nil
+	case "xsel":
+		return &CommandClipboard{CopyCommand: []string{"xsel", "--clipboard", "--input"}, PasteCommand: []string{"xsel", "--clipboard", "--output"}}, nil
+	case "pbcopy":
+		return &CommandClipboard{CopyCommand: []string{"pbcopy"}, PasteCommand: []string{"pbpaste"}}, nil
+	case "osc52":
+		return &OSC52Clipboard{Out: os.Stdout}, nil
+	case "memory":
+		return &MemoryClipboard{}, nil
+	default:
+		return nil, fmt.Errorf("unknown clipboard backend '%s'", name)
+	}
+}
+
+// DetectClipboard picks a clipboard helper available on this system and
+// falls back to OSC 52 terminal escapes
+func DetectClipboard() Clipboard {
+	var candidates []string
+	switch {
+	case runtime.GOOS == "darwin":
+		candidates = []string{"pbcopy"}
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		candidates = []string{"wayland", "xclip", "xsel"}
+	case os.Getenv("DISPLAY") != "":
+		candidates = []string{"xclip", "xsel"}
+	}
+
+	helpers := map[string]string{"wayland": "wl-copy", "xclip": "xclip", "xsel": "xsel", "pbcopy": "pbcopy"}
+	for _, name := range candidates {
+		if _, err := exec.LookPath(helpers[name]); err == nil {
+			clipboard, _ := NewClipboard(name)
+			return clipboard
+		}
+	}
+
+	return &OSC52Clipboard{Out: os.Stdout}
+}
+
+// ClipboardGuard copies secrets to a clipboard and clears them again after
+// a timeout, unless the clipboard content has been replaced in the meantime
+type ClipboardGuard struct {
+	mu        sync.Mutex
+	clipboard Clipboard
+	timeout   time.Duration
+	secret    string
+	deadline  time.Time
+	timer     *time.Timer
+	copies    int // incremented for every copy, so stale timers do nothing
+
+	// OnCleared is called when the timeout expired and the secret is no
+	// longer on the clipboard
+	OnCleared func()
+	// Dispatch runs the timed clear, e.g. on a UI thread. If nil the clear
+	// runs on the timer's goroutine.
+	Dispatch func(fn func())
+}
+
+// NewClipboardGuard creates a guard for the clipboard. A zero timeout
+// never clears the clipboard automatically.
+func NewClipboardGuard(clipboard Clipboard, timeout time.Duration) *ClipboardGuard {
+	return &ClipboardGuard{
+		clipboard: clipboard,
+		timeout:   timeout,
+	}
+}
+
+// Timeout returns how long copied secrets stay on the clipboard
+func (g *ClipboardGuard) Timeout() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.timeout
+}
+
+// SetTimeout changes the timeout for secrets copied from now on
+func (g *ClipboardGuard) SetTimeout(timeout time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.timeout = timeout
+}
+
+// Copy places the secret on the clipboard and schedules clearing it
+func (g *ClipboardGuard) Copy(secret string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.clipboard.SetText(secret); err != nil {
+		return err
+	}
+
+	g.stopLocked()
+	if g.timeout <= 0 {
+		return nil
+	}
+
+	g.copies++
+	copyNumber := g.copies
+	g.secret = secret
+	g.deadline = time.Now().Add(g.timeout)
+	clear := func() {
+		g.mu.Lock()
+		cleared := g.copies == copyNumber && g.secret != "" && g.clearLocked() == nil
+		onCleared := g.OnCleared
+		g.mu.Unlock()
+
+		if cleared && onCleared != nil {
+			onCleared()
+		}
+	}
+	g.timer = time.AfterFunc(g.timeout, func() {
+		if g.Dispatch != nil {
+			g.Dispatch(clear)
+		} else {
+			clear()
+		}
+	})
+	return nil
+}
+
+// Remaining returns the time left until the clipboard is cleared, or zero
+// if no secret is pending
+func (g *ClipboardGuard) Remaining() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.secret == "" {
+		return 0
+	}
+	remaining := time.Until(g.deadline)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Clear clears a pending secret from the clipboard immediately
+func (g *ClipboardGuard) Clear() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.secret == "" {
+		return nil
+	}
+	return g.clearLocked()
+}
+
+// clearLocked clears the clipboard if it still holds the secret.
+// Clipboards that cannot be read are cleared unconditionally.
+func (g *ClipboardGuard) clearLocked() error {
+	secret := g.secret
+	g.stopLocked()
+
+	current, err := g.clipboard.Text()
+	if err != nil && err != ErrClipboardUnreadable {
+		return err
+	}
+	if err == nil && current != secret {
+		return nil // Replaced by the user, leave it alone
+	}
+	return g.clipboard.SetText("")
+}
+
+// stopLocked cancels the pending clear
+func (g *ClipboardGuard) stopLocked() {
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	g.secret = ""
+	g.deadline = time.Time{}
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+// waitForClipboard polls the clipboard until it holds want or the test
+// times out
+func waitForClipboard(t *testing.T, clipboard *MemoryClipboard, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		text, _ := clipboard.Text()
+		if text == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("clipboard = %q, want %q", text, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClipboardGuardClearsAfterTimeout(t *testing.T) {
+	clipboard := &MemoryClipboard{}
+	guard := NewClipboardGuard(clipboard, 20*time.Millisecond)
+	cleared := make(chan struct{})
+	guard.OnCleared = func() { close(cleared) }
+
+	if err := guard.Copy("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := clipboard.Text(); text != "hunter2" {
+		t.Fatalf("clipboard after Copy = %q", text)
+	}
+	if remaining := guard.Remaining(); remaining <= 0 || remaining > 20*time.Millisecond {
+		t.Errorf("Remaining = %s", remaining)
+	}
+
+	select {
+	case <-cleared:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnCleared not called")
+	}
+	if text, _ := clipboard.Text(); text != "" {
+		t.Errorf("clipboard after the timeout = %q", text)
+	}
+	if remaining := guard.Remaining(); remaining != 0 {
+		t.Errorf("Remaining after the timeout = %s", remaining)
+	}
+}
+
+func TestClipboardGuardKeepsReplacedContent(t *testing.T) {
+	clipboard := &MemoryClipboard{}
+	guard := NewClipboardGuard(clipboard, 20*time.Millisecond)
+	ran := make(chan struct{})
+	guard.Dispatch = func(fn func()) {
+		fn()
+		close(ran)
+	}
+
+	if err := guard.Copy("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	// The user copies something else before the timeout
+	clipboard.SetText("shopping list")
+
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed clear not dispatched")
+	}
+	if text, _ := clipboard.Text(); text != "shopping list" {
+		t.Errorf("clipboard = %q, the replaced content was cleared", text)
+	}
+}
+
+func TestClipboardGuardNewCopyRestartsTimer(t *testing.T) {
+	clipboard := &MemoryClipboard{}
+	guard := NewClipboardGuard(clipboard, 50*time.Millisecond)
+
+	if err := guard.Copy("first"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := guard.Copy("second"); err != nil {
+		t.Fatal(err)
+	}
+	// The timer of the first copy would have fired by now
+	time.Sleep(30 * time.Millisecond)
+	if text, _ := clipboard.Text(); text != "second" {
+		t.Fatalf("clipboard = %q, cleared by the timer of an earlier copy", text)
+	}
+	waitForClipboard(t, clipboard, "")
+}
+
+func TestClipboardGuardClear(t *testing.T) {
+	clipboard := &MemoryClipboard{}
+	guard := NewClipboardGuard(clipboard, time.Hour)
+
+	if err := guard.Copy("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := clipboard.Text(); text != "" {
+		t.Errorf("clipboard after Clear = %q", text)
+	}
+
+	// Without a timeout the secret stays until it is replaced
+	guard.SetTimeout(0)
+	if err := guard.Copy("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := clipboard.Text(); text != "hunter2" {
+		t.Errorf("clipboard without a timeout = %q", text)
+	}
+}
@@ -20,21 +20,22 @@ const (
 )
 
 // deriveKey derives an encryption key from a password using PBKDF2
-func deriveKey(password string, salt []byte) []byte {
-	return pbkdf2.Key([]byte(password), salt, iterations, keySize, sha256.New)
+func deriveKey(password []byte, salt []byte) *SecureBuffer {
+	return NewSecureBufferFrom(pbkdf2.Key(password, salt, iterations, keySize, sha256.New))
 }
 
-// EncryptData encrypts data using AES-GCM with a password-derived key
-func EncryptData(data []byte, password string) ([]byte, error) {
-	// Generate random salt
+// newSalt generates a random salt for key derivation
+func newSalt() ([]byte, error) {
 	salt := make([]byte, saltSize)
 	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
 		return nil, err
 	}
+	return salt, nil
+}
 
-	// Derive key from password
-	key := deriveKey(password, salt)
-
+// encryptWithKey encrypts data using AES-GCM with the data key. The header
+// with the key slots is stored in front of the nonce.
+func encryptWithKey(data []byte, key []byte, header WalletHeader) ([]byte, error) {
 	// Create AES cipher
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -54,30 +55,29 @@ func EncryptData(data []byte, password string) ([]byte, error) {
 	}
 
 	// Encrypt and authenticate
-	ciphertext := gcm.Seal(nil, nonce, data, nil)
+	headerBytes := header.bytes(key)
+	ciphertext := gcm.Seal(nil, nonce, data, header.additionalData())
 
-	// Prepend salt and nonce to ciphertext
-	encrypted := make([]byte, 0, len(salt)+len(nonce)+len(ciphertext))
-	encrypted = append(encrypted, salt...)
+	// Prepend header and nonce to ciphertext
+	encrypted := make([]byte, 0, len(headerBytes)+len(nonce)+len(ciphertext))
+	encrypted = append(encrypted, headerBytes...)
 	encrypted = append(encrypted, nonce...)
 	encrypted = append(encrypted, ciphertext...)
 
 	return encrypted, nil
 }
 
-// DecryptData decrypts data using AES-GCM with a password-derived key
-func DecryptData(encrypted []byte, password string) ([]byte, error) {
-	if len(encrypted) < saltSize+nonceSize {
-		return nil, errors.New("encrypted data too short")
+// decryptWithKey decrypts data encrypted by encryptWithKey and checks that
+// the key slots in its header were written with the same key
+func decryptWithKey(encrypted []byte, key []byte) ([]byte, error) {
+	header, headerSize, err := parseWalletHeader(encrypted)
+	if err != nil {
+		return nil, err
 	}
 
-	// Extract salt, nonce, and ciphertext
-	salt := encrypted[:saltSize]
-	nonce := encrypted[saltSize : saltSize+nonceSize]
-	ciphertext := encrypted[saltSize+nonceSize:]
-
-	// Derive key from password
-	key := deriveKey(password, salt)
+	// Extract nonce and ciphertext
+	nonce := encrypted[headerSize : headerSize+nonceSize]
+	ciphertext := encrypted[headerSize+nonceSize:]
 
 	// Create AES cipher
 	block, err := aes.NewCipher(key)
@@ -92,14 +92,60 @@ func DecryptData(encrypted []byte, password string) ([]byte, error) {
 	}
 
 	// Decrypt and verify
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, header.additionalData())
 	if err != nil {
 		return nil, errors.New("decryption failed: invalid password or corrupted data")
 	}
+	if err := header.verify(key); err != nil {
+		Wipe(plaintext)
+		return nil, err
+	}
 
 	return plaintext, nil
 }
 
+// EncryptData encrypts data using AES-GCM with a random data key, wrapped in
+// a single key slot for the password
+func EncryptData(data []byte, password string) ([]byte, error) {
+	key, err := newDataKey()
+	if err != nil {
+		return nil, err
+	}
+	defer key.Destroy()
+
+	passwordBytes := []byte(password)
+	slot, err := newPasswordSlot(generateUniqueID("slot"), "Master password", passwordBytes, nil, key)
+	Wipe(passwordBytes)
+	if err != nil {
+		return nil, err
+	}
+	return encryptWithKey(data, key.Bytes(), WalletHeader{Version: currentFormatVersion, Slots: []KeySlot{slot}})
+}
+
+// DecryptData decrypts data written by EncryptData, or by an older version
+// with a key derived directly from the password
+func DecryptData(encrypted []byte, password string) ([]byte, error) {
+	header, _, err := parseWalletHeader(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordBytes := []byte(password)
+	defer Wipe(passwordBytes)
+	var key *SecureBuffer
+	if header.Version == currentFormatVersion {
+		key, _, err = openPasswordSlots(header.Slots, passwordBytes, nil)
+	} else {
+		key, err = deriveWalletKey(passwordBytes, nil, header)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer key.Destroy()
+
+	return decryptWithKey(encrypted, key.Bytes())
+}
+
 // EncryptToBase64 encrypts data and returns it as a base64-encoded string
 func EncryptToBase64(data []byte, password string) (string, error) {
 	encrypted, err := EncryptData(data, password)
@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+)
+
+// encryptLegacy encrypts data like version 1 and 2 wallets, with a key
+// derived directly from the password and the keyfile digest
+func encryptLegacy(t *testing.T, data []byte, password string, keyFile *SecureBuffer, version byte) []byte {
+	t.Helper()
+	salt, err := newSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := WalletHeader{Version: version, KeyFile: keyFile != nil, Salt: salt}
+	key, err := deriveWalletKey([]byte(password), keyFile, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Destroy()
+	encrypted, err := encryptWithKey(data, key.Bytes(), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encrypted
+}
+
+func TestEncryptDataWritesKeySlots(t *testing.T) {
+	encrypted, err := EncryptData([]byte("secret"), "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _, err := parseWalletHeader(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != currentFormatVersion || len(header.Slots) != 1 || header.Slots[0].Type != SlotTypePassword {
+		t.Fatalf("EncryptData wrote version %d with slots %+v", header.Version, header.Slots)
+	}
+
+	plaintext, err := DecryptData(encrypted, "password")
+	if err != nil || string(plaintext) != "secret" {
+		t.Fatalf("DecryptData = %q, %v", plaintext, err)
+	}
+	if _, err := DecryptData(encrypted, "wrong"); err == nil {
+		t.Error("DecryptData with the wrong password succeeded")
+	}
+}
+
+func TestDecryptDataReadsOlderFormats(t *testing.T) {
+	for _, version := range []byte{legacyFormatVersion, keyFileFormatVersion} {
+		encrypted := encryptLegacy(t, []byte("secret"), "password", nil, version)
+		if version == legacyFormatVersion && bytes.HasPrefix(encrypted, []byte(walletMagic)) {
+			t.Fatal("version 1 data starts with the magic")
+		}
+		plaintext, err := DecryptData(encrypted, "password")
+		if err != nil || string(plaintext) != "secret" {
+			t.Errorf("version %d: DecryptData = %q, %v", version, plaintext, err)
+		}
+		if _, err := DecryptData(encrypted, "wrong"); err == nil {
+			t.Errorf("version %d: DecryptData with the wrong password succeeded", version)
+		}
+	}
+}
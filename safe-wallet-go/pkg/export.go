@@ -0,0 +1,474 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ExportFormat selects the file format of an export
+type ExportFormat string
+
+const (
+	// ExportWallet writes a wallet file locked by its own password or
+	// recipient keys
+	ExportWallet ExportFormat = "wallet"
+	// ExportJSON writes the Wallet model as plaintext JSON
+	ExportJSON ExportFormat = "json"
+	// ExportCSV writes one plaintext row per entry with a group path column
+	// and a column per field name, numbered if an entry repeats the name
+	ExportCSV ExportFormat = "csv"
+	// ExportKeePassXML writes the plaintext XML that KeePass 2 imports
+	ExportKeePassXML ExportFormat = "keepass-xml"
+)
+
+// ExportFormats are the supported export formats
+var ExportFormats = []ExportFormat{ExportWallet, ExportJSON, ExportCSV, ExportKeePassXML}
+
+// ErrPlaintextNotConfirmed is returned for a plaintext export without
+// ExportOptions.ConfirmPlaintext
+var ErrPlaintextNotConfirmed = errors.New("plaintext export writes all passwords unencrypted and must be confirmed")
+
+// ErrExportExists is returned when the export file exists and
+// ExportOptions.Overwrite is not set
+var ErrExportExists = errors.New("the export file already exists")
+
+// IsPlaintext reports whether the format writes field values unencrypted
+func (f ExportFormat) IsPlaintext() bool {
+	return f != ExportWallet
+}
+
+// ExportOptions controls what is exported and how
+type ExportOptions struct {
+	Format ExportFormat
+	// Path selects the group, or the entry, to export. The whole wallet is
+	// exported if it is empty.
+	Path Path
+	// Password locks an ExportWallet file
+	Password string
+	// Recipients are age recipients whose identity files unlock an
+	// ExportWallet file instead of a password
+	Recipients []string
+	// ConfirmPlaintext must be set for plaintext formats
+	ConfirmPlaintext bool
+	// Overwrite replaces an existing file. The open wallet is never
+	// overwritten.
+	Overwrite bool
+}
+
+// Export writes the wallet, or the subtree at options.Path, to a new file
+func (ws *WalletService) Export(path string, options ExportOptions) error {
+	if ws.wallet == nil {
+		return errors.New("wallet not loaded")
+	}
+	if options.Format.IsPlaintext() && !options.ConfirmPlaintext {
+		return ErrPlaintextNotConfirmed
+	}
+	if err := ws.checkExportTarget(path, options.Overwrite); err != nil {
+		return err
+	}
+
+	groups, prefix, err := ws.exportGroups(options.Path)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch options.Format {
+	case ExportWallet:
+		return ws.exportWallet(path, groups, options)
+	case ExportJSON:
+		data, err = json.MarshalIndent(&Wallet{Version: ws.wallet.Version, Groups: groups}, "", "  ")
+	case ExportCSV:
+		data, err = exportCSV(groups, prefix)
+	case ExportKeePassXML:
+		data, err = exportKeePassXML(groups)
+	default:
+		return fmt.Errorf("unknown export format '%s'", options.Format)
+	}
+	if err != nil {
+		return err
+	}
+	defer Wipe(data)
+	return writeExportFile(path, data, options.Overwrite)
+}
+
+// checkExportTarget refuses to write an export over the open wallet, into
+// its sync directory or, unless overwrite is set, over any existing file.
+// Paths are compared by the files they name, so "./w.dat" is the wallet
+// w.dat too.
+func (ws *WalletService) checkExportTarget(path string, overwrite bool) error {
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(target)
+	switch {
+	case err == nil && info.IsDir():
+		return fmt.Errorf("%s is a directory", path)
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+
+	if _, local := ws.storage.(FileStorage); local {
+		if wallet, err := os.Stat(ws.filepath); err == nil {
+			// The target or any directory above it must not be the wallet
+			for dir := target; ; dir = filepath.Dir(dir) {
+				if dirInfo, err := os.Stat(dir); err == nil && os.SameFile(dirInfo, wallet) {
+					return errors.New("cannot export over the open wallet")
+				}
+				if dir == filepath.Dir(dir) {
+					break
+				}
+			}
+		}
+	}
+
+	if info != nil && !overwrite {
+		return ErrExportExists
+	}
+	return nil
+}
+
+// writeExportFile writes a plaintext export readable by the owner only. A
+// new file is created exclusively, so a file created in the meantime is not
+// overwritten. With overwrite the data is written next to the target first
+// and moved over it.
+func writeExportFile(path string, data []byte, overwrite bool) error {
+	if !overwrite {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // 0600 = rw-------
+		if err != nil {
+			if os.IsExist(err) {
+				return ErrExportExists
+			}
+			return err
+		}
+		if _, err := file.Write(data); err != nil {
+			file.Close()
+			os.Remove(path)
+			return err
+		}
+		return file.Close()
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+// placeExportFile moves a finished export from temp to path. Without
+// overwrite it is linked to path, which fails if path exists meanwhile.
+func placeExportFile(temp string, path string, overwrite bool) error {
+	if overwrite {
+		return os.Rename(temp, path)
+	}
+	if err := os.Link(temp, path); err != nil {
+		if os.IsExist(err) {
+			return ErrExportExists
+		}
+		// Some filesystems have no hard links
+		if _, statErr := os.Lstat(path); statErr == nil {
+			return ErrExportExists
+		}
+		return os.Rename(temp, path)
+	}
+	return os.Remove(temp)
+}
+
+// exportGroups returns a plaintext copy of the groups to export and the
+// names of the groups above them
+func (ws *WalletService) exportGroups(path Path) ([]Group, []string, error) {
+	if len(path.GroupIDs) == 0 {
+		groups, err := openedGroups(ws.wallet.Groups, ws.fieldKey.Bytes())
+		return groups, nil, err
+	}
+
+	group, err := FindGroupByPath(ws.wallet, Path{GroupIDs: path.GroupIDs})
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := *group
+	if path.EntryID != "" {
+		entry, err := FindEntryByPath(ws.wallet, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		selected.Groups = nil
+		selected.Entries = []Entry{*entry}
+	}
+	groups, err := openedGroups([]Group{selected}, ws.fieldKey.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var prefix []string
+	for i := 1; i < len(path.GroupIDs); i++ {
+		parent, err := FindGroupByPath(ws.wallet, Path{GroupIDs: path.GroupIDs[:i]})
+		if err != nil {
+			return nil, nil, err
+		}
+		prefix = append(prefix, parent.Name)
+	}
+	return groups, prefix, nil
+}
+
+// exportWallet writes the groups to a new wallet file that the password and
+// the recipients unlock. The file has no recovery key. It is written next to
+// path and only moved there once complete.
+func (ws *WalletService) exportWallet(path string, groups []Group, options ExportOptions) error {
+	if options.Password == "" && len(options.Recipients) == 0 {
+		return errors.New("an encrypted export needs a password or recipients")
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".export-*")
+	if err != nil {
+		return err
+	}
+	temp.Close()
+	if err := ws.writeExportWallet(temp.Name(), groups, options); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := placeExportFile(temp.Name(), path, options.Overwrite); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return nil
+}
+
+// writeExportWallet creates the wallet file of an ExportWallet export with
+// a key slot for the password, if given, and for each recipient
+func (ws *WalletService) writeExportWallet(path string, groups []Group, options ExportOptions) error {
+	key, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	slots, err := newRecipientSlots(options.Recipients, key)
+	if err != nil {
+		key.Destroy()
+		return err
+	}
+	if options.Password != "" {
+		password := []byte(options.Password)
+		slot, err := newPasswordSlot(generateUniqueID("slot"), "Password", password, nil, key)
+		Wipe(password)
+		if err != nil {
+			key.Destroy()
+			return err
+		}
+		slots = append([]KeySlot{slot}, slots...)
+	}
+
+	export := NewWalletService(path, "")
+	defer export.Close()
+	if err := export.create(key, slots, ""); err != nil {
+		return err
+	}
+	for i := range groups {
+		if err := export.AddGroup(Path{}, &groups[i]); err != nil {
+			return err
+		}
+	}
+	return export.Save()
+}
+
+// exportCSV flattens the entries to rows of group path, title and a column
+// for every field name in the order the names first appear. A name that an
+// entry repeats gets a column for each repetition, e.g. "URL (2)".
+func exportCSV(groups []Group, prefix []string) ([]byte, error) {
+	// csvColumn is the n-th field with the name in an entry
+	type csvColumn struct {
+		name string
+		n    int
+	}
+	type row struct {
+		group  string
+		entry  Entry
+		values map[csvColumn]string
+	}
+	var rows []row
+	var columns []csvColumn
+	seen := make(map[csvColumn]bool)
+
+	var walk func(groups []Group, names []string)
+	walk = func(groups []Group, names []string) {
+		for _, group := range groups {
+			groupNames := append(append([]string(nil), names...), group.Name)
+			for _, entry := range group.Entries {
+				values := make(map[csvColumn]string)
+				counts := make(map[string]int)
+				for _, field := range entry.Fields {
+					counts[field.Name]++
+					column := csvColumn{name: field.Name, n: counts[field.Name]}
+					if !seen[column] {
+						seen[column] = true
+						columns = append(columns, column)
+					}
+					values[column] = field.Value
+				}
+				rows = append(rows, row{group: JoinNamePath(groupNames), entry: entry, values: values})
+			}
+			walk(group.Groups, groupNames)
+		}
+	}
+	walk(groups, prefix)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	header := []string{"Group", "Title"}
+	used := map[string]bool{"Group": true, "Title": true}
+	for _, column := range columns {
+		base := column.name
+		if column.n > 1 {
+			base = NumberedRename(column.name, column.n)
+		}
+		// Keep the header unique if a field is named like a fixed column or
+		// like the column of a repeated name
+		name := base
+		for n := 2; used[name]; n++ {
+			name = NumberedRename(base, n)
+		}
+		used[name] = true
+		header = append(header, name)
+	}
+	writer.Write(header)
+	for _, r := range rows {
+		record := []string{r.group, r.entry.Title}
+		for _, column := range columns {
+			record = append(record, r.values[column])
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// KeePass XML export. Standard fields map to the KeePass strings, other
+// fields are kept as custom strings.
+
+type keePassXMLFile struct {
+	XMLName xml.Name        `xml:"KeePassFile"`
+	Meta    keePassXMLMeta  `xml:"Meta"`
+	Root    keePassXMLGroup `xml:"Root>Group"`
+}
+
+type keePassXMLMeta struct {
+	Generator    string `xml:"Generator"`
+	DatabaseName string `xml:"DatabaseName"`
+}
+
+type keePassXMLGroup struct {
+	UUID    string            `xml:"UUID"`
+	Name    string            `xml:"Name"`
+	Entries []keePassXMLEntry `xml:"Entry"`
+	Groups  []keePassXMLGroup `xml:"Group"`
+}
+
+type keePassXMLEntry struct {
+	UUID    string             `xml:"UUID"`
+	Strings []keePassXMLString `xml:"String"`
+}
+
+type keePassXMLString struct {
+	Key   string          `xml:"Key"`
+	Value keePassXMLValue `xml:"Value"`
+}
+
+type keePassXMLValue struct {
+	ProtectInMemory string `xml:"ProtectInMemory,attr,omitempty"`
+	Text            string `xml:",chardata"`
+}
+
+// exportKeePassXML writes the groups below a root group as KeePass 2 XML
+func exportKeePassXML(groups []Group) ([]byte, error) {
+	root := keePassXMLGroup{UUID: keePassUUID("root"), Name: "Safe Wallet"}
+	if len(groups) == 1 {
+		root = keePassXMLGroupOf(groups[0])
+	} else {
+		for _, group := range groups {
+			root.Groups = append(root.Groups, keePassXMLGroupOf(group))
+		}
+	}
+
+	file := keePassXMLFile{
+		Meta: keePassXMLMeta{Generator: "Safe Wallet", DatabaseName: root.Name},
+		Root: root,
+	}
+	data, err := xml.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+func keePassXMLGroupOf(group Group) keePassXMLGroup {
+	result := keePassXMLGroup{UUID: keePassUUID(group.ID), Name: group.Name}
+	for _, entry := range group.Entries {
+		result.Entries = append(result.Entries, keePassXMLEntryOf(entry))
+	}
+	for _, subgroup := range group.Groups {
+		result.Groups = append(result.Groups, keePassXMLGroupOf(subgroup))
+	}
+	return result
+}
+
+func keePassXMLEntryOf(entry Entry) keePassXMLEntry {
+	result := keePassXMLEntry{UUID: keePassUUID(entry.ID)}
+	used := map[string]bool{"Title": true}
+	add := func(key string, value string, protect bool) {
+		var protected string
+		if protect {
+			protected = "True"
+		}
+		result.Strings = append(result.Strings, keePassXMLString{Key: key, Value: keePassXMLValue{ProtectInMemory: protected, Text: value}})
+	}
+	add("Title", entry.Title, false)
+
+	// KeePass needs unique keys and reserves the standard ones
+	reserved := func(key string) bool {
+		return used[key] || isKeePassStandardField(key)
+	}
+	for _, field := range entry.Fields {
+		key := ""
+		for _, standard := range keePassStandardFields {
+			if standard.name == field.Name && !used[standard.key] {
+				key = standard.key
+			}
+		}
+		if key == "" {
+			key = field.Name
+			for n := 2; reserved(key); n++ {
+				key = NumberedRename(field.Name, n)
+			}
+		}
+		used[key] = true
+		add(key, field.Value, field.Type.IsSensitive())
+	}
+	return result
+}
+
+// keePassUUID derives the base64 KeePass UUID of an item from its ID, so
+// exporting again gives the same UUIDs
+func keePassUUID(id string) string {
+	hash := sha256.Sum256([]byte("safe-wallet " + id))
+	return base64.StdEncoding.EncodeToString(hash[:16])
+}
@@ -0,0 +1,262 @@
+package pkg
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// clashingFields returns the fields of a login whose names repeat and
+// clash with the columns of a CSV export
+func clashingFields() []EntryField {
+	return []EntryField{
+		general("Username", "alice"),
+		password("Password", "hunter2"),
+		general("URL", "https://a.example"),
+		general("URL", "https://b.example"),
+		general("URL (2)", "https://c.example"),
+		general("Title", "Inbox"),
+	}
+}
+
+// exportTo exports to a new file in a temporary directory and returns its path
+func exportTo(t *testing.T, service *WalletService, options ExportOptions) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "export")
+	if err := service.Export(path, options); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExportCSV(t *testing.T) {
+	service := newTestWallet(t)
+	work := addTestGroup(t, service, Path{}, &Group{Name: "Work"})
+	cloud := addTestGroup(t, service, work, &Group{Name: "Cloud"})
+	addTestEntry(t, service, work, &Entry{Title: "Mail", Fields: clashingFields()})
+	addTestEntry(t, service, cloud, &Entry{Title: "AWS", Fields: []EntryField{password("Password", "p, \"quoted\"")}})
+
+	path := exportTo(t, service, ExportOptions{Format: ExportCSV, ConfirmPlaintext: true})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Group", "Title", "Username", "Password", "URL", "URL (2)", "URL (2) (2)", "Title (2)"},
+		{"/Work", "Mail", "alice", "hunter2", "https://a.example", "https://b.example", "https://c.example", "Inbox"},
+		{"/Work/Cloud", "AWS", "", "p, \"quoted\"", "", "", "", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV =\n%q\nwant\n%q", records, want)
+	}
+
+	// A subtree keeps the names of the groups above it
+	path = exportTo(t, service, ExportOptions{Format: ExportCSV, Path: cloud, ConfirmPlaintext: true})
+	if data, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Group,Title,Password\n/Work/Cloud,AWS,\"p, \"\"quoted\"\"\"\n"; string(data) != want {
+		t.Errorf("CSV of the subtree = %q, want %q", data, want)
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	service := newTestWallet(t)
+	work := addTestGroup(t, service, Path{}, &Group{Name: "Work"})
+	addTestEntry(t, service, work, &Entry{Title: "Mail", Fields: []EntryField{general("Username", "alice"), password("Password", "hunter2")}})
+	addTestGroup(t, service, work, &Group{Name: "Cloud"})
+
+	path := exportTo(t, service, ExportOptions{Format: ExportJSON, ConfirmPlaintext: true})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported Wallet
+	if err := json.Unmarshal(data, &exported); err != nil {
+		t.Fatal(err)
+	}
+	want, err := openedGroups(service.GetWallet().Groups, service.fieldKey.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exported.Groups, want) {
+		t.Errorf("JSON groups =\n%+v\nwant\n%+v", exported.Groups, want)
+	}
+	if exported.Groups[0].Entries[0].Fields[1].Value != "hunter2" {
+		t.Error("the JSON export does not hold the password in plaintext")
+	}
+}
+
+func TestExportKeePassXML(t *testing.T) {
+	service := newTestWallet(t)
+	work := addTestGroup(t, service, Path{}, &Group{Name: "Work"})
+	addTestGroup(t, service, work, &Group{Name: "Cloud"})
+	addTestEntry(t, service, work, &Entry{Title: "Mail", Fields: clashingFields()})
+
+	path := exportTo(t, service, ExportOptions{Format: ExportKeePassXML, ConfirmPlaintext: true})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file keePassXMLFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	if file.Root.Name != "Work" || len(file.Root.Groups) != 1 || file.Root.Groups[0].Name != "Cloud" {
+		t.Fatalf("groups = %+v, want Work holding Cloud", file.Root)
+	}
+
+	var keys []string
+	values := make(map[string]keePassXMLValue)
+	for _, s := range file.Root.Entries[0].Strings {
+		keys = append(keys, s.Key)
+		values[s.Key] = s.Value
+	}
+	wantKeys := []string{"Title", "UserName", "Password", "URL", "URL (2)", "URL (2) (2)", "Title (2)"}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("keys = %q, want %q", keys, wantKeys)
+	}
+	if v := values["Password"]; v.Text != "hunter2" || v.ProtectInMemory != "True" {
+		t.Errorf("Password = %+v, want the protected password", v)
+	}
+	if v := values["URL (2)"]; v.Text != "https://b.example" || v.ProtectInMemory != "" {
+		t.Errorf("URL (2) = %+v, want the second URL", v)
+	}
+
+	// The UUIDs stay the same on the next export
+	again, err := os.ReadFile(exportTo(t, service, ExportOptions{Format: ExportKeePassXML, ConfirmPlaintext: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Error("exporting again gives a different file")
+	}
+}
+
+func TestExportNeedsPlaintextConfirmation(t *testing.T) {
+	service := newTestWallet(t)
+	work := addTestGroup(t, service, Path{}, &Group{Name: "Work"})
+	addTestEntry(t, service, work, &Entry{Title: "Mail", Fields: []EntryField{password("Password", "hunter2")}})
+	for _, format := range []ExportFormat{ExportJSON, ExportCSV, ExportKeePassXML} {
+		path := filepath.Join(t.TempDir(), "export")
+		if err := service.Export(path, ExportOptions{Format: format}); !errors.Is(err, ErrPlaintextNotConfirmed) {
+			t.Errorf("%s: Export = %v, want %v", format, err, ErrPlaintextNotConfirmed)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: the unconfirmed export was written", format)
+		}
+	}
+}
+
+func TestExportRefusesToOverwrite(t *testing.T) {
+	service := newTestWallet(t)
+	work := addTestGroup(t, service, Path{}, &Group{Name: "Work"})
+	addTestEntry(t, service, work, &Entry{Title: "Mail", Fields: []EntryField{password("Password", "hunter2")}})
+	for _, options := range []ExportOptions{
+		{Format: ExportCSV, ConfirmPlaintext: true},
+		{Format: ExportWallet, Password: "export password"},
+	} {
+		path := filepath.Join(t.TempDir(), "export")
+		if err := os.WriteFile(path, []byte("keep me"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := service.Export(path, options); !errors.Is(err, ErrExportExists) {
+			t.Errorf("%s: Export over a file = %v, want %v", options.Format, err, ErrExportExists)
+		}
+		if data, _ := os.ReadFile(path); string(data) != "keep me" {
+			t.Errorf("%s: the existing file was changed", options.Format)
+		}
+
+		options.Overwrite = true
+		if err := service.Export(path, options); err != nil {
+			t.Fatalf("%s: Export with Overwrite: %v", options.Format, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) == "keep me" {
+			t.Errorf("%s: Overwrite left the file as it was", options.Format)
+		}
+		if names, _ := os.ReadDir(filepath.Dir(path)); len(names) != 1 {
+			t.Errorf("%s: the export left %d files, want 1", options.Format, len(names))
+		}
+	}
+}
+
+func TestExportWallet(t *testing.T) {
+	service := newTestWallet(t)
+	work := addTestGroup(t, service, Path{}, &Group{Name: "Work"})
+	cloud := addTestGroup(t, service, work, &Group{Name: "Cloud"})
+	addTestEntry(t, service, work, &Entry{Title: "Mail", Fields: []EntryField{password("Password", "hunter2")}})
+	addTestEntry(t, service, cloud, &Entry{Title: "AWS", Fields: []EntryField{password("Password", "p, \"quoted\"")}})
+
+	if err := service.Export(filepath.Join(t.TempDir(), "export"), ExportOptions{Format: ExportWallet}); err == nil {
+		t.Error("a wallet export without a password or recipients succeeded")
+	}
+
+	path := exportTo(t, service, ExportOptions{Format: ExportWallet, Path: cloud, Password: "export password"})
+	wrong := NewWalletService(path, "password")
+	defer wrong.Close()
+	if err := wrong.Load(); err == nil {
+		t.Error("the password of the wallet opens the export")
+	}
+	exported := NewWalletService(path, "export password")
+	defer exported.Close()
+	if err := exported.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	slots := exported.ListSlots()
+	if len(slots) != 1 || slots[0].Type != SlotTypePassword {
+		t.Errorf("slots = %+v, want a single password slot", slots)
+	}
+	if want := []string{"Cloud/", "AWS"}; !reflect.DeepEqual(walletOutline(exported), want) {
+		t.Errorf("exported wallet = %v, want %v", walletOutline(exported), want)
+	}
+	entry := revealedEntry(t, exported, "AWS")
+	if entry.Fields[0].Value != "p, \"quoted\"" {
+		t.Errorf("password = %q", entry.Fields[0].Value)
+	}
+}
+
+func TestExportWalletForRecipients(t *testing.T) {
+	service := newTestWallet(t)
+	work := addTestGroup(t, service, Path{}, &Group{Name: "Work"})
+	cloud := addTestGroup(t, service, work, &Group{Name: "Cloud"})
+	addTestEntry(t, service, cloud, &Entry{Title: "AWS", Fields: []EntryField{password("Password", "p, \"quoted\"")}})
+	identityFile := filepath.Join(t.TempDir(), "identity.txt")
+	recipient, err := GenerateIdentityFile(identityFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := exportTo(t, service, ExportOptions{Format: ExportWallet, Path: cloud, Password: "export password", Recipients: []string{recipient}})
+	if names, _ := os.ReadDir(filepath.Dir(path)); len(names) != 1 {
+		t.Errorf("the export left %d files, want 1", len(names))
+	}
+
+	exported := NewWalletService(path, "")
+	defer exported.Close()
+	exported.Lock()
+	if err := exported.UnlockWithIdentityFile(identityFile); err != nil {
+		t.Fatal(err)
+	}
+	var types []SlotType
+	for _, slot := range exported.ListSlots() {
+		types = append(types, slot.Type)
+	}
+	if want := []SlotType{SlotTypePassword, SlotTypeRecipient}; !reflect.DeepEqual(types, want) {
+		t.Errorf("slot types = %v, want %v", types, want)
+	}
+	exported.Lock()
+	if err := exported.Unlock("export password"); err != nil {
+		t.Errorf("the export password does not unlock the export: %v", err)
+	}
+}
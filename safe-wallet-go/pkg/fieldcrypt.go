@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// fieldSealAD is authenticated with every sealed field value
+const fieldSealAD = "safe-wallet field"
+
+// IsSensitive reports whether values of the type are kept encrypted in
+// memory while the wallet is unlocked
+func (t FieldType) IsSensitive() bool {
+	return t == FieldTypePassword || t == FieldTypePIN
+}
+
+// IsSealed reports whether the value is encrypted and has to be read with
+// WalletService.FieldValue
+func (f EntryField) IsSealed() bool {
+	return f.sealed != nil
+}
+
+// SetValue replaces the value of the field. A sealed field, e.g. on a copy
+// of an entry that is edited, gets the new value even if it is empty.
+func (f *EntryField) SetValue(value string) {
+	f.Value = value
+	f.sealed = nil
+}
+
+// sealField encrypts the value of a sensitive field with the field key and
+// clears Value. A field that is still sealed is unchanged, or opened if it
+// is no longer sensitive. Its Value must stay empty, a new value is set with
+// SetValue.
+func sealField(field *EntryField, fieldKey []byte) error {
+	if field.sealed != nil {
+		if field.Value != "" {
+			return fmt.Errorf("field '%s' is sealed, set its value with SetValue", field.Name)
+		}
+		if field.Type.IsSensitive() {
+			return nil
+		}
+		value, err := openField(*field, fieldKey)
+		if err != nil {
+			return err
+		}
+		field.SetValue(value)
+	}
+	if !field.Type.IsSensitive() {
+		return nil
+	}
+	value := []byte(field.Value)
+	sealed, err := wrapKey(fieldKey, value, fieldSealAD)
+	Wipe(value)
+	if err != nil {
+		return err
+	}
+	field.sealed = sealed
+	field.Value = ""
+	return nil
+}
+
+// openField returns the plaintext value of a field
+func openField(field EntryField, fieldKey []byte) (string, error) {
+	if field.sealed == nil {
+		return field.Value, nil
+	}
+	if fieldKey == nil {
+		return "", errors.New("wallet is locked")
+	}
+	value, err := unwrapKey(fieldKey, field.sealed, fieldSealAD)
+	if err != nil {
+		return "", errors.New("field value cannot be decrypted")
+	}
+	defer value.Destroy()
+	return string(value.Bytes()), nil
+}
+
+// sealEntry seals the sensitive fields of the entry
+func sealEntry(entry *Entry, fieldKey []byte) error {
+	for i := range entry.Fields {
+		if err := sealField(&entry.Fields[i], fieldKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sealGroups seals the sensitive fields of all entries below the groups
+func sealGroups(groups []Group, fieldKey []byte) error {
+	for i := range groups {
+		if err := sealGroup(&groups[i], fieldKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sealGroup seals the sensitive fields of the group's entries and subgroups
+func sealGroup(group *Group, fieldKey []byte) error {
+	for i := range group.Entries {
+		if err := sealEntry(&group.Entries[i], fieldKey); err != nil {
+			return err
+		}
+	}
+	return sealGroups(group.Groups, fieldKey)
+}
+
+// openedGroups returns a copy of the groups with all field values in
+// plaintext, e.g. to marshal the wallet for saving
+func openedGroups(groups []Group, fieldKey []byte) ([]Group, error) {
+	opened := make([]Group, len(groups))
+	for i, group := range groups {
+		opened[i] = Group{ID: group.ID, Name: group.Name, Entries: make([]Entry, len(group.Entries))}
+		for j, entry := range group.Entries {
+			fields, err := openedFields(entry.Fields, fieldKey)
+			if err != nil {
+				return nil, err
+			}
+			opened[i].Entries[j] = Entry{ID: entry.ID, Title: entry.Title, Fields: fields}
+		}
+		var err error
+		if opened[i].Groups, err = openedGroups(group.Groups, fieldKey); err != nil {
+			return nil, err
+		}
+	}
+	return opened, nil
+}
+
+// openedFields returns a copy of the fields with the values in plaintext
+func openedFields(fields []EntryField, fieldKey []byte) ([]EntryField, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	opened := make([]EntryField, len(fields))
+	for i, field := range fields {
+		value, err := openField(field, fieldKey)
+		if err != nil {
+			return nil, err
+		}
+		opened[i] = EntryField{Name: field.Name, Value: value, Type: field.Type}
+	}
+	return opened, nil
+}
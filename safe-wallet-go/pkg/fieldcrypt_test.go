@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// addMailEntry adds the entry Mail holding a username, a password and a
+// PIN to a new group and returns its path
+func addMailEntry(t *testing.T, service *WalletService) Path {
+	t.Helper()
+	group := addTestGroup(t, service, Path{}, &Group{Name: "Email"})
+	return addTestEntry(t, service, group, &Entry{Title: "Mail", Fields: []EntryField{
+		{Name: "Username", Value: "alice", Type: FieldTypeGeneral},
+		{Name: "Password", Value: "hunter2", Type: FieldTypePassword},
+		{Name: "PIN", Value: "8642", Type: FieldTypePIN},
+	}})
+}
+
+// fieldValues returns the plaintext values of the entry's fields
+func fieldValues(t *testing.T, service *WalletService, path Path) []string {
+	t.Helper()
+	entry, err := FindEntryByPath(service.GetWallet(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for _, field := range entry.Fields {
+		value, err := service.FieldValue(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestAddEntrySealsSensitiveFields(t *testing.T) {
+	service := newTestWallet(t)
+	path := addMailEntry(t, service)
+	entry, err := FindEntryByPath(service.GetWallet(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range entry.Fields {
+		if field.Type.IsSensitive() != field.IsSealed() {
+			t.Errorf("field %s: sealed = %v", field.Name, field.IsSealed())
+		}
+		if field.IsSealed() && field.Value != "" {
+			t.Errorf("sealed field %s keeps its value", field.Name)
+		}
+	}
+	if got := strings.Join(fieldValues(t, service, path), ","); got != "alice,hunter2,8642" {
+		t.Errorf("values = %s, want alice,hunter2,8642", got)
+	}
+
+	revealed, err := service.RevealFields(entry.Fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"alice", "hunter2", "8642"} {
+		if revealed[i].Value != want || revealed[i].IsSealed() {
+			t.Errorf("revealed field %d = %q, sealed %v, want %q", i, revealed[i].Value, revealed[i].IsSealed(), want)
+		}
+	}
+	if !entry.Fields[1].IsSealed() {
+		t.Error("RevealFields opened the fields of the wallet")
+	}
+}
+
+func TestUpdateEntryReseals(t *testing.T) {
+	service := newTestWallet(t)
+	path := addMailEntry(t, service)
+	entry, err := FindEntryByPath(service.GetWallet(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A copy of the sealed fields that is saved unchanged keeps the values
+	unchanged := *entry
+	unchanged.Fields = append([]EntryField(nil), entry.Fields...)
+	if err := service.UpdateEntry(path, unchanged); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fieldValues(t, service, path), ","); got != "alice,hunter2,8642" {
+		t.Errorf("values after an unchanged update = %s", got)
+	}
+
+	// A value set on a copy of a sealed field replaces the sealed value
+	edited := *entry
+	edited.Fields = append([]EntryField(nil), entry.Fields...)
+	edited.Fields[1].SetValue("correct horse")
+	if err := service.UpdateEntry(path, edited); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fieldValues(t, service, path), ","); got != "alice,correct horse,8642" {
+		t.Errorf("values after editing a sealed copy = %s", got)
+	}
+
+	// Even when it is empty
+	entry, _ = FindEntryByPath(service.GetWallet(), path)
+	cleared := *entry
+	cleared.Fields = append([]EntryField(nil), entry.Fields...)
+	cleared.Fields[2].SetValue("")
+	if err := service.UpdateEntry(path, cleared); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fieldValues(t, service, path), ","); got != "alice,correct horse," {
+		t.Errorf("values after clearing a sealed copy = %s", got)
+	}
+
+	// A value assigned to a sealed field without SetValue is refused
+	entry, _ = FindEntryByPath(service.GetWallet(), path)
+	assigned := *entry
+	assigned.Fields = append([]EntryField(nil), entry.Fields...)
+	assigned.Fields[1].Value = "tr0ub4dor"
+	if err := service.UpdateEntry(path, assigned); err == nil {
+		t.Error("UpdateEntry kept a value assigned to a sealed field")
+	}
+	if got := strings.Join(fieldValues(t, service, path), ","); got != "alice,correct horse," {
+		t.Errorf("values after a refused update = %s", got)
+	}
+
+	// A sealed field that is made general is opened
+	entry, _ = FindEntryByPath(service.GetWallet(), path)
+	restored := *entry
+	restored.Fields = append([]EntryField(nil), entry.Fields...)
+	restored.Fields[2].SetValue("8642")
+	if err := service.UpdateEntry(path, restored); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ = FindEntryByPath(service.GetWallet(), path)
+	general := *entry
+	general.Fields = append([]EntryField(nil), entry.Fields...)
+	general.Fields[2].Type = FieldTypeGeneral
+	if err := service.UpdateEntry(path, general); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ = FindEntryByPath(service.GetWallet(), path)
+	if entry.Fields[2].IsSealed() || entry.Fields[2].Value != "8642" {
+		t.Errorf("general field = %q, sealed %v, want the plaintext PIN", entry.Fields[2].Value, entry.Fields[2].IsSealed())
+	}
+
+	// Revealed fields are sealed again
+	revealed, err := service.RevealFields(entry.Fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revealed[1].Value = "battery staple"
+	if err := service.UpdateEntry(path, Entry{Title: "Mail", Fields: revealed}); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ = FindEntryByPath(service.GetWallet(), path)
+	if !entry.Fields[1].IsSealed() || entry.Fields[1].Value != "" {
+		t.Error("the revealed password was not sealed again")
+	}
+	if got := strings.Join(fieldValues(t, service, path), ","); got != "alice,battery staple,8642" {
+		t.Errorf("values after updating revealed fields = %s", got)
+	}
+}
+
+func TestSealedValuesStayOutOfIndexAndJSON(t *testing.T) {
+	service := newTestWallet(t)
+	path := addMailEntry(t, service)
+
+	if results := service.SearchEntries("hunter2"); len(results) != 0 {
+		t.Errorf("the password is searchable: %d results", len(results))
+	}
+	if results := service.SearchEntries("alice"); len(results) != 1 {
+		t.Errorf("the username is not searchable: %d results", len(results))
+	}
+
+	data, err := json.Marshal(service.GetWallet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("hunter2")) || bytes.Contains(data, []byte("8642")) {
+		t.Errorf("the wallet marshals sealed values in plaintext: %s", data)
+	}
+
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := readWalletFile(service.storage, service.filepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(saved, []byte("hunter2")) {
+		t.Error("the saved wallet holds the password in plaintext")
+	}
+
+	// The saved wallet holds the values, sealed again once loaded
+	reloaded := NewWalletServiceWithStorage(service.storage, service.filepath, "password")
+	t.Cleanup(reloaded.Close)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fieldValues(t, reloaded, path), ","); got != "alice,hunter2,8642" {
+		t.Errorf("values after loading = %s", got)
+	}
+	entry, _ := FindEntryByPath(reloaded.GetWallet(), path)
+	if !entry.Fields[1].IsSealed() {
+		t.Error("the loaded password is not sealed")
+	}
+}
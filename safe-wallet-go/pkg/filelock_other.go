@@ -0,0 +1,27 @@
+//go:build !unix && !windows
+
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// lockFile creates the lock file exclusively where files cannot be locked.
+// A lock file that is left behind by a crash has to be removed by hand.
+func lockFile(path string) (func() error, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // 0600 = rw-------
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("wallet is being written by another program, remove %s if none is running", path)
+		}
+		return nil, err
+	}
+	fmt.Fprintf(file, "%d\n", os.Getpid())
+	file.Close()
+	return func() error {
+		return os.Remove(path)
+	}, nil
+}
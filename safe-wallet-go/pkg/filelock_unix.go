@@ -0,0 +1,20 @@
+//go:build unix
+
+package pkg
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile locks the file at path with flock and removes it on unlock
+func lockFile(path string) (func() error, error) {
+	return openLockFile(path, true,
+		func(file *os.File) error {
+			return unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		},
+		func(file *os.File) error {
+			return unix.Flock(int(file.Fd()), unix.LOCK_UN)
+		})
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package pkg
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile locks the file at path with LockFileEx. Windows does not remove
+// a file that is open without FILE_SHARE_DELETE, as os.OpenFile opens it,
+// so the lock file stays next to the wallet.
+func lockFile(path string) (func() error, error) {
+	return openLockFile(path, false,
+		func(file *os.File) error {
+			return windows.LockFileEx(windows.Handle(file.Fd()),
+				windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+				0, 1, 0, new(windows.Overlapped))
+		},
+		func(file *os.File) error {
+			return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, new(windows.Overlapped))
+		})
+}
@@ -0,0 +1,238 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// walletMagic starts every wallet file written since format version 2.
+	// Version 1 files start directly with the salt.
+	walletMagic = "SWLT"
+	// legacyFormatVersion files are encrypted with a key derived from the password
+	legacyFormatVersion = 1
+	// keyFileFormatVersion adds a header with a flag for keyfiles
+	keyFileFormatVersion = 2
+	// currentFormatVersion files are encrypted with a random data key that
+	// is wrapped by one or more key slots
+	currentFormatVersion = 3
+
+	// headerFlagKeyFile records that the key needs a keyfile besides the password
+	headerFlagKeyFile = 1 << 0
+
+	// maxSlotTableSize bounds the slot table read from a version 3 header
+	maxSlotTableSize = 1 << 20
+	// slotTableMACSize is the size of the HMAC-SHA256 that follows the slot table
+	slotTableMACSize = sha256.Size
+	// slotTableInfo is the HKDF info of the key that authenticates the slot table
+	slotTableInfo = "safe-wallet slot table"
+)
+
+// WalletHeader is the unencrypted part of a wallet file that describes how
+// the key is derived
+type WalletHeader struct {
+	Version byte
+	// KeyFile and Salt describe the key of version 1 and 2 files, which is
+	// derived directly from the password
+	KeyFile bool
+	Salt    []byte
+	// Slots wrap the data key of version 3 files
+	Slots []KeySlot
+
+	// signed is the header up to the end of a parsed slot table and mac the
+	// HMAC that authenticates it
+	signed []byte
+	mac    []byte
+}
+
+// slotTable is the JSON encoded part of a version 3 header
+type slotTable struct {
+	Slots []KeySlot `json:"slots"`
+}
+
+// UsesKeyFile reports whether any way to unlock the wallet with a password
+// involves a keyfile
+func (h WalletHeader) UsesKeyFile() bool {
+	if h.Version != currentFormatVersion {
+		return h.KeyFile
+	}
+	for _, slot := range h.Slots {
+		if slot.Type == SlotTypePassword && slot.KeyFile {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresKeyFile reports whether the wallet cannot be unlocked with a
+// password alone
+func (h WalletHeader) RequiresKeyFile() bool {
+	if h.Version != currentFormatVersion {
+		return h.KeyFile
+	}
+	found := false
+	for _, slot := range h.Slots {
+		if slot.Type != SlotTypePassword {
+			continue
+		}
+		if !slot.KeyFile {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// bytes encodes the header as it is stored in front of the nonce. The slot
+// table of version 3 is authenticated with a key derived from the data key.
+func (h WalletHeader) bytes(dataKey []byte) []byte {
+	switch h.Version {
+	case legacyFormatVersion:
+		return append([]byte(nil), h.Salt...)
+	case keyFileFormatVersion:
+		var flags byte
+		if h.KeyFile {
+			flags |= headerFlagKeyFile
+		}
+		encoded := make([]byte, 0, len(walletMagic)+2+len(h.Salt))
+		encoded = append(encoded, walletMagic...)
+		encoded = append(encoded, h.Version, flags)
+		encoded = append(encoded, h.Salt...)
+		return encoded
+	default:
+		// Marshalling plain slots cannot fail
+		table, _ := json.Marshal(slotTable{Slots: h.Slots})
+		encoded := make([]byte, 0, len(walletMagic)+5+len(table))
+		encoded = append(encoded, walletMagic...)
+		encoded = append(encoded, h.Version)
+		encoded = binary.BigEndian.AppendUint32(encoded, uint32(len(table)))
+		encoded = append(encoded, table...)
+		return append(encoded, slotTableMAC(dataKey, encoded)...)
+	}
+}
+
+// slotTableMAC computes the HMAC of a version 3 header up to the end of the
+// slot table
+func slotTableMAC(dataKey []byte, signed []byte) []byte {
+	macKey := make([]byte, keySize)
+	defer Wipe(macKey)
+	// Reading one key from HKDF-SHA256 cannot fail
+	io.ReadFull(hkdf.New(sha256.New, dataKey, nil, []byte(slotTableInfo)), macKey)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(signed)
+	return mac.Sum(nil)
+}
+
+// verify checks the slot table of a parsed version 3 header against the
+// data key. The slots are read before the data key is known, so they can
+// only be trusted once this succeeds.
+func (h WalletHeader) verify(dataKey []byte) error {
+	if h.Version != currentFormatVersion {
+		return nil
+	}
+	if !hmac.Equal(slotTableMAC(dataKey, h.signed), h.mac) {
+		return errors.New("the key slots of the wallet were changed without its data key")
+	}
+	return nil
+}
+
+// additionalData returns the header bytes authenticated by AES-GCM. Version
+// 3 only authenticates the format, the slot table has its own HMAC so slots
+// can change without re-encrypting the wallet.
+func (h WalletHeader) additionalData() []byte {
+	switch h.Version {
+	case legacyFormatVersion:
+		return nil
+	case keyFileFormatVersion:
+		return h.bytes(nil)
+	default:
+		return append([]byte(walletMagic), h.Version)
+	}
+}
+
+// parseWalletHeader decodes the header and returns it with its length
+func parseWalletHeader(data []byte) (WalletHeader, int, error) {
+	if !bytes.HasPrefix(data, []byte(walletMagic)) {
+		if len(data) < saltSize+nonceSize {
+			return WalletHeader{}, 0, errors.New("encrypted data too short")
+		}
+		return WalletHeader{Version: legacyFormatVersion, Salt: data[:saltSize]}, saltSize, nil
+	}
+	if len(data) < len(walletMagic)+1 {
+		return WalletHeader{}, 0, errors.New("encrypted data too short")
+	}
+
+	switch version := data[len(walletMagic)]; version {
+	case keyFileFormatVersion:
+		size := len(walletMagic) + 2 + saltSize
+		if len(data) < size+nonceSize {
+			return WalletHeader{}, 0, errors.New("encrypted data too short")
+		}
+		flags := data[len(walletMagic)+1]
+		if flags&^headerFlagKeyFile != 0 {
+			return WalletHeader{}, 0, errors.New("unsupported wallet header flags")
+		}
+		return WalletHeader{
+			Version: version,
+			KeyFile: flags&headerFlagKeyFile != 0,
+			Salt:    data[size-saltSize : size],
+		}, size, nil
+
+	case currentFormatVersion:
+		start := len(walletMagic) + 5
+		if len(data) < start {
+			return WalletHeader{}, 0, errors.New("encrypted data too short")
+		}
+		tableSize := binary.BigEndian.Uint32(data[len(walletMagic)+1 : start])
+		end := start + int(tableSize)
+		if tableSize > maxSlotTableSize || len(data) < end+slotTableMACSize+nonceSize {
+			return WalletHeader{}, 0, errors.New("invalid wallet header")
+		}
+		var table slotTable
+		if err := json.Unmarshal(data[start:end], &table); err != nil {
+			return WalletHeader{}, 0, errors.New("invalid wallet header")
+		}
+		if len(table.Slots) == 0 {
+			return WalletHeader{}, 0, errors.New("wallet has no key slots")
+		}
+		for _, slot := range table.Slots {
+			if err := slot.validate(); err != nil {
+				return WalletHeader{}, 0, fmt.Errorf("invalid wallet header: %v", err)
+			}
+		}
+		return WalletHeader{
+			Version: version,
+			Slots:   table.Slots,
+			signed:  append([]byte(nil), data[:end]...),
+			mac:     append([]byte(nil), data[end:end+slotTableMACSize]...),
+		}, end + slotTableMACSize, nil
+
+	default:
+		return WalletHeader{}, 0, errors.New("unsupported wallet format version")
+	}
+}
+
+// ReadWalletHeader reads the header of a wallet file without decrypting it,
+// e.g. to find out whether a keyfile is needed to unlock it
+func ReadWalletHeader(filepath string) (WalletHeader, error) {
+	return ReadWalletHeaderFrom(FileStorage{}, filepath)
+}
+
+// ReadWalletHeaderFrom reads the header of the wallet at the name in the
+// storage without decrypting it
+func ReadWalletHeaderFrom(storage Storage, filepath string) (WalletHeader, error) {
+	encrypted, err := readWalletFile(storage, filepath)
+	if err != nil {
+		return WalletHeader{}, err
+	}
+	header, _, err := parseWalletHeader(encrypted)
+	return header, err
+}
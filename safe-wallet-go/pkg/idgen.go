@@ -25,6 +25,11 @@ func generateUniqueID(prefix string) string {
 
 // checkGroupIDExists checks if a group ID already exists in the wallet
 func checkGroupIDExists(wallet *Wallet, groupID string) bool {
+	if wallet.index != nil {
+		_, exists := wallet.index.groupPaths[groupID]
+		return exists
+	}
+
 	var exists bool
 	TraverseForward(wallet, func(info PathInfo) bool {
 		if !info.IsEntry && info.Group != nil && info.Group.ID == groupID {
@@ -38,6 +43,11 @@ func checkGroupIDExists(wallet *Wallet, groupID string) bool {
 
 // checkEntryIDExists checks if an entry ID already exists in the wallet
 func checkEntryIDExists(wallet *Wallet, entryID string) bool {
+	if wallet.index != nil {
+		_, exists := wallet.index.entryPaths[entryID]
+		return exists
+	}
+
 	var exists bool
 	TraverseForward(wallet, func(info PathInfo) bool {
 		if info.IsEntry && info.Entry != nil && info.Entry.ID == entryID {
@@ -51,6 +61,10 @@ func checkEntryIDExists(wallet *Wallet, entryID string) bool {
 
 // checkGroupNameExists checks if a group name already exists in the wallet
 func checkGroupNameExists(wallet *Wallet, groupName string, excludeID string) bool {
+	if wallet.index != nil {
+		return wallet.index.hasGroupName(groupName, excludeID)
+	}
+
 	var exists bool
 	TraverseForward(wallet, func(info PathInfo) bool {
 		if !info.IsEntry && info.Group != nil && info.Group.Name == groupName {
@@ -67,6 +81,10 @@ func checkGroupNameExists(wallet *Wallet, groupName string, excludeID string) bo
 
 // checkEntryTitleExists checks if an entry title already exists in the wallet
 func checkEntryTitleExists(wallet *Wallet, entryTitle string, excludeID string) bool {
+	if wallet.index != nil {
+		return wallet.index.hasEntryTitle(entryTitle, excludeID)
+	}
+
 	var exists bool
 	TraverseForward(wallet, func(info PathInfo) bool {
 		if info.IsEntry && info.Entry != nil && info.Entry.Title == entryTitle {
@@ -0,0 +1,354 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Importer reads the export or database of another password manager
+type Importer interface {
+	// Name identifies the format, e.g. "Bitwarden JSON"
+	Name() string
+	// NeedsPassword reports whether the file is encrypted and Import needs
+	// ImportOptions.Password or ImportOptions.KeyFilePath
+	NeedsPassword() bool
+	// Detect reports whether a file with the name and the first bytes of
+	// its content is in this format
+	Detect(filename string, head []byte) bool
+	// Import reads the file and returns its items as a single group named
+	// after the source, with folders as nested groups
+	Import(path string, options ImportOptions) (*Group, error)
+}
+
+// ImportOptions holds the credentials of encrypted imports
+type ImportOptions struct {
+	Password    string
+	KeyFilePath string
+}
+
+// Importers are the supported import formats, in the order they are tried
+// when detecting the format of a file
+var Importers = []Importer{
+	kdbxImporter{},
+	bitwardenImporter{},
+	onePasswordPUXImporter{},
+	onePasswordCSVImporter{},
+	lastPassImporter{},
+}
+
+const (
+	// importHeadSize is how much of a file DetectImporter looks at
+	importHeadSize = 4096
+	// utf8BOM starts some CSV exports
+	utf8BOM = "\xef\xbb\xbf"
+)
+
+// DetectImporter returns the importer for the format of the file
+func DetectImporter(path string) (Importer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	head := make([]byte, importHeadSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	for _, importer := range Importers {
+		if importer.Detect(filepath.Base(path), head) {
+			return importer, nil
+		}
+	}
+	return nil, errors.New("unrecognized import format")
+}
+
+// FindImporter returns the importer with the name, ignoring case
+func FindImporter(name string) (Importer, error) {
+	for _, importer := range Importers {
+		if strings.EqualFold(importer.Name(), name) {
+			return importer, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown import format '%s'", name)
+}
+
+// RenamePolicy returns the n-th candidate name, starting at n = 2, for an
+// imported group or entry whose name is already taken
+type RenamePolicy func(name string, n int) string
+
+// NumberedRename appends " (2)", " (3)", ... to the name
+func NumberedRename(name string, n int) string {
+	return fmt.Sprintf("%s (%d)", name, n)
+}
+
+// CountItems returns the number of groups, including the group itself, and
+// entries in a group tree
+func CountItems(group *Group) (groups int, entries int) {
+	groups, entries = 1, len(group.Entries)
+	for i := range group.Groups {
+		g, e := CountItems(&group.Groups[i])
+		groups += g
+		entries += e
+	}
+	return groups, entries
+}
+
+// ImportGroup adds an imported group tree at the path. Group names and entry
+// titles that clash with the wallet or within the tree are renamed with the
+// policy, NumberedRename if nil. It returns the number of renamed items.
+func (ws *WalletService) ImportGroup(path Path, group *Group, rename RenamePolicy) (int, error) {
+	if ws.wallet == nil {
+		return 0, errors.New("wallet not loaded")
+	}
+	if rename == nil {
+		rename = NumberedRename
+	}
+
+	renamed := 0
+	unique := func(name string, used map[string]bool, exists func(string, string) bool) string {
+		candidate := name
+		for n := 2; used[candidate] || exists(candidate, ""); n++ {
+			candidate = rename(name, n)
+		}
+		if candidate != name {
+			renamed++
+		}
+		used[candidate] = true
+		return candidate
+	}
+
+	groupNames := make(map[string]bool)
+	entryTitles := make(map[string]bool)
+	groupExists := func(name string, excludeID string) bool {
+		return checkGroupNameExists(ws.wallet, name, excludeID)
+	}
+	entryExists := func(title string, excludeID string) bool {
+		return checkEntryTitleExists(ws.wallet, title, excludeID)
+	}
+
+	var renameGroup func(group *Group)
+	renameGroup = func(group *Group) {
+		group.Name = unique(group.Name, groupNames, groupExists)
+		for i := range group.Entries {
+			group.Entries[i].Title = unique(group.Entries[i].Title, entryTitles, entryExists)
+		}
+		for i := range group.Groups {
+			renameGroup(&group.Groups[i])
+		}
+	}
+	renameGroup(group)
+
+	if err := ws.AddGroup(path, group); err != nil {
+		return 0, err
+	}
+	return renamed, nil
+}
+
+// changeCopy runs change on a copy of the wallet and keeps its changes only
+// if it succeeds, so a change that fails half way leaves the wallet as it was
+func (ws *WalletService) changeCopy(change func() error) error {
+	original := ws.wallet
+	working := &Wallet{Version: original.Version, Groups: cloneGroups(original.Groups)}
+	working.index = buildIndex(working)
+	ws.wallet = working
+	defer func() { ws.wallet = original }()
+
+	if err := change(); err != nil {
+		return err
+	}
+	// The wallet keeps its identity, callers may hold on to it
+	original.Groups, original.index = working.Groups, working.index
+	return nil
+}
+
+// cloneGroups copies groups with everything below them, so the copy can be
+// changed without changing the groups
+func cloneGroups(groups []Group) []Group {
+	if groups == nil {
+		return nil
+	}
+	cloned := make([]Group, len(groups))
+	for i, group := range groups {
+		group.Groups = cloneGroups(group.Groups)
+		if group.Entries != nil {
+			entries := make([]Entry, len(group.Entries))
+			for j, entry := range group.Entries {
+				entry.Fields = append([]EntryField(nil), entry.Fields...)
+				entries[j] = entry
+			}
+			group.Entries = entries
+		}
+		cloned[i] = group
+	}
+	return cloned
+}
+
+// importItem is an item of an export before it is placed in a group
+type importItem struct {
+	// folder is the path of folder names from the top of the export
+	folder []string
+	// kind names the EntryTemplates entry of the item type, or is empty
+	// to choose the template by the fields
+	kind   string
+	title  string
+	fields []EntryField
+}
+
+// field appends a field unless the value is empty or only whitespace. The
+// value is kept as it is, spaces may be part of a password.
+func (item *importItem) field(name string, value string, fieldType FieldType) {
+	if strings.TrimSpace(value) != "" {
+		item.fields = append(item.fields, EntryField{Name: name, Value: value, Type: fieldType})
+	}
+}
+
+// buildImportGroup places the items in a group named after the source, with
+// a nested group for every folder
+func buildImportGroup(name string, items []importItem) *Group {
+	root := &Group{ID: generateGroupID(), Name: name, Groups: []Group{}, Entries: []Entry{}}
+	for _, item := range items {
+		group := root
+		for _, folder := range item.folder {
+			if folder = strings.TrimSpace(folder); folder != "" {
+				group = importSubgroup(group, folder)
+			}
+		}
+		group.Entries = append(group.Entries, importEntry(item))
+	}
+	return root
+}
+
+// importEntry creates the entry of an item with the fields arranged by the
+// closest template
+func importEntry(item importItem) Entry {
+	title := strings.TrimSpace(item.title)
+	if title == "" {
+		title = "(untitled)"
+	}
+	return Entry{
+		ID:     generateEntryID(),
+		Title:  title,
+		Fields: applyTemplate(closestTemplate(item.kind, item.fields), item.fields),
+	}
+}
+
+// importSubgroup returns the subgroup with the name, adding it if needed
+func importSubgroup(parent *Group, name string) *Group {
+	for i := range parent.Groups {
+		if parent.Groups[i].Name == name {
+			return &parent.Groups[i]
+		}
+	}
+	parent.Groups = append(parent.Groups, Group{ID: generateGroupID(), Name: name, Groups: []Group{}, Entries: []Entry{}})
+	return &parent.Groups[len(parent.Groups)-1]
+}
+
+// closestTemplate returns the template named by kind or else the one that
+// shares the most field names with the fields, nil if none shares any
+func closestTemplate(kind string, fields []EntryField) *EntryTemplate {
+	var closest *EntryTemplate
+	best := 0
+	for i := range EntryTemplates {
+		template := &EntryTemplates[i]
+		if kind != "" && template.Name == kind {
+			return template
+		}
+		shared := 0
+		for _, field := range fields {
+			if templateField(template, field.Name) != nil {
+				shared++
+			}
+		}
+		if shared > best {
+			closest, best = template, shared
+		}
+	}
+	return closest
+}
+
+// templateField returns the field of the template with the name, ignoring case
+func templateField(template *EntryTemplate, name string) *EntryField {
+	for i := range template.Fields {
+		if strings.EqualFold(template.Fields[i].Name, name) {
+			return &template.Fields[i]
+		}
+	}
+	return nil
+}
+
+// applyTemplate orders the fields as in the template, with its names and
+// types, followed by the fields the template does not have
+func applyTemplate(template *EntryTemplate, fields []EntryField) []EntryField {
+	result := []EntryField{}
+	if template == nil {
+		return append(result, fields...)
+	}
+
+	used := make([]bool, len(fields))
+	for _, templateField := range template.Fields {
+		for i, field := range fields {
+			if !used[i] && strings.EqualFold(field.Name, templateField.Name) {
+				used[i] = true
+				fieldType := templateField.Type
+				if field.Type.IsSensitive() && !fieldType.IsSensitive() {
+					fieldType = field.Type
+				}
+				result = append(result, EntryField{Name: templateField.Name, Value: field.Value, Type: fieldType})
+				break
+			}
+		}
+	}
+	for i, field := range fields {
+		if !used[i] {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// csvHeader returns the lower case column names in the first line of a CSV file
+func csvHeader(head []byte) map[string]bool {
+	line, _, _ := bytes.Cut(bytes.TrimPrefix(head, []byte(utf8BOM)), []byte("\n"))
+	record, err := csv.NewReader(bytes.NewReader(line)).Read()
+	if err != nil {
+		return nil
+	}
+	columns := make(map[string]bool)
+	for _, column := range record {
+		columns[strings.ToLower(strings.TrimSpace(column))] = true
+	}
+	return columns
+}
+
+// readImportCSV returns the column names and records of a CSV export
+func readImportCSV(path string) ([]string, [][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte(utf8BOM))))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV export: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("CSV export is empty")
+	}
+	header := records[0]
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	return header, records[1:], nil
+}
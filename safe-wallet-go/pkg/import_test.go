@@ -0,0 +1,323 @@
+package pkg
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const bitwardenFixture = `{
+  "encrypted": false,
+  "folders": [
+    {"id": "f1", "name": "Work/Cloud"},
+    {"id": "f2", "name": "Work"}
+  ],
+  "items": [
+    {"folderId": "f1", "type": 1, "name": "AWS", "notes": "  ",
+     "login": {"username": "alice", "password": "  pass word ", "totp": "",
+               "uris": [{"uri": "https://aws.example"}, {"uri": "https://console.aws.example"}]},
+     "fields": [
+       {"name": "API key", "value": "k3y", "type": 1},
+       {"name": "Region", "value": "eu", "type": 0},
+       {"name": "Owner", "value": "", "type": 3}
+     ]},
+    {"folderId": "f2", "type": 2, "name": "Door code", "notes": " 1234\n"},
+    {"folderId": null, "type": 3, "name": "Visa",
+     "card": {"cardholderName": "Alice", "brand": "Visa", "number": "4111", "expMonth": "12", "expYear": "2030", "code": "123"}},
+    {"type": 4, "name": "  ", "identity": {"firstName": "Alice", "lastName": "Doe", "email": "", "phone": null}}
+  ]
+}`
+
+const lastPassFixture = "url,username,password,totp,extra,name,grouping,fav\n" +
+	"https://mail.example,bob, secret ,  ,,Mail,Email\\Personal,0\n" +
+	"http://sn,,,,\"NoteType:Credit Card\nName on Card:Bob\nNumber:4111\nSecurity Code:321\nNotes:first\nsecond\",Card,Finance,0\n" +
+	"http://sn,,,,plain note,Note,,0\n"
+
+const onePasswordCSVFixture = "Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes,Custom\n" +
+	"Router,http://192.168.0.1,admin, pw ,,false,false,home,\"  \",x\n" +
+	"Old,https://old.example,me,p,,false,true,,gone,\n"
+
+const onePasswordPUXFixture = `{"accounts": [{"vaults": [{"attrs": {"name": "Private"}, "items": [
+  {"item": {"state": "active", "categoryUuid": "001",
+    "overview": {"title": "Forum", "url": "https://forum.example",
+                 "urls": [{"url": "https://forum.example"}, {"url": "https://m.forum.example"}]},
+    "details": {
+      "loginFields": [
+        {"value": "carol", "designation": "username", "fieldType": "T"},
+        {"value": " pw ", "designation": "password", "fieldType": "P"},
+        {"value": "42", "name": "pin code", "fieldType": "P"}
+      ],
+      "notesPlain": " ",
+      "sections": [{"title": "", "fields": [
+        {"title": "Security question", "id": "q1", "value": {"concealed": "blue"}},
+        {"title": "Expires", "id": "exp", "value": {"monthYear": 202712}},
+        {"title": "Empty", "id": "e", "value": {"string": "  "}}
+      ]}]}}},
+  {"state": "archived", "categoryUuid": "002", "overview": {"title": "Amex"},
+   "details": {"notesPlain": "card", "sections": [{"fields": [
+     {"id": "ccnum", "value": {"creditCardNumber": "3782"}},
+     {"id": "cvv", "value": {"concealed": "1234"}},
+     {"id": "expiry", "value": {"monthYear": 202901}}
+   ]}]}}
+]}]}]}`
+
+// writeImportFixture writes the content to a file with the name in a
+// temporary directory and returns its path
+func writeImportFixture(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// write1PUXFixture writes a 1PUX archive with the export.data document
+func write1PUXFixture(t *testing.T, exportData string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "export.1pux")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	w, err := archive.Create("export.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(exportData)); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// importGroup is a group as an importer returns it, without IDs
+func importGroup(name string, groups []Group, entries ...Entry) Group {
+	if groups == nil {
+		groups = []Group{}
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	return Group{Name: name, Groups: groups, Entries: entries}
+}
+
+// importEntryOf is an imported entry without an ID
+func importEntryOf(title string, fields ...EntryField) Entry {
+	return Entry{Title: title, Fields: fields}
+}
+
+func general(name, value string) EntryField {
+	return EntryField{Name: name, Value: value, Type: FieldTypeGeneral}
+}
+
+func password(name, value string) EntryField {
+	return EntryField{Name: name, Value: value, Type: FieldTypePassword}
+}
+
+func pin(name, value string) EntryField {
+	return EntryField{Name: name, Value: value, Type: FieldTypePIN}
+}
+
+func TestImporters(t *testing.T) {
+	tests := []struct {
+		name     string
+		importer string
+		path     func(t *testing.T) string
+		want     Group
+	}{
+		{
+			name:     "Bitwarden",
+			importer: "Bitwarden JSON",
+			path:     func(t *testing.T) string { return writeImportFixture(t, "bitwarden.json", bitwardenFixture) },
+			want: importGroup("Bitwarden",
+				[]Group{importGroup("Work",
+					[]Group{importGroup("Cloud", nil, importEntryOf("AWS",
+						general("Username", "alice"),
+						password("Password", "  pass word "),
+						general("URL", "https://aws.example"),
+						general("URL 2", "https://console.aws.example"),
+						password("API key", "k3y"),
+						general("Region", "eu"),
+					))},
+					importEntryOf("Door code", general("Note", " 1234\n")),
+				)},
+				importEntryOf("Visa",
+					general("Cardholder Name", "Alice"),
+					general("Card Number", "4111"),
+					general("Expiration Date", "12/2030"),
+					pin("CVV", "123"),
+					general("Brand", "Visa"),
+				),
+				importEntryOf("(untitled)", general("First Name", "Alice"), general("Last Name", "Doe")),
+			),
+		},
+		{
+			name:     "LastPass",
+			importer: "LastPass CSV",
+			path:     func(t *testing.T) string { return writeImportFixture(t, "lastpass.csv", lastPassFixture) },
+			want: importGroup("LastPass",
+				[]Group{
+					importGroup("Email", []Group{importGroup("Personal", nil, importEntryOf("Mail",
+						general("Username", "bob"),
+						password("Password", " secret "),
+						general("URL", "https://mail.example"),
+					))}),
+					importGroup("Finance", nil, importEntryOf("Card",
+						general("Cardholder Name", "Bob"),
+						general("Card Number", "4111"),
+						pin("CVV", "321"),
+						general("Notes", "first\nsecond"),
+					)),
+				},
+				importEntryOf("Note", general("Note", "plain note")),
+			),
+		},
+		{
+			name:     "1Password CSV",
+			importer: "1Password CSV",
+			path:     func(t *testing.T) string { return writeImportFixture(t, "1password.csv", onePasswordCSVFixture) },
+			want: importGroup("1Password",
+				[]Group{importGroup("Archive", nil, importEntryOf("Old",
+					general("Username", "me"),
+					password("Password", "p"),
+					general("URL", "https://old.example"),
+					general("Notes", "gone"),
+				))},
+				importEntryOf("Router",
+					general("Username", "admin"),
+					password("Password", " pw "),
+					general("URL", "http://192.168.0.1"),
+					general("Custom", "x"),
+				),
+			),
+		},
+		{
+			name:     "1Password 1PUX",
+			importer: "1Password 1PUX",
+			path:     func(t *testing.T) string { return write1PUXFixture(t, onePasswordPUXFixture) },
+			want: importGroup("1Password",
+				[]Group{importGroup("Private",
+					[]Group{importGroup("Archive", nil, importEntryOf("Amex",
+						general("Card Number", "3782"),
+						general("Expiration Date", "01/2029"),
+						pin("CVV", "1234"),
+						general("Notes", "card"),
+					))},
+					importEntryOf("Forum",
+						general("Username", "carol"),
+						password("Password", " pw "),
+						general("URL", "https://forum.example"),
+						password("pin code", "42"),
+						general("URL 2", "https://m.forum.example"),
+						password("Security question", "blue"),
+						general("Expires", "12/2027"),
+					),
+				)},
+			),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := test.path(t)
+			importer, err := DetectImporter(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if importer.Name() != test.importer {
+				t.Fatalf("DetectImporter = %s, want %s", importer.Name(), test.importer)
+			}
+			group, err := importer.Import(path, ImportOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := withoutIDs(*group); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Import =\n%+v\nwant\n%+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestImporterErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		importer Importer
+		path     func(t *testing.T) string
+	}{
+		{"encrypted Bitwarden", bitwardenImporter{}, func(t *testing.T) string {
+			return writeImportFixture(t, "bitwarden.json", `{"encrypted": true, "items": []}`)
+		}},
+		{"invalid Bitwarden", bitwardenImporter{}, func(t *testing.T) string {
+			return writeImportFixture(t, "bitwarden.json", `{"items": [`)
+		}},
+		{"empty CSV", lastPassImporter{}, func(t *testing.T) string {
+			return writeImportFixture(t, "lastpass.csv", "")
+		}},
+		{"1PUX without export.data", onePasswordPUXImporter{}, func(t *testing.T) string {
+			path := filepath.Join(t.TempDir(), "export.1pux")
+			file, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			if err := zip.NewWriter(file).Close(); err != nil {
+				t.Fatal(err)
+			}
+			return path
+		}},
+	}
+	for _, test := range tests {
+		if _, err := test.importer.Import(test.path(t), ImportOptions{}); err == nil {
+			t.Errorf("%s: Import succeeded", test.name)
+		}
+	}
+}
+
+// walletOutline lists the groups and entries of the wallet by name
+func walletOutline(service *WalletService) []string {
+	var outline []string
+	service.TraverseForward(func(info PathInfo) bool {
+		if info.IsEntry {
+			outline = append(outline, info.Entry.Title)
+		} else {
+			outline = append(outline, info.Group.Name+"/")
+		}
+		return true
+	})
+	return outline
+}
+
+func TestImportGroupRenamesCollisions(t *testing.T) {
+	service := NewWalletServiceWithStorage(NewMemoryStorage(), "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(service.Close)
+
+	path := writeImportFixture(t, "1password.csv", "Title,Username,Password\nRouter,admin,a\nRouter,root,b\n")
+	for i, want := range []int{1, 3} {
+		group, err := onePasswordCSVImporter{}.Import(path, ImportOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		renamed, err := service.ImportGroup(Path{}, group, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if renamed != want {
+			t.Errorf("import %d: renamed = %d, want %d", i+1, renamed, want)
+		}
+	}
+
+	want := []string{"1Password/", "Router", "Router (2)", "1Password (2)/", "Router (3)", "Router (4)"}
+	if got := walletOutline(service); !reflect.DeepEqual(got, want) {
+		t.Errorf("wallet = %v, want %v", got, want)
+	}
+}
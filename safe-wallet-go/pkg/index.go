@@ -0,0 +1,281 @@
+package pkg
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// walletIndex keeps in-memory lookup tables for a wallet so that ID, name
+// and search lookups do not need a full traversal
+type walletIndex struct {
+	groupPaths  map[string]Path                // group ID -> path to the group
+	entryPaths  map[string]Path                // entry ID -> path to the entry
+	groupNames  map[string]map[string]struct{} // group name -> group IDs
+	entryTitles map[string]map[string]struct{} // entry title -> entry IDs
+	entryNames  map[string]string              // entry ID -> indexed title
+	groupIDName map[string]string              // group ID -> indexed name
+	tokens      map[string]map[string]struct{} // search token -> entry IDs
+	entryTokens map[string][]string            // entry ID -> indexed tokens
+
+	// suffixes holds every suffix of every search token, sorted, so the
+	// tokens that contain a search token are found by a prefix search. It
+	// is rebuilt on the next search after a token is added or removed.
+	suffixes []tokenSuffix
+}
+
+// tokenSuffix is a suffix of an indexed search token
+type tokenSuffix struct {
+	suffix string
+	token  string
+}
+
+// newWalletIndex creates an empty index
+func newWalletIndex() *walletIndex {
+	return &walletIndex{
+		groupPaths:  make(map[string]Path),
+		entryPaths:  make(map[string]Path),
+		groupNames:  make(map[string]map[string]struct{}),
+		entryTitles: make(map[string]map[string]struct{}),
+		entryNames:  make(map[string]string),
+		groupIDName: make(map[string]string),
+		tokens:      make(map[string]map[string]struct{}),
+		entryTokens: make(map[string][]string),
+	}
+}
+
+// buildIndex builds a complete index for the wallet
+func buildIndex(wallet *Wallet) *walletIndex {
+	idx := newWalletIndex()
+	idx.addGroups(wallet.Groups, Path{GroupIDs: []string{}})
+	return idx
+}
+
+// addGroups indexes the given groups and everything below them.
+// parentPath is the path of the group that contains them.
+func (idx *walletIndex) addGroups(groups []Group, parentPath Path) {
+	for i := range groups {
+		idx.addGroup(&groups[i], parentPath)
+	}
+}
+
+// addGroup indexes a group and its whole subtree
+func (idx *walletIndex) addGroup(group *Group, parentPath Path) {
+	groupPath := Path{GroupIDs: append(append([]string{}, parentPath.GroupIDs...), group.ID)}
+	idx.groupPaths[group.ID] = groupPath
+	idx.setGroupName(group.ID, group.Name)
+
+	for i := range group.Entries {
+		idx.addEntry(&group.Entries[i], groupPath)
+	}
+	idx.addGroups(group.Groups, groupPath)
+}
+
+// removeGroup removes a group and its whole subtree from the index
+func (idx *walletIndex) removeGroup(group *Group) {
+	for i := range group.Groups {
+		idx.removeGroup(&group.Groups[i])
+	}
+	for i := range group.Entries {
+		idx.removeEntry(group.Entries[i].ID)
+	}
+	delete(idx.groupPaths, group.ID)
+	removeFromSet(idx.groupNames, idx.groupIDName[group.ID], group.ID)
+	delete(idx.groupIDName, group.ID)
+}
+
+// setGroupName records the name of a group, replacing any previous name
+func (idx *walletIndex) setGroupName(groupID, name string) {
+	if old, ok := idx.groupIDName[groupID]; ok {
+		removeFromSet(idx.groupNames, old, groupID)
+	}
+	idx.groupIDName[groupID] = name
+	addToSet(idx.groupNames, name, groupID)
+}
+
+// addEntry indexes an entry located in the group at groupPath
+func (idx *walletIndex) addEntry(entry *Entry, groupPath Path) {
+	idx.entryPaths[entry.ID] = Path{
+		GroupIDs: append([]string{}, groupPath.GroupIDs...),
+		EntryID:  entry.ID,
+	}
+	idx.entryNames[entry.ID] = entry.Title
+	addToSet(idx.entryTitles, entry.Title, entry.ID)
+
+	tokens := entryTokens(entry)
+	idx.entryTokens[entry.ID] = tokens
+	for _, token := range tokens {
+		if _, ok := idx.tokens[token]; !ok {
+			idx.suffixes = nil
+		}
+		addToSet(idx.tokens, token, entry.ID)
+	}
+}
+
+// updateEntry re-indexes an entry after its title or fields changed
+func (idx *walletIndex) updateEntry(entry *Entry) {
+	path, ok := idx.entryPaths[entry.ID]
+	if !ok {
+		return
+	}
+	idx.removeEntry(entry.ID)
+	idx.addEntry(entry, path)
+}
+
+// removeEntry removes an entry from the index. It only relies on what was
+// indexed, so it works even if the entry has been modified in place.
+func (idx *walletIndex) removeEntry(entryID string) {
+	for _, token := range idx.entryTokens[entryID] {
+		removeFromSet(idx.tokens, token, entryID)
+		if _, ok := idx.tokens[token]; !ok {
+			idx.suffixes = nil
+		}
+	}
+	delete(idx.entryTokens, entryID)
+	removeFromSet(idx.entryTitles, idx.entryNames[entryID], entryID)
+	delete(idx.entryNames, entryID)
+	delete(idx.entryPaths, entryID)
+}
+
+// hasGroupName checks if any group other than excludeID uses the name
+func (idx *walletIndex) hasGroupName(name string, excludeID string) bool {
+	return setHasOther(idx.groupNames[name], excludeID)
+}
+
+// hasEntryTitle checks if any entry other than excludeID uses the title
+func (idx *walletIndex) hasEntryTitle(title string, excludeID string) bool {
+	return setHasOther(idx.entryTitles[title], excludeID)
+}
+
+// searchCandidates returns the IDs of entries that contain every token of
+// the search term as part of an indexed token. ok is false when the term
+// has no searchable tokens and the caller has to fall back to a full scan.
+func (idx *walletIndex) searchCandidates(term string) (ids []string, ok bool) {
+	queryTokens := tokenize(term)
+	if len(queryTokens) == 0 {
+		return nil, false
+	}
+
+	suffixes := idx.tokenSuffixes()
+	var candidates map[string]struct{}
+	for _, queryToken := range queryTokens {
+		matches := make(map[string]struct{})
+		// A token contains the query token if one of its suffixes starts
+		// with it, and those suffixes are next to each other
+		first := sort.Search(len(suffixes), func(i int) bool {
+			return suffixes[i].suffix >= queryToken
+		})
+		for i := first; i < len(suffixes) && strings.HasPrefix(suffixes[i].suffix, queryToken); i++ {
+			for id := range idx.tokens[suffixes[i].token] {
+				if candidates == nil {
+					matches[id] = struct{}{}
+				} else if _, ok := candidates[id]; ok {
+					matches[id] = struct{}{}
+				}
+			}
+		}
+		candidates = matches
+		if len(candidates) == 0 {
+			break
+		}
+	}
+
+	for id := range candidates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, true
+}
+
+// tokenSuffixes returns the sorted suffixes of the search tokens, building
+// them if tokens changed since the last search
+func (idx *walletIndex) tokenSuffixes() []tokenSuffix {
+	if idx.suffixes != nil {
+		return idx.suffixes
+	}
+	suffixes := make([]tokenSuffix, 0, len(idx.tokens))
+	for token := range idx.tokens {
+		for i := range token {
+			suffixes = append(suffixes, tokenSuffix{suffix: token[i:], token: token})
+		}
+	}
+	sort.Slice(suffixes, func(i, j int) bool {
+		if suffixes[i].suffix != suffixes[j].suffix {
+			return suffixes[i].suffix < suffixes[j].suffix
+		}
+		return suffixes[i].token < suffixes[j].token
+	})
+	idx.suffixes = suffixes
+	return suffixes
+}
+
+// entryTokens returns the distinct search tokens of an entry's title and fields
+func entryTokens(entry *Entry) []string {
+	seen := make(map[string]struct{})
+	var tokens []string
+	add := func(s string) {
+		for _, token := range tokenize(s) {
+			if _, ok := seen[token]; !ok {
+				seen[token] = struct{}{}
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	add(entry.Title)
+	for _, field := range entry.Fields {
+		add(field.Name)
+		add(field.Value)
+	}
+	return tokens
+}
+
+// tokenize splits a string into lower-case runs of letters and digits
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// entryMatches reports whether the entry's title, a field name or a field
+// value contains the lower-case search term
+func entryMatches(entry *Entry, term string) bool {
+	if strings.Contains(strings.ToLower(entry.Title), term) {
+		return true
+	}
+	for _, field := range entry.Fields {
+		if strings.Contains(strings.ToLower(field.Name), term) || strings.Contains(strings.ToLower(field.Value), term) {
+			return true
+		}
+	}
+	return false
+}
+
+func addToSet(sets map[string]map[string]struct{}, key, id string) {
+	set, ok := sets[key]
+	if !ok {
+		set = make(map[string]struct{})
+		sets[key] = set
+	}
+	set[id] = struct{}{}
+}
+
+func removeFromSet(sets map[string]map[string]struct{}, key, id string) {
+	set, ok := sets[key]
+	if !ok {
+		return
+	}
+	delete(set, id)
+	if len(set) == 0 {
+		delete(sets, key)
+	}
+}
+
+func setHasOther(set map[string]struct{}, excludeID string) bool {
+	for id := range set {
+		if excludeID == "" || id != excludeID {
+			return true
+		}
+	}
+	return false
+}
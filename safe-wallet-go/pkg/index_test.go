@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+// searchTitles returns the titles and group IDs of the search results in order
+func searchTitles(service *WalletService, term string) []string {
+	var titles []string
+	for _, info := range service.SearchEntries(term) {
+		titles = append(titles, info.Entry.Title+" in "+info.Path.GroupIDs[len(info.Path.GroupIDs)-1])
+	}
+	return titles
+}
+
+// addURLEntry adds an entry with the ID, the title and a URL field to the
+// group at path
+func addURLEntry(t *testing.T, service *WalletService, path Path, id, title, url string) {
+	t.Helper()
+	addTestEntry(t, service, path, &Entry{ID: id, Title: title, Fields: []EntryField{{Name: "URL", Value: url, Type: FieldTypeGeneral}}})
+}
+
+func TestSearchEntriesOrder(t *testing.T) {
+	service := newTestWallet(t)
+	work := addTestGroup(t, service, Path{}, &Group{ID: "group-b", Name: "Work"})
+	archive := addTestGroup(t, service, work, &Group{ID: "group-c", Name: "Archive"})
+	home := addTestGroup(t, service, Path{}, &Group{ID: "group-a", Name: "Home"})
+	// Entries of a group come before those of its subgroups, whatever
+	// the order they were added in
+	addURLEntry(t, service, archive, "entry-0", "Archive", "https://archive.example/-/")
+	addURLEntry(t, service, work, "entry-4", "Webmail", "https://mail.example/-/inbox")
+	addURLEntry(t, service, work, "entry-2", "bank", "https://bank.example/-/login")
+	addURLEntry(t, service, home, "entry-3", "Gmail", "https://mail.example.com/-/")
+	addURLEntry(t, service, home, "entry-1", "Bank", "https://bank.example/-/")
+
+	// "example" is found through the index, "/-/" has no tokens and is
+	// found by scanning every entry. Both keep the order of the tree.
+	want := []string{"Webmail in group-b", "bank in group-b", "Archive in group-c", "Gmail in group-a", "Bank in group-a"}
+	for _, term := range []string{"example", "/-/"} {
+		if got := searchTitles(service, term); !reflect.DeepEqual(got, want) {
+			t.Errorf("SearchEntries(%q) = %v, want %v", term, got, want)
+		}
+	}
+}
+
+func TestSearchEntriesSubstrings(t *testing.T) {
+	service := newTestWallet(t)
+	work := addTestGroup(t, service, Path{}, &Group{ID: "group-b", Name: "Work"})
+	home := addTestGroup(t, service, Path{}, &Group{ID: "group-a", Name: "Home"})
+	addURLEntry(t, service, work, "entry-4", "Webmail", "https://mail.example/-/inbox")
+	addURLEntry(t, service, work, "entry-2", "bank", "https://bank.example/-/login")
+	addURLEntry(t, service, home, "entry-3", "Gmail", "https://mail.example.com/-/")
+	addURLEntry(t, service, home, "entry-1", "Bank", "https://bank.example/-/")
+
+	tests := []struct {
+		term string
+		want []string
+	}{
+		{"ail", []string{"Webmail in group-b", "Gmail in group-a"}},
+		{"MAIL.EXAMPLE.C", []string{"Gmail in group-a"}},
+		{"bank.ex", []string{"bank in group-b", "Bank in group-a"}},
+		{"bank mail", nil},
+		{"zzz", nil},
+	}
+	for _, test := range tests {
+		if got := searchTitles(service, test.term); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SearchEntries(%q) = %v, want %v", test.term, got, test.want)
+		}
+	}
+
+	// The suffixes built by the searches above follow later changes
+	path, _, err := service.FindEntryByID("entry-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.UpdateEntry(path, Entry{Title: "Postbox"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddEntry(home, &Entry{ID: "entry-5", Title: "Mailbox"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Webmail in group-b", "Mailbox in group-a"}; !reflect.DeepEqual(searchTitles(service, "ail"), want) {
+		t.Errorf("SearchEntries after changes = %v, want %v", searchTitles(service, "ail"), want)
+	}
+	if want := []string{"Postbox in group-a"}; !reflect.DeepEqual(searchTitles(service, "stbo"), want) {
+		t.Errorf("SearchEntries of the new title = %v, want %v", searchTitles(service, "stbo"), want)
+	}
+	if err := service.DeleteGroup(work); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Mailbox in group-a"}; !reflect.DeepEqual(searchTitles(service, "ail"), want) {
+		t.Errorf("SearchEntries after deleting a group = %v, want %v", searchTitles(service, "ail"), want)
+	}
+}
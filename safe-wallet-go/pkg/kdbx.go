@@ -0,0 +1,642 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+// Reading KeePass KDBX 3.1 and 4 databases for import. Only what is needed
+// to get at the XML document is implemented, databases are never written.
+
+const (
+	kdbxSignature1 = 0x9AA2D903
+	kdbxSignature2 = 0xB54BFB67
+
+	// Outer header field IDs
+	kdbxHeaderEnd                = 0
+	kdbxHeaderCipherID           = 2
+	kdbxHeaderCompression        = 3
+	kdbxHeaderMasterSeed         = 4
+	kdbxHeaderTransformSeed      = 5
+	kdbxHeaderTransformRounds    = 6
+	kdbxHeaderEncryptionIV       = 7
+	kdbxHeaderProtectedStreamKey = 8
+	kdbxHeaderStreamStartBytes   = 9
+	kdbxHeaderInnerRandomStream  = 10
+	kdbxHeaderKdfParameters      = 11
+
+	// Inner header field IDs of KDBX 4
+	kdbxInnerHeaderEnd       = 0
+	kdbxInnerHeaderStreamID  = 1
+	kdbxInnerHeaderStreamKey = 2
+
+	// Inner random stream IDs that protect values in the XML document
+	kdbxStreamNone     = 0
+	kdbxStreamSalsa20  = 2
+	kdbxStreamChaCha20 = 3
+
+	// maxKDBXSize bounds the database read into memory
+	maxKDBXSize = 256 << 20
+)
+
+var (
+	kdbxCipherAES      = mustDecodeHex("31c1f2e6bf714350be5805216afc5aff")
+	kdbxCipherChaCha20 = mustDecodeHex("d6038a2b8b6f4cb5a524339a31dbb59a")
+	kdbxKdfAES         = mustDecodeHex("c9d9f39a628a4460bf740d08c18a4fea")
+	kdbxKdfAESKDBX3    = mustDecodeHex("7c02bb8279a74ac0927d114a00648238")
+	kdbxKdfArgon2d     = mustDecodeHex("ef636ddf8c29444b91f7a9a403e30a0c")
+	kdbxKdfArgon2id    = mustDecodeHex("9e298b1956db4773b23dfc3ec6f0a1e6")
+
+	kdbxSalsa20Nonce = []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}
+)
+
+// errKDBXKey is returned when the password or keyfile does not open the database
+var errKDBXKey = errors.New("invalid password or keyfile for the KeePass database")
+
+// kdbxHeader holds the outer header fields of a database
+type kdbxHeader struct {
+	major           uint16
+	cipherID        []byte
+	compressed      bool
+	masterSeed      []byte
+	iv              []byte
+	transformSeed   []byte
+	transformRounds uint64
+	streamKey       []byte
+	streamStart     []byte
+	streamID        uint32
+	kdfParams       map[string][]byte
+}
+
+// readKDBX decrypts a KeePass database with the password and the keyfile at
+// keyFilePath, either of which may be empty, and returns its XML document
+// with protected values in plaintext
+func readKDBX(path string, password string, keyFilePath string) (*xmlNode, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxKDBXSize))
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var keyFile []byte
+	if keyFilePath != "" {
+		if keyFile, err = readKeePassKeyFile(keyFilePath); err != nil {
+			return nil, fmt.Errorf("error reading keyfile: %v", err)
+		}
+		defer Wipe(keyFile)
+	}
+	if password == "" && keyFile == nil {
+		return nil, errors.New("a password or keyfile is required")
+	}
+	composite := kdbxCompositeKey([]byte(password), keyFile)
+	defer Wipe(composite)
+
+	return decryptKDBX(data, composite)
+}
+
+// decryptKDBX opens the database with the composite key
+func decryptKDBX(data []byte, composite []byte) (*xmlNode, error) {
+	header, headerSize, err := parseKDBXHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	transformed, err := header.transformKey(composite)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(transformed)
+
+	masterKey := sha256.Sum256(append(append([]byte(nil), header.masterSeed...), transformed...))
+	defer Wipe(masterKey[:])
+
+	var payload []byte
+	var stream cipher.Stream
+	if header.major == 3 {
+		payload, err = decryptKDBX3(data[headerSize:], header, masterKey[:])
+		if err != nil {
+			return nil, err
+		}
+		if stream, err = newKDBXStream(header.streamID, header.streamKey); err != nil {
+			return nil, err
+		}
+	} else {
+		payload, err = decryptKDBX4(data, headerSize, header, masterKey[:], transformed)
+		if err != nil {
+			return nil, err
+		}
+		var rest []byte
+		if stream, rest, err = parseKDBXInnerHeader(payload); err != nil {
+			return nil, err
+		}
+		payload = rest
+	}
+	return parseKDBXDocument(payload, stream)
+}
+
+// parseKDBXHeader decodes the outer header and returns it with its size
+func parseKDBXHeader(data []byte) (kdbxHeader, int, error) {
+	if len(data) < 12 || binary.LittleEndian.Uint32(data[0:4]) != kdbxSignature1 ||
+		binary.LittleEndian.Uint32(data[4:8]) != kdbxSignature2 {
+		return kdbxHeader{}, 0, errors.New("not a KeePass KDBX database")
+	}
+	header := kdbxHeader{major: uint16(binary.LittleEndian.Uint32(data[8:12]) >> 16)}
+	if header.major != 3 && header.major != 4 {
+		return kdbxHeader{}, 0, fmt.Errorf("unsupported KDBX version %d", header.major)
+	}
+
+	pos := 12
+	for {
+		sizeLen := 2
+		if header.major == 4 {
+			sizeLen = 4
+		}
+		if len(data) < pos+1+sizeLen {
+			return kdbxHeader{}, 0, errors.New("truncated KDBX header")
+		}
+		id := data[pos]
+		var size int
+		if sizeLen == 2 {
+			size = int(binary.LittleEndian.Uint16(data[pos+1:]))
+		} else {
+			size = int(binary.LittleEndian.Uint32(data[pos+1:]))
+		}
+		pos += 1 + sizeLen
+		if size < 0 || len(data) < pos+size {
+			return kdbxHeader{}, 0, errors.New("truncated KDBX header")
+		}
+		value := data[pos : pos+size]
+		pos += size
+
+		switch id {
+		case kdbxHeaderEnd:
+			if err := header.validate(); err != nil {
+				return kdbxHeader{}, 0, err
+			}
+			return header, pos, nil
+		case kdbxHeaderCipherID:
+			header.cipherID = value
+		case kdbxHeaderCompression:
+			if len(value) != 4 {
+				return kdbxHeader{}, 0, errors.New("invalid KDBX compression flags")
+			}
+			header.compressed = binary.LittleEndian.Uint32(value) == 1
+		case kdbxHeaderMasterSeed:
+			header.masterSeed = value
+		case kdbxHeaderTransformSeed:
+			header.transformSeed = value
+		case kdbxHeaderTransformRounds:
+			if len(value) != 8 {
+				return kdbxHeader{}, 0, errors.New("invalid KDBX transform rounds")
+			}
+			header.transformRounds = binary.LittleEndian.Uint64(value)
+		case kdbxHeaderEncryptionIV:
+			header.iv = value
+		case kdbxHeaderProtectedStreamKey:
+			header.streamKey = value
+		case kdbxHeaderStreamStartBytes:
+			header.streamStart = value
+		case kdbxHeaderInnerRandomStream:
+			if len(value) != 4 {
+				return kdbxHeader{}, 0, errors.New("invalid KDBX inner stream ID")
+			}
+			header.streamID = binary.LittleEndian.Uint32(value)
+		case kdbxHeaderKdfParameters:
+			params, err := parseVariantDictionary(value)
+			if err != nil {
+				return kdbxHeader{}, 0, err
+			}
+			header.kdfParams = params
+		}
+	}
+}
+
+// validate checks that the fields needed to decrypt the database are present
+func (h kdbxHeader) validate() error {
+	if len(h.masterSeed) != 32 {
+		return errors.New("invalid KDBX master seed")
+	}
+	if !bytes.Equal(h.cipherID, kdbxCipherAES) && !bytes.Equal(h.cipherID, kdbxCipherChaCha20) {
+		return errors.New("unsupported KDBX cipher, only AES and ChaCha20 databases can be imported")
+	}
+	if h.major == 3 && (len(h.transformSeed) != 32 || len(h.streamStart) != 32) {
+		return errors.New("invalid KDBX 3 header")
+	}
+	if h.major == 4 && h.kdfParams == nil {
+		return errors.New("KDBX 4 header has no key derivation parameters")
+	}
+	return nil
+}
+
+// transformKey runs the key derivation of the database on the composite key
+func (h kdbxHeader) transformKey(composite []byte) ([]byte, error) {
+	if h.major == 3 {
+		return kdbxAESKDF(composite, h.transformSeed, h.transformRounds)
+	}
+
+	kdf := h.kdfParams["$UUID"]
+	switch {
+	case bytes.Equal(kdf, kdbxKdfAES) || bytes.Equal(kdf, kdbxKdfAESKDBX3):
+		rounds, err := variantUint(h.kdfParams, "R", 8)
+		if err != nil {
+			return nil, err
+		}
+		return kdbxAESKDF(composite, h.kdfParams["S"], rounds)
+
+	case bytes.Equal(kdf, kdbxKdfArgon2d) || bytes.Equal(kdf, kdbxKdfArgon2id):
+		iterations, err := variantUint(h.kdfParams, "I", 8)
+		if err != nil {
+			return nil, err
+		}
+		memory, err := variantUint(h.kdfParams, "M", 8)
+		if err != nil {
+			return nil, err
+		}
+		parallelism, err := variantUint(h.kdfParams, "P", 4)
+		if err != nil {
+			return nil, err
+		}
+		if version, err := variantUint(h.kdfParams, "V", 4); err != nil || version != argon2Version {
+			return nil, errors.New("unsupported Argon2 version")
+		}
+		if _, ok := h.kdfParams["K"]; ok {
+			return nil, errors.New("Argon2 secret keys are not supported")
+		}
+		if iterations == 0 || iterations > 1<<32-1 || memory/1024 > 1<<32-1 || parallelism == 0 || parallelism > 255 {
+			return nil, errors.New("invalid Argon2 parameters")
+		}
+		salt := h.kdfParams["S"]
+		if bytes.Equal(kdf, kdbxKdfArgon2id) {
+			return argon2.IDKey(composite, salt, uint32(iterations), uint32(memory/1024), uint8(parallelism), 32), nil
+		}
+		return argon2dKey(composite, salt, uint32(iterations), uint32(memory/1024), uint8(parallelism), 32), nil
+
+	default:
+		return nil, errors.New("unsupported KDBX key derivation function")
+	}
+}
+
+// kdbxCompositeKey hashes the password and the keyfile key together
+func kdbxCompositeKey(password []byte, keyFile []byte) []byte {
+	h := sha256.New()
+	if len(password) > 0 {
+		passwordHash := sha256.Sum256(password)
+		h.Write(passwordHash[:])
+		Wipe(passwordHash[:])
+	}
+	if keyFile != nil {
+		h.Write(keyFile)
+	}
+	return h.Sum(nil)
+}
+
+// kdbxAESKDF encrypts the key with AES-ECB under the seed for the given
+// number of rounds and hashes the result
+func kdbxAESKDF(composite []byte, seed []byte, rounds uint64) ([]byte, error) {
+	if len(seed) != 32 {
+		return nil, errors.New("invalid AES-KDF seed")
+	}
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, err
+	}
+	key := append([]byte(nil), composite...)
+	defer Wipe(key)
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(key[0:16], key[0:16])
+		block.Encrypt(key[16:32], key[16:32])
+	}
+	transformed := sha256.Sum256(key)
+	return transformed[:], nil
+}
+
+// decryptKDBX3 decrypts the payload of a KDBX 3.1 database and reassembles
+// its hashed blocks
+func decryptKDBX3(encrypted []byte, header kdbxHeader, masterKey []byte) ([]byte, error) {
+	plaintext, err := kdbxDecryptPayload(encrypted, header, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) < 32 || !bytes.Equal(plaintext[:32], header.streamStart) {
+		return nil, errKDBXKey
+	}
+
+	var payload []byte
+	blocks := plaintext[32:]
+	for {
+		if len(blocks) < 40 {
+			return nil, errors.New("truncated KDBX block")
+		}
+		hash := blocks[4:36]
+		size := int(binary.LittleEndian.Uint32(blocks[36:40]))
+		blocks = blocks[40:]
+		if size == 0 {
+			break
+		}
+		if size < 0 || len(blocks) < size {
+			return nil, errors.New("truncated KDBX block")
+		}
+		if sum := sha256.Sum256(blocks[:size]); !bytes.Equal(sum[:], hash) {
+			return nil, errors.New("corrupted KDBX block")
+		}
+		payload = append(payload, blocks[:size]...)
+		blocks = blocks[size:]
+	}
+	if header.compressed {
+		return gunzip(payload)
+	}
+	return payload, nil
+}
+
+// decryptKDBX4 checks the header HMAC, reassembles the HMAC protected blocks
+// and decrypts the payload of a KDBX 4 database
+func decryptKDBX4(data []byte, headerSize int, header kdbxHeader, masterKey []byte, transformed []byte) ([]byte, error) {
+	if len(data) < headerSize+64 {
+		return nil, errors.New("truncated KDBX header")
+	}
+	headerHash := sha256.Sum256(data[:headerSize])
+	if !bytes.Equal(headerHash[:], data[headerSize:headerSize+32]) {
+		return nil, errors.New("corrupted KDBX header")
+	}
+
+	hmacBase := sha512.Sum512(append(append(append([]byte(nil), header.masterSeed...), transformed...), 1))
+	defer Wipe(hmacBase[:])
+	headerMAC := kdbxBlockHMAC(hmacBase[:], ^uint64(0), data[:headerSize])
+	if !hmac.Equal(headerMAC, data[headerSize+32:headerSize+64]) {
+		return nil, errKDBXKey
+	}
+
+	var encrypted []byte
+	blocks := data[headerSize+64:]
+	for index := uint64(0); ; index++ {
+		if len(blocks) < 36 {
+			return nil, errors.New("truncated KDBX block")
+		}
+		mac := blocks[:32]
+		size := int(int32(binary.LittleEndian.Uint32(blocks[32:36])))
+		if size < 0 || len(blocks) < 36+size {
+			return nil, errors.New("truncated KDBX block")
+		}
+		if !hmac.Equal(mac, kdbxBlockHMAC(hmacBase[:], index, blocks[32:36+size])) {
+			return nil, errors.New("corrupted KDBX block")
+		}
+		if size == 0 {
+			break
+		}
+		encrypted = append(encrypted, blocks[36:36+size]...)
+		blocks = blocks[36+size:]
+	}
+
+	payload, err := kdbxDecryptPayload(encrypted, header, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if header.compressed {
+		return gunzip(payload)
+	}
+	return payload, nil
+}
+
+// kdbxBlockHMAC authenticates a KDBX 4 block, or the header with index ^0
+func kdbxBlockHMAC(hmacBase []byte, index uint64, data []byte) []byte {
+	var indexBytes [8]byte
+	binary.LittleEndian.PutUint64(indexBytes[:], index)
+	blockKey := sha512.Sum512(append(indexBytes[:], hmacBase...))
+	defer Wipe(blockKey[:])
+
+	mac := hmac.New(sha256.New, blockKey[:])
+	mac.Write(indexBytes[:])
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// kdbxDecryptPayload decrypts with the cipher of the header
+func kdbxDecryptPayload(encrypted []byte, header kdbxHeader, masterKey []byte) ([]byte, error) {
+	if bytes.Equal(header.cipherID, kdbxCipherChaCha20) {
+		stream, err := chacha20.NewUnauthenticatedCipher(masterKey, header.iv)
+		if err != nil {
+			return nil, errors.New("invalid KDBX encryption IV")
+		}
+		plaintext := make([]byte, len(encrypted))
+		stream.XORKeyStream(plaintext, encrypted)
+		return plaintext, nil
+	}
+
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.iv) != aes.BlockSize || len(encrypted) == 0 || len(encrypted)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid KDBX payload")
+	}
+	plaintext := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, header.iv).CryptBlocks(plaintext, encrypted)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errKDBXKey
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, errKDBXKey
+		}
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// parseKDBXInnerHeader reads the inner header of a KDBX 4 payload and
+// returns the stream for protected values and the XML document after it
+func parseKDBXInnerHeader(payload []byte) (cipher.Stream, []byte, error) {
+	var streamID uint32
+	var streamKey []byte
+	for {
+		if len(payload) < 5 {
+			return nil, nil, errors.New("truncated KDBX inner header")
+		}
+		id := payload[0]
+		size := int(binary.LittleEndian.Uint32(payload[1:5]))
+		if size < 0 || len(payload) < 5+size {
+			return nil, nil, errors.New("truncated KDBX inner header")
+		}
+		value := payload[5 : 5+size]
+		payload = payload[5+size:]
+
+		switch id {
+		case kdbxInnerHeaderEnd:
+			stream, err := newKDBXStream(streamID, streamKey)
+			return stream, payload, err
+		case kdbxInnerHeaderStreamID:
+			if len(value) != 4 {
+				return nil, nil, errors.New("invalid KDBX inner stream ID")
+			}
+			streamID = binary.LittleEndian.Uint32(value)
+		case kdbxInnerHeaderStreamKey:
+			streamKey = value
+		}
+		// Attachments are skipped, they are not imported
+	}
+}
+
+// newKDBXStream creates the stream that protects values in the XML document
+func newKDBXStream(id uint32, key []byte) (cipher.Stream, error) {
+	switch id {
+	case kdbxStreamNone:
+		return nil, nil
+	case kdbxStreamSalsa20:
+		return &kdbxSalsa20{key: sha256.Sum256(key)}, nil
+	case kdbxStreamChaCha20:
+		hash := sha512.Sum512(key)
+		defer Wipe(hash[:])
+		return chacha20.NewUnauthenticatedCipher(hash[:32], hash[32:44])
+	default:
+		return nil, errors.New("unsupported KDBX inner stream cipher")
+	}
+}
+
+// kdbxSalsa20 is the Salsa20 key stream of KDBX 3.1 protected values, which
+// continues across values in document order
+type kdbxSalsa20 struct {
+	key     [32]byte
+	counter uint64
+	block   [64]byte
+	used    int
+}
+
+func (s *kdbxSalsa20) XORKeyStream(dst []byte, src []byte) {
+	for i := range src {
+		if s.used == 0 || s.used == len(s.block) {
+			var input [16]byte
+			copy(input[:8], kdbxSalsa20Nonce)
+			binary.LittleEndian.PutUint64(input[8:], s.counter)
+			var zero [64]byte
+			salsa.XORKeyStream(s.block[:], zero[:], &input, &s.key)
+			s.counter++
+			s.used = 0
+		}
+		dst[i] = src[i] ^ s.block[s.used]
+		s.used++
+	}
+}
+
+// parseVariantDictionary decodes the KDF parameters of a KDBX 4 header.
+// Values are kept in their little endian encoding.
+func parseVariantDictionary(data []byte) (map[string][]byte, error) {
+	invalid := errors.New("invalid KDBX variant dictionary")
+	if len(data) < 2 || data[1] != 1 {
+		return nil, invalid
+	}
+	data = data[2:]
+	items := make(map[string][]byte)
+	for {
+		if len(data) < 1 {
+			return nil, invalid
+		}
+		if data[0] == 0 {
+			return items, nil
+		}
+		if len(data) < 5 {
+			return nil, invalid
+		}
+		nameSize := int(binary.LittleEndian.Uint32(data[1:5]))
+		data = data[5:]
+		if nameSize < 0 || len(data) < nameSize+4 {
+			return nil, invalid
+		}
+		name := string(data[:nameSize])
+		valueSize := int(binary.LittleEndian.Uint32(data[nameSize : nameSize+4]))
+		data = data[nameSize+4:]
+		if valueSize < 0 || len(data) < valueSize {
+			return nil, invalid
+		}
+		items[name] = data[:valueSize]
+		data = data[valueSize:]
+	}
+}
+
+// variantUint returns an unsigned integer of the given size from the dictionary
+func variantUint(items map[string][]byte, name string, size int) (uint64, error) {
+	value, ok := items[name]
+	if !ok || len(value) != size {
+		return 0, fmt.Errorf("missing or invalid KDF parameter %s", name)
+	}
+	if size == 4 {
+		return uint64(binary.LittleEndian.Uint32(value)), nil
+	}
+	return binary.LittleEndian.Uint64(value), nil
+}
+
+// readKeePassKeyFile returns the key of a KeePass keyfile: the key in an XML
+// keyfile, 32 raw bytes, 64 hex digits, or else the hash of the file
+func readKeePassKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(data)
+	if len(data) == 0 {
+		return nil, errors.New("keyfile is empty")
+	}
+
+	var xmlKeyFile struct {
+		XMLName xml.Name `xml:"KeyFile"`
+		Version string   `xml:"Meta>Version"`
+		Data    string   `xml:"Key>Data"`
+	}
+	if xml.Unmarshal(data, &xmlKeyFile) == nil && xmlKeyFile.Data != "" {
+		if strings.HasPrefix(xmlKeyFile.Version, "2.") {
+			return hex.DecodeString(strings.Join(strings.Fields(xmlKeyFile.Data), ""))
+		}
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(xmlKeyFile.Data))
+	}
+
+	switch len(data) {
+	case 32:
+		return append([]byte(nil), data...), nil
+	case 64:
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+// gunzip decompresses a gzip payload
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(io.LimitReader(reader, maxKDBXSize))
+}
+
+// mustDecodeHex decodes a hex constant
+func mustDecodeHex(s string) []byte {
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return decoded
+}
@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The fixtures in testdata are written by testdata/kdbx.py, which implements
+// the formats on its own. keepass3.kdbx is a KDBX 3.1 database with AES,
+// AES-KDF and Salsa20 protected values. keepass4.kdbx is a KDBX 4 database
+// with ChaCha20, Argon2d and ChaCha20 protected values that also needs the
+// keyfile keepass4.keyx. Both hold the same groups and entries.
+const kdbxFixturePassword = "fixture password"
+
+// keePassFixture is the group both fixtures import as, without IDs
+var keePassFixture = Group{
+	Name: "Fixture",
+	Groups: []Group{{
+		Name:   "Email",
+		Groups: []Group{},
+		Entries: []Entry{{
+			Title: "Work Mail",
+			Fields: []EntryField{
+				{Name: "Username", Value: "alice@example.com", Type: FieldTypeGeneral},
+				{Name: "Password", Value: "hunter2 éè", Type: FieldTypePassword},
+			},
+		}},
+	}},
+	Entries: []Entry{{
+		Title: "Bank",
+		Fields: []EntryField{
+			{Name: "Username", Value: "alice", Type: FieldTypeGeneral},
+			{Name: "Password", Value: "correct horse", Type: FieldTypePassword},
+			{Name: "URL", Value: "https://bank.example", Type: FieldTypeGeneral},
+			{Name: "Notes", Value: "Line 1\nLine 2 & more", Type: FieldTypeGeneral},
+			{Name: "PIN", Value: "1234", Type: FieldTypePassword},
+			{Name: "Branch", Value: "Main Street", Type: FieldTypeGeneral},
+		},
+	}},
+}
+
+// withoutIDs clears the generated IDs of the group and everything below it
+func withoutIDs(group Group) Group {
+	group.ID = ""
+	for i := range group.Groups {
+		group.Groups[i] = withoutIDs(group.Groups[i])
+	}
+	for i := range group.Entries {
+		group.Entries[i].ID = ""
+	}
+	return group
+}
+
+func TestKDBXFixtures(t *testing.T) {
+	fixtures := []struct {
+		name    string
+		keyFile string
+	}{
+		{"keepass3.kdbx", ""},
+		{"keepass4.kdbx", "keepass4.keyx"},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			path := filepath.Join("testdata", fixture.name)
+			head, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !(kdbxImporter{}).Detect(fixture.name, head) {
+				t.Error("Detect does not recognize the database")
+			}
+
+			options := ImportOptions{Password: kdbxFixturePassword}
+			if fixture.keyFile != "" {
+				options.KeyFilePath = filepath.Join("testdata", fixture.keyFile)
+			}
+			group, err := kdbxImporter{}.Import(path, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := withoutIDs(*group); !reflect.DeepEqual(got, keePassFixture) {
+				t.Errorf("Import =\n%+v\nwant\n%+v", got, keePassFixture)
+			}
+
+			options.Password = "wrong password"
+			if _, err := (kdbxImporter{}).Import(path, options); err != errKDBXKey {
+				t.Errorf("Import with a wrong password = %v, want %v", err, errKDBXKey)
+			}
+		})
+	}
+
+	if _, err := (kdbxImporter{}).Import(filepath.Join("testdata", "keepass4.kdbx"), ImportOptions{Password: kdbxFixturePassword}); err != errKDBXKey {
+		t.Errorf("Import without the keyfile = %v, want %v", err, errKDBXKey)
+	}
+}
+
+func TestKDBXCorrupted(t *testing.T) {
+	for _, name := range []string{"keepass3.kdbx", "keepass4.kdbx"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyFile := []byte(nil)
+		if name == "keepass4.kdbx" {
+			if keyFile, err = readKeePassKeyFile(filepath.Join("testdata", "keepass4.keyx")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		composite := kdbxCompositeKey([]byte(kdbxFixturePassword), keyFile)
+
+		// A flipped bit near the end is caught by the block hash or HMAC,
+		// or in KDBX 3.1 by the padding
+		corrupted := append([]byte(nil), data...)
+		corrupted[len(corrupted)-40] ^= 1
+		if _, err := decryptKDBX(corrupted, composite); err == nil {
+			t.Errorf("%s: a corrupted database opened", name)
+		}
+		if _, err := decryptKDBX(data[:len(data)/2], composite); err == nil {
+			t.Errorf("%s: a truncated database opened", name)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// KeePass entry strings that map to the standard fields of an entry
+var keePassStandardFields = []struct {
+	key       string
+	name      string
+	fieldType FieldType
+}{
+	{"UserName", "Username", FieldTypeGeneral},
+	{"Password", "Password", FieldTypePassword},
+	{"URL", "URL", FieldTypeGeneral},
+	{"Notes", "Notes", FieldTypeGeneral},
+}
+
+// xmlNode is an element of the KeePass XML document
+type xmlNode struct {
+	name      string
+	text      string
+	protected bool
+	children  []*xmlNode
+}
+
+// child returns the first child element with the name, or nil
+func (n *xmlNode) child(name string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// childText returns the text of the first child element with the name
+func (n *xmlNode) childText(name string) string {
+	if c := n.child(name); c != nil {
+		return c.text
+	}
+	return ""
+}
+
+// kdbxImporter imports KeePass KDBX 3.1 and 4 databases
+type kdbxImporter struct{}
+
+func (kdbxImporter) Name() string {
+	return "KeePass KDBX"
+}
+
+func (kdbxImporter) NeedsPassword() bool {
+	return true
+}
+
+func (kdbxImporter) Detect(filename string, head []byte) bool {
+	return len(head) >= 8 && binary.LittleEndian.Uint32(head[0:4]) == kdbxSignature1 &&
+		binary.LittleEndian.Uint32(head[4:8]) == kdbxSignature2
+}
+
+// Import returns the groups and entries of the database as a single group
+// named after the database root. The recycle bin and entry history are not
+// imported.
+func (kdbxImporter) Import(path string, options ImportOptions) (*Group, error) {
+	document, err := readKDBX(path, options.Password, options.KeyFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	root := document.child("Root").child("Group")
+	if root == nil {
+		return nil, errors.New("KeePass database has no root group")
+	}
+	var recycleBin string
+	if meta := document.child("Meta"); meta.childText("RecycleBinEnabled") == "True" {
+		recycleBin = meta.childText("RecycleBinUUID")
+	}
+
+	group := keePassGroup(root, recycleBin)
+	return &group, nil
+}
+
+// keePassGroup converts a KeePass group and everything below it
+func keePassGroup(node *xmlNode, recycleBin string) Group {
+	group := Group{
+		ID:      generateGroupID(),
+		Name:    strings.TrimSpace(node.childText("Name")),
+		Groups:  []Group{},
+		Entries: []Entry{},
+	}
+	if group.Name == "" {
+		group.Name = "(unnamed)"
+	}
+
+	for _, c := range node.children {
+		switch c.name {
+		case "Group":
+			if recycleBin != "" && c.childText("UUID") == recycleBin {
+				continue
+			}
+			group.Groups = append(group.Groups, keePassGroup(c, recycleBin))
+		case "Entry":
+			group.Entries = append(group.Entries, keePassEntry(c))
+		}
+	}
+	return group
+}
+
+// keePassEntry converts a KeePass entry. Standard strings become the usual
+// fields, custom strings are kept under their own name and protected custom
+// strings are typed as passwords.
+func keePassEntry(node *xmlNode) Entry {
+	values := make(map[string]*xmlNode)
+	var custom []*xmlNode
+	for _, c := range node.children {
+		if c.name != "String" {
+			continue
+		}
+		key := c.childText("Key")
+		values[key] = c.child("Value")
+		if key != "Title" && !isKeePassStandardField(key) {
+			custom = append(custom, c)
+		}
+	}
+
+	entry := Entry{
+		ID:     generateEntryID(),
+		Title:  strings.TrimSpace(values["Title"].textOrEmpty()),
+		Fields: []EntryField{},
+	}
+	if entry.Title == "" {
+		entry.Title = "(untitled)"
+	}
+
+	for _, standard := range keePassStandardFields {
+		if value := values[standard.key].textOrEmpty(); value != "" {
+			entry.Fields = append(entry.Fields, EntryField{Name: standard.name, Value: value, Type: standard.fieldType})
+		}
+	}
+	for _, c := range custom {
+		value := c.child("Value")
+		fieldType := FieldTypeGeneral
+		if value != nil && value.protected {
+			fieldType = FieldTypePassword
+		}
+		entry.Fields = append(entry.Fields, EntryField{Name: c.childText("Key"), Value: value.textOrEmpty(), Type: fieldType})
+	}
+	return entry
+}
+
+// textOrEmpty returns the text of the node, or "" for a missing node
+func (n *xmlNode) textOrEmpty() string {
+	if n == nil {
+		return ""
+	}
+	return n.text
+}
+
+// isKeePassStandardField reports whether the string key maps to a standard field
+func isKeePassStandardField(key string) bool {
+	for _, standard := range keePassStandardFields {
+		if standard.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// parseKDBXDocument parses the XML document of a database. Protected values
+// are decrypted with the stream in document order.
+func parseKDBXDocument(data []byte, stream cipher.Stream) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid KeePass XML document: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local}
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "Protected" && strings.EqualFold(attr.Value, "True") {
+					node.protected = true
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if node.protected && stream != nil {
+				value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(node.text))
+				if err != nil {
+					return nil, errors.New("invalid protected value in KeePass XML document")
+				}
+				stream.XORKeyStream(value, value)
+				node.text = string(value)
+				Wipe(value)
+			}
+		}
+	}
+	if root == nil || root.name != "KeePassFile" {
+		return nil, errors.New("invalid KeePass XML document")
+	}
+	return root, nil
+}
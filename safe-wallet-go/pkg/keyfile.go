@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+)
+
+// keyFileSize is the number of random bytes in a generated keyfile
+const keyFileSize = 64
+
+// ErrKeyFileRequired is returned when a wallet that needs a keyfile is opened without one
+var ErrKeyFileRequired = errors.New("wallet requires a keyfile")
+
+// ReadKeyFile hashes the contents of a keyfile. Any file can be used, its
+// SHA-256 digest is combined with the password.
+func ReadKeyFile(path string) (*SecureBuffer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, errors.New("keyfile is a directory")
+	}
+	if info.Size() == 0 {
+		return nil, errors.New("keyfile is empty")
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	return NewSecureBufferFrom(hash.Sum(nil)), nil
+}
+
+// GenerateKeyFile writes a new keyfile of random bytes. Existing files are
+// not overwritten.
+func GenerateKeyFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := WriteKeyFile(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WriteKeyFile writes the random contents of a new keyfile to w
+func WriteKeyFile(w io.Writer) error {
+	data := make([]byte, keyFileSize)
+	defer Wipe(data)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// compositeKey combines the password with the keyfile digest into the input
+// for key derivation. Without a keyfile the password is used directly, which
+// keeps wallets written before keyfile support readable.
+func compositeKey(password []byte, keyFile *SecureBuffer) []byte {
+	if keyFile == nil {
+		return append([]byte(nil), password...)
+	}
+	passwordHash := sha256.Sum256(password)
+	composite := make([]byte, 0, len(passwordHash)+keyFile.Len())
+	composite = append(composite, passwordHash[:]...)
+	composite = append(composite, keyFile.Bytes()...)
+	Wipe(passwordHash[:])
+	return composite
+}
+
+// deriveWalletKey derives the key of a version 1 or 2 wallet from the
+// password and the keyfile digest, which must be given exactly when the
+// header requires it
+func deriveWalletKey(password []byte, keyFile *SecureBuffer, header WalletHeader) (*SecureBuffer, error) {
+	if header.KeyFile && keyFile == nil {
+		return nil, ErrKeyFileRequired
+	}
+	if !header.KeyFile && keyFile != nil {
+		return nil, errors.New("wallet does not use a keyfile")
+	}
+
+	material := compositeKey(password, keyFile)
+	defer Wipe(material)
+	return deriveKey(material, header.Salt), nil
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newKeyFile generates a keyfile in a temporary directory
+func newKeyFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wallet.key")
+	if err := GenerateKeyFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadKeyFile(t *testing.T) {
+	path := newKeyFile(t)
+	if err := GenerateKeyFile(path); err == nil {
+		t.Error("GenerateKeyFile overwrote an existing keyfile")
+	}
+	digest, err := ReadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer digest.Destroy()
+	if digest.Len() != 32 {
+		t.Errorf("keyfile digest has %d bytes, want 32", digest.Len())
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.key")
+	if err := os.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{empty, t.TempDir(), filepath.Join(t.TempDir(), "missing.key")} {
+		if _, err := ReadKeyFile(path); err == nil {
+			t.Errorf("ReadKeyFile(%s) succeeded", path)
+		}
+	}
+}
+
+func TestWalletWithKeyFile(t *testing.T) {
+	storage := NewMemoryStorage()
+	keyFile := newKeyFile(t)
+	service := NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+	if err := service.SetKeyFile(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	service.Close()
+
+	header, err := ReadWalletHeaderFrom(storage, "wallet.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.RequiresKeyFile() {
+		t.Error("the header does not record that a keyfile is required")
+	}
+
+	// The password alone, or with another keyfile, does not unlock it
+	reopened := NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+	defer reopened.Close()
+	if err := reopened.Load(); err == nil {
+		t.Error("the wallet was unlocked without its keyfile")
+	}
+	if err := reopened.SetKeyFile(newKeyFile(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Unlock("password"); err == nil {
+		t.Error("the wallet was unlocked with another keyfile")
+	}
+
+	if err := reopened.SetKeyFile(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Unlock("password"); err != nil {
+		t.Fatalf("the password and keyfile did not unlock the wallet: %v", err)
+	}
+	if !reopened.UsesKeyFile() {
+		t.Error("UsesKeyFile = false for a slot that requires a keyfile")
+	}
+}
+
+func TestOlderKeyFileWalletMovesToKeySlots(t *testing.T) {
+	storage := NewMemoryStorage()
+	keyFile := newKeyFile(t)
+	digest, err := ReadKeyFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"version":1,"groups":[{"id":"grp-1","name":"Work"}]}`)
+	if err := storage.WriteFile("wallet.dat", encryptLegacy(t, data, "password", digest, keyFileFormatVersion)); err != nil {
+		t.Fatal(err)
+	}
+	digest.Destroy()
+
+	service := NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+	defer service.Close()
+	if err := service.Load(); !errors.Is(err, ErrKeyFileRequired) {
+		t.Fatalf("Load without the keyfile = %v, want ErrKeyFileRequired", err)
+	}
+	if err := service.SetKeyFile(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Unlock("password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := ReadWalletHeaderFrom(storage, "wallet.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != currentFormatVersion || !header.RequiresKeyFile() {
+		t.Fatalf("saved version %d with slots %+v, want key slots requiring the keyfile", header.Version, header.Slots)
+	}
+
+	reopened := NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+	defer reopened.Close()
+	if err := reopened.SetKeyFile(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Load(); err != nil {
+		t.Fatalf("the saved wallet does not unlock with the password and keyfile: %v", err)
+	}
+	if groups := reopened.GetWallet().Groups; len(groups) != 1 || groups[0].Name != "Work" {
+		t.Errorf("groups after the upgrade = %+v", groups)
+	}
+}
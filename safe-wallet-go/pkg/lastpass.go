@@ -0,0 +1,121 @@
+package pkg
+
+import "strings"
+
+// lastPassSecureNoteURL marks secure notes in a LastPass export
+const lastPassSecureNoteURL = "http://sn"
+
+// lastPassNoteTypes maps LastPass secure note types to templates and their
+// field names to the field names of the templates
+var lastPassNoteTypes = map[string]struct {
+	kind   string
+	fields map[string]string
+}{
+	"Credit Card": {"Credit Card", map[string]string{
+		"Name on Card":    "Cardholder Name",
+		"Number":          "Card Number",
+		"Security Code":   "CVV",
+		"Expiration Date": "Expiration Date",
+	}},
+	"Bank Account": {"Bank Account", map[string]string{
+		"Bank Name":      "Bank Name",
+		"Account Type":   "Account Type",
+		"Account Number": "Account Number",
+		"Routing Number": "Routing Number",
+		"PIN":            "PIN",
+	}},
+}
+
+// lastPassSensitiveFields are secure note fields imported as passwords
+var lastPassSensitiveFields = map[string]bool{
+	"Password":      true,
+	"Security Code": true,
+	"PIN":           true,
+}
+
+// lastPassImporter imports the CSV export of LastPass
+type lastPassImporter struct{}
+
+func (lastPassImporter) Name() string {
+	return "LastPass CSV"
+}
+
+func (lastPassImporter) NeedsPassword() bool {
+	return false
+}
+
+func (lastPassImporter) Detect(filename string, head []byte) bool {
+	header := csvHeader(head)
+	return header["grouping"] && header["extra"]
+}
+
+// Import maps the grouping column, where "\" separates nested folders, to
+// groups. Secure notes of a known type are split into their fields.
+func (lastPassImporter) Import(path string, options ImportOptions) (*Group, error) {
+	header, records, err := readImportCSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []importItem
+	for _, record := range records {
+		columns := make(map[string]string)
+		for i, column := range header {
+			if i < len(record) {
+				columns[strings.ToLower(column)] = record[i]
+			}
+		}
+
+		item := importItem{title: columns["name"]}
+		if grouping := columns["grouping"]; grouping != "" {
+			item.folder = strings.Split(grouping, `\`)
+		}
+
+		if columns["url"] == lastPassSecureNoteURL {
+			lastPassNote(&item, columns["extra"])
+		} else {
+			item.kind = "Password"
+			item.field("Username", columns["username"], FieldTypeGeneral)
+			item.field("Password", columns["password"], FieldTypePassword)
+			item.field("URL", columns["url"], FieldTypeGeneral)
+			item.field("TOTP", columns["totp"], FieldTypePassword)
+			item.field("Notes", columns["extra"], FieldTypeGeneral)
+		}
+		items = append(items, item)
+	}
+	return buildImportGroup("LastPass", items), nil
+}
+
+// lastPassNote fills the item from a secure note. Typed notes start with a
+// "NoteType:" line followed by "Name:value" lines and a free "Notes:" part.
+func lastPassNote(item *importItem, extra string) {
+	if !strings.HasPrefix(extra, "NoteType:") {
+		item.kind = "Note"
+		item.field("Note", extra, FieldTypeGeneral)
+		return
+	}
+
+	lines := strings.Split(extra, "\n")
+	noteType := lastPassNoteTypes[strings.TrimSpace(strings.TrimPrefix(lines[0], "NoteType:"))]
+	item.kind = noteType.kind
+	for i := 1; i < len(lines); i++ {
+		name, value, ok := strings.Cut(lines[i], ":")
+		if !ok {
+			continue
+		}
+		if name == "Notes" {
+			// The notes run to the end of the note
+			item.field("Notes", strings.Join(append([]string{value}, lines[i+1:]...), "\n"), FieldTypeGeneral)
+			break
+		}
+
+		fieldType := FieldTypeGeneral
+		if lastPassSensitiveFields[name] {
+			fieldType = FieldTypePassword
+		}
+		if mapped, ok := noteType.fields[name]; ok {
+			name = mapped
+		}
+		item.field(name, value, fieldType)
+	}
+}
@@ -0,0 +1,187 @@
+package pkg
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps wallets in memory, e.g. for tests. The zero value is
+// not usable, create it with NewMemoryStorage.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	files map[string]memoryFile
+	dirs  map[string]bool
+	locks map[string]bool
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryStorage returns an empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		files: make(map[string]memoryFile),
+		dirs:  map[string]bool{".": true, string(filepath.Separator): true},
+		locks: make(map[string]bool),
+	}
+}
+
+func (m *MemoryStorage) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, notExist("read", name)
+	}
+	return append([]byte(nil), file.data...), nil
+}
+
+func (m *MemoryStorage) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return fmt.Errorf("write %s: is a directory", name)
+	}
+	if !m.dirs[filepath.Dir(name)] {
+		return notExist("write", name)
+	}
+	m.files[name] = memoryFile{data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+func (m *MemoryStorage) Stat(name string) (StorageInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return StorageInfo{IsDir: true}, nil
+	}
+	file, ok := m.files[name]
+	if !ok {
+		return StorageInfo{}, notExist("stat", name)
+	}
+	return StorageInfo{Size: int64(len(file.data)), ModTime: file.modTime}, nil
+}
+
+func (m *MemoryStorage) ReadDir(name string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if !m.dirs[name] {
+		return nil, notExist("readdir", name)
+	}
+	var names []string
+	for _, child := range m.children(name) {
+		names = append(names, filepath.Base(child))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *MemoryStorage) Mkdir(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for dir := filepath.Clean(name); !m.dirs[dir]; dir = filepath.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return fmt.Errorf("mkdir %s: not a directory", dir)
+		}
+		m.dirs[dir] = true
+	}
+	return nil
+}
+
+func (m *MemoryStorage) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	if !m.dirs[name] {
+		return notExist("remove", name)
+	}
+	if len(m.children(name)) > 0 {
+		return fmt.Errorf("remove %s: directory not empty", name)
+	}
+	delete(m.dirs, name)
+	return nil
+}
+
+func (m *MemoryStorage) Rename(oldName string, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldName, newName = filepath.Clean(oldName), filepath.Clean(newName)
+	if !m.dirs[filepath.Dir(newName)] {
+		return notExist("rename", newName)
+	}
+	if file, ok := m.files[oldName]; ok {
+		delete(m.files, oldName)
+		m.files[newName] = file
+		return nil
+	}
+	if !m.dirs[oldName] {
+		return notExist("rename", oldName)
+	}
+
+	// Move the directory and everything below it
+	prefix := oldName + string(filepath.Separator)
+	for name, file := range m.files {
+		if strings.HasPrefix(name, prefix) {
+			delete(m.files, name)
+			m.files[newName+name[len(oldName):]] = file
+		}
+	}
+	for dir := range m.dirs {
+		if dir == oldName || strings.HasPrefix(dir, prefix) {
+			delete(m.dirs, dir)
+			m.dirs[newName+dir[len(oldName):]] = true
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStorage) Lock(name string) (func() error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if m.locks[name] {
+		return nil, fmt.Errorf("wallet %s is being written by someone else", name)
+	}
+	m.locks[name] = true
+	return func() error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.locks, name)
+		return nil
+	}, nil
+}
+
+// children returns the files and directories directly in the directory
+func (m *MemoryStorage) children(dir string) []string {
+	var children []string
+	for name := range m.files {
+		if filepath.Dir(name) == dir {
+			children = append(children, name)
+		}
+	}
+	for name := range m.dirs {
+		if name != dir && filepath.Dir(name) == dir {
+			children = append(children, name)
+		}
+	}
+	return children
+}
+
+// notExist returns an error for a missing name that satisfies os.IsNotExist
+func notExist(op string, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,176 @@
+package pkg
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryStorageFiles(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	if _, err := storage.ReadFile("wallet.dat"); !os.IsNotExist(err) {
+		t.Fatalf("ReadFile of a missing file: %v", err)
+	}
+	if err := storage.WriteFile("missing/wallet.dat", []byte("x")); !os.IsNotExist(err) {
+		t.Fatalf("WriteFile into a missing directory: %v", err)
+	}
+
+	data := []byte("secret")
+	if err := storage.WriteFile("wallet.dat", data); err != nil {
+		t.Fatal(err)
+	}
+	// The storage keeps its own copy
+	data[0] = 'S'
+	read, err := storage.ReadFile("./wallet.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != "secret" {
+		t.Errorf("ReadFile = %q, want %q", read, "secret")
+	}
+	read[0] = 'S'
+	if read, _ := storage.ReadFile("wallet.dat"); string(read) != "secret" {
+		t.Errorf("changing the read data changed the file: %q", read)
+	}
+
+	info, err := storage.Stat("wallet.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDir || info.Size != 6 || info.ModTime.IsZero() {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	if err := storage.Rename("wallet.dat", "renamed.dat"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Stat("wallet.dat"); !os.IsNotExist(err) {
+		t.Errorf("old name still exists after Rename: %v", err)
+	}
+	if err := storage.Remove("renamed.dat"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Remove("renamed.dat"); !os.IsNotExist(err) {
+		t.Errorf("Remove of a removed file: %v", err)
+	}
+}
+
+func TestMemoryStorageDirectories(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	if err := storage.Mkdir("vault/entries"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := storage.Stat("vault"); err != nil || !info.IsDir {
+		t.Fatalf("Stat of a parent created by Mkdir = %+v, %v", info, err)
+	}
+	for _, name := range []string{"vault/wallet.swlt", "vault/entries/b.swlt", "vault/entries/a.swlt"} {
+		if err := storage.WriteFile(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := storage.WriteFile("vault/entries", nil); err == nil {
+		t.Error("WriteFile over a directory succeeded")
+	}
+	if err := storage.Mkdir("vault/wallet.swlt/sub"); err == nil {
+		t.Error("Mkdir below a file succeeded")
+	}
+
+	names, err := storage.ReadDir("vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"entries", "wallet.swlt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir = %v, want %v", names, want)
+	}
+	if err := storage.Remove("vault/entries"); err == nil {
+		t.Error("Remove of a directory that is not empty succeeded")
+	}
+
+	if err := storage.Rename("vault", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	names, err = storage.ReadDir("moved/entries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.swlt", "b.swlt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir after Rename = %v, want %v", names, want)
+	}
+	if data, err := storage.ReadFile("moved/entries/a.swlt"); err != nil || string(data) != "vault/entries/a.swlt" {
+		t.Errorf("ReadFile after Rename = %q, %v", data, err)
+	}
+	if _, err := storage.ReadDir("vault"); !os.IsNotExist(err) {
+		t.Errorf("ReadDir of the old name: %v", err)
+	}
+}
+
+func TestMemoryStorageLock(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	unlock, err := storage.Lock("wallet.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Lock("./wallet.dat"); err == nil {
+		t.Fatal("second Lock succeeded while the first is held")
+	}
+	other, err := storage.Lock("other.dat")
+	if err != nil {
+		t.Fatalf("Lock of another wallet: %v", err)
+	}
+	other()
+	unlock()
+	if unlock, err = storage.Lock("wallet.dat"); err != nil {
+		t.Fatalf("Lock after unlock: %v", err)
+	}
+	unlock()
+}
+
+func TestMemoryStorageWallet(t *testing.T) {
+	for _, format := range []StorageFormat{StorageFile, StorageSyncDir} {
+		t.Run(string(format), func(t *testing.T) {
+			storage := NewMemoryStorage()
+			service := NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+			if err := service.CreateNew(); err != nil {
+				t.Fatal(err)
+			}
+			if format == StorageSyncDir {
+				if err := service.ConvertStorage(StorageSyncDir); err != nil {
+					t.Fatal(err)
+				}
+			}
+			group := &Group{Name: "Email"}
+			if err := service.AddGroup(Path{}, group); err != nil {
+				t.Fatal(err)
+			}
+			path := Path{GroupIDs: []string{group.ID}}
+			entry := &Entry{Title: "Mail", Fields: []EntryField{{Name: "password", Value: "hunter2", Type: FieldTypePassword}}}
+			if err := service.AddEntry(path, entry); err != nil {
+				t.Fatal(err)
+			}
+			if err := service.Save(); err != nil {
+				t.Fatal(err)
+			}
+			service.Close()
+
+			reopened := NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+			defer reopened.Close()
+			if err := reopened.Load(); err != nil {
+				t.Fatal(err)
+			}
+			if got := reopened.StorageFormat(); got != format {
+				t.Errorf("StorageFormat = %s, want %s", got, format)
+			}
+			_, loaded, err := reopened.FindEntryByID(entry.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, err := reopened.FieldValue(loaded.Fields[0])
+			if err != nil || value != "hunter2" {
+				t.Errorf("FieldValue = %q, %v", value, err)
+			}
+		})
+	}
+}
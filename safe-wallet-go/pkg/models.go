@@ -4,6 +4,10 @@ package pkg
 type Wallet struct {
 	Version int     `json:"version"`
 	Groups  []Group `json:"groups"`
+
+	// index is the lookup index maintained by WalletService, nil if the
+	// wallet is not managed by a service
+	index *walletIndex
 }
 
 // Group represents a group that can contain other groups and entries
@@ -21,11 +25,16 @@ type Entry struct {
 	Fields []EntryField `json:"fields"`
 }
 
-// EntryField represents a key-value pair for an entry's field
+// EntryField represents a key-value pair for an entry's field. Sensitive
+// fields of a wallet held by WalletService are sealed: Value is empty and
+// the value is read with WalletService.FieldValue.
 type EntryField struct {
 	Name  string    `json:"name"`
 	Value string    `json:"value"`
 	Type  FieldType `json:"type"`
+
+	// sealed is the value encrypted with the field key of the service
+	sealed []byte
 }
 
 // FieldType defines the type of an entry field
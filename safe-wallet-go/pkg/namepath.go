@@ -0,0 +1,233 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// NamePathSeparator separates group names in a name path like "Work/AWS/Console"
+	NamePathSeparator = '/'
+	// namePathEscape escapes a separator or another escape inside a name
+	namePathEscape = '\\'
+)
+
+// NameSegment is a segment of a name path
+type NameSegment struct {
+	Name string
+	// Navigation is set for "." and "..", which refer to the current and
+	// parent group. Written escaped, as `\.` and `\.\.`, they are names.
+	Navigation bool
+	// Group is set when a separator follows the name, so it can only name
+	// a group, e.g. "Mail/" where "Mail" could also be an entry
+	Group bool
+}
+
+// EscapeName escapes separators and backslashes in a group name or entry title
+// so it can be used as a single name path segment. The names "." and ".."
+// are escaped as well, so they are not taken for the current or parent group.
+func EscapeName(name string) string {
+	if name == "." || name == ".." {
+		return strings.Repeat(string(namePathEscape)+".", len(name))
+	}
+	var b strings.Builder
+	for _, r := range name {
+		if r == NamePathSeparator || r == namePathEscape {
+			b.WriteRune(namePathEscape)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// JoinNamePath joins names into an absolute name path, escaping each name
+func JoinNamePath(names []string) string {
+	escaped := make([]string, len(names))
+	for i, name := range names {
+		escaped[i] = EscapeName(name)
+	}
+	return string(NamePathSeparator) + strings.Join(escaped, string(NamePathSeparator))
+}
+
+// SplitNamePath splits a name path into its unescaped segments.
+// absolute reports whether the path starts with a separator. Empty
+// segments (e.g. from "Work//AWS" or a trailing separator) are dropped.
+// "." and ".." are navigation segments unless any of their dots is escaped.
+// Every segment followed by a separator is a group segment.
+func SplitNamePath(s string) (segments []NameSegment, absolute bool, err error) {
+	absolute = strings.HasPrefix(s, string(NamePathSeparator))
+
+	var current strings.Builder
+	escaped, hasEscape := false, false
+	endSegment := func() {
+		if current.Len() > 0 {
+			name := current.String()
+			navigation := !hasEscape && (name == "." || name == "..")
+			segments = append(segments, NameSegment{Name: name, Navigation: navigation})
+			current.Reset()
+		}
+		hasEscape = false
+	}
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == namePathEscape:
+			escaped, hasEscape = true, true
+		case r == NamePathSeparator:
+			endSegment()
+			if len(segments) > 0 {
+				segments[len(segments)-1].Group = true
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if escaped {
+		return nil, false, errors.New("name path ends with an incomplete escape")
+	}
+	endSegment()
+
+	return segments, absolute, nil
+}
+
+// FormatNamePath returns the absolute name path of a group or entry,
+// e.g. "/Work/AWS/Console". The root is formatted as "/". A group that has
+// an entry of the same name next to it gets a trailing separator, so the
+// path resolves to the group again.
+func FormatNamePath(wallet *Wallet, path Path) (string, error) {
+	var names []string
+	// siblings are the entries next to the last group
+	var siblings, entries []Entry
+
+	currentPath := Path{GroupIDs: []string{}}
+	for _, groupID := range path.GroupIDs {
+		currentPath.GroupIDs = append(currentPath.GroupIDs, groupID)
+		group, err := FindGroupByPath(wallet, currentPath)
+		if err != nil {
+			return "", err
+		}
+		names = append(names, group.Name)
+		siblings, entries = entries, group.Entries
+	}
+
+	if path.EntryID != "" {
+		entry, err := FindEntryByPath(wallet, path)
+		if err != nil {
+			return "", err
+		}
+		return JoinNamePath(append(names, entry.Title)), nil
+	}
+
+	namePath := JoinNamePath(names)
+	if len(names) > 0 && findEntryByTitle(siblings, names[len(names)-1]) != nil {
+		namePath += string(NamePathSeparator)
+	}
+	return namePath, nil
+}
+
+// ResolveNamePath resolves a name path to a Path. Relative name paths are
+// resolved against the group at base; "." and ".." refer to the current and
+// parent group, and `\.` and `\.\.` to groups or entries with those names.
+// The last segment may name an entry in the group reached so far, which is
+// preferred over a group of the same name unless a separator follows it.
+func ResolveNamePath(wallet *Wallet, base Path, s string) (Path, error) {
+	segments, absolute, err := SplitNamePath(s)
+	if err != nil {
+		return Path{}, err
+	}
+	return resolveSegments(wallet, base, segments, absolute)
+}
+
+// ResolveGroupNamePath resolves a name path that must lead to a group, as if
+// it ended with a separator
+func ResolveGroupNamePath(wallet *Wallet, base Path, s string) (Path, error) {
+	segments, absolute, err := SplitNamePath(s)
+	if err != nil {
+		return Path{}, err
+	}
+	if len(segments) > 0 {
+		segments[len(segments)-1].Group = true
+	}
+	return resolveSegments(wallet, base, segments, absolute)
+}
+
+// resolveSegments resolves the segments of a name path
+func resolveSegments(wallet *Wallet, base Path, segments []NameSegment, absolute bool) (Path, error) {
+	groupIDs := []string{}
+	if !absolute {
+		groupIDs = append(groupIDs, base.GroupIDs...)
+	}
+
+	for i, segment := range segments {
+		if segment.Navigation {
+			if segment.Name == ".." && len(groupIDs) > 0 {
+				groupIDs = groupIDs[:len(groupIDs)-1]
+			}
+			continue
+		}
+		name := segment.Name
+
+		groups, entries, err := childrenAt(wallet, Path{GroupIDs: groupIDs})
+		if err != nil {
+			return Path{}, err
+		}
+
+		last := i == len(segments)-1
+		if last && !segment.Group {
+			if entry := findEntryByTitle(entries, name); entry != nil {
+				return Path{GroupIDs: groupIDs, EntryID: entry.ID}, nil
+			}
+		}
+
+		if group := findGroupByName(groups, name); group != nil {
+			groupIDs = append(groupIDs, group.ID)
+			continue
+		}
+
+		if findEntryByTitle(entries, name) != nil {
+			return Path{}, fmt.Errorf("'%s' is an entry, not a group", name)
+		}
+		if segment.Group {
+			return Path{}, fmt.Errorf("no group named '%s'", name)
+		}
+		return Path{}, fmt.Errorf("no group or entry named '%s'", name)
+	}
+
+	return Path{GroupIDs: groupIDs}, nil
+}
+
+// childrenAt returns the groups and entries directly inside the group at path,
+// or the root groups if the path is empty
+func childrenAt(wallet *Wallet, path Path) ([]Group, []Entry, error) {
+	if len(path.GroupIDs) == 0 {
+		return wallet.Groups, nil, nil
+	}
+	group, err := FindGroupByPath(wallet, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return group.Groups, group.Entries, nil
+}
+
+// findGroupByName finds a group by name among the given groups
+func findGroupByName(groups []Group, name string) *Group {
+	for i := range groups {
+		if groups[i].Name == name {
+			return &groups[i]
+		}
+	}
+	return nil
+}
+
+// findEntryByTitle finds an entry by title among the given entries
+func findEntryByTitle(entries []Entry, title string) *Entry {
+	for i := range entries {
+		if entries[i].Title == title {
+			return &entries[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEscapeName(t *testing.T) {
+	tests := map[string]string{
+		"Work":    "Work",
+		"Dev/Ops": `Dev\/Ops`,
+		`C:\`:     `C:\\`,
+		".":       `\.`,
+		"..":      `\.\.`,
+		"...":     "...",
+		".ssh":    ".ssh",
+	}
+	for name, want := range tests {
+		if got := EscapeName(name); got != want {
+			t.Errorf("EscapeName(%q) = %q, want %q", name, got, want)
+		}
+		segments, _, err := SplitNamePath(EscapeName(name))
+		if err != nil || !reflect.DeepEqual(segments, []NameSegment{{Name: name}}) {
+			t.Errorf("SplitNamePath(EscapeName(%q)) = %+v, %v", name, segments, err)
+		}
+	}
+}
+
+func TestSplitNamePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		segments []NameSegment
+		absolute bool
+	}{
+		{"/Work//AWS/", []NameSegment{{Name: "Work", Group: true}, {Name: "AWS", Group: true}}, true},
+		{"/Work/AWS", []NameSegment{{Name: "Work", Group: true}, {Name: "AWS"}}, true},
+		{"../Dev\\/Ops", []NameSegment{{Name: "..", Navigation: true, Group: true}, {Name: "Dev/Ops"}}, false},
+		{"./a", []NameSegment{{Name: ".", Navigation: true, Group: true}, {Name: "a"}}, false},
+		{`\./\.\./\..`, []NameSegment{{Name: ".", Group: true}, {Name: "..", Group: true}, {Name: ".."}}, false},
+		{`/..\/`, []NameSegment{{Name: "../"}}, true},
+	}
+	for _, test := range tests {
+		segments, absolute, err := SplitNamePath(test.path)
+		if err != nil {
+			t.Errorf("SplitNamePath(%q): %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(segments, test.segments) || absolute != test.absolute {
+			t.Errorf("SplitNamePath(%q) = %+v, %v, want %+v, %v", test.path, segments, absolute, test.segments, test.absolute)
+		}
+	}
+	if _, _, err := SplitNamePath(`Work\`); err == nil {
+		t.Error("SplitNamePath of an incomplete escape succeeded")
+	}
+}
+
+func TestResolveDotNames(t *testing.T) {
+	service := NewWalletServiceWithStorage(NewMemoryStorage(), "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	// /Work/.. is a group and /Work/../. an entry in it
+	work := &Group{Name: "Work"}
+	if err := service.AddGroup(Path{}, work); err != nil {
+		t.Fatal(err)
+	}
+	workPath := Path{GroupIDs: []string{work.ID}}
+	dots := &Group{Name: ".."}
+	if err := service.AddGroup(workPath, dots); err != nil {
+		t.Fatal(err)
+	}
+	dotsPath := Path{GroupIDs: []string{work.ID, dots.ID}}
+	dot := &Entry{Title: "."}
+	if err := service.AddEntry(dotsPath, dot); err != nil {
+		t.Fatal(err)
+	}
+	dotPath := Path{GroupIDs: dotsPath.GroupIDs, EntryID: dot.ID}
+
+	tests := []struct {
+		base Path
+		path string
+		want Path
+	}{
+		{Path{}, `/Work/\.\.`, dotsPath},
+		{Path{}, `/Work/\.\./\.`, dotPath},
+		{workPath, `\.\.`, dotsPath},
+		{workPath, "..", Path{GroupIDs: []string{}}},
+		{dotsPath, ".", dotsPath},
+		{dotsPath, `\.`, dotPath},
+		{dotsPath, "../..", Path{GroupIDs: []string{}}},
+	}
+	for _, test := range tests {
+		got, err := service.ResolvePath(test.base, test.path)
+		if err != nil {
+			t.Errorf("ResolvePath(%q): %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ResolvePath(%q) = %+v, want %+v", test.path, got, test.want)
+		}
+	}
+
+	formatted, err := service.FormatPath(dotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted != `/Work/\.\./\.` {
+		t.Errorf("FormatPath = %q", formatted)
+	}
+	if resolved, err := service.ResolvePath(Path{}, formatted); err != nil || !reflect.DeepEqual(resolved, dotPath) {
+		t.Errorf("ResolvePath(FormatPath) = %+v, %v", resolved, err)
+	}
+}
+
+func TestResolveEntryNamedLikeGroup(t *testing.T) {
+	service := NewWalletServiceWithStorage(NewMemoryStorage(), "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	// /Work holds both a group and an entry named Mail
+	work := &Group{Name: "Work"}
+	if err := service.AddGroup(Path{}, work); err != nil {
+		t.Fatal(err)
+	}
+	workPath := Path{GroupIDs: []string{work.ID}}
+	group := &Group{Name: "Mail"}
+	if err := service.AddGroup(workPath, group); err != nil {
+		t.Fatal(err)
+	}
+	entry := &Entry{Title: "Mail"}
+	if err := service.AddEntry(workPath, entry); err != nil {
+		t.Fatal(err)
+	}
+	groupPath := Path{GroupIDs: []string{work.ID, group.ID}}
+	entryPath := Path{GroupIDs: []string{work.ID}, EntryID: entry.ID}
+
+	tests := []struct {
+		path string
+		want Path
+	}{
+		{"/Work/Mail", entryPath},
+		{"/Work/Mail/", groupPath},
+		{"/Work/Mail/.", groupPath},
+		{"/Work", workPath},
+	}
+	for _, test := range tests {
+		got, err := service.ResolvePath(Path{}, test.path)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ResolvePath(%q) = %+v, %v, want %+v", test.path, got, err, test.want)
+		}
+	}
+	if got, err := service.ResolveGroupPath(workPath, "Mail"); err != nil || !reflect.DeepEqual(got, groupPath) {
+		t.Errorf("ResolveGroupPath(Mail) = %+v, %v, want the group", got, err)
+	}
+
+	// Both format to paths that resolve to them again
+	for _, path := range []Path{groupPath, entryPath} {
+		formatted, err := service.FormatPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved, err := service.ResolvePath(Path{}, formatted); err != nil || !reflect.DeepEqual(resolved, path) {
+			t.Errorf("ResolvePath(%q) = %+v, %v, want %+v", formatted, resolved, err, path)
+		}
+	}
+	if formatted, _ := service.FormatPath(groupPath); formatted != "/Work/Mail/" {
+		t.Errorf("FormatPath of the group = %q", formatted)
+	}
+}
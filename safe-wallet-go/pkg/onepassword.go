@@ -0,0 +1,320 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// onePasswordCategories maps 1Password item categories to templates
+var onePasswordCategories = map[string]string{
+	"001": "Password",     // Login
+	"002": "Credit Card",  // Credit Card
+	"003": "Note",         // Secure Note
+	"005": "Password",     // Password
+	"101": "Bank Account", // Bank Account
+}
+
+// onePasswordFieldNames maps the IDs of built-in 1Password fields to the
+// field names of the templates
+var onePasswordFieldNames = map[string]string{
+	"cardholder":  "Cardholder Name",
+	"ccnum":       "Card Number",
+	"cvv":         "CVV",
+	"expiry":      "Expiration Date",
+	"pin":         "PIN",
+	"bankName":    "Bank Name",
+	"owner":       "Account Holder Name",
+	"accountType": "Account Type",
+	"accountNo":   "Account Number",
+	"routingNo":   "Routing Number",
+}
+
+// onePasswordItem is an item of a 1PUX export
+type onePasswordItem struct {
+	State        string `json:"state"`
+	CategoryUUID string `json:"categoryUuid"`
+	Details      struct {
+		LoginFields []struct {
+			Value       string `json:"value"`
+			Name        string `json:"name"`
+			FieldType   string `json:"fieldType"`
+			Designation string `json:"designation"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Title  string `json:"title"`
+			Fields []struct {
+				Title string                     `json:"title"`
+				ID    string                     `json:"id"`
+				Value map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+	} `json:"details"`
+	Overview struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		URLs  []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+	} `json:"overview"`
+}
+
+// onePasswordExport is the export.data document of a 1PUX archive
+type onePasswordExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []json.RawMessage `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+// onePasswordPUXImporter imports the 1PUX export of 1Password 8
+type onePasswordPUXImporter struct{}
+
+func (onePasswordPUXImporter) Name() string {
+	return "1Password 1PUX"
+}
+
+func (onePasswordPUXImporter) NeedsPassword() bool {
+	return false
+}
+
+func (onePasswordPUXImporter) Detect(filename string, head []byte) bool {
+	return bytes.HasPrefix(head, []byte("PK\x03\x04")) && strings.HasSuffix(strings.ToLower(filename), ".1pux")
+}
+
+// Import maps every vault to a group. Archived items go to an Archive
+// group inside their vault.
+func (onePasswordPUXImporter) Import(path string, options ImportOptions) (*Group, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 1PUX export: %v", err)
+	}
+	defer archive.Close()
+
+	var export onePasswordExport
+	found := false
+	for _, file := range archive.File {
+		if file.Name != "export.data" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(reader, maxKDBXSize))
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &export); err != nil {
+			return nil, fmt.Errorf("invalid 1PUX export: %v", err)
+		}
+		found = true
+	}
+	if !found {
+		return nil, errors.New("invalid 1PUX export: export.data is missing")
+	}
+
+	var items []importItem
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, raw := range vault.Items {
+				source, err := parseOnePasswordItem(raw)
+				if err != nil {
+					return nil, err
+				}
+				folder := []string{vault.Attrs.Name}
+				if source.State == "archived" {
+					folder = append(folder, "Archive")
+				}
+				items = append(items, onePasswordImportItem(source, folder))
+			}
+		}
+	}
+	return buildImportGroup("1Password", items), nil
+}
+
+// parseOnePasswordItem decodes an item, which older exports wrap in "item"
+func parseOnePasswordItem(raw json.RawMessage) (onePasswordItem, error) {
+	var wrapped struct {
+		Item *onePasswordItem `json:"item"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err == nil && wrapped.Item != nil {
+		return *wrapped.Item, nil
+	}
+	var item onePasswordItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return item, fmt.Errorf("invalid 1PUX item: %v", err)
+	}
+	return item, nil
+}
+
+// onePasswordImportItem converts a 1PUX item
+func onePasswordImportItem(source onePasswordItem, folder []string) importItem {
+	item := importItem{
+		folder: folder,
+		kind:   onePasswordCategories[source.CategoryUUID],
+		title:  source.Overview.Title,
+	}
+
+	for _, login := range source.Details.LoginFields {
+		switch {
+		case login.Designation == "username":
+			item.field("Username", login.Value, FieldTypeGeneral)
+		case login.Designation == "password":
+			item.field("Password", login.Value, FieldTypePassword)
+		case login.FieldType == "P":
+			item.field(login.Name, login.Value, FieldTypePassword)
+		}
+	}
+	item.field("Password", source.Details.Password, FieldTypePassword)
+
+	url := source.Overview.URL
+	if url == "" && len(source.Overview.URLs) > 0 {
+		url = source.Overview.URLs[0].URL
+	}
+	item.field("URL", url, FieldTypeGeneral)
+	for i, u := range source.Overview.URLs {
+		if u.URL != url {
+			item.field(fmt.Sprintf("URL %d", i+1), u.URL, FieldTypeGeneral)
+		}
+	}
+
+	for _, section := range source.Details.Sections {
+		for _, field := range section.Fields {
+			value, fieldType := onePasswordValue(field.Value)
+			name := onePasswordFieldNames[field.ID]
+			if name == "" {
+				name = field.Title
+			}
+			if name == "" {
+				name = field.ID
+			}
+			item.field(name, value, fieldType)
+		}
+	}
+
+	if item.kind == "Note" {
+		item.field("Note", source.Details.NotesPlain, FieldTypeGeneral)
+	} else {
+		item.field("Notes", source.Details.NotesPlain, FieldTypeGeneral)
+	}
+	return item
+}
+
+// onePasswordValue returns a field value, which is an object with a single
+// key naming its type, as text
+func onePasswordValue(value map[string]json.RawMessage) (string, FieldType) {
+	for kind, raw := range value {
+		var text string
+		if json.Unmarshal(raw, &text) == nil {
+			if kind == "concealed" || kind == "totp" {
+				return text, FieldTypePassword
+			}
+			return text, FieldTypeGeneral
+		}
+
+		var number int64
+		if json.Unmarshal(raw, &number) == nil {
+			switch kind {
+			case "monthYear":
+				// e.g. 202712 for 12/2027
+				return fmt.Sprintf("%02d/%d", number%100, number/100), FieldTypeGeneral
+			case "date":
+				return time.Unix(number, 0).UTC().Format("2006-01-02"), FieldTypeGeneral
+			}
+			return fmt.Sprint(number), FieldTypeGeneral
+		}
+
+		var object map[string]interface{}
+		if json.Unmarshal(raw, &object) == nil {
+			if kind == "email" {
+				if email, ok := object["email_address"].(string); ok {
+					return email, FieldTypeGeneral
+				}
+			}
+			if kind == "address" {
+				var parts []string
+				for _, key := range []string{"street", "city", "state", "zip", "country"} {
+					if part, ok := object[key].(string); ok && part != "" {
+						parts = append(parts, part)
+					}
+				}
+				return strings.Join(parts, ", "), FieldTypeGeneral
+			}
+		}
+	}
+	return "", FieldTypeGeneral
+}
+
+// onePasswordCSVImporter imports the CSV export of 1Password
+type onePasswordCSVImporter struct{}
+
+func (onePasswordCSVImporter) Name() string {
+	return "1Password CSV"
+}
+
+func (onePasswordCSVImporter) NeedsPassword() bool {
+	return false
+}
+
+func (onePasswordCSVImporter) Detect(filename string, head []byte) bool {
+	header := csvHeader(head)
+	return header["title"] && header["password"] && !header["grouping"]
+}
+
+// Import reads the columns 1Password 7 and 8 export. Archived items go to
+// an Archive group, other columns become fields.
+func (onePasswordCSVImporter) Import(path string, options ImportOptions) (*Group, error) {
+	header, records, err := readImportCSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []importItem
+	for _, record := range records {
+		item := importItem{kind: "Password"}
+		var notes string
+		for i, column := range header {
+			if i >= len(record) {
+				break
+			}
+			value := record[i]
+			switch strings.ToLower(column) {
+			case "title":
+				item.title = value
+			case "url", "website", "urls":
+				item.field("URL", value, FieldTypeGeneral)
+			case "username":
+				item.field("Username", value, FieldTypeGeneral)
+			case "password":
+				item.field("Password", value, FieldTypePassword)
+			case "otpauth", "one-time password":
+				item.field("TOTP", value, FieldTypePassword)
+			case "notes", "notesplain":
+				notes = value
+			case "archived":
+				if strings.EqualFold(value, "true") {
+					item.folder = []string{"Archive"}
+				}
+			case "favorite", "tags", "type":
+			default:
+				item.field(column, value, FieldTypeGeneral)
+			}
+		}
+		item.field("Notes", notes, FieldTypeGeneral)
+		items = append(items, item)
+	}
+	return buildImportGroup("1Password", items), nil
+}
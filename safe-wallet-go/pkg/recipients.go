@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// newRecipientSlot wraps the data key to the public key of an age recipient.
+// Only the matching identity file can open it, no secret is shared.
+func newRecipientSlot(id string, label string, recipient string, dataKey *SecureBuffer) (KeySlot, error) {
+	if _, err := ParseRecipient(recipient); err != nil {
+		return KeySlot{}, err
+	}
+	slot := KeySlot{
+		ID:        id,
+		Type:      SlotTypeRecipient,
+		Label:     label,
+		Created:   time.Now(),
+		Recipient: strings.TrimSpace(recipient),
+	}
+	if err := slot.rewrapDataKey(dataKey.Bytes()); err != nil {
+		return KeySlot{}, err
+	}
+	return slot, nil
+}
+
+// newRecipientSlots wraps the data key to each of the recipients
+func newRecipientSlots(recipients []string, dataKey *SecureBuffer) ([]KeySlot, error) {
+	var slots []KeySlot
+	for _, recipient := range recipients {
+		slot, err := newRecipientSlot(generateUniqueID("slot"), shortRecipient(strings.TrimSpace(recipient)), recipient, dataKey)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+// openRecipientSlots returns the data key and slot ID for the first identity
+// that matches a recipient slot
+func openRecipientSlots(slots []KeySlot, identities *SecureBuffer) (*SecureBuffer, string, error) {
+	tried := false
+	for _, slot := range slots {
+		if slot.Type != SlotTypeRecipient {
+			continue
+		}
+		tried = true
+
+		public, err := ParseRecipient(slot.Recipient)
+		if err != nil {
+			continue
+		}
+		scalars := identities.Bytes()
+		for i := 0; i+curve25519.ScalarSize <= len(scalars); i += curve25519.ScalarSize {
+			scalar := scalars[i : i+curve25519.ScalarSize]
+			if own, err := curve25519.X25519(scalar, curve25519.Basepoint); err != nil || !bytes.Equal(own, public) {
+				continue
+			}
+			dataKey, err := unwrapWithIdentity(scalar, slot.Ephemeral, slot.WrappedKey)
+			if err == nil {
+				return dataKey, slot.ID, nil
+			}
+		}
+	}
+
+	if !tried {
+		return nil, "", errors.New("wallet has no recipients")
+	}
+	return nil, "", errors.New("identity is not a recipient of the wallet")
+}
+
+// shortRecipient abbreviates a recipient for lists, e.g. age1qyqs…x7k3
+func shortRecipient(recipient string) string {
+	if len(recipient) <= 16 {
+		return recipient
+	}
+	return recipient[:8] + "…" + recipient[len(recipient)-4:]
+}
@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	recoveryKeySize = 32
+	keyChecksumSize = 2
+	keyGroupSize    = 5
+	// recoveryKeyInfo separates recovery slot keys from other uses of the recovery key
+	recoveryKeyInfo = "safe-wallet recovery slot"
+)
+
+// keyEncoding writes recovery keys and shares without padding so they only
+// contain letters and the digits 2-7
+var keyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryKey generates a random recovery key and returns it with its
+// printable form
+func newRecoveryKey() (*SecureBuffer, string, error) {
+	key := NewSecureBuffer(recoveryKeySize)
+	if _, err := io.ReadFull(rand.Reader, key.Bytes()); err != nil {
+		key.Destroy()
+		return nil, "", err
+	}
+	return key, formatRecoveryKey(key.Bytes()), nil
+}
+
+// formatRecoveryKey encodes the key with a checksum in dash separated groups,
+// e.g. ABCDE-FGHIJ-...
+func formatRecoveryKey(key []byte) string {
+	return formatKeyGroups(key)
+}
+
+// parseRecoveryKey decodes a recovery key typed by the user
+func parseRecoveryKey(s string) (*SecureBuffer, error) {
+	data, err := parseKeyGroups(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recovery key: %v", err)
+	}
+	if len(data) != recoveryKeySize {
+		Wipe(data)
+		return nil, errors.New("invalid recovery key: wrong length")
+	}
+	return NewSecureBufferFrom(data), nil
+}
+
+// formatKeyGroups encodes secret data with a short checksum in base32 and
+// splits it into dash separated groups that are easy to write down
+func formatKeyGroups(data []byte) string {
+	checksum := sha256.Sum256(data)
+	withChecksum := append(append([]byte(nil), data...), checksum[:keyChecksumSize]...)
+	encoded := keyEncoding.EncodeToString(withChecksum)
+	Wipe(withChecksum)
+
+	var groups []string
+	for len(encoded) > keyGroupSize {
+		groups = append(groups, encoded[:keyGroupSize])
+		encoded = encoded[keyGroupSize:]
+	}
+	groups = append(groups, encoded)
+	return strings.Join(groups, "-")
+}
+
+// parseKeyGroups decodes data written by formatKeyGroups. Case, spaces and
+// dashes do not matter, the checksum catches most typos.
+func parseKeyGroups(s string) ([]byte, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			return -1
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, s)
+
+	data, err := keyEncoding.DecodeString(cleaned)
+	if err != nil || len(data) <= keyChecksumSize {
+		return nil, errors.New("wrong format")
+	}
+
+	size := len(data) - keyChecksumSize
+	checksum := sha256.Sum256(data[:size])
+	if !bytes.Equal(checksum[:keyChecksumSize], data[size:]) {
+		Wipe(data)
+		return nil, errors.New("checksum does not match, check for typos")
+	}
+	return data[:size], nil
+}
+
+// newRecoverySlot wraps the data key with a key derived from the recovery key
+func newRecoverySlot(id string, recoveryKey *SecureBuffer, dataKey *SecureBuffer) (KeySlot, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return KeySlot{}, err
+	}
+	slot := KeySlot{
+		ID:      id,
+		Type:    SlotTypeRecovery,
+		Label:   "Recovery key",
+		Created: time.Now(),
+		Salt:    salt,
+	}
+
+	slotKey, err := slot.deriveHKDFKey(recoveryKey.Bytes(), recoveryKeyInfo)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	defer slotKey.Destroy()
+	if err := slot.sealDataKey(slotKey.Bytes(), dataKey.Bytes()); err != nil {
+		return KeySlot{}, err
+	}
+	return slot, nil
+}
+
+// openRecoverySlots returns the data key and slot ID for the recovery key
+func openRecoverySlots(slots []KeySlot, recoveryKey *SecureBuffer) (*SecureBuffer, string, error) {
+	tried := false
+	for _, slot := range slots {
+		if slot.Type != SlotTypeRecovery {
+			continue
+		}
+		tried = true
+
+		slotKey, err := slot.deriveHKDFKey(recoveryKey.Bytes(), recoveryKeyInfo)
+		if err != nil {
+			return nil, "", err
+		}
+		dataKey, err := slot.openDataKey(slotKey.Bytes())
+		slotKey.Destroy()
+		if err == nil {
+			return dataKey, slot.ID, nil
+		}
+	}
+
+	if !tried {
+		return nil, "", errors.New("wallet has no recovery key")
+	}
+	return nil, "", errors.New("invalid recovery key")
+}
+
+// recoverySheetTemplate is the printable recovery sheet
+const recoverySheetTemplate = `SAFE WALLET RECOVERY KIT
+========================
+
+Wallet file:  {{.WalletFile}}
+Created:      {{.Created.Format "2006-01-02 15:04"}}
+
+Recovery key:
+
+    {{.RecoveryKey}}
+
+This key unlocks the wallet if the master password or keyfile is lost.
+Anyone who has it and the wallet file can read every entry.
+
+To use it:
+  CLI: start the wallet with -recover and enter the key when asked
+  GUI: choose "Use Recovery Key" on the unlock screen
+Then add a new password slot and generate a new recovery kit.
+
+Generating a new recovery kit revokes this key.
+
+Print this sheet or write the key down, and keep it somewhere safe and
+offline, away from the wallet file. Do not store it on this computer.
+`
+
+var recoverySheet = template.Must(template.New("recovery").Parse(recoverySheetTemplate))
+
+// RecoverySheet renders the printable recovery sheet for a recovery key
+func RecoverySheet(walletFile string, recoveryKey string, created time.Time) string {
+	var sheet strings.Builder
+	// Executing the fixed template only fails on write errors, which a
+	// strings.Builder does not return
+	recoverySheet.Execute(&sheet, struct {
+		WalletFile  string
+		RecoveryKey string
+		Created     time.Time
+	}{walletFile, recoveryKey, created})
+	return sheet.String()
+}
@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecoveryKeyFormat(t *testing.T) {
+	key, formatted, err := newRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Destroy()
+
+	for _, group := range strings.Split(formatted, "-") {
+		if len(group) == 0 || len(group) > keyGroupSize {
+			t.Fatalf("recovery key %s has a group of %d characters", formatted, len(group))
+		}
+	}
+
+	// Case, spaces and dashes do not matter
+	typed := strings.ToLower(strings.ReplaceAll(formatted, "-", " "))
+	parsed, err := parseRecoveryKey(typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parsed.Destroy()
+	if !bytes.Equal(parsed.Bytes(), key.Bytes()) {
+		t.Error("parsed recovery key differs from the generated one")
+	}
+}
+
+func TestRecoveryKeyTypos(t *testing.T) {
+	key, formatted, err := newRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Destroy()
+
+	// Change one character of the first group
+	typo := []byte(formatted)
+	if typo[0] == 'A' {
+		typo[0] = 'B'
+	} else {
+		typo[0] = 'A'
+	}
+	if _, err := parseRecoveryKey(string(typo)); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("a typo was not caught by the checksum: %v", err)
+	}
+
+	short := formatKeyGroups(make([]byte, recoveryKeySize-1))
+	for _, invalid := range []string{"", "not a key!", short} {
+		if _, err := parseRecoveryKey(invalid); err == nil {
+			t.Errorf("parseRecoveryKey(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestUnlockWithRecoveryKey(t *testing.T) {
+	storage := NewMemoryStorage()
+	service := NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	recoveryKey := service.TakeRecoveryKey()
+	if recoveryKey == "" || service.TakeRecoveryKey() != "" {
+		t.Fatal("TakeRecoveryKey does not return the recovery key exactly once")
+	}
+	if !service.HasRecoveryKey() {
+		t.Error("HasRecoveryKey = false for a new wallet")
+	}
+	service.Close()
+
+	recovered := NewWalletServiceWithStorage(storage, "wallet.dat", "")
+	defer recovered.Close()
+	_, other, err := newRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recovered.UnlockWithRecoveryKey(other); err == nil {
+		t.Error("another recovery key unlocked the wallet")
+	}
+	if err := recovered.UnlockWithRecoveryKey(recoveryKey); err != nil {
+		t.Fatalf("the recovery key did not unlock the wallet: %v", err)
+	}
+
+	// A new password can be added once the password is lost
+	if _, err := recovered.AddPasswordSlot("New password", "new password", ""); err != nil {
+		t.Fatal(err)
+	}
+	reopened := NewWalletServiceWithStorage(storage, "wallet.dat", "new password")
+	defer reopened.Close()
+	if err := reopened.Load(); err != nil {
+		t.Errorf("the added password does not unlock the wallet: %v", err)
+	}
+}
+
+func TestRecoverySheet(t *testing.T) {
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	sheet := RecoverySheet("wallet.dat", "ABCDE-FGHIJ", created)
+	for _, want := range []string{"wallet.dat", "ABCDE-FGHIJ", "2024-03-01 09:30", "-recover"} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("recovery sheet lacks %q:\n%s", want, sheet)
+		}
+	}
+}
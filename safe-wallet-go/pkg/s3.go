@@ -0,0 +1,637 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Config describes a bucket of Amazon S3 or a compatible store such as
+// MinIO. Buckets are addressed in path style, which all of them support.
+type S3Config struct {
+	// Endpoint is the URL of the service, e.g. http://localhost:9000
+	Endpoint string
+	// Region signs the requests, us-east-1 if empty
+	Region string
+	Bucket string
+	// Prefix is put in front of the names of all objects, e.g. "team/"
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// Client sends the requests, a client that gives up on a request
+	// after 30 seconds if nil
+	Client *http.Client
+}
+
+// S3Storage stores wallets in an S3-compatible bucket. Objects are only
+// overwritten if their ETag did not change since they were read, so saves
+// from different computers cannot overwrite each other. With versioning
+// enabled on the bucket, earlier versions of the wallet are kept as backups.
+// Directories are objects named with a trailing slash.
+type S3Storage struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+
+	mu    sync.Mutex
+	etags map[string]string
+	locks map[string]bool
+	// now returns the time requests are signed with
+	now func() time.Time
+}
+
+// NewS3Storage returns the storage for the bucket
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	endpoint, err := url.Parse(strings.TrimSpace(config.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %v", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, errors.New("the S3 endpoint must start with https:// or http://")
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("no S3 bucket given")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Prefix = strings.Trim(config.Prefix, "/"); config.Prefix != "" {
+		config.Prefix += "/"
+	}
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &S3Storage{
+		config:   config,
+		endpoint: endpoint,
+		client:   client,
+		etags:    make(map[string]string),
+		locks:    make(map[string]bool),
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3Storage) ReadFile(name string) ([]byte, error) {
+	response, err := s.do(http.MethodGet, s.key(name), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if err := s3Status(response, name, http.StatusOK); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.setETag(name, response.Header.Get("ETag"))
+	return data, nil
+}
+
+// WriteFile uploads the object unless it changed since it was read, or was
+// created meanwhile if it has not been read
+func (s *S3Storage) WriteFile(name string, data []byte) error {
+	header := http.Header{}
+	if etag := s.etag(name); etag != "" {
+		header.Set("If-Match", etag)
+	} else {
+		header.Set("If-None-Match", "*")
+	}
+	response, err := s.do(http.MethodPut, s.key(name), nil, header, data)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if err := s3Status(response, name, http.StatusOK); err != nil {
+		return err
+	}
+	s.setETag(name, response.Header.Get("ETag"))
+	return nil
+}
+
+func (s *S3Storage) Stat(name string) (StorageInfo, error) {
+	response, err := s.do(http.MethodHead, s.key(name), nil, nil, nil)
+	if err != nil {
+		return StorageInfo{}, err
+	}
+	response.Body.Close()
+	if response.StatusCode == http.StatusOK {
+		modified, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+		return StorageInfo{Size: response.ContentLength, ModTime: modified}, nil
+	}
+	if err := s3Status(response, name, http.StatusOK); !os.IsNotExist(err) {
+		return StorageInfo{}, err
+	}
+
+	// A directory is anything with objects below it
+	list, err := s.listPage(s.dirKey(name), "", 1, "")
+	if err != nil {
+		return StorageInfo{}, err
+	}
+	if len(list.Contents) == 0 && len(list.CommonPrefixes) == 0 {
+		return StorageInfo{}, notExist("stat", name)
+	}
+	return StorageInfo{IsDir: true}, nil
+}
+
+func (s *S3Storage) ReadDir(name string) ([]string, error) {
+	prefix := s.dirKey(name)
+	var names []string
+	token := ""
+	for {
+		list, err := s.listPage(prefix, "/", 1000, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range list.Contents {
+			if object.Key != prefix {
+				names = append(names, strings.TrimPrefix(object.Key, prefix))
+			}
+		}
+		for _, common := range list.CommonPrefixes {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(common.Prefix, prefix), "/"))
+		}
+		if !list.IsTruncated {
+			break
+		}
+		token = list.NextContinuationToken
+	}
+	if len(names) == 0 {
+		if _, err := s.Stat(name); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Mkdir creates an empty directory object, so the directory exists before
+// anything is written to it
+func (s *S3Storage) Mkdir(name string) error {
+	if info, err := s.Stat(name); err == nil {
+		if !info.IsDir {
+			return fmt.Errorf("mkdir %s: not a directory", name)
+		}
+		return nil
+	}
+	response, err := s.do(http.MethodPut, s.dirKey(name), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return s3Status(response, name, http.StatusOK)
+}
+
+// Remove deletes the object, or the marker of an empty directory
+func (s *S3Storage) Remove(name string) error {
+	key := s.key(name)
+	if info, err := s.Stat(name); err != nil {
+		return err
+	} else if info.IsDir {
+		names, err := s.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			return fmt.Errorf("remove %s: directory not empty", name)
+		}
+		key = s.dirKey(name)
+	}
+	response, err := s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if err := s3Status(response, name, http.StatusNoContent, http.StatusOK); err != nil {
+		return err
+	}
+	s.setETag(name, "")
+	return nil
+}
+
+// Rename copies the objects to the new name and deletes the old ones, S3
+// has no rename
+func (s *S3Storage) Rename(oldName string, newName string) error {
+	oldKey, newKey := s.key(oldName), s.key(newName)
+	info, err := s.Stat(oldName)
+	if err != nil {
+		return err
+	}
+	keys := []string{oldKey}
+	if info.IsDir {
+		keys = nil
+		token := ""
+		for {
+			list, err := s.listPage(oldKey+"/", "", 1000, token)
+			if err != nil {
+				return err
+			}
+			for _, object := range list.Contents {
+				keys = append(keys, object.Key)
+			}
+			if !list.IsTruncated {
+				break
+			}
+			token = list.NextContinuationToken
+		}
+	}
+
+	for _, key := range keys {
+		target := newKey + key[len(oldKey):]
+		if err := s.copyObject(key, target); err != nil {
+			return err
+		}
+		response, err := s.do(http.MethodDelete, key, nil, nil, nil)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		if err := s3Status(response, key, http.StatusNoContent, http.StatusOK); err != nil {
+			return err
+		}
+	}
+
+	// A copy keeps the ETag of the content
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldPrefix := filepath.Clean(oldName) + string(filepath.Separator)
+	moved := make(map[string]string)
+	for name, etag := range s.etags {
+		switch {
+		case name == filepath.Clean(oldName):
+			moved[filepath.Clean(newName)] = etag
+		case strings.HasPrefix(name, oldPrefix):
+			moved[filepath.Join(newName, name[len(oldPrefix):])] = etag
+		default:
+			continue
+		}
+		delete(s.etags, name)
+	}
+	for name, etag := range moved {
+		s.etags[name] = etag
+	}
+	return nil
+}
+
+func (s *S3Storage) Lock(name string) (func() error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name = filepath.Clean(name)
+	if s.locks[name] {
+		return nil, fmt.Errorf("wallet %s is already being written", name)
+	}
+	s.locks[name] = true
+	return func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.locks, name)
+		return nil
+	}, nil
+}
+
+// EnableVersioning turns on versioning for the bucket, so every save keeps
+// the previous version of the wallet as a backup
+func (s *S3Storage) EnableVersioning() error {
+	body := []byte(`<VersioningConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Status>Enabled</Status></VersioningConfiguration>`)
+	response, err := s.do(http.MethodPut, "", url.Values{"versioning": {""}}, nil, body)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return s3Status(response, s.config.Bucket, http.StatusOK)
+}
+
+// Versions lists the versions of the object, newest first
+func (s *S3Storage) Versions(name string) ([]FileVersion, error) {
+	key := s.key(name)
+	var versions []FileVersion
+	keyMarker, versionIDMarker := "", ""
+	for {
+		page, err := s.versionsPage(key, keyMarker, versionIDMarker)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range page.Versions {
+			// The prefix also matches longer keys, e.g. wallet.dat.tokens
+			if version.Key != key {
+				continue
+			}
+			modified, _ := time.Parse(time.RFC3339, version.LastModified)
+			versions = append(versions, FileVersion{
+				ID:      version.VersionID,
+				ModTime: modified,
+				Size:    version.Size,
+				Latest:  version.IsLatest,
+			})
+		}
+		if !page.IsTruncated {
+			break
+		}
+		if page.NextKeyMarker == keyMarker && page.NextVersionIDMarker == versionIDMarker {
+			return nil, fmt.Errorf("S3 listed the versions of %s without advancing", name)
+		}
+		keyMarker, versionIDMarker = page.NextKeyMarker, page.NextVersionIDMarker
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].ModTime.After(versions[j].ModTime)
+	})
+	return versions, nil
+}
+
+// s3VersionsResult is a page of ListObjectVersions
+type s3VersionsResult struct {
+	Versions []struct {
+		Key          string `xml:"Key"`
+		VersionID    string `xml:"VersionId"`
+		IsLatest     bool   `xml:"IsLatest"`
+		LastModified string `xml:"LastModified"`
+		Size         int64  `xml:"Size"`
+	} `xml:"Version"`
+	IsTruncated         bool   `xml:"IsTruncated"`
+	NextKeyMarker       string `xml:"NextKeyMarker"`
+	NextVersionIDMarker string `xml:"NextVersionIdMarker"`
+}
+
+func (s *S3Storage) versionsPage(prefix string, keyMarker string, versionIDMarker string) (*s3VersionsResult, error) {
+	query := url.Values{"versions": {""}, "prefix": {prefix}}
+	if keyMarker != "" {
+		query.Set("key-marker", keyMarker)
+	}
+	if versionIDMarker != "" {
+		query.Set("version-id-marker", versionIDMarker)
+	}
+	response, err := s.do(http.MethodGet, "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if err := s3Status(response, prefix, http.StatusOK); err != nil {
+		return nil, err
+	}
+	var result s3VersionsResult
+	if err := xml.NewDecoder(io.LimitReader(response.Body, 16<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid S3 response: %v", err)
+	}
+	return &result, nil
+}
+
+// ReadVersion returns the content of a version of the object
+func (s *S3Storage) ReadVersion(name string, id string) ([]byte, error) {
+	response, err := s.do(http.MethodGet, s.key(name), url.Values{"versionId": {id}}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if err := s3Status(response, name, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(response.Body)
+}
+
+// copyObject copies the object to the target key
+func (s *S3Storage) copyObject(key string, target string) error {
+	source := "/" + s.config.Bucket + "/" + s3Escape(key, false)
+	header := http.Header{}
+	header.Set("X-Amz-Copy-Source", source)
+	response, err := s.do(http.MethodPut, target, nil, header, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err := s3Status(response, key, http.StatusOK); err != nil {
+		return err
+	}
+	// A copy can fail after the status has been sent
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&result) == nil && result.XMLName.Local == "Error" {
+		return fmt.Errorf("S3 copy of %s: %s", key, result.Message)
+	}
+	return nil
+}
+
+// s3ListResult is a page of ListObjectsV2
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Storage) listPage(prefix string, delimiter string, maxKeys int, token string) (*s3ListResult, error) {
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+		"max-keys":  {fmt.Sprint(maxKeys)},
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	response, err := s.do(http.MethodGet, "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if err := s3Status(response, prefix, http.StatusOK); err != nil {
+		return nil, err
+	}
+	var result s3ListResult
+	if err := xml.NewDecoder(io.LimitReader(response.Body, 16<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid S3 response: %v", err)
+	}
+	return &result, nil
+}
+
+// key returns the object key of the name
+func (s *S3Storage) key(name string) string {
+	return s.config.Prefix + strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+}
+
+// dirKey returns the prefix of the objects in the directory
+func (s *S3Storage) dirKey(name string) string {
+	key := s.key(name)
+	if key == "." || key == s.config.Prefix+"." {
+		return s.config.Prefix
+	}
+	return key + "/"
+}
+
+// do sends a signed request for the object key, or for the bucket if key
+// is empty
+func (s *S3Storage) do(method string, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = path.Join("/", s.endpoint.Path, s.config.Bucket)
+	u.RawPath = s3Escape(u.Path, false)
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath += "/" + s3Escape(key, false)
+	}
+	u.RawQuery = s3CanonicalQuery(query)
+
+	request, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	s.sign(request, body)
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach the S3 service: %v", err)
+	}
+	return response, nil
+}
+
+// sign adds an AWS Signature Version 4 to the request
+func (s *S3Storage) sign(request *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := s3HMAC([]byte("AWS4"+s.config.SecretKey), date)
+	key = s3HMAC(key, s.config.Region)
+	key = s3HMAC(key, "s3")
+	key = s3HMAC(key, "aws4_request")
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, signature))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but the unreserved characters and,
+// unless escapeSlash is set, the slashes
+func s3Escape(s string, escapeSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !escapeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// s3CanonicalQuery encodes the query sorted by name, as it is signed
+func s3CanonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Status returns an error unless the response has one of the codes. A
+// missing object gives an error that satisfies os.IsNotExist and a failed
+// condition ErrRemoteChanged.
+func s3Status(response *http.Response, name string, codes ...int) error {
+	for _, code := range codes {
+		if response.StatusCode == code {
+			return nil
+		}
+	}
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return notExist(response.Request.Method, name)
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return ErrRemoteChanged
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("S3 service refused access to %s, check the access key and bucket", name)
+	}
+
+	var result struct {
+		Message string `xml:"Message"`
+	}
+	if xml.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&result) == nil && result.Message != "" {
+		return fmt.Errorf("S3 %s %s: %s", response.Request.Method, name, result.Message)
+	}
+	return fmt.Errorf("S3 %s %s: %s", response.Request.Method, name, response.Status)
+}
+
+func (s *S3Storage) etag(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.etags[filepath.Clean(name)]
+}
+
+func (s *S3Storage) setETag(name string, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if etag == "" {
+		delete(s.etags, filepath.Clean(name))
+	} else {
+		s.etags[filepath.Clean(name)] = etag
+	}
+}
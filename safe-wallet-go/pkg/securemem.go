@@ -0,0 +1,62 @@
+package pkg
+
+// SecureBuffer holds secret bytes such as the master key. Where the platform
+// supports it the memory is allocated outside the Go heap and locked so it is
+// never written to swap. Destroy wipes the contents.
+type SecureBuffer struct {
+	data   []byte
+	mapped bool
+}
+
+// NewSecureBuffer allocates a zeroed buffer of the given size
+func NewSecureBuffer(size int) *SecureBuffer {
+	if size <= 0 {
+		return &SecureBuffer{data: []byte{}}
+	}
+	if data, ok := allocLocked(size); ok {
+		return &SecureBuffer{data: data, mapped: true}
+	}
+	return &SecureBuffer{data: make([]byte, size)}
+}
+
+// NewSecureBufferFrom copies src into a new secure buffer and wipes src
+func NewSecureBufferFrom(src []byte) *SecureBuffer {
+	b := NewSecureBuffer(len(src))
+	copy(b.data, src)
+	Wipe(src)
+	return b
+}
+
+// Bytes returns the secret. The slice must not be retained after Destroy.
+func (b *SecureBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+// Len returns the size of the secret, 0 after Destroy
+func (b *SecureBuffer) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.data)
+}
+
+// Destroy wipes the secret and releases the locked memory
+func (b *SecureBuffer) Destroy() {
+	if b == nil || b.data == nil {
+		return
+	}
+	Wipe(b.data)
+	if b.mapped {
+		freeLocked(b.data)
+	}
+	b.data = nil
+	b.mapped = false
+}
+
+// Wipe overwrites b with zeros
+func Wipe(b []byte) {
+	clear(b)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package pkg
+
+// allocLocked is not supported on this platform, secrets live on the Go heap
+// and are only wiped on Destroy
+func allocLocked(size int) ([]byte, bool) {
+	return nil, false
+}
+
+func freeLocked(data []byte) {}
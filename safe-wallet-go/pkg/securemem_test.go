@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSecureBufferFromWipesSource(t *testing.T) {
+	src := []byte("master key")
+	b := NewSecureBufferFrom(src)
+	defer b.Destroy()
+	if !bytes.Equal(b.Bytes(), []byte("master key")) {
+		t.Errorf("Bytes = %q, want the copied secret", b.Bytes())
+	}
+	if !bytes.Equal(src, make([]byte, len(src))) {
+		t.Errorf("source was not wiped: %q", src)
+	}
+}
+
+func TestSecureBufferDestroy(t *testing.T) {
+	data := []byte("secret")
+	b := &SecureBuffer{data: data}
+	b.Destroy()
+	if !bytes.Equal(data, make([]byte, len(data))) {
+		t.Errorf("Destroy did not wipe the secret: %q", data)
+	}
+	if b.Len() != 0 || b.Bytes() != nil {
+		t.Errorf("destroyed buffer still holds %d bytes", b.Len())
+	}
+	b.Destroy()
+
+	var missing *SecureBuffer
+	missing.Destroy()
+	if missing.Len() != 0 || missing.Bytes() != nil {
+		t.Error("nil buffer is not empty")
+	}
+}
+
+func TestCloseWipesSecrets(t *testing.T) {
+	service := NewWalletServiceWithStorage(NewMemoryStorage(), "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddGroup(Path{}, &Group{Name: "Work"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The buffers are replaced by ones on the Go heap to look at them after
+	// Destroy, locked memory is unmapped then
+	key := append([]byte(nil), service.key.Bytes()...)
+	fieldKey := append([]byte(nil), service.fieldKey.Bytes()...)
+	service.key.Destroy()
+	service.fieldKey.Destroy()
+	service.key = &SecureBuffer{data: key}
+	service.fieldKey = &SecureBuffer{data: fieldKey}
+
+	service.Close()
+	if !service.IsLocked() || service.GetWallet() != nil {
+		t.Error("the wallet is still open after Close")
+	}
+	if service.key != nil || service.fieldKey != nil || service.secret != nil || service.TakeRecoveryKey() != "" {
+		t.Error("secrets are still referenced after Close")
+	}
+	for name, secret := range map[string][]byte{"data key": key, "field key": fieldKey} {
+		if !bytes.Equal(secret, make([]byte, len(secret))) {
+			t.Errorf("%s was not wiped", name)
+		}
+	}
+}
+
+func TestDecryptWalletWipesPlaintext(t *testing.T) {
+	plaintext := []byte(`{"version":1,"groups":[{"id":"grp-1","name":"Work"}]}`)
+	wallet, err := decryptWallet(nil, func([]byte) ([]byte, error) { return plaintext, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wallet.Groups) != 1 || wallet.Groups[0].Name != "Work" {
+		t.Fatalf("decrypted wallet = %+v", wallet)
+	}
+	if !bytes.Equal(plaintext, make([]byte, len(plaintext))) {
+		t.Error("the decrypted JSON was not wiped")
+	}
+}
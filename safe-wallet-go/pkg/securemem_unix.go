@@ -0,0 +1,23 @@
+//go:build unix
+
+package pkg
+
+import "golang.org/x/sys/unix"
+
+// allocLocked maps anonymous memory for a secret and locks it into RAM.
+// Locking may fail because of RLIMIT_MEMLOCK, in which case the mapping is
+// still used so the secret stays off the garbage collected heap.
+func allocLocked(size int) ([]byte, bool) {
+	data, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, false
+	}
+	_ = unix.Mlock(data)
+	return data, true
+}
+
+// freeLocked unlocks and unmaps memory returned by allocLocked
+func freeLocked(data []byte) {
+	_ = unix.Munlock(data)
+	_ = unix.Munmap(data)
+}
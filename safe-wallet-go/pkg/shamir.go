@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// Shamir's secret sharing over GF(256). Every byte of the secret is the
+// constant term of its own random polynomial of degree k-1; a share holds
+// the x coordinate followed by the polynomials evaluated at x.
+
+// maxShares is the number of distinct non-zero x coordinates in GF(256)
+const maxShares = 255
+
+// SplitSecret splits the secret into n shares so that any k of them recover
+// it and fewer reveal nothing about it. Each share is the x coordinate
+// followed by one byte per secret byte.
+func SplitSecret(secret []byte, n int, k int) ([][]byte, error) {
+	if k < 2 {
+		return nil, errors.New("threshold must be at least 2")
+	}
+	if n < k {
+		return nil, errors.New("number of shares must be at least the threshold")
+	}
+	if n > maxShares {
+		return nil, errors.New("at most 255 shares are supported")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("secret cannot be empty")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, k)
+	defer Wipe(coefficients)
+	for b, value := range secret {
+		coefficients[0] = value
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			share[b+1] = evaluatePolynomial(coefficients, share[0])
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares recovers the secret from shares made by SplitSecret by
+// interpolating at x = 0. With fewer shares than the threshold the result is
+// a wrong secret, not an error.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least 2 shares are needed")
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, errors.New("invalid share")
+	}
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if len(share) != size {
+			return nil, errors.New("shares have different lengths")
+		}
+		if share[0] == 0 || seen[share[0]] {
+			return nil, errors.New("duplicate or invalid share")
+		}
+		seen[share[0]] = true
+	}
+
+	secret := make([]byte, size-1)
+	for i, share := range shares {
+		// Lagrange basis polynomial for this share evaluated at 0
+		basis := byte(1)
+		for j, other := range shares {
+			if i == j {
+				continue
+			}
+			basis = gfMul(basis, gfDiv(other[0], other[0]^share[0]))
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(share[b+1], basis)
+		}
+	}
+	return secret, nil
+}
+
+// evaluatePolynomial evaluates the polynomial with the given coefficients,
+// lowest degree first, at x using Horner's method
+func evaluatePolynomial(coefficients []byte, x byte) byte {
+	result := byte(0)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// gfMul multiplies in GF(256) with the AES polynomial x^8+x^4+x^3+x+1. It
+// avoids lookup tables and branches on secret data.
+func gfMul(a byte, b byte) byte {
+	var product byte
+	for i := 0; i < 8; i++ {
+		product ^= -(b & 1) & a
+		carry := -(a >> 7)
+		a = (a << 1) ^ (carry & 0x1b)
+		b >>= 1
+	}
+	return product
+}
+
+// gfInverse returns the multiplicative inverse, a^254 in GF(256)
+func gfInverse(a byte) byte {
+	result := byte(1)
+	power := a
+	for exponent := 254; exponent > 0; exponent >>= 1 {
+		if exponent&1 == 1 {
+			result = gfMul(result, power)
+		}
+		power = gfMul(power, power)
+	}
+	return result
+}
+
+// gfDiv divides a by a non-zero b in GF(256)
+func gfDiv(a byte, b byte) byte {
+	return gfMul(a, gfInverse(b))
+}
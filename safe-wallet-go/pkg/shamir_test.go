@@ -0,0 +1,216 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// gfMulReference multiplies in GF(256) the textbook way, with branches
+func gfMulReference(a byte, b byte) byte {
+	product := 0
+	x, y := int(a), int(b)
+	for y > 0 {
+		if y&1 == 1 {
+			product ^= x
+		}
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11b
+		}
+		y >>= 1
+	}
+	return byte(product)
+}
+
+func TestGF256(t *testing.T) {
+	// FIPS-197 section 4.2
+	if got := gfMul(0x57, 0x83); got != 0xc1 {
+		t.Errorf("gfMul(0x57, 0x83) = %#x, want 0xc1", got)
+	}
+	if got := gfMul(0x57, 0x13); got != 0xfe {
+		t.Errorf("gfMul(0x57, 0x13) = %#x, want 0xfe", got)
+	}
+	// FIPS-197 section 5.1.1
+	if got := gfInverse(0x53); got != 0xca {
+		t.Errorf("gfInverse(0x53) = %#x, want 0xca", got)
+	}
+
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			if got, want := gfMul(byte(a), byte(b)), gfMulReference(byte(a), byte(b)); got != want {
+				t.Fatalf("gfMul(%#x, %#x) = %#x, want %#x", a, b, got, want)
+			}
+		}
+		if a != 0 {
+			if got := gfMul(byte(a), gfInverse(byte(a))); got != 1 {
+				t.Fatalf("%#x times its inverse = %#x", a, got)
+			}
+			if got := gfDiv(byte(a), byte(a)); got != 1 {
+				t.Fatalf("gfDiv(%#x, %#x) = %#x", a, a, got)
+			}
+		}
+	}
+}
+
+// shamirVectorShares split "Secret" with threshold 3, using the polynomials
+// with the coefficients 01 02 03 04 05 06 for x and a0 b1 c2 d3 e4 f5 for
+// x^2, computed independently of this package
+var shamirVectorShares = []string{
+	"01f2d6a2a58487",
+	"02e793401bd281",
+	"03462081cc3372",
+	"04b988fbfdb3a5",
+	"05183b3a2a5256",
+}
+
+func decodeShares(t *testing.T, encoded ...string) [][]byte {
+	t.Helper()
+	shares := make([][]byte, len(encoded))
+	for i, s := range encoded {
+		share, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shares[i] = share
+	}
+	return shares
+}
+
+func TestCombineSharesKnownAnswer(t *testing.T) {
+	v := shamirVectorShares
+	for _, subset := range [][]string{
+		{v[0], v[1], v[2]},
+		{v[4], v[2], v[0]},
+		{v[1], v[3], v[4]},
+		{v[0], v[1], v[2], v[3], v[4]},
+	} {
+		secret, err := CombineShares(decodeShares(t, subset...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(secret) != "Secret" {
+			t.Errorf("CombineShares(%v) = %q, want %q", subset, secret, "Secret")
+		}
+	}
+
+	// Below the threshold the result is a wrong secret
+	secret, err := CombineShares(decodeShares(t, v[0], v[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) == "Secret" {
+		t.Error("2 of 3 shares recovered the secret")
+	}
+}
+
+func TestSplitSecret(t *testing.T) {
+	secret := []byte("correct horse battery staple, 32")
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("SplitSecret returned %d shares, want 5", len(shares))
+	}
+	for i, share := range shares {
+		if len(share) != len(secret)+1 || share[0] != byte(i+1) {
+			t.Fatalf("share %d = %x", i, share)
+		}
+	}
+
+	// Every set of 3 shares recovers the secret, no set of 2 does
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			combined, err := CombineShares([][]byte{shares[a], shares[b]})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(combined, secret) {
+				t.Errorf("shares %d and %d recovered the secret below the threshold", a, b)
+			}
+			for c := b + 1; c < 5; c++ {
+				combined, err := CombineShares([][]byte{shares[c], shares[a], shares[b]})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(combined, secret) {
+					t.Errorf("shares %d, %d and %d = %q", a, b, c, combined)
+				}
+			}
+		}
+	}
+
+	// The secret bytes are split with independent random polynomials
+	again, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again[0], shares[0]) {
+		t.Error("two splits of the same secret gave the same shares")
+	}
+}
+
+func TestSplitSecretErrors(t *testing.T) {
+	for _, test := range []struct {
+		secret []byte
+		n, k   int
+	}{
+		{[]byte("secret"), 3, 1},
+		{[]byte("secret"), 2, 3},
+		{[]byte("secret"), 256, 2},
+		{nil, 3, 2},
+	} {
+		if _, err := SplitSecret(test.secret, test.n, test.k); err == nil {
+			t.Errorf("SplitSecret(%q, %d, %d) succeeded", test.secret, test.n, test.k)
+		}
+	}
+	if _, err := SplitSecret([]byte("secret"), 255, 255); err != nil {
+		t.Errorf("SplitSecret with 255 shares: %v", err)
+	}
+}
+
+func TestCombineSharesErrors(t *testing.T) {
+	v := shamirVectorShares
+	for name, shares := range map[string][][]byte{
+		"one share":         decodeShares(t, v[0]),
+		"duplicate x":       decodeShares(t, v[0], v[0], v[1]),
+		"zero x":            decodeShares(t, "00f2d6a2a58487", v[1], v[2]),
+		"different lengths": decodeShares(t, v[0], v[1], v[2][:8]),
+		"empty share":       {{}, {}},
+	} {
+		if _, err := CombineShares(shares); err == nil {
+			t.Errorf("CombineShares with %s succeeded", name)
+		}
+	}
+}
+
+func TestShamirSlot(t *testing.T) {
+	service := NewWalletServiceWithStorage(NewMemoryStorage(), "wallet.dat", "password")
+	defer service.Close()
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	shares, err := service.AddShamirSlot("family", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if threshold, err := ShareThreshold(shares[0]); err != nil || threshold != 2 {
+		t.Errorf("ShareThreshold = %d, %v", threshold, err)
+	}
+	other, err := service.AddShamirSlot("friends", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service.Lock()
+	if err := service.UnlockWithShares(shares[:1]); err == nil {
+		t.Error("unlocked with fewer shares than the threshold")
+	}
+	if err := service.UnlockWithShares([]string{shares[0], other[1]}); err == nil {
+		t.Error("unlocked with shares of different splits")
+	}
+	if err := service.UnlockWithShares([]string{shares[2], shares[0]}); err != nil {
+		t.Fatalf("UnlockWithShares: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	shareFormatVersion = 1
+	shareSecretSize    = 32
+	// shareTagSize bytes of the slot ID hash tell shares of different splits apart
+	shareTagSize = 3
+	// shareHeaderSize is the version, threshold and tag in front of the share
+	shareHeaderSize = 2 + shareTagSize
+	// shamirKeyInfo separates Shamir slot keys from other uses of the secret
+	shamirKeyInfo = "safe-wallet shamir slot"
+)
+
+// keyShare is a decoded share of a Shamir slot secret
+type keyShare struct {
+	threshold int
+	tag       []byte
+	// share is the x coordinate followed by the share bytes
+	share []byte
+}
+
+// newShamirSlot wraps the data key with a key derived from a random secret
+// that is split into n shares, any k of which unlock the slot. The shares are
+// returned in printable form.
+func newShamirSlot(id string, label string, n int, k int, dataKey *SecureBuffer) (KeySlot, []string, error) {
+	secret := NewSecureBuffer(shareSecretSize)
+	defer secret.Destroy()
+	if _, err := io.ReadFull(rand.Reader, secret.Bytes()); err != nil {
+		return KeySlot{}, nil, err
+	}
+	rawShares, err := SplitSecret(secret.Bytes(), n, k)
+	if err != nil {
+		return KeySlot{}, nil, err
+	}
+
+	salt, err := newSalt()
+	if err != nil {
+		return KeySlot{}, nil, err
+	}
+	slot := KeySlot{
+		ID:        id,
+		Type:      SlotTypeShamir,
+		Label:     label,
+		Created:   time.Now(),
+		Salt:      salt,
+		Threshold: k,
+		Shares:    n,
+	}
+
+	slotKey, err := slot.deriveHKDFKey(secret.Bytes(), shamirKeyInfo)
+	if err != nil {
+		return KeySlot{}, nil, err
+	}
+	defer slotKey.Destroy()
+	if err := slot.sealDataKey(slotKey.Bytes(), dataKey.Bytes()); err != nil {
+		return KeySlot{}, nil, err
+	}
+
+	tag := shareTag(slot.ID)
+	shares := make([]string, len(rawShares))
+	for i, raw := range rawShares {
+		encoded := append([]byte{shareFormatVersion, byte(k)}, tag...)
+		encoded = append(encoded, raw...)
+		shares[i] = formatKeyGroups(encoded)
+		Wipe(encoded)
+		Wipe(raw)
+	}
+	return slot, shares, nil
+}
+
+// shareTag identifies the shares of one slot
+func shareTag(slotID string) []byte {
+	hash := sha256.Sum256([]byte(slotID))
+	return hash[:shareTagSize]
+}
+
+// parseKeyShare decodes a share typed by the user
+func parseKeyShare(s string) (keyShare, error) {
+	data, err := parseKeyGroups(s)
+	if err != nil {
+		return keyShare{}, fmt.Errorf("invalid share: %v", err)
+	}
+	if len(data) != shareHeaderSize+1+shareSecretSize || data[0] != shareFormatVersion {
+		Wipe(data)
+		return keyShare{}, errors.New("invalid share: wrong format")
+	}
+	return keyShare{
+		threshold: int(data[1]),
+		tag:       data[2:shareHeaderSize],
+		share:     data[shareHeaderSize:],
+	}, nil
+}
+
+// ShareThreshold returns how many shares are needed together with this one
+func ShareThreshold(share string) (int, error) {
+	parsed, err := parseKeyShare(share)
+	if err != nil {
+		return 0, err
+	}
+	Wipe(parsed.share)
+	return parsed.threshold, nil
+}
+
+// combineKeyShares recovers the slot secret from printable shares
+func combineKeyShares(shares []string) (*SecureBuffer, error) {
+	var parsed []keyShare
+	defer func() {
+		for _, share := range parsed {
+			Wipe(share.share)
+		}
+	}()
+
+	for i, s := range shares {
+		share, err := parseKeyShare(s)
+		if err != nil {
+			return nil, fmt.Errorf("share %d: %v", i+1, err)
+		}
+		parsed = append(parsed, share)
+		if share.threshold != parsed[0].threshold || !bytes.Equal(share.tag, parsed[0].tag) {
+			return nil, fmt.Errorf("share %d belongs to a different split", i+1)
+		}
+	}
+	if len(parsed) == 0 {
+		return nil, errors.New("no shares given")
+	}
+	if len(parsed) < parsed[0].threshold {
+		return nil, fmt.Errorf("%d shares are needed, got %d", parsed[0].threshold, len(parsed))
+	}
+
+	rawShares := make([][]byte, len(parsed))
+	for i, share := range parsed {
+		rawShares[i] = share.share
+	}
+	secret, err := CombineShares(rawShares)
+	if err != nil {
+		return nil, err
+	}
+	return NewSecureBufferFrom(secret), nil
+}
+
+// openShamirSlots returns the data key and slot ID for a combined secret
+func openShamirSlots(slots []KeySlot, secret *SecureBuffer) (*SecureBuffer, string, error) {
+	tried := false
+	for _, slot := range slots {
+		if slot.Type != SlotTypeShamir {
+			continue
+		}
+		tried = true
+
+		slotKey, err := slot.deriveHKDFKey(secret.Bytes(), shamirKeyInfo)
+		if err != nil {
+			return nil, "", err
+		}
+		dataKey, err := slot.openDataKey(slotKey.Bytes())
+		slotKey.Destroy()
+		if err == nil {
+			return dataKey, slot.ID, nil
+		}
+	}
+
+	if !tried {
+		return nil, "", errors.New("wallet has no key shares")
+	}
+	return nil, "", errors.New("invalid shares, they may belong to a revoked split")
+}
@@ -0,0 +1,300 @@
+package pkg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// SlotType defines how the key of a key slot is obtained
+type SlotType string
+
+const (
+	// SlotTypePassword slots derive their key from a password and an optional keyfile
+	SlotTypePassword SlotType = "password"
+	// SlotTypeRecovery slots derive their key from a generated recovery key
+	SlotTypeRecovery SlotType = "recovery"
+	// SlotTypeShamir slots derive their key from a secret split into shares
+	SlotTypeShamir SlotType = "shamir"
+	// SlotTypeRecipient slots wrap the data key to an X25519 public key
+	SlotTypeRecipient SlotType = "x25519"
+)
+
+// The PBKDF2 iterations of a password slot are used before the slot table
+// can be authenticated. Fewer than the wallet has always used would weaken
+// the slot, and far more would hang the unlock.
+const (
+	minSlotIterations = iterations
+	maxSlotIterations = 100 * iterations
+)
+
+// KeySlot wraps the data key of a wallet with a key obtained from one unlock
+// secret. Slots can be added without re-encrypting the wallet.
+//
+// Each password, recovery and Shamir slot has its own X25519 key pair. The
+// slot key wraps the private key, and the data key is wrapped to the public
+// key like it is to a recipient. A new data key can so be wrapped for every
+// slot without knowing their secrets, which RotateDataKey does.
+type KeySlot struct {
+	ID      string    `json:"id"`
+	Type    SlotType  `json:"type"`
+	Label   string    `json:"label"`
+	Created time.Time `json:"created"`
+	// KeyFile and Iterations describe the key derivation of password slots
+	KeyFile    bool   `json:"keyfile,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	// Threshold of Shares are needed to unlock a Shamir slot
+	Threshold int `json:"threshold,omitempty"`
+	Shares    int `json:"shares,omitempty"`
+	// Recipient is the age recipient of recipient slots
+	Recipient string `json:"recipient,omitempty"`
+	// PublicKey is the public key of the slot key pair and WrappedPrivateKey
+	// its private key, wrapped with the slot key
+	PublicKey         []byte `json:"publicKey,omitempty"`
+	WrappedPrivateKey []byte `json:"wrappedPrivateKey,omitempty"`
+	// Ephemeral is the share of the stanza that wraps the data key to the
+	// recipient or the public key
+	Ephemeral []byte `json:"ephemeral,omitempty"`
+	// WrappedKey is the stanza body with the encrypted data key
+	WrappedKey []byte `json:"wrappedKey"`
+}
+
+// validate rejects slot parameters that would make unlocking unsafe
+func (s KeySlot) validate() error {
+	if s.Type == SlotTypePassword && (s.Iterations < minSlotIterations || s.Iterations > maxSlotIterations) {
+		return fmt.Errorf("key slot %s has %d PBKDF2 iterations, expected %d to %d", s.ID, s.Iterations, minSlotIterations, maxSlotIterations)
+	}
+	return nil
+}
+
+// Description summarizes how the slot is unlocked, e.g. "password + keyfile"
+func (s KeySlot) Description() string {
+	switch {
+	case s.Type == SlotTypePassword && s.KeyFile:
+		return "password + keyfile"
+	case s.Type == SlotTypeShamir:
+		return fmt.Sprintf("%d of %d shares", s.Threshold, s.Shares)
+	case s.Type == SlotTypeRecipient:
+		return "recipient " + shortRecipient(s.Recipient)
+	default:
+		return string(s.Type)
+	}
+}
+
+// newDataKey generates the random key the wallet is encrypted with
+func newDataKey() (*SecureBuffer, error) {
+	key := NewSecureBuffer(keySize)
+	if _, err := io.ReadFull(rand.Reader, key.Bytes()); err != nil {
+		key.Destroy()
+		return nil, err
+	}
+	return key, nil
+}
+
+// wrapKey encrypts a key with the slot key. The slot ID is authenticated so
+// wrapped keys cannot be swapped between slots.
+func wrapKey(slotKey []byte, key []byte, slotID string) ([]byte, error) {
+	gcm, err := newGCM(slotKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, key, []byte(slotID)), nil
+}
+
+// unwrapKey decrypts a key wrapped by wrapKey
+func unwrapKey(slotKey []byte, wrapped []byte, slotID string) (*SecureBuffer, error) {
+	gcm, err := newGCM(slotKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < nonceSize {
+		return nil, errors.New("invalid wrapped key")
+	}
+	key, err := gcm.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], []byte(slotID))
+	if err != nil {
+		return nil, errors.New("invalid wrapped key")
+	}
+	return NewSecureBufferFrom(key), nil
+}
+
+// sealDataKey generates the key pair of the slot, wraps its private key
+// with the slot key and the data key to its public key
+func (s *KeySlot) sealDataKey(slotKey []byte, dataKey []byte) error {
+	scalar := make([]byte, curve25519.ScalarSize)
+	defer Wipe(scalar)
+	if _, err := io.ReadFull(rand.Reader, scalar); err != nil {
+		return err
+	}
+	public, err := curve25519.X25519(scalar, curve25519.Basepoint)
+	if err != nil {
+		return err
+	}
+	wrappedPrivate, err := wrapKey(slotKey, scalar, s.ID)
+	if err != nil {
+		return err
+	}
+	s.PublicKey = public
+	s.WrappedPrivateKey = wrappedPrivate
+	return s.rewrapDataKey(dataKey)
+}
+
+// openDataKey unwraps the data key with the slot key
+func (s KeySlot) openDataKey(slotKey []byte) (*SecureBuffer, error) {
+	scalar, err := unwrapKey(slotKey, s.WrappedPrivateKey, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer scalar.Destroy()
+	return unwrapWithIdentity(scalar.Bytes(), s.Ephemeral, s.WrappedKey)
+}
+
+// rewrapDataKey wraps the data key to the public key of the slot, or to its
+// recipient
+func (s *KeySlot) rewrapDataKey(dataKey []byte) error {
+	public := s.PublicKey
+	if s.Type == SlotTypeRecipient {
+		var err error
+		if public, err = ParseRecipient(s.Recipient); err != nil {
+			return err
+		}
+	}
+	if len(public) == 0 {
+		return fmt.Errorf("key slot '%s' has no public key", s.Label)
+	}
+	share, body, err := wrapToRecipient(public, dataKey)
+	if err != nil {
+		return err
+	}
+	s.Ephemeral, s.WrappedKey = share, body
+	return nil
+}
+
+// newGCM creates an AES-GCM cipher for the key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newPasswordSlot wraps the data key with a key derived from the password
+// and the keyfile digest, if given
+func newPasswordSlot(id string, label string, password []byte, keyFile *SecureBuffer, dataKey *SecureBuffer) (KeySlot, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return KeySlot{}, err
+	}
+	slot := KeySlot{
+		ID:         id,
+		Type:       SlotTypePassword,
+		Label:      label,
+		Created:    time.Now(),
+		KeyFile:    keyFile != nil,
+		Salt:       salt,
+		Iterations: iterations,
+	}
+
+	slotKey := slot.derivePasswordKey(password, keyFile)
+	defer slotKey.Destroy()
+	if err := slot.sealDataKey(slotKey.Bytes(), dataKey.Bytes()); err != nil {
+		return KeySlot{}, err
+	}
+	return slot, nil
+}
+
+// deriveHKDFKey derives the key of a slot whose secret is random, like a
+// recovery key, so HKDF is enough and no password stretching is needed
+func (s KeySlot) deriveHKDFKey(secret []byte, info string) (*SecureBuffer, error) {
+	slotKey := NewSecureBuffer(keySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, s.Salt, []byte(info)), slotKey.Bytes()); err != nil {
+		slotKey.Destroy()
+		return nil, err
+	}
+	return slotKey, nil
+}
+
+// derivePasswordKey derives the key of a password slot
+func (s KeySlot) derivePasswordKey(password []byte, keyFile *SecureBuffer) *SecureBuffer {
+	material := compositeKey(password, keyFile)
+	defer Wipe(material)
+	return NewSecureBufferFrom(pbkdf2.Key(material, s.Salt, s.Iterations, keySize, sha256.New))
+}
+
+// openPasswordSlots tries the password slots that match whether a keyfile
+// was given and returns the data key and the ID of the slot that opened it
+func openPasswordSlots(slots []KeySlot, password []byte, keyFile *SecureBuffer) (*SecureBuffer, string, error) {
+	tried := false
+	for _, slot := range slots {
+		if slot.Type != SlotTypePassword || slot.KeyFile != (keyFile != nil) {
+			continue
+		}
+		tried = true
+
+		slotKey := slot.derivePasswordKey(password, keyFile)
+		dataKey, err := slot.openDataKey(slotKey.Bytes())
+		slotKey.Destroy()
+		if err == nil {
+			return dataKey, slot.ID, nil
+		}
+	}
+
+	switch {
+	case !tried && keyFile == nil:
+		return nil, "", ErrKeyFileRequired
+	case !tried:
+		return nil, "", errors.New("wallet does not use a keyfile")
+	case keyFile != nil:
+		return nil, "", errors.New("invalid password or keyfile")
+	default:
+		return nil, "", errors.New("invalid password")
+	}
+}
+
+// upgradeHeader moves a version 1 or 2 wallet to a random data key. The key
+// derived from the password wraps the new data key in the first slot, so the
+// password unlocks the wallet as before.
+func upgradeHeader(header WalletHeader, passwordKey *SecureBuffer) (WalletHeader, *SecureBuffer, string, error) {
+	dataKey, err := newDataKey()
+	if err != nil {
+		return WalletHeader{}, nil, "", err
+	}
+	slot := KeySlot{
+		ID:         generateUniqueID("slot"),
+		Type:       SlotTypePassword,
+		Label:      "Master password",
+		Created:    time.Now(),
+		KeyFile:    header.KeyFile,
+		Salt:       append([]byte(nil), header.Salt...),
+		Iterations: iterations,
+	}
+	if err := slot.sealDataKey(passwordKey.Bytes(), dataKey.Bytes()); err != nil {
+		dataKey.Destroy()
+		return WalletHeader{}, nil, "", err
+	}
+	return WalletHeader{Version: currentFormatVersion, Slots: []KeySlot{slot}}, dataKey, slot.ID, nil
+}
+
+// findSlot returns the index of the slot with the ID, or -1
+func findSlot(slots []KeySlot, id string) int {
+	for i, slot := range slots {
+		if slot.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,249 @@
+package pkg
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newSlotsWallet creates a wallet on memory storage with a second password,
+// a recovery key, a Shamir slot and a recipient slot
+func newSlotsWallet(t *testing.T) (storage *MemoryStorage, service *WalletService, recoveryKey string, shares []string, identityFile string) {
+	t.Helper()
+	storage = NewMemoryStorage()
+	service = NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	recoveryKey = service.TakeRecoveryKey()
+	group := &Group{Name: "Email"}
+	if err := service.AddGroup(Path{}, group); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddEntry(Path{GroupIDs: []string{group.ID}}, &Entry{Title: "Mail"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.AddPasswordSlot("Second", "other password", ""); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if shares, err = service.AddShamirSlot("", 3, 2); err != nil {
+		t.Fatal(err)
+	}
+	identityFile = filepath.Join(t.TempDir(), "identity.txt")
+	recipient, err := GenerateIdentityFile(identityFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.AddRecipientSlot("", recipient); err != nil {
+		t.Fatal(err)
+	}
+	return storage, service, recoveryKey, shares, identityFile
+}
+
+// findSlotByLabel returns the ID of the slot with the label
+func findSlotByLabel(t *testing.T, service *WalletService, label string) string {
+	t.Helper()
+	for _, slot := range service.ListSlots() {
+		if slot.Label == label {
+			return slot.ID
+		}
+	}
+	t.Fatalf("no key slot '%s'", label)
+	return ""
+}
+
+// openWithKey reports whether the data key decrypts the wallet as stored
+func openWithKey(storage Storage, key []byte) error {
+	encrypted, err := readWalletFile(storage, "wallet.dat")
+	if err != nil {
+		return err
+	}
+	_, err = decryptWallet(encrypted, func(encrypted []byte) ([]byte, error) {
+		return decryptWithKey(encrypted, key)
+	})
+	return err
+}
+
+// checkUnlocks checks that every remaining secret unlocks the wallet
+func checkUnlocks(t *testing.T, storage Storage, recoveryKey string, shares []string, identityFile string) {
+	t.Helper()
+	unlocks := map[string]func(*WalletService) error{
+		"password":      func(ws *WalletService) error { return ws.Unlock("password") },
+		"recovery key":  func(ws *WalletService) error { return ws.UnlockWithRecoveryKey(recoveryKey) },
+		"shares":        func(ws *WalletService) error { return ws.UnlockWithShares(shares[1:]) },
+		"identity file": func(ws *WalletService) error { return ws.UnlockWithIdentityFile(identityFile) },
+	}
+	for name, unlock := range unlocks {
+		reopened := NewWalletServiceWithStorage(storage, "wallet.dat", "")
+		reopened.Lock()
+		if err := unlock(reopened); err != nil {
+			t.Errorf("unlocking with the %s: %v", name, err)
+		} else if results := reopened.SearchEntries("Mail"); len(results) != 1 {
+			t.Errorf("unlocked with the %s, found %d entries", name, len(results))
+		}
+		reopened.Close()
+	}
+}
+
+func TestRevokeSlotKeepsDataKey(t *testing.T) {
+	storage, service, recoveryKey, shares, identityFile := newSlotsWallet(t)
+	key := append([]byte(nil), service.key.Bytes()...)
+
+	if err := service.RevokeSlot(findSlotByLabel(t, service, "Second")); err != nil {
+		t.Fatal(err)
+	}
+	if err := openWithKey(storage, key); err != nil {
+		t.Errorf("the data key changed when a slot was revoked: %v", err)
+	}
+	service.Close()
+
+	revoked := NewWalletServiceWithStorage(storage, "wallet.dat", "other password")
+	if err := revoked.Load(); err == nil {
+		t.Error("the revoked password still unlocks the wallet")
+	}
+	checkUnlocks(t, storage, recoveryKey, shares, identityFile)
+}
+
+func TestRotateDataKey(t *testing.T) {
+	storage, service, recoveryKey, shares, identityFile := newSlotsWallet(t)
+	oldKey := append([]byte(nil), service.key.Bytes()...)
+
+	if err := service.RotateDataKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := openWithKey(storage, oldKey); err == nil {
+		t.Error("the data key from before the rotation still opens the wallet")
+	}
+	if err := openWithKey(storage, service.key.Bytes()); err != nil {
+		t.Errorf("the new data key does not open the wallet: %v", err)
+	}
+	service.Close()
+	checkUnlocks(t, storage, recoveryKey, shares, identityFile)
+}
+
+func TestRotateRecoveryKeyRevokesPreviousKey(t *testing.T) {
+	storage, service, recoveryKey, _, _ := newSlotsWallet(t)
+	defer service.Close()
+
+	rotated, err := service.RotateRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened := NewWalletServiceWithStorage(storage, "wallet.dat", "")
+	defer reopened.Close()
+	reopened.Lock()
+	if err := reopened.UnlockWithRecoveryKey(recoveryKey); err == nil {
+		t.Error("the previous recovery key still unlocks the wallet")
+	}
+	if err := reopened.UnlockWithRecoveryKey(rotated); err != nil {
+		t.Errorf("the new recovery key does not unlock the wallet: %v", err)
+	}
+}
+
+func TestTamperedSlotTableFailsToLoad(t *testing.T) {
+	_, attacker, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ParseRecipient(attacker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := newDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherKey.Destroy()
+
+	tamper := map[string]func(slots []KeySlot) []KeySlot{
+		"swapped public key": func(slots []KeySlot) []KeySlot {
+			slots[1].PublicKey = public
+			return slots
+		},
+		// The stanza of a recipient slot names neither the slot nor the
+		// wallet, only the table HMAC catches a copy
+		"copied recipient": func(slots []KeySlot) []KeySlot {
+			slot := slots[len(slots)-1]
+			slot.ID, slot.Label = "slot-copy", "copy"
+			return append(slots, slot)
+		},
+		"injected recipient": func(slots []KeySlot) []KeySlot {
+			slot, err := newRecipientSlot("slot-attacker", "attacker", attacker, otherKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return append(slots, slot)
+		},
+	}
+	for name, change := range tamper {
+		t.Run(name, func(t *testing.T) {
+			storage, service, _, _, _ := newSlotsWallet(t)
+			service.Close()
+
+			encrypted, err := readWalletFile(storage, "wallet.dat")
+			if err != nil {
+				t.Fatal(err)
+			}
+			header, size, err := parseWalletHeader(encrypted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header.Slots = change(header.Slots)
+			// Without the data key the table can only be signed with another key
+			tampered := append(header.bytes(otherKey.Bytes()), encrypted[size:]...)
+			if err := storage.WriteFile("wallet.dat", tampered); err != nil {
+				t.Fatal(err)
+			}
+
+			reopened := NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+			defer reopened.Close()
+			if err := reopened.Load(); err == nil || !strings.Contains(err.Error(), "key slots") {
+				t.Errorf("Load of a tampered slot table = %v", err)
+			}
+		})
+	}
+}
+
+func TestPasswordSlotBindsSlotID(t *testing.T) {
+	dataKey, err := newDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dataKey.Destroy()
+
+	// The wrapped private key authenticates the slot ID
+	password, err := newPasswordSlot("slot-3", "password", []byte("password"), nil, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password.ID = "slot-4"
+	slotKey := password.derivePasswordKey([]byte("password"), nil)
+	defer slotKey.Destroy()
+	if _, err := password.openDataKey(slotKey.Bytes()); err == nil {
+		t.Error("a password slot opened under another ID")
+	}
+}
+
+func TestParseHeaderRejectsIterations(t *testing.T) {
+	for _, n := range []int{0, 1, minSlotIterations - 1, maxSlotIterations + 1, 1 << 31} {
+		header := WalletHeader{Version: currentFormatVersion, Slots: []KeySlot{{
+			ID: "slot-1", Type: SlotTypePassword, Salt: make([]byte, saltSize), Iterations: n,
+		}}}
+		data := append(header.bytes(make([]byte, keySize)), make([]byte, nonceSize)...)
+		if _, _, err := parseWalletHeader(data); err == nil {
+			t.Errorf("a slot with %d iterations was accepted", n)
+		}
+	}
+
+	header := WalletHeader{Version: currentFormatVersion, Slots: []KeySlot{{
+		ID: "slot-1", Type: SlotTypePassword, Salt: make([]byte, saltSize), Iterations: iterations,
+	}}}
+	if _, _, err := parseWalletHeader(append(header.bytes(make([]byte, keySize)), make([]byte, nonceSize)...)); err != nil {
+		t.Errorf("a slot with the default iterations was rejected: %v", err)
+	}
+}
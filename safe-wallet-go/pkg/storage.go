@@ -3,43 +3,229 @@ package pkg
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 )
 
-// SaveWallet encrypts and saves the wallet to a file
+// Storage holds the files of a wallet. WalletService reads and writes
+// through it, so wallets can live somewhere else than the local disk.
+// Errors for names that do not exist satisfy os.IsNotExist.
+type Storage interface {
+	// ReadFile returns the content of the file
+	ReadFile(name string) ([]byte, error)
+	// WriteFile replaces the content of the file, creating it if needed.
+	// The file should be readable by the owner only.
+	WriteFile(name string, data []byte) error
+	// Stat describes the file or directory
+	Stat(name string) (StorageInfo, error)
+	// ReadDir returns the names of the files and directories in the directory
+	ReadDir(name string) ([]string, error)
+	// Mkdir creates the directory and any missing parents
+	Mkdir(name string) error
+	// Remove removes the file or the empty directory
+	Remove(name string) error
+	// Rename moves the file or directory to a new name
+	Rename(oldName string, newName string) error
+	// Lock keeps other programs from writing the wallet at the name until
+	// the returned function is called
+	Lock(name string) (func() error, error)
+}
+
+// ErrRemoteChanged is returned when a file on the server changed since it
+// was read, so writing it would lose someone else's changes
+var ErrRemoteChanged = errors.New("the wallet on the server was changed by someone else, unlock it again to load the changes before saving")
+
+// StorageInfo describes a file or directory in a Storage
+type StorageInfo struct {
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// FileStorage stores wallets on the local filesystem
+type FileStorage struct{}
+
+func (FileStorage) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (FileStorage) WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, 0600) // 0600 = rw-------
+}
+
+func (FileStorage) Stat(name string) (StorageInfo, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return StorageInfo{}, err
+	}
+	return StorageInfo{IsDir: info.IsDir(), Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (FileStorage) ReadDir(name string) ([]string, error) {
+	items, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Name()
+	}
+	return names, nil
+}
+
+func (FileStorage) Mkdir(name string) error {
+	return os.MkdirAll(name, 0700)
+}
+
+func (FileStorage) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (FileStorage) Rename(oldName string, newName string) error {
+	return os.Rename(oldName, newName)
+}
+
+// Lock takes an exclusive lock on a lock file next to the wallet. The
+// operating system releases the lock when the program exits, so a lock file
+// left behind by a crash does not block later saves.
+func (FileStorage) Lock(name string) (func() error, error) {
+	return lockFile(name + ".lock")
+}
+
+// openLockFile opens the lock file and locks it with tryLock, which fails
+// if another program holds the lock. The lock file may be removed by the
+// holder between opening and locking it, so the lock is only kept if the
+// path still names the locked file. With remove, unlocking removes the file
+// before releasing the lock, so no other program can lock it in between.
+// Where an open file cannot be removed the file is left in place; it does
+// not block the next lock.
+func openLockFile(path string, remove bool, tryLock func(*os.File) error, unlock func(*os.File) error) (func() error, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600) // 0600 = rw-------
+		if err != nil {
+			return nil, err
+		}
+		if err := tryLock(file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("wallet is being written by another program: %v", err)
+		}
+
+		locked, err := file.Stat()
+		if err != nil {
+			unlock(file)
+			file.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if err != nil || !os.SameFile(locked, current) {
+			// Removed by the previous holder, lock the new file
+			unlock(file)
+			file.Close()
+			continue
+		}
+
+		file.Truncate(0)
+		fmt.Fprintf(file, "%d\n", os.Getpid())
+		return func() error {
+			var err error
+			if remove {
+				err = os.Remove(path)
+			}
+			unlock(file)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}, nil
+	}
+}
+
+// removeAll removes the file or the directory with everything in it
+func removeAll(storage Storage, name string) error {
+	info, err := storage.Stat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir {
+		names, err := storage.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, child := range names {
+			if err := removeAll(storage, filepath.Join(name, child)); err != nil {
+				return err
+			}
+		}
+	}
+	return storage.Remove(name)
+}
+
+// SaveWallet encrypts and saves the wallet to a file with a single password
+// slot. Use WalletService to keep the key slots of an existing wallet.
 func SaveWallet(wallet *Wallet, filepath string, password string) error {
+	return saveWalletWith(FileStorage{}, wallet, filepath, func(jsonData []byte) ([]byte, error) {
+		return EncryptData(jsonData, password)
+	})
+}
+
+// LoadWallet loads and decrypts a wallet from a file
+func LoadWallet(filepath string, password string) (*Wallet, error) {
+	encrypted, err := readWalletFile(FileStorage{}, filepath)
+	if err != nil {
+		return nil, err
+	}
+	return decryptWallet(encrypted, func(encrypted []byte) ([]byte, error) {
+		return DecryptData(encrypted, password)
+	})
+}
+
+// saveWalletWith marshals the wallet, encrypts it with encrypt and writes it
+// to the file. The plaintext JSON is wiped afterwards.
+func saveWalletWith(storage Storage, wallet *Wallet, filepath string, encrypt func(jsonData []byte) ([]byte, error)) error {
 	// Marshal wallet to JSON
 	jsonData, err := json.MarshalIndent(wallet, "", "  ")
 	if err != nil {
 		return err
 	}
+	defer Wipe(jsonData)
 
 	// Encrypt the JSON data
-	encrypted, err := EncryptData(jsonData, password)
+	encrypted, err := encrypt(jsonData)
 	if err != nil {
 		return err
 	}
 
 	// Write to file
-	return os.WriteFile(filepath, encrypted, 0600) // 0600 = rw-------
+	return storage.WriteFile(filepath, encrypted)
 }
 
-// LoadWallet loads and decrypts a wallet from a file
-func LoadWallet(filepath string, password string) (*Wallet, error) {
-	// Read encrypted file
-	encrypted, err := os.ReadFile(filepath)
+// readWalletFile reads the encrypted wallet file, or the index of a sync
+// directory
+func readWalletFile(storage Storage, filepath string) ([]byte, error) {
+	encrypted, err := storage.ReadFile(storageFile(storage, filepath))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, errors.New("wallet file does not exist")
 		}
 		return nil, err
 	}
+	return encrypted, nil
+}
 
+// decryptWallet decrypts the file contents with decrypt and unmarshals the
+// wallet. The plaintext JSON is wiped afterwards.
+func decryptWallet(encrypted []byte, decrypt func(encrypted []byte) ([]byte, error)) (*Wallet, error) {
 	// Decrypt the data
-	jsonData, err := DecryptData(encrypted, password)
+	jsonData, err := decrypt(encrypted)
 	if err != nil {
 		return nil, err
 	}
+	defer Wipe(jsonData)
 
 	// Unmarshal JSON to wallet
 	var wallet Wallet
@@ -60,6 +246,11 @@ func CreateNewWallet() *Wallet {
 
 // WalletExists checks if a wallet file exists
 func WalletExists(filepath string) bool {
-	_, err := os.Stat(filepath)
+	return WalletExistsIn(FileStorage{}, filepath)
+}
+
+// WalletExistsIn checks if a wallet exists at the name in the storage
+func WalletExistsIn(storage Storage, filepath string) bool {
+	_, err := storage.Stat(filepath)
 	return !os.IsNotExist(err)
 }
@@ -0,0 +1,50 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFileStorageLockIgnoresStaleLockFile(t *testing.T) {
+	wallet := filepath.Join(t.TempDir(), "wallet.dat")
+	// Left behind by a program that crashed while saving
+	if err := os.WriteFile(wallet+".lock", []byte("99999999\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := FileStorage{}.Lock(wallet)
+	if err != nil {
+		t.Fatalf("Lock with a stale lock file: %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	// Windows cannot remove the open lock file, it stays
+	if _, err := os.Stat(wallet + ".lock"); runtime.GOOS != "windows" && !os.IsNotExist(err) {
+		t.Errorf("lock file not removed on unlock: %v", err)
+	}
+}
+
+func TestFileStorageLockIsExclusive(t *testing.T) {
+	wallet := filepath.Join(t.TempDir(), "wallet.dat")
+	storage := FileStorage{}
+
+	unlock, err := storage.Lock(wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Lock(wallet); err == nil {
+		t.Fatal("second Lock succeeded while the first is held")
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err = storage.Lock(wallet)
+	if err != nil {
+		t.Fatalf("Lock after unlock: %v", err)
+	}
+	unlock()
+}
@@ -0,0 +1,407 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A sync directory stores the wallet as one encrypted file per entry plus an
+// encrypted index of the group tree, so editing an entry rewrites only its
+// file and edits to different entries merge cleanly in git. The index holds
+// the group names and which entries each group has, so adding, deleting or
+// moving an entry and any change to a group rewrite wallet.swlt as well.
+// Such changes made in two clones conflict on that file.
+//
+//	wallet.swlt          header with the key slots and the encrypted index
+//	entries/<id>.swlt    an entry, encrypted with the data key
+//	.gitattributes       marks the encrypted files as binary
+const (
+	syncIndexFile     = "wallet.swlt"
+	syncEntriesDir    = "entries"
+	syncEntryExt      = ".swlt"
+	syncGitAttributes = ".gitattributes"
+
+	// syncEntryMagic and syncEntryVersion start every entry file
+	syncEntryMagic   = "SWLE"
+	syncEntryVersion = 1
+)
+
+// StorageFormat is how a wallet is stored on disk
+type StorageFormat string
+
+const (
+	// StorageFile stores the wallet as a single encrypted file
+	StorageFile StorageFormat = "file"
+	// StorageSyncDir stores the wallet as a directory with a file per entry
+	StorageSyncDir StorageFormat = "sync"
+)
+
+// syncIndex is the group tree of a sync directory with the IDs of the
+// entries in each group
+type syncIndex struct {
+	Version int         `json:"version"`
+	Groups  []syncGroup `json:"groups"`
+}
+
+type syncGroup struct {
+	ID      string      `json:"id"`
+	Name    string      `json:"name"`
+	Groups  []syncGroup `json:"groups"`
+	Entries []string    `json:"entries"`
+}
+
+// isSyncDir reports whether the wallet at the path is stored as a sync
+// directory
+func isSyncDir(storage Storage, path string) bool {
+	info, err := storage.Stat(path)
+	return err == nil && info.IsDir
+}
+
+// storageFile returns the file that holds the header of the wallet at the path
+func storageFile(storage Storage, path string) string {
+	if isSyncDir(storage, path) {
+		return filepath.Join(path, syncIndexFile)
+	}
+	return path
+}
+
+// syncEntryFile returns the file of an entry in a sync directory. IDs come
+// from the decrypted index, so anything that is not a plain name is refused.
+func syncEntryFile(dir string, id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid entry ID '%s'", id)
+	}
+	return filepath.Join(dir, syncEntriesDir, id+syncEntryExt), nil
+}
+
+// syncEntryAD authenticates the format and the entry ID, so entry files
+// cannot be swapped
+func syncEntryAD(id string) []byte {
+	return append([]byte{syncEntryVersion}, syncEntryMagic+id...)
+}
+
+// readSyncDir decrypts the index, given with its header, and the entry
+// files of a sync directory
+func readSyncDir(storage Storage, dir string, encryptedIndex []byte, key []byte) (*Wallet, error) {
+	data, err := decryptWithKey(encryptedIndex, key)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(data)
+	var index syncIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+
+	groups, err := readSyncGroups(storage, dir, index.Groups, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{Version: index.Version, Groups: groups}, nil
+}
+
+func readSyncGroups(storage Storage, dir string, syncGroups []syncGroup, key []byte) ([]Group, error) {
+	groups := make([]Group, len(syncGroups))
+	for i, syncGroup := range syncGroups {
+		groups[i] = Group{ID: syncGroup.ID, Name: syncGroup.Name, Entries: make([]Entry, len(syncGroup.Entries))}
+		for j, id := range syncGroup.Entries {
+			entry, err := readSyncEntry(storage, dir, id, key)
+			if err != nil {
+				return nil, err
+			}
+			groups[i].Entries[j] = *entry
+		}
+		var err error
+		if groups[i].Groups, err = readSyncGroups(storage, dir, syncGroup.Groups, key); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// readSyncEntry decrypts the file of an entry
+func readSyncEntry(storage Storage, dir string, id string, key []byte) (*Entry, error) {
+	path, err := syncEntryFile(dir, id)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := storage.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file of entry '%s' is missing", id)
+		}
+		return nil, err
+	}
+	prefix := append([]byte(syncEntryMagic), syncEntryVersion)
+	if !bytes.HasPrefix(encrypted, prefix) {
+		return nil, fmt.Errorf("file of entry '%s' is not a wallet entry", id)
+	}
+	data, err := unwrapKey(key, encrypted[len(prefix):], string(syncEntryAD(id)))
+	if err != nil {
+		return nil, fmt.Errorf("file of entry '%s' cannot be decrypted", id)
+	}
+	defer data.Destroy()
+
+	var entry Entry
+	if err := json.Unmarshal(data.Bytes(), &entry); err != nil {
+		return nil, err
+	}
+	if entry.ID != id {
+		return nil, fmt.Errorf("file of entry '%s' holds another entry", id)
+	}
+	return &entry, nil
+}
+
+// saveSyncDir writes the plaintext wallet to the sync directory. Only the
+// entries and the index that changed since they were last read or written
+// are encrypted again, the files of deleted entries are removed.
+func (ws *WalletService) saveSyncDir(wallet *Wallet) error {
+	dir := ws.filepath
+	if err := ws.storage.Mkdir(filepath.Join(dir, syncEntriesDir)); err != nil {
+		return err
+	}
+	gitAttributes := filepath.Join(dir, syncGitAttributes)
+	if _, err := ws.storage.Stat(gitAttributes); os.IsNotExist(err) {
+		if err := ws.storage.WriteFile(gitAttributes, []byte("*"+syncEntryExt+" binary\n")); err != nil {
+			return err
+		}
+	}
+
+	stored := make(map[string][]byte)
+	var entries []Entry
+	index := syncIndex{Version: wallet.Version, Groups: syncGroupsOf(wallet.Groups, &entries)}
+
+	// Entries first, so the index never lists an entry without a file
+	for _, entry := range entries {
+		path, err := syncEntryFile(dir, entry.ID)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(entry, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = ws.writeSyncFile(stored, entry.ID, path, data, func(data []byte) ([]byte, error) {
+			sealed, err := wrapKey(ws.key.Bytes(), data, string(syncEntryAD(entry.ID)))
+			return append(append([]byte(syncEntryMagic), syncEntryVersion), sealed...), err
+		})
+		Wipe(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ws.writeSyncFile(stored, syncIndexFile, filepath.Join(dir, syncIndexFile), data, func(data []byte) ([]byte, error) {
+		return encryptWithKey(data, ws.key.Bytes(), ws.header)
+	})
+	Wipe(data)
+	if err != nil {
+		return err
+	}
+
+	for id := range ws.stored {
+		if _, ok := stored[id]; ok {
+			continue
+		}
+		if path, err := syncEntryFile(dir, id); err == nil {
+			if err := ws.storage.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	ws.stored = stored
+	return nil
+}
+
+// writeSyncFile encrypts and writes the data unless it is unchanged since
+// the file was last read or written, and records its fingerprint in stored
+func (ws *WalletService) writeSyncFile(stored map[string][]byte, name string, path string, data []byte, encrypt func(data []byte) ([]byte, error)) error {
+	fingerprint := ws.syncFingerprint(name, data)
+	stored[name] = fingerprint
+	if hmac.Equal(ws.stored[name], fingerprint) {
+		if _, err := ws.storage.Stat(path); err == nil {
+			return nil
+		}
+	}
+	encrypted, err := encrypt(data)
+	if err != nil {
+		return err
+	}
+	return ws.storage.WriteFile(path, encrypted)
+}
+
+// rememberSyncDir records the fingerprints of the files of a sync directory
+// that was just read, so the next save skips what did not change
+func (ws *WalletService) rememberSyncDir() error {
+	ws.stored = nil
+	if !isSyncDir(ws.storage, ws.filepath) {
+		return nil
+	}
+	groups, err := openedGroups(ws.wallet.Groups, ws.fieldKey.Bytes())
+	if err != nil {
+		return err
+	}
+	ws.stored = make(map[string][]byte)
+	var entries []Entry
+	index := syncIndex{Version: ws.wallet.Version, Groups: syncGroupsOf(groups, &entries)}
+	for _, entry := range entries {
+		data, err := json.MarshalIndent(entry, "", "  ")
+		if err != nil {
+			return err
+		}
+		ws.stored[entry.ID] = ws.syncFingerprint(entry.ID, data)
+		Wipe(data)
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	ws.stored[syncIndexFile] = ws.syncFingerprint(syncIndexFile, data)
+	return nil
+}
+
+// syncFingerprint identifies the plaintext of a file. It is keyed with the
+// field key, so the fingerprints reveal nothing about the values.
+func (ws *WalletService) syncFingerprint(name string, data []byte) []byte {
+	mac := hmac.New(sha256.New, ws.fieldKey.Bytes())
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// syncGroupsOf returns the index of the groups and appends their entries
+func syncGroupsOf(groups []Group, entries *[]Entry) []syncGroup {
+	result := make([]syncGroup, len(groups))
+	for i, group := range groups {
+		result[i] = syncGroup{ID: group.ID, Name: group.Name, Entries: make([]string, len(group.Entries))}
+		for j, entry := range group.Entries {
+			result[i].Entries[j] = entry.ID
+			*entries = append(*entries, entry)
+		}
+		result[i].Groups = syncGroupsOf(group.Groups, entries)
+	}
+	return result
+}
+
+// StorageFormat returns how the wallet is stored on disk
+func (ws *WalletService) StorageFormat() StorageFormat {
+	if isSyncDir(ws.storage, ws.filepath) {
+		return StorageSyncDir
+	}
+	return StorageFile
+}
+
+// storedDigest hashes the wallet file, or the index and the entry files of a
+// sync directory, as they are in the storage
+func storedDigest(storage Storage, path string) ([]byte, error) {
+	data, err := readWalletFile(storage, path)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	hash.Write(data)
+	if !isSyncDir(storage, path) {
+		return hash.Sum(nil), nil
+	}
+
+	dir := filepath.Join(path, syncEntriesDir)
+	names, err := storage.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := storage.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(hash, "%s %d\n", name, len(data))
+		hash.Write(data)
+	}
+	return hash.Sum(nil), nil
+}
+
+// ConvertStorage stores the wallet in the format at the same path, keeping
+// its key slots. The wallet is written next to the old one first, which is
+// only removed once that succeeded.
+func (ws *WalletService) ConvertStorage(format StorageFormat) error {
+	if ws.wallet == nil {
+		return errors.New("wallet not loaded")
+	}
+	if ws.key == nil {
+		return errors.New("wallet is locked")
+	}
+	if format != StorageFile && format != StorageSyncDir {
+		return fmt.Errorf("unknown storage format '%s'", format)
+	}
+	if format == ws.StorageFormat() {
+		return nil
+	}
+	if format == StorageFile {
+		// The directory may be a git checkout, never remove what is not ours
+		if err := checkSyncDirContents(ws.storage, ws.filepath); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := ws.lockStorage()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	original := ws.filepath
+	converted := original + ".converting"
+	if err := removeAll(ws.storage, converted); err != nil {
+		return err
+	}
+	if format == StorageSyncDir {
+		if err := ws.storage.Mkdir(converted); err != nil {
+			return err
+		}
+	}
+
+	ws.filepath = converted
+	ws.stored = nil
+	err = ws.Save()
+	ws.filepath = original
+	if err != nil {
+		removeAll(ws.storage, converted)
+		return err
+	}
+
+	if err := removeAll(ws.storage, original); err != nil {
+		return err
+	}
+	return ws.storage.Rename(converted, original)
+}
+
+// checkSyncDirContents returns an error if the directory holds files that
+// are not part of the sync directory
+func checkSyncDirContents(storage Storage, dir string) error {
+	names, err := storage.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		switch name {
+		case syncIndexFile, syncEntriesDir, syncGitAttributes:
+		default:
+			return fmt.Errorf("'%s' holds other files, such as '%s', move the wallet to its own directory first", dir, name)
+		}
+	}
+	return nil
+}
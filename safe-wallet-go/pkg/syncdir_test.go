@@ -0,0 +1,204 @@
+package pkg
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// syncDirFiles tracks the contents of the files in a sync directory. Every
+// write encrypts with a new nonce, so a rewritten file always changes.
+type syncDirFiles struct {
+	t     *testing.T
+	dir   string
+	files map[string][]byte
+}
+
+// read returns the contents of the files below the directory by their
+// slash-separated names
+func (f *syncDirFiles) read() map[string][]byte {
+	f.t.Helper()
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(f.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(filepath.Dir(f.dir), path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(name)] = data
+		return nil
+	})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return files
+}
+
+// takeWritten returns the names of the files written since the last call
+func (f *syncDirFiles) takeWritten() []string {
+	f.t.Helper()
+	files := f.read()
+	var names []string
+	for name, data := range files {
+		if !bytes.Equal(data, f.files[name]) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	f.files = files
+	return names
+}
+
+func TestSyncDirRewritesOnlyChangedFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "wallet")
+	service := NewWalletService(dir, "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+	if err := service.ConvertStorage(StorageSyncDir); err != nil {
+		t.Fatal(err)
+	}
+	group := &Group{Name: "Email"}
+	if err := service.AddGroup(Path{}, group); err != nil {
+		t.Fatal(err)
+	}
+	groupPath := Path{GroupIDs: []string{group.ID}}
+	mail := &Entry{Title: "Mail", Fields: []EntryField{{Name: "Password", Value: "hunter2", Type: FieldTypePassword}}}
+	if err := service.AddEntry(groupPath, mail); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddEntry(groupPath, &Entry{Title: "Chat"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+	files := &syncDirFiles{t: t, dir: dir}
+	files.takeWritten()
+
+	// Editing an entry rewrites its file only
+	mailPath := Path{GroupIDs: groupPath.GroupIDs, EntryID: mail.ID}
+	edited := *mail
+	edited.Fields = []EntryField{{Name: "Password", Value: "correct horse", Type: FieldTypePassword}}
+	if err := service.UpdateEntry(mailPath, edited); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := files.takeWritten(), []string{"wallet/entries/" + mail.ID + ".swlt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("editing an entry wrote %v, want %v", got, want)
+	}
+
+	// Saving again writes nothing
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := files.takeWritten(); len(got) != 0 {
+		t.Errorf("saving an unchanged wallet wrote %v", got)
+	}
+
+	// Adding an entry writes its file and the index with the group tree
+	added := &Entry{Title: "Calendar"}
+	if err := service.AddEntry(groupPath, added); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := files.takeWritten(), []string{"wallet/entries/" + added.ID + ".swlt", "wallet/wallet.swlt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("adding an entry wrote %v, want %v", got, want)
+	}
+}
+
+func TestSyncDirRejectsSwappedEntryFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "wallet")
+	service := NewWalletService(dir, "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.ConvertStorage(StorageSyncDir); err != nil {
+		t.Fatal(err)
+	}
+	group := &Group{Name: "Email"}
+	if err := service.AddGroup(Path{}, group); err != nil {
+		t.Fatal(err)
+	}
+	first, second := &Entry{Title: "Mail"}, &Entry{Title: "Chat"}
+	for _, entry := range []*Entry{first, second} {
+		if err := service.AddEntry(Path{GroupIDs: []string{group.ID}}, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+	service.Close()
+
+	firstFile, _ := syncEntryFile(dir, first.ID)
+	secondFile, _ := syncEntryFile(dir, second.ID)
+	data, err := os.ReadFile(firstFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(secondFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	reopened := NewWalletService(dir, "password")
+	defer reopened.Close()
+	if err := reopened.Load(); err == nil {
+		t.Error("a sync directory with an entry file copied over another loaded")
+	}
+}
+
+func TestSyncDirRotateDataKeyRewritesEveryFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "wallet")
+	service := NewWalletService(dir, "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.ConvertStorage(StorageSyncDir); err != nil {
+		t.Fatal(err)
+	}
+	group := &Group{Name: "Email"}
+	if err := service.AddGroup(Path{}, group); err != nil {
+		t.Fatal(err)
+	}
+	mail := &Entry{Title: "Mail"}
+	if err := service.AddEntry(Path{GroupIDs: []string{group.ID}}, mail); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+	files := &syncDirFiles{t: t, dir: dir}
+	files.takeWritten()
+
+	if err := service.RotateDataKey(); err != nil {
+		t.Fatal(err)
+	}
+	service.Close()
+	if got, want := files.takeWritten(), []string{"wallet/entries/" + mail.ID + ".swlt", "wallet/wallet.swlt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rotating the data key wrote %v, want %v", got, want)
+	}
+
+	reopened := NewWalletService(dir, "password")
+	defer reopened.Close()
+	if err := reopened.Load(); err != nil {
+		t.Fatalf("the rotated sync directory does not load: %v", err)
+	}
+	if results := reopened.SearchEntries("Mail"); len(results) != 1 {
+		t.Errorf("found %d entries after rotating the data key, want 1", len(results))
+	}
+}
@@ -0,0 +1,424 @@
+#!/usr/bin/env python3
+"""Writes the KeePass fixtures keepass3.kdbx and keepass4.kdbx.
+
+Everything but AES, which comes from the openssl command, is implemented
+here from the specifications so the fixtures do not depend on the reader
+they test. The random values are fixed, so the output is reproducible.
+
+    python3 kdbx.py
+"""
+
+import base64
+import gzip
+import hashlib
+import hmac
+import struct
+import subprocess
+
+MASK64 = (1 << 64) - 1
+
+
+def aes(mode, key, data, iv=None):
+    args = ["openssl", "enc", "-" + mode, "-K", key.hex(), "-nopad"]
+    if iv is not None:
+        args += ["-iv", iv.hex()]
+    return subprocess.run(args, input=data, capture_output=True, check=True).stdout
+
+
+# Argon2d, RFC 9106
+
+def blake2b_long(size, data):
+    data = struct.pack("<I", size) + data
+    if size <= 64:
+        return hashlib.blake2b(data, digest_size=size).digest()
+    r = (size + 31) // 32 - 2
+    v = hashlib.blake2b(data).digest()
+    out = v[:32]
+    for _ in range(r - 1):
+        v = hashlib.blake2b(v).digest()
+        out += v[:32]
+    return out + hashlib.blake2b(v, digest_size=size - 32 * r).digest()
+
+
+def gb(v, a, b, c, d):
+    def mul(x, y):
+        return 2 * (x & 0xFFFFFFFF) * (y & 0xFFFFFFFF)
+
+    def rotr(x, n):
+        return ((x >> n) | (x << (64 - n))) & MASK64
+
+    v[a] = (v[a] + v[b] + mul(v[a], v[b])) & MASK64
+    v[d] = rotr(v[d] ^ v[a], 32)
+    v[c] = (v[c] + v[d] + mul(v[c], v[d])) & MASK64
+    v[b] = rotr(v[b] ^ v[c], 24)
+    v[a] = (v[a] + v[b] + mul(v[a], v[b])) & MASK64
+    v[d] = rotr(v[d] ^ v[a], 16)
+    v[c] = (v[c] + v[d] + mul(v[c], v[d])) & MASK64
+    v[b] = rotr(v[b] ^ v[c], 63)
+
+
+def permute(v):
+    gb(v, 0, 4, 8, 12)
+    gb(v, 1, 5, 9, 13)
+    gb(v, 2, 6, 10, 14)
+    gb(v, 3, 7, 11, 15)
+    gb(v, 0, 5, 10, 15)
+    gb(v, 1, 6, 11, 12)
+    gb(v, 2, 7, 8, 13)
+    gb(v, 3, 4, 9, 14)
+
+
+def compress(x, y):
+    r = [a ^ b for a, b in zip(x, y)]
+    z = list(r)
+    for row in range(8):
+        v = z[16 * row:16 * row + 16]
+        permute(v)
+        z[16 * row:16 * row + 16] = v
+    for col in range(8):
+        idx = []
+        for row in range(8):
+            idx += [16 * row + 2 * col, 16 * row + 2 * col + 1]
+        v = [z[i] for i in idx]
+        permute(v)
+        for i, w in zip(idx, v):
+            z[i] = w
+    return [a ^ b for a, b in zip(z, r)]
+
+
+def argon2d(password, salt, time, memory, lanes, size, secret=b"", data=b""):
+    def u32(n):
+        return struct.pack("<I", n)
+
+    h0 = hashlib.blake2b(
+        u32(lanes) + u32(size) + u32(memory) + u32(time) + u32(0x13) + u32(0)
+        + u32(len(password)) + password + u32(len(salt)) + salt
+        + u32(len(secret)) + secret + u32(len(data)) + data).digest()
+    memory = max(memory, 8 * lanes) // (4 * lanes) * (4 * lanes)
+    columns = memory // lanes
+    segment = columns // 4
+
+    def words(b):
+        return list(struct.unpack("<128Q", b))
+
+    blocks = [[None] * columns for _ in range(lanes)]
+    for lane in range(lanes):
+        for j in range(2):
+            blocks[lane][j] = words(blake2b_long(1024, h0 + u32(j) + u32(lane)))
+
+    for p in range(time):
+        for s in range(4):
+            for lane in range(lanes):
+                for index in range(segment):
+                    j = s * segment + index
+                    if p == 0 and j < 2:
+                        continue
+                    prev = blocks[lane][j - 1 if j > 0 else columns - 1]
+                    j1, j2 = prev[0] & 0xFFFFFFFF, prev[0] >> 32
+                    ref_lane = lane if p == 0 and s == 0 else j2 % lanes
+                    same = ref_lane == lane
+                    if p == 0:
+                        area = s * segment + index - 1 if same else s * segment - (1 if index == 0 else 0)
+                        start = 0
+                    else:
+                        area = 3 * segment + index - 1 if same else 3 * segment - (1 if index == 0 else 0)
+                        start = (s + 1) * segment % columns
+                    x = (j1 * j1) >> 32
+                    y = (area * x) >> 32
+                    ref = blocks[ref_lane][(start + area - 1 - y) % columns]
+                    new = compress(prev, ref)
+                    if p > 0:
+                        new = [a ^ b for a, b in zip(new, blocks[lane][j])]
+                    blocks[lane][j] = new
+
+    final = blocks[0][columns - 1]
+    for lane in range(1, lanes):
+        final = [a ^ b for a, b in zip(final, blocks[lane][columns - 1])]
+    return blake2b_long(size, struct.pack("<128Q", *final))
+
+
+# Salsa20 and ChaCha20 (RFC 8439)
+
+def rotl32(v, n):
+    return ((v << n) & 0xFFFFFFFF) | (v >> (32 - n))
+
+
+def salsa20_block(key, nonce, counter):
+    c = [0x61707865, 0x3320646E, 0x79622D32, 0x6B206574]
+    k = struct.unpack("<8I", key)
+    n = struct.unpack("<2I", nonce)
+    s = [c[0], *k[:4], c[1], *n, counter & 0xFFFFFFFF, counter >> 32, c[2], *k[4:], c[3]]
+    x = list(s)
+
+    def qr(a, b, c, d):
+        x[b] ^= rotl32((x[a] + x[d]) & 0xFFFFFFFF, 7)
+        x[c] ^= rotl32((x[b] + x[a]) & 0xFFFFFFFF, 9)
+        x[d] ^= rotl32((x[c] + x[b]) & 0xFFFFFFFF, 13)
+        x[a] ^= rotl32((x[d] + x[c]) & 0xFFFFFFFF, 18)
+
+    for _ in range(10):
+        qr(0, 4, 8, 12)
+        qr(5, 9, 13, 1)
+        qr(10, 14, 2, 6)
+        qr(15, 3, 7, 11)
+        qr(0, 1, 2, 3)
+        qr(5, 6, 7, 4)
+        qr(10, 11, 8, 9)
+        qr(15, 12, 13, 14)
+    return struct.pack("<16I", *[(a + b) & 0xFFFFFFFF for a, b in zip(x, s)])
+
+
+def chacha20_block(key, nonce, counter):
+    s = [0x61707865, 0x3320646E, 0x79622D32, 0x6B206574, *struct.unpack("<8I", key),
+         counter, *struct.unpack("<3I", nonce)]
+    x = list(s)
+
+    def qr(a, b, c, d):
+        x[a] = (x[a] + x[b]) & 0xFFFFFFFF
+        x[d] = rotl32(x[d] ^ x[a], 16)
+        x[c] = (x[c] + x[d]) & 0xFFFFFFFF
+        x[b] = rotl32(x[b] ^ x[c], 12)
+        x[a] = (x[a] + x[b]) & 0xFFFFFFFF
+        x[d] = rotl32(x[d] ^ x[a], 8)
+        x[c] = (x[c] + x[d]) & 0xFFFFFFFF
+        x[b] = rotl32(x[b] ^ x[c], 7)
+
+    for _ in range(10):
+        qr(0, 4, 8, 12)
+        qr(1, 5, 9, 13)
+        qr(2, 6, 10, 14)
+        qr(3, 7, 11, 15)
+        qr(0, 5, 10, 15)
+        qr(1, 6, 11, 12)
+        qr(2, 7, 8, 13)
+        qr(3, 4, 9, 14)
+    return struct.pack("<16I", *[(a + b) & 0xFFFFFFFF for a, b in zip(x, s)])
+
+
+class KeyStream:
+    def __init__(self, block):
+        self.block = block
+        self.counter = 0
+        self.buffer = b""
+
+    def xor(self, data):
+        while len(self.buffer) < len(data):
+            self.buffer += self.block(self.counter)
+            self.counter += 1
+        out = bytes(a ^ b for a, b in zip(data, self.buffer))
+        self.buffer = self.buffer[len(data):]
+        return out
+
+
+def check_primitives():
+    # RFC 9106 section 5.1
+    tag = argon2d(b"\x01" * 32, b"\x02" * 16, 3, 32, 4, 32, b"\x03" * 8, b"\x04" * 12)
+    assert tag.hex() == "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"
+    # RFC 8439 section 2.3.2
+    block = chacha20_block(bytes(range(32)), bytes.fromhex("000000090000004a00000000"), 1)
+    assert block[:8].hex() == "10f1e7e4d13b5915"
+    # Salsa20 paper section 10: key 1..32, nonce 3..10, counter 7 + 8 << 32
+    key = bytes(range(1, 17)) + bytes(range(201, 217))
+    block = salsa20_block(key, bytes(range(101, 109)), int.from_bytes(bytes(range(109, 117)), "little"))
+    assert list(block[:4]) == [69, 37, 68, 39]
+
+
+# The database
+
+def xml_document(protect, header_hash=None):
+    def value(text):
+        return "<Value Protected=\"True\">%s</Value>" % base64.b64encode(protect(text.encode())).decode()
+
+    meta_hash = ""
+    if header_hash is not None:
+        meta_hash = "<HeaderHash>%s</HeaderHash>" % base64.b64encode(header_hash).decode()
+    return ("""<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+\t<Meta>
+\t\t<Generator>kdbx.py</Generator>%s
+\t\t<DatabaseName>Fixture</DatabaseName>
+\t\t<RecycleBinEnabled>True</RecycleBinEnabled>
+\t\t<RecycleBinUUID>AAAAAAAAAAAAAAAAAAAAAQ==</RecycleBinUUID>
+\t</Meta>
+\t<Root>
+\t\t<Group>
+\t\t\t<UUID>AAAAAAAAAAAAAAAAAAAAAA==</UUID>
+\t\t\t<Name>Fixture</Name>
+\t\t\t<Entry>
+\t\t\t\t<String><Key>Title</Key><Value>Bank</Value></String>
+\t\t\t\t<String><Key>UserName</Key><Value>alice</Value></String>
+\t\t\t\t<String><Key>Password</Key>%s</String>
+\t\t\t\t<String><Key>URL</Key><Value>https://bank.example</Value></String>
+\t\t\t\t<String><Key>Notes</Key><Value>Line 1
+Line 2 &amp; more</Value></String>
+\t\t\t\t<String><Key>PIN</Key>%s</String>
+\t\t\t\t<String><Key>Branch</Key><Value>Main Street</Value></String>
+\t\t\t\t<History>
+\t\t\t\t\t<Entry>
+\t\t\t\t\t\t<String><Key>Title</Key><Value>Bank</Value></String>
+\t\t\t\t\t\t<String><Key>Password</Key>%s</String>
+\t\t\t\t\t</Entry>
+\t\t\t\t</History>
+\t\t\t</Entry>
+\t\t\t<Group>
+\t\t\t\t<UUID>AAAAAAAAAAAAAAAAAAAAAg==</UUID>
+\t\t\t\t<Name>Email</Name>
+\t\t\t\t<Entry>
+\t\t\t\t\t<String><Key>Title</Key><Value>Work Mail</Value></String>
+\t\t\t\t\t<String><Key>UserName</Key><Value>alice@example.com</Value></String>
+\t\t\t\t\t<String><Key>Password</Key>%s</String>
+\t\t\t\t</Entry>
+\t\t\t</Group>
+\t\t\t<Group>
+\t\t\t\t<UUID>AAAAAAAAAAAAAAAAAAAAAQ==</UUID>
+\t\t\t\t<Name>Recycle Bin</Name>
+\t\t\t\t<Entry>
+\t\t\t\t\t<String><Key>Title</Key><Value>Deleted</Value></String>
+\t\t\t\t\t<String><Key>Password</Key>%s</String>
+\t\t\t\t</Entry>
+\t\t\t</Group>
+\t\t</Group>
+\t</Root>
+</KeePassFile>
+""" % (meta_hash, value("correct horse"), value("1234"), value("old password"),
+       value("hunter2 éè"), value("gone"))).encode()
+
+
+def composite_key(password, key_file=None):
+    parts = hashlib.sha256(password).digest()
+    if key_file is not None:
+        parts += key_file
+    return hashlib.sha256(parts).digest()
+
+
+def aes_kdf(composite, seed, rounds):
+    key = composite
+    for _ in range(rounds):
+        key = aes("aes-256-ecb", seed, key)
+    return hashlib.sha256(key).digest()
+
+
+def write_kdbx3(path, password):
+    master_seed = bytes(range(0x10, 0x30))
+    transform_seed = bytes(range(0x30, 0x50))
+    rounds = 1000
+    iv = bytes(range(0x50, 0x60))
+    stream_key = bytes(range(0x60, 0x80))
+    stream_start = bytes(range(0x80, 0xA0))
+
+    def field(id, value):
+        return struct.pack("<BH", id, len(value)) + value
+
+    header = struct.pack("<III", 0x9AA2D903, 0xB54BFB67, 0x00030001)
+    header += field(2, bytes.fromhex("31c1f2e6bf714350be5805216afc5aff"))
+    header += field(3, struct.pack("<I", 1))
+    header += field(4, master_seed)
+    header += field(5, transform_seed)
+    header += field(6, struct.pack("<Q", rounds))
+    header += field(7, iv)
+    header += field(8, stream_key)
+    header += field(9, stream_start)
+    header += field(10, struct.pack("<I", 2))
+    header += field(0, b"\r\n\r\n")
+
+    salsa_key = hashlib.sha256(stream_key).digest()
+    nonce = bytes.fromhex("e830094b97205d2a")
+    stream = KeyStream(lambda counter: salsa20_block(salsa_key, nonce, counter))
+    document = gzip.compress(xml_document(stream.xor, hashlib.sha256(header).digest()), mtime=0)
+
+    # Small blocks so the payload spans several
+    payload = stream_start
+    for index, start in enumerate(range(0, len(document), 256)):
+        chunk = document[start:start + 256]
+        payload += struct.pack("<I", index) + hashlib.sha256(chunk).digest() + struct.pack("<I", len(chunk)) + chunk
+    payload += struct.pack("<I", index + 1) + bytes(32) + struct.pack("<I", 0)
+
+    transformed = aes_kdf(composite_key(password), transform_seed, rounds)
+    master_key = hashlib.sha256(master_seed + transformed).digest()
+    padding = 16 - len(payload) % 16
+    payload += bytes([padding]) * padding
+    with open(path, "wb") as f:
+        f.write(header + aes("aes-256-cbc", master_key, payload, iv))
+
+
+def write_kdbx4(path, password, key_file):
+    master_seed = bytes(range(0xA0, 0xC0))
+    salt = bytes(range(0xC0, 0xE0))
+    iv = bytes(range(0xE0, 0xEC))
+    stream_key = bytes(range(0x00, 0x40))
+    time, memory, lanes = 2, 64 * 1024, 2
+
+    def variant(type, name, value):
+        return struct.pack("<BI", type, len(name)) + name + struct.pack("<I", len(value)) + value
+
+    kdf = b"\x00\x01"
+    kdf += variant(0x42, b"$UUID", bytes.fromhex("ef636ddf8c29444b91f7a9a403e30a0c"))
+    kdf += variant(0x42, b"S", salt)
+    kdf += variant(0x05, b"I", struct.pack("<Q", time))
+    kdf += variant(0x05, b"M", struct.pack("<Q", memory))
+    kdf += variant(0x04, b"P", struct.pack("<I", lanes))
+    kdf += variant(0x04, b"V", struct.pack("<I", 0x13))
+    kdf += b"\x00"
+
+    def field(id, value):
+        return struct.pack("<BI", id, len(value)) + value
+
+    header = struct.pack("<III", 0x9AA2D903, 0xB54BFB67, 0x00040000)
+    header += field(2, bytes.fromhex("d6038a2b8b6f4cb5a524339a31dbb59a"))
+    header += field(3, struct.pack("<I", 1))
+    header += field(4, master_seed)
+    header += field(7, iv)
+    header += field(11, kdf)
+    header += field(0, b"\r\n\r\n")
+
+    transformed = argon2d(composite_key(password, key_file), salt, time, memory // 1024, lanes, 32)
+    master_key = hashlib.sha256(master_seed + transformed).digest()
+    hmac_base = hashlib.sha512(master_seed + transformed + b"\x01").digest()
+
+    def block_mac(index, data):
+        index = struct.pack("<Q", index)
+        key = hashlib.sha512(index + hmac_base).digest()
+        return hmac.new(key, index + data, hashlib.sha256).digest()
+
+    inner_key = hashlib.sha512(stream_key).digest()
+    stream = KeyStream(lambda counter: chacha20_block(inner_key[:32], inner_key[32:44], counter))
+    inner = field(1, struct.pack("<I", 3)) + field(2, stream_key)
+    # An attachment, which is skipped
+    inner += field(3, b"\x01attachment")
+    inner += field(0, b"")
+    payload = gzip.compress(inner + xml_document(stream.xor), mtime=0)
+
+    cipher = KeyStream(lambda counter: chacha20_block(master_key, iv, counter))
+    encrypted = cipher.xor(payload)
+
+    body = hashlib.sha256(header).digest() + block_mac(MASK64, header)
+    index = 0
+    for start in range(0, len(encrypted), 256):
+        chunk = struct.pack("<i", len(encrypted[start:start + 256])) + encrypted[start:start + 256]
+        body += block_mac(index, chunk) + chunk
+        index += 1
+    body += block_mac(index, struct.pack("<i", 0)) + struct.pack("<i", 0)
+    with open(path, "wb") as f:
+        f.write(header + body)
+
+
+KEY_FILE = bytes(range(0x40, 0x60))
+
+if __name__ == "__main__":
+    check_primitives()
+    write_kdbx3("keepass3.kdbx", b"fixture password")
+    groups = " ".join(KEY_FILE.hex().upper()[i:i + 8] for i in range(0, 64, 8))
+    with open("keepass4.keyx", "w") as f:
+        f.write("""<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+\t<Meta>
+\t\t<Version>2.0</Version>
+\t</Meta>
+\t<Key>
+\t\t<Data Hash="%s">
+\t\t\t%s
+\t\t</Data>
+\t</Key>
+</KeyFile>
+""" % (hashlib.sha256(KEY_FILE).digest()[:4].hex().upper(), groups))
+    write_kdbx4("keepass4.kdbx", b"fixture password", KEY_FILE)
@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"errors"
+	"sort"
 )
 
 // FindGroupByPath finds a group by its path (list of group IDs)
@@ -130,8 +131,67 @@ func TraverseBackward(wallet *Wallet, callback func(info PathInfo) bool) {
 	}
 }
 
+// sortTreeOrder sorts entries found through the index into the order
+// TraverseForward visits them
+func sortTreeOrder(wallet *Wallet, entries []PathInfo) {
+	positions := make(map[string][]int, len(entries))
+	for _, info := range entries {
+		positions[info.Path.EntryID] = treePosition(wallet, info.Path)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := positions[entries[i].Path.EntryID], positions[entries[j].Path.EntryID]
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+}
+
+// treePosition returns the index of each group on the path among its
+// siblings, followed by the index of the entry. The entry index is counted
+// back from the end of the group's entries, so it is negative and sorts an
+// entry before the subgroups of its group, as TraverseForward visits them.
+func treePosition(wallet *Wallet, path Path) []int {
+	position := make([]int, 0, len(path.GroupIDs)+1)
+	groups := wallet.Groups
+	var group *Group
+	for _, id := range path.GroupIDs {
+		group = nil
+		for i := range groups {
+			if groups[i].ID == id {
+				group = &groups[i]
+				position = append(position, i)
+				break
+			}
+		}
+		if group == nil {
+			return position
+		}
+		groups = group.Groups
+	}
+	if group != nil {
+		for i := range group.Entries {
+			if group.Entries[i].ID == path.EntryID {
+				position = append(position, i-len(group.Entries))
+				break
+			}
+		}
+	}
+	return position
+}
+
 // GetPathToGroup returns the path to a group by its ID
 func GetPathToGroup(wallet *Wallet, targetGroupID string) (Path, error) {
+	if wallet.index != nil {
+		path, ok := wallet.index.groupPaths[targetGroupID]
+		if !ok {
+			return Path{}, errors.New("group not found")
+		}
+		return copyPath(path), nil
+	}
+
 	var foundPath Path
 	found := false
 
@@ -168,6 +228,14 @@ func GetPathToGroup(wallet *Wallet, targetGroupID string) (Path, error) {
 
 // GetPathToEntry returns the path to an entry by its ID
 func GetPathToEntry(wallet *Wallet, targetEntryID string) (Path, error) {
+	if wallet.index != nil {
+		path, ok := wallet.index.entryPaths[targetEntryID]
+		if !ok {
+			return Path{}, errors.New("entry not found")
+		}
+		return copyPath(path), nil
+	}
+
 	var foundPath Path
 	found := false
 
@@ -218,6 +286,14 @@ func GetParentPath(path Path) Path {
 	}
 }
 
+// copyPath returns a copy of the path that does not share its GroupIDs slice
+func copyPath(path Path) Path {
+	return Path{
+		GroupIDs: append([]string{}, path.GroupIDs...),
+		EntryID:  path.EntryID,
+	}
+}
+
 // GetRootGroups returns all root-level groups
 func GetRootGroups(wallet *Wallet) []Group {
 	return wallet.Groups
@@ -1,53 +1,769 @@
 package pkg
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"strings"
 )
 
 // WalletService provides high-level operations on the wallet
 type WalletService struct {
 	wallet   *Wallet
+	storage  Storage
 	filepath string
-	password string
+	// secret is the password, recovery key, combined shares or identities
+	// pending for the next Load. It is wiped once the data key has been unwrapped.
+	secret     *SecureBuffer
+	secretType SlotType
+	// recoveryKey is the recovery key generated by CreateNew until it is
+	// taken with TakeRecoveryKey
+	recoveryKey string
+	// keyFile is the digest of the keyfile, if the wallet uses one. It is
+	// kept while unlocked so the password can be changed.
+	keyFile *SecureBuffer
+	// key is the random data key the wallet is encrypted with
+	key *SecureBuffer
+	// header holds the key slots that wrap the data key
+	header WalletHeader
+	// slotID is the slot the wallet was unlocked with
+	slotID string
+	// fieldKey seals the values of sensitive fields in memory. It is random
+	// for every unlock and never stored.
+	fieldKey *SecureBuffer
+	// stored holds the fingerprints of the files of a sync directory as
+	// they were last read or written
+	stored map[string][]byte
+	// storageLocked is set while LockStorage holds the storage lock
+	storageLocked bool
+	// digest is the storedDigest of the wallet as Refresh last loaded or
+	// Save last wrote it, nil if it may have changed since
+	digest []byte
 }
 
-// NewWalletService creates a new wallet service instance
+// NewWalletService creates a new wallet service instance for a wallet on
+// the local filesystem
 func NewWalletService(filepath string, password string) *WalletService {
+	return NewWalletServiceWithStorage(FileStorage{}, filepath, password)
+}
+
+// NewWalletServiceWithStorage creates a new wallet service instance for a
+// wallet at the name in the storage
+func NewWalletServiceWithStorage(storage Storage, filepath string, password string) *WalletService {
 	return &WalletService{
-		filepath: filepath,
-		password: password,
+		storage:    storage,
+		filepath:   filepath,
+		secret:     NewSecureBufferFrom([]byte(password)),
+		secretType: SlotTypePassword,
 	}
 }
 
-// Load loads the wallet from the file
+// SetKeyFile sets the keyfile combined with the password by the next
+// CreateNew, Load or Unlock. It has to be set again after Lock.
+func (ws *WalletService) SetKeyFile(path string) error {
+	keyFile, err := ReadKeyFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading keyfile: %v", err)
+	}
+	ws.keyFile.Destroy()
+	ws.keyFile = keyFile
+	return nil
+}
+
+// Load loads the wallet from the file. The data key is unwrapped with the
+// password on the first load, after which the password is wiped. Wallets in
+// an older format are moved to key slots and written that way on Save.
 func (ws *WalletService) Load() error {
-	wallet, err := LoadWallet(ws.filepath, ws.password)
+	encrypted, err := readWalletFile(ws.storage, ws.filepath)
+	if err != nil {
+		return err
+	}
+	header, _, err := parseWalletHeader(encrypted)
 	if err != nil {
 		return err
 	}
+
+	key, slotID := ws.key, ws.slotID
+	switch {
+	case ws.secret != nil:
+		key, slotID, err = ws.openHeader(header)
+		if err != nil {
+			return err
+		}
+	case key == nil:
+		return errors.New("wallet is locked")
+	case header.Version != currentFormatVersion:
+		return errors.New("wallet file was re-encrypted, unlock it again")
+	}
+
+	var wallet *Wallet
+	if isSyncDir(ws.storage, ws.filepath) {
+		wallet, err = readSyncDir(ws.storage, ws.filepath, encrypted, key.Bytes())
+	} else {
+		wallet, err = decryptWallet(encrypted, func(encrypted []byte) ([]byte, error) {
+			return decryptWithKey(encrypted, key.Bytes())
+		})
+	}
+	if err != nil {
+		if key != ws.key {
+			key.Destroy()
+		}
+		if ws.secret == nil {
+			return errors.New("wallet file was re-encrypted, unlock it again")
+		}
+		return err
+	}
+
+	if header.Version != currentFormatVersion {
+		passwordKey := key
+		header, key, slotID, err = upgradeHeader(header, passwordKey)
+		passwordKey.Destroy()
+		if err != nil {
+			return err
+		}
+	}
+
+	ws.setKey(key, header, slotID)
+	if err := ws.setWallet(wallet); err != nil {
+		return err
+	}
+	ws.digest = nil
+	return ws.rememberSyncDir()
+}
+
+// setWallet seals the sensitive fields of the wallet, creating the field key
+// if needed, and indexes it. Until the garbage collector runs, the decoded
+// plaintext values remain in memory as unreachable Go strings.
+func (ws *WalletService) setWallet(wallet *Wallet) error {
+	if ws.fieldKey == nil {
+		fieldKey, err := newDataKey()
+		if err != nil {
+			return err
+		}
+		ws.fieldKey = fieldKey
+	}
+	if err := sealGroups(wallet.Groups, ws.fieldKey.Bytes()); err != nil {
+		return err
+	}
+	wallet.index = buildIndex(wallet)
 	ws.wallet = wallet
 	return nil
 }
 
-// Save saves the wallet to the file
+// openHeader returns the key that decrypts a file with the header using the
+// pending secret, and the slot that was used
+func (ws *WalletService) openHeader(header WalletHeader) (*SecureBuffer, string, error) {
+	if header.Version != currentFormatVersion {
+		if ws.secretType != SlotTypePassword {
+			return nil, "", fmt.Errorf("wallet has no %s slot", ws.secretType)
+		}
+		key, err := deriveWalletKey(ws.secret.Bytes(), ws.keyFile, header)
+		return key, "", err
+	}
+
+	switch ws.secretType {
+	case SlotTypeRecovery:
+		return openRecoverySlots(header.Slots, ws.secret)
+	case SlotTypeShamir:
+		return openShamirSlots(header.Slots, ws.secret)
+	case SlotTypeRecipient:
+		return openRecipientSlots(header.Slots, ws.secret)
+	default:
+		return openPasswordSlots(header.Slots, ws.secret.Bytes(), ws.keyFile)
+	}
+}
+
+// Save saves the wallet to the file, or to the sync directory
 func (ws *WalletService) Save() error {
+	unlock, err := ws.lockStorage()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return ws.save()
+}
+
+// save saves the wallet while the storage is locked
+func (ws *WalletService) save() error {
 	if ws.wallet == nil {
 		return errors.New("wallet not loaded")
 	}
-	return SaveWallet(ws.wallet, ws.filepath, ws.password)
+	if ws.key == nil {
+		return errors.New("wallet is locked")
+	}
+	groups, err := openedGroups(ws.wallet.Groups, ws.fieldKey.Bytes())
+	if err != nil {
+		return err
+	}
+	wallet := &Wallet{Version: ws.wallet.Version, Groups: groups}
+	if isSyncDir(ws.storage, ws.filepath) {
+		err = ws.saveSyncDir(wallet)
+	} else {
+		err = saveWalletWith(ws.storage, wallet, ws.filepath, func(jsonData []byte) ([]byte, error) {
+			return encryptWithKey(jsonData, ws.key.Bytes(), ws.header)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	ws.rememberDigest()
+	return nil
+}
+
+// LockStorage takes the storage lock of the wallet until the returned
+// function is called, so that other programs cannot write the wallet
+// between a Refresh and the next Save. Writes made meanwhile use the lock
+// that is held.
+func (ws *WalletService) LockStorage() (func() error, error) {
+	if ws.storageLocked {
+		return nil, errors.New("storage is already locked")
+	}
+	unlock, err := ws.storage.Lock(ws.filepath)
+	if err != nil {
+		return nil, err
+	}
+	ws.storageLocked = true
+	return func() error {
+		ws.storageLocked = false
+		return unlock()
+	}, nil
+}
+
+// lockStorage takes the storage lock for a write, unless LockStorage holds it
+func (ws *WalletService) lockStorage() (func() error, error) {
+	if ws.storageLocked {
+		return func() error { return nil }, nil
+	}
+	return ws.storage.Lock(ws.filepath)
+}
+
+// Refresh loads the wallet again if the stored wallet differs from what
+// was last loaded or saved, because another program wrote it. It reports
+// whether the wallet was loaded. It should be called with LockStorage held,
+// or the wallet may change again before the next Save.
+func (ws *WalletService) Refresh() (bool, error) {
+	digest, err := storedDigest(ws.storage, ws.filepath)
+	if err != nil {
+		return false, err
+	}
+	if ws.digest != nil && bytes.Equal(digest, ws.digest) {
+		return false, nil
+	}
+	if err := ws.Load(); err != nil {
+		return false, err
+	}
+	ws.digest = digest
+	return true, nil
+}
+
+// rememberDigest records the digest of the wallet just written for Refresh.
+// Without the storage lock another program may already have written it
+// again, so the digest is forgotten and the next Refresh loads the wallet.
+func (ws *WalletService) rememberDigest() {
+	ws.digest = nil
+	if ws.storageLocked {
+		ws.digest, _ = storedDigest(ws.storage, ws.filepath)
+	}
 }
 
-// CreateNew creates a new wallet and saves it
+// CreateNew creates a new wallet and saves it. The password, and the keyfile
+// if one has been set, unlock it through the first key slot. A recovery key
+// is generated for the second slot, see TakeRecoveryKey.
 func (ws *WalletService) CreateNew() error {
-	ws.wallet = CreateNewWallet()
+	if ws.secret == nil || ws.secretType != SlotTypePassword {
+		return errors.New("no password set")
+	}
+	key, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	slot, err := newPasswordSlot(generateUniqueID("slot"), "Master password", ws.secret.Bytes(), ws.keyFile, key)
+	if err != nil {
+		key.Destroy()
+		return err
+	}
+
+	recoveryKey, formatted, err := newRecoveryKey()
+	if err != nil {
+		key.Destroy()
+		return err
+	}
+	recoverySlot, err := newRecoverySlot(generateUniqueID("slot"), recoveryKey, key)
+	recoveryKey.Destroy()
+	if err != nil {
+		key.Destroy()
+		return err
+	}
+
+	ws.recoveryKey = formatted
+	return ws.create(key, []KeySlot{slot, recoverySlot}, slot.ID)
+}
+
+// CreateNewForRecipients creates a new wallet that has no password and
+// saves it. Every recipient gets a key slot, so the identity file of any of
+// them unlocks the wallet. No recovery key is generated.
+func (ws *WalletService) CreateNewForRecipients(recipients []string) error {
+	if len(recipients) == 0 {
+		return errors.New("no recipients given")
+	}
+	key, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	slots, err := newRecipientSlots(recipients, key)
+	if err != nil {
+		key.Destroy()
+		return err
+	}
+	return ws.create(key, slots, "")
+}
+
+// create saves a new, empty wallet encrypted with the data key, which the
+// slots wrap. slotID is the slot it counts as unlocked with.
+func (ws *WalletService) create(key *SecureBuffer, slots []KeySlot, slotID string) error {
+	ws.setKey(key, WalletHeader{Version: currentFormatVersion, Slots: slots}, slotID)
+	if err := ws.setWallet(CreateNewWallet()); err != nil {
+		return err
+	}
 	return ws.Save()
 }
 
+// UsesKeyFile reports whether the slot the wallet was unlocked with requires a keyfile
+func (ws *WalletService) UsesKeyFile() bool {
+	if i := findSlot(ws.header.Slots, ws.slotID); i >= 0 {
+		return ws.header.Slots[i].KeyFile
+	}
+	return false
+}
+
+// ChangePassword re-wraps the data key in the slot the wallet was unlocked
+// with, using a key derived from the new password and a fresh salt. This is
+// the only time a key is derived again after unlocking. A keyfile stays
+// required if the slot uses one.
+func (ws *WalletService) ChangePassword(currentPassword string, newPassword string) error {
+	if ws.wallet == nil || ws.key == nil {
+		return errors.New("wallet is locked")
+	}
+	if newPassword == "" {
+		return errors.New("password cannot be empty")
+	}
+	i := findSlot(ws.header.Slots, ws.slotID)
+	if i < 0 || ws.header.Slots[i].Type != SlotTypePassword {
+		return errors.New("wallet was not unlocked with a password, add a password slot instead")
+	}
+	slot := ws.header.Slots[i]
+
+	current := []byte(currentPassword)
+	currentKey := slot.derivePasswordKey(current, ws.keyFile)
+	Wipe(current)
+	dataKey, err := slot.openDataKey(currentKey.Bytes())
+	currentKey.Destroy()
+	if err != nil {
+		return errors.New("current password is incorrect")
+	}
+	dataKey.Destroy()
+
+	password := []byte(newPassword)
+	replacement, err := newPasswordSlot(slot.ID, slot.Label, password, ws.keyFile, ws.key)
+	Wipe(password)
+	if err != nil {
+		return err
+	}
+	replacement.Created = slot.Created
+
+	return ws.updateSlots(func(slots []KeySlot) []KeySlot {
+		slots[i] = replacement
+		return slots
+	})
+}
+
+// TakeRecoveryKey returns the recovery key generated by CreateNew once, so it
+// can be shown to the user, and forgets it
+func (ws *WalletService) TakeRecoveryKey() string {
+	recoveryKey := ws.recoveryKey
+	ws.recoveryKey = ""
+	return recoveryKey
+}
+
+// HasRecoveryKey reports whether a recovery key can unlock the wallet
+func (ws *WalletService) HasRecoveryKey() bool {
+	for _, slot := range ws.header.Slots {
+		if slot.Type == SlotTypeRecovery {
+			return true
+		}
+	}
+	return false
+}
+
+// RotateRecoveryKey generates a new recovery key and revokes the previous
+// one like RevokeSlot does. The new key is returned to be printed, it is not
+// stored anywhere.
+func (ws *WalletService) RotateRecoveryKey() (string, error) {
+	if ws.key == nil {
+		return "", errors.New("wallet is locked")
+	}
+
+	recoveryKey, formatted, err := newRecoveryKey()
+	if err != nil {
+		return "", err
+	}
+	slot, err := newRecoverySlot(generateUniqueID("slot"), recoveryKey, ws.key)
+	recoveryKey.Destroy()
+	if err != nil {
+		return "", err
+	}
+
+	current := findSlot(ws.header.Slots, ws.slotID)
+	unlockedWithRecovery := current >= 0 && ws.header.Slots[current].Type == SlotTypeRecovery
+
+	if err := ws.updateSlots(func(slots []KeySlot) []KeySlot {
+		var kept []KeySlot
+		for _, existing := range slots {
+			if existing.Type != SlotTypeRecovery {
+				kept = append(kept, existing)
+			}
+		}
+		return append(kept, slot)
+	}); err != nil {
+		return "", err
+	}
+	if unlockedWithRecovery {
+		ws.slotID = slot.ID
+	}
+	return formatted, nil
+}
+
+// AddShamirSlot adds a key slot whose secret is split into n shares, any k
+// of which unlock the wallet. The shares are returned to be handed out, they
+// are not stored anywhere.
+func (ws *WalletService) AddShamirSlot(label string, n int, k int) ([]string, error) {
+	if ws.key == nil {
+		return nil, errors.New("wallet is locked")
+	}
+	if strings.TrimSpace(label) == "" {
+		label = fmt.Sprintf("%d of %d shares", k, n)
+	}
+
+	slot, shares, err := newShamirSlot(generateUniqueID("slot"), strings.TrimSpace(label), n, k, ws.key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.updateSlots(func(slots []KeySlot) []KeySlot {
+		return append(slots, slot)
+	}); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// AddRecipientSlot adds a key slot that unlocks the wallet with the
+// identity file of an age1... recipient
+func (ws *WalletService) AddRecipientSlot(label string, recipient string) (KeySlot, error) {
+	if ws.key == nil {
+		return KeySlot{}, errors.New("wallet is locked")
+	}
+	recipient = strings.TrimSpace(recipient)
+	for _, slot := range ws.header.Slots {
+		if slot.Type == SlotTypeRecipient && slot.Recipient == recipient {
+			return KeySlot{}, errors.New("recipient already has a key slot")
+		}
+	}
+	if strings.TrimSpace(label) == "" {
+		label = shortRecipient(recipient)
+	}
+
+	slot, err := newRecipientSlot(generateUniqueID("slot"), strings.TrimSpace(label), recipient, ws.key)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	if err := ws.updateSlots(func(slots []KeySlot) []KeySlot {
+		return append(slots, slot)
+	}); err != nil {
+		return KeySlot{}, err
+	}
+	return slot, nil
+}
+
+// ListSlots returns the key slots that can unlock the wallet
+func (ws *WalletService) ListSlots() []KeySlot {
+	return append([]KeySlot(nil), ws.header.Slots...)
+}
+
+// CurrentSlotID returns the ID of the slot the wallet was unlocked with
+func (ws *WalletService) CurrentSlotID() string {
+	return ws.slotID
+}
+
+// AddPasswordSlot adds a key slot that unlocks the wallet with another
+// password, combined with the keyfile at keyFilePath unless it is empty
+func (ws *WalletService) AddPasswordSlot(label string, password string, keyFilePath string) (KeySlot, error) {
+	if ws.key == nil {
+		return KeySlot{}, errors.New("wallet is locked")
+	}
+	if password == "" {
+		return KeySlot{}, errors.New("password cannot be empty")
+	}
+	if strings.TrimSpace(label) == "" {
+		label = "Password"
+	}
+
+	var keyFile *SecureBuffer
+	if keyFilePath != "" {
+		var err error
+		if keyFile, err = ReadKeyFile(keyFilePath); err != nil {
+			return KeySlot{}, fmt.Errorf("error reading keyfile: %v", err)
+		}
+		defer keyFile.Destroy()
+	}
+
+	passwordBytes := []byte(password)
+	slot, err := newPasswordSlot(generateUniqueID("slot"), strings.TrimSpace(label), passwordBytes, keyFile, ws.key)
+	Wipe(passwordBytes)
+	if err != nil {
+		return KeySlot{}, err
+	}
+
+	if err := ws.updateSlots(func(slots []KeySlot) []KeySlot {
+		return append(slots, slot)
+	}); err != nil {
+		return KeySlot{}, err
+	}
+	return slot, nil
+}
+
+// RevokeSlot removes a key slot so its secret no longer unlocks the wallet.
+// Only the header is written, the wallet is not encrypted again. Whoever
+// opened the slot before may have kept the data key, and copies made before,
+// such as backups, stay readable with the revoked secret; RotateDataKey
+// replaces the data key. The last slot cannot be revoked.
+func (ws *WalletService) RevokeSlot(id string) error {
+	if ws.key == nil {
+		return errors.New("wallet is locked")
+	}
+	i := findSlot(ws.header.Slots, id)
+	if i < 0 {
+		return errors.New("key slot not found")
+	}
+	if len(ws.header.Slots) == 1 {
+		return errors.New("cannot revoke the last key slot")
+	}
+
+	if err := ws.updateSlots(func(slots []KeySlot) []KeySlot {
+		return append(slots[:i], slots[i+1:]...)
+	}); err != nil {
+		return err
+	}
+	if ws.slotID == id {
+		ws.slotID = ""
+	}
+	return nil
+}
+
+// RotateDataKey encrypts the wallet again with a new data key that is
+// wrapped for every key slot, so a data key taken from a copy opened with a
+// revoked slot cannot open later versions. Other programs that have the
+// wallet unlocked have to unlock it again. If saving fails the previous key
+// is restored, but a sync directory may have been written in part, so it
+// keeps the new key to be saved again.
+func (ws *WalletService) RotateDataKey() error {
+	if ws.wallet == nil || ws.key == nil {
+		return errors.New("wallet is locked")
+	}
+
+	key, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	rewrapped := make([]KeySlot, len(ws.header.Slots))
+	for i, slot := range ws.header.Slots {
+		if err := slot.rewrapDataKey(key.Bytes()); err != nil {
+			key.Destroy()
+			return err
+		}
+		rewrapped[i] = slot
+	}
+
+	previousKey, previousSlots, previousStored := ws.key, ws.header.Slots, ws.stored
+	ws.key = key
+	ws.header.Slots = rewrapped
+	// Every file of a sync directory is encrypted again
+	ws.stored = make(map[string][]byte, len(previousStored))
+	for name := range previousStored {
+		ws.stored[name] = nil
+	}
+
+	if err := ws.Save(); err != nil {
+		if isSyncDir(ws.storage, ws.filepath) {
+			previousKey.Destroy()
+			return fmt.Errorf("the wallet was only partly encrypted with the new key, save it again: %v", err)
+		}
+		ws.key, ws.header.Slots, ws.stored = previousKey, previousSlots, previousStored
+		key.Destroy()
+		return err
+	}
+	previousKey.Destroy()
+	return nil
+}
+
+// updateSlots changes the key slots and writes the new header. The slots
+// are restored if writing fails.
+func (ws *WalletService) updateSlots(update func(slots []KeySlot) []KeySlot) error {
+	previous := ws.header.Slots
+	ws.header.Slots = update(append([]KeySlot(nil), previous...))
+	if err := ws.saveHeader(); err != nil {
+		ws.header.Slots = previous
+		return err
+	}
+	return nil
+}
+
+// saveHeader writes the header in front of the encrypted wallet, or the
+// index of a sync directory, without re-encrypting it. If the file is in an
+// older format, not encrypted with the data key or not on the local disk,
+// the whole wallet is saved instead.
+func (ws *WalletService) saveHeader() error {
+	unlock, err := ws.lockStorage()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Reading a shared file could take in changes made by someone else,
+	// which the next save would then overwrite
+	if _, local := ws.storage.(FileStorage); local {
+		encrypted, err := readWalletFile(ws.storage, ws.filepath)
+		if err == nil {
+			header, size, err := parseWalletHeader(encrypted)
+			if err == nil && header.Version == currentFormatVersion {
+				if plaintext, err := decryptWithKey(encrypted, ws.key.Bytes()); err == nil {
+					Wipe(plaintext)
+					updated := append(ws.header.bytes(ws.key.Bytes()), encrypted[size:]...)
+					if err := ws.storage.WriteFile(storageFile(ws.storage, ws.filepath), updated); err != nil {
+						return err
+					}
+					ws.rememberDigest()
+					return nil
+				}
+			}
+		}
+	}
+
+	// The header is written with the index even if the groups are unchanged
+	delete(ws.stored, syncIndexFile)
+	return ws.save()
+}
+
+// setKey replaces the data key and the header and wipes the pending secret
+func (ws *WalletService) setKey(key *SecureBuffer, header WalletHeader, slotID string) {
+	if ws.key != key {
+		ws.key.Destroy()
+	}
+	ws.key = key
+	ws.header = header
+	ws.slotID = slotID
+	ws.setSecret(nil, "")
+}
+
+// setSecret replaces the secret pending for the next Load
+func (ws *WalletService) setSecret(secret *SecureBuffer, secretType SlotType) {
+	ws.secret.Destroy()
+	ws.secret = secret
+	ws.secretType = secretType
+}
+
+// Close wipes the data key, the field key, the keyfile digest and any
+// pending secret and forgets the decrypted wallet. Unsaved changes are
+// lost. Field values are Go strings that cannot be overwritten, they are
+// released to the garbage collector.
+func (ws *WalletService) Close() {
+	ws.key.Destroy()
+	ws.key = nil
+	ws.keyFile.Destroy()
+	ws.keyFile = nil
+	ws.setSecret(nil, "")
+	ws.recoveryKey = ""
+	ws.header = WalletHeader{}
+	ws.slotID = ""
+	ws.fieldKey.Destroy()
+	ws.fieldKey = nil
+	ws.stored = nil
+	ws.digest = nil
+	ws.wallet = nil
+}
+
+// Lock forgets the decrypted wallet and the data key. Unsaved changes are lost.
+func (ws *WalletService) Lock() {
+	ws.Close()
+}
+
+// Unlock loads the wallet again with the given password after Lock. Wallets
+// that use a keyfile need SetKeyFile first.
+func (ws *WalletService) Unlock(password string) error {
+	return ws.unlockWith(NewSecureBufferFrom([]byte(password)), SlotTypePassword)
+}
+
+// UnlockWithRecoveryKey loads the wallet with the recovery key instead of a
+// password. A new password slot should be added afterwards.
+func (ws *WalletService) UnlockWithRecoveryKey(recoveryKey string) error {
+	recovery, err := parseRecoveryKey(recoveryKey)
+	if err != nil {
+		return err
+	}
+	return ws.unlockWith(recovery, SlotTypeRecovery)
+}
+
+// UnlockWithShares loads the wallet with at least the threshold number of
+// shares of a key split with AddShamirSlot
+func (ws *WalletService) UnlockWithShares(shares []string) error {
+	secret, err := combineKeyShares(shares)
+	if err != nil {
+		return err
+	}
+	return ws.unlockWith(secret, SlotTypeShamir)
+}
+
+// UnlockWithIdentityFile loads the wallet with an age identity file whose
+// recipient has a key slot
+func (ws *WalletService) UnlockWithIdentityFile(path string) error {
+	identities, err := ReadIdentityFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading identity file: %v", err)
+	}
+	return ws.unlockWith(identities, SlotTypeRecipient)
+}
+
+// unlockWith loads the wallet with the secret and wipes it if that fails
+func (ws *WalletService) unlockWith(secret *SecureBuffer, secretType SlotType) error {
+	ws.setSecret(secret, secretType)
+	if err := ws.Load(); err != nil {
+		ws.setSecret(nil, "")
+		return err
+	}
+	return nil
+}
+
+// IsLocked reports whether no decrypted wallet is held in memory
+func (ws *WalletService) IsLocked() bool {
+	return ws.wallet == nil
+}
+
 // GetWallet returns the current wallet
 func (ws *WalletService) GetWallet() *Wallet {
 	return ws.wallet
 }
 
+// FieldValue returns the value of a field, decrypting it if it is sealed.
+// Call it only when the value is shown or copied.
+func (ws *WalletService) FieldValue(field EntryField) (string, error) {
+	return openField(field, ws.fieldKey.Bytes())
+}
+
+// RevealFields returns copies of the fields with their values in plaintext,
+// e.g. to edit an entry. UpdateEntry seals them again.
+func (ws *WalletService) RevealFields(fields []EntryField) ([]EntryField, error) {
+	return openedFields(fields, ws.fieldKey.Bytes())
+}
+
 // AddGroup adds a group at the specified path
 func (ws *WalletService) AddGroup(path Path, group *Group) error {
 	if ws.wallet == nil {
@@ -76,10 +792,14 @@ func (ws *WalletService) AddGroup(path Path, group *Group) error {
 	if group.Entries == nil {
 		group.Entries = []Entry{}
 	}
+	if err := sealGroup(group, ws.fieldKey.Bytes()); err != nil {
+		return err
+	}
 
 	// If path is empty, add to root
 	if len(path.GroupIDs) == 0 {
 		ws.wallet.Groups = append(ws.wallet.Groups, *group)
+		ws.wallet.index.addGroup(group, path)
 		return nil
 	}
 
@@ -90,6 +810,7 @@ func (ws *WalletService) AddGroup(path Path, group *Group) error {
 	}
 
 	parentGroup.Groups = append(parentGroup.Groups, *group)
+	ws.wallet.index.addGroup(group, path)
 	return nil
 }
 
@@ -123,7 +844,11 @@ func (ws *WalletService) AddEntry(path Path, entry *Entry) error {
 		return err
 	}
 
+	if err := sealEntry(entry, ws.fieldKey.Bytes()); err != nil {
+		return err
+	}
 	group.Entries = append(group.Entries, *entry)
+	ws.wallet.index.addEntry(entry, path)
 	return nil
 }
 
@@ -154,6 +879,7 @@ func (ws *WalletService) UpdateGroup(path Path, updatedGroup Group) error {
 				updatedGroup.Groups = ws.wallet.Groups[i].Groups
 				updatedGroup.Entries = ws.wallet.Groups[i].Entries
 				ws.wallet.Groups[i] = updatedGroup
+				ws.wallet.index.setGroupName(targetID, updatedGroup.Name)
 				return nil
 			}
 		}
@@ -171,6 +897,7 @@ func (ws *WalletService) UpdateGroup(path Path, updatedGroup Group) error {
 			updatedGroup.Groups = parentGroup.Groups[i].Groups
 			updatedGroup.Entries = parentGroup.Groups[i].Entries
 			parentGroup.Groups[i] = updatedGroup
+			ws.wallet.index.setGroupName(targetID, updatedGroup.Name)
 			return nil
 		}
 	}
@@ -198,8 +925,12 @@ func (ws *WalletService) UpdateEntry(path Path, updatedEntry Entry) error {
 		return errors.New("entry title already exists")
 	}
 
+	if err := sealEntry(&updatedEntry, ws.fieldKey.Bytes()); err != nil {
+		return err
+	}
 	updatedEntry.ID = entry.ID
 	*entry = updatedEntry
+	ws.wallet.index.updateEntry(entry)
 	return nil
 }
 
@@ -218,6 +949,7 @@ func (ws *WalletService) DeleteGroup(path Path) error {
 		// Delete root-level group
 		for i, group := range ws.wallet.Groups {
 			if group.ID == path.GroupIDs[len(path.GroupIDs)-1] {
+				ws.wallet.index.removeGroup(&ws.wallet.Groups[i])
 				ws.wallet.Groups = append(ws.wallet.Groups[:i], ws.wallet.Groups[i+1:]...)
 				return nil
 			}
@@ -233,6 +965,7 @@ func (ws *WalletService) DeleteGroup(path Path) error {
 	targetID := path.GroupIDs[len(path.GroupIDs)-1]
 	for i, group := range parentGroup.Groups {
 		if group.ID == targetID {
+			ws.wallet.index.removeGroup(&parentGroup.Groups[i])
 			parentGroup.Groups = append(parentGroup.Groups[:i], parentGroup.Groups[i+1:]...)
 			return nil
 		}
@@ -258,6 +991,7 @@ func (ws *WalletService) DeleteEntry(path Path) error {
 
 	for i, entry := range group.Entries {
 		if entry.ID == path.EntryID {
+			ws.wallet.index.removeEntry(entry.ID)
 			group.Entries = append(group.Entries[:i], group.Entries[i+1:]...)
 			return nil
 		}
@@ -319,3 +1053,72 @@ func (ws *WalletService) TraverseBackward(callback func(info PathInfo) bool) {
 	}
 	TraverseBackward(ws.wallet, callback)
 }
+
+// SearchEntries returns all entries whose title, field names or field values
+// contain the search term (case-insensitive), in the order TraverseForward
+// visits them
+func (ws *WalletService) SearchEntries(term string) []PathInfo {
+	if ws.wallet == nil {
+		return nil
+	}
+
+	term = strings.ToLower(term)
+	if term == "" {
+		return nil
+	}
+
+	var results []PathInfo
+	ids, ok := ws.wallet.index.searchCandidates(term)
+	if !ok {
+		// Nothing the index can narrow down, scan every entry
+		TraverseForward(ws.wallet, func(info PathInfo) bool {
+			if info.IsEntry && entryMatches(info.Entry, term) {
+				results = append(results, info)
+			}
+			return true
+		})
+		return results
+	}
+
+	for _, id := range ids {
+		path := ws.wallet.index.entryPaths[id]
+		entry, err := FindEntryByPath(ws.wallet, path)
+		if err != nil || !entryMatches(entry, term) {
+			continue
+		}
+		results = append(results, PathInfo{
+			Path:    copyPath(path),
+			Entry:   entry,
+			Depth:   len(path.GroupIDs) - 1,
+			IsEntry: true,
+		})
+	}
+
+	sortTreeOrder(ws.wallet, results)
+	return results
+}
+
+// ResolvePath resolves a name path such as "Work/AWS/Console" relative to base
+func (ws *WalletService) ResolvePath(base Path, namePath string) (Path, error) {
+	if ws.wallet == nil {
+		return Path{}, errors.New("wallet not loaded")
+	}
+	return ResolveNamePath(ws.wallet, base, namePath)
+}
+
+// ResolveGroupPath resolves a name path that must lead to a group, e.g. for
+// cd, even if an entry has the same name as the last group
+func (ws *WalletService) ResolveGroupPath(base Path, namePath string) (Path, error) {
+	if ws.wallet == nil {
+		return Path{}, errors.New("wallet not loaded")
+	}
+	return ResolveGroupNamePath(ws.wallet, base, namePath)
+}
+
+// FormatPath returns the absolute name path of a group or entry
+func (ws *WalletService) FormatPath(path Path) (string, error) {
+	if ws.wallet == nil {
+		return "", errors.New("wallet not loaded")
+	}
+	return FormatNamePath(ws.wallet, path)
+}
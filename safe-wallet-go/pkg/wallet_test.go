@@ -0,0 +1,33 @@
+package pkg
+
+import "testing"
+
+// newTestWallet creates an empty wallet with the password "password" that
+// is closed when the test ends
+func newTestWallet(t *testing.T) *WalletService {
+	t.Helper()
+	service := NewWalletServiceWithStorage(NewMemoryStorage(), "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(service.Close)
+	return service
+}
+
+// addTestGroup adds the group below the group at parent and returns its path
+func addTestGroup(t *testing.T, service *WalletService, parent Path, group *Group) Path {
+	t.Helper()
+	if err := service.AddGroup(parent, group); err != nil {
+		t.Fatal(err)
+	}
+	return Path{GroupIDs: append(append([]string{}, parent.GroupIDs...), group.ID)}
+}
+
+// addTestEntry adds the entry to the group at path and returns its path
+func addTestEntry(t *testing.T, service *WalletService, path Path, entry *Entry) Path {
+	t.Helper()
+	if err := service.AddEntry(path, entry); err != nil {
+		t.Fatal(err)
+	}
+	return Path{GroupIDs: append([]string{}, path.GroupIDs...), EntryID: entry.ID}
+}
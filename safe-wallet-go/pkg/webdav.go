@@ -0,0 +1,476 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webDAVPropfind asks for the properties Stat and ReadDir need
+const webDAVPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/><d:getetag/></d:prop></d:propfind>`
+
+// WebDAVConfig describes a WebDAV server, e.g. the files of a Nextcloud
+// account at https://cloud.example.com/remote.php/dav/files/alice/
+type WebDAVConfig struct {
+	// URL is the directory wallet names are relative to
+	URL      string
+	Username string
+	// Password is best an app password that can be revoked on the server
+	Password string
+	// CacheDir keeps the last downloaded encrypted files, so the wallet
+	// can be unlocked without a connection. Caching is off if empty.
+	CacheDir string
+	// Client sends the requests. NewWebDAVStorage creates one with a
+	// 30 second timeout if it is nil.
+	Client *http.Client
+}
+
+// WebDAVStorage stores wallets on a WebDAV server. Files are only written
+// if they did not change on the server since they were read, which is
+// checked with their ETags. Lock only keeps this program from writing
+// concurrently, other clients are detected by the ETags.
+type WebDAVStorage struct {
+	config  WebDAVConfig
+	baseURL *url.URL
+	client  *http.Client
+
+	mu      sync.Mutex
+	etags   map[string]string
+	locks   map[string]bool
+	offline bool
+}
+
+// NewWebDAVStorage returns the storage for the WebDAV server
+func NewWebDAVStorage(config WebDAVConfig) (*WebDAVStorage, error) {
+	baseURL, err := url.Parse(strings.TrimSpace(config.URL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebDAV URL: %v", err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, errors.New("the WebDAV URL must start with https:// or http://")
+	}
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if config.CacheDir != "" {
+		if err := os.MkdirAll(config.CacheDir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &WebDAVStorage{
+		config:  config,
+		baseURL: baseURL,
+		client:  client,
+		etags:   make(map[string]string),
+		locks:   make(map[string]bool),
+	}, nil
+}
+
+// Offline reports whether the last request failed to reach the server, so
+// files came from the cache
+func (s *WebDAVStorage) Offline() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offline
+}
+
+func (s *WebDAVStorage) ReadFile(name string) ([]byte, error) {
+	response, err := s.do(http.MethodGet, name, nil, nil)
+	if err != nil {
+		if data, cacheErr := s.readCache(name); cacheErr == nil {
+			return data, nil
+		}
+		return nil, err
+	}
+	defer response.Body.Close()
+	if err := webDAVStatus(response, name, http.StatusOK); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	etag := response.Header.Get("ETag")
+	s.setETag(name, etag)
+	s.writeCache(name, data, etag)
+	return data, nil
+}
+
+// WriteFile uploads the file unless it changed on the server since it was
+// read, or was created there if it has not been read
+func (s *WebDAVStorage) WriteFile(name string, data []byte) error {
+	header := http.Header{}
+	if etag := s.etag(name); etag != "" {
+		header.Set("If-Match", etag)
+	} else {
+		header.Set("If-None-Match", "*")
+	}
+	response, err := s.do(http.MethodPut, name, bytes.NewReader(data), header)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode == http.StatusPreconditionFailed {
+		return ErrRemoteChanged
+	}
+	if err := webDAVStatus(response, name, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+		return err
+	}
+
+	// Servers that do not return the new ETag are asked for it
+	etag := response.Header.Get("ETag")
+	if etag == "" {
+		if info, err := s.propfind(name, "0"); err == nil && len(info) > 0 {
+			etag = info[0].etag
+		}
+	}
+	s.setETag(name, etag)
+	s.writeCache(name, data, etag)
+	return nil
+}
+
+func (s *WebDAVStorage) Stat(name string) (StorageInfo, error) {
+	responses, err := s.propfind(name, "0")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return StorageInfo{}, err
+		}
+		return s.statCache(name, err)
+	}
+	if len(responses) == 0 {
+		return StorageInfo{}, fmt.Errorf("WebDAV server sent no properties for %s", name)
+	}
+	if responses[0].info.IsDir {
+		s.writeCacheDir(name)
+	}
+	return responses[0].info, nil
+}
+
+func (s *WebDAVStorage) ReadDir(name string) ([]string, error) {
+	responses, err := s.propfind(name, "1")
+	if err != nil {
+		return nil, err
+	}
+	self := strings.TrimSuffix(s.url(name).Path, "/")
+	var names []string
+	for _, response := range responses {
+		if response.path != self {
+			names = append(names, path.Base(response.path))
+		}
+	}
+	return names, nil
+}
+
+// Mkdir creates the directory and its parents below the URL
+func (s *WebDAVStorage) Mkdir(name string) error {
+	dir := ""
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Clean(name)), "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		dir = path.Join(dir, part)
+		response, err := s.do("MKCOL", dir, nil, nil)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		// 405 Method Not Allowed means the directory exists
+		if err := webDAVStatus(response, dir, http.StatusCreated, http.StatusMethodNotAllowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove deletes the file unless it changed on the server since it was read
+func (s *WebDAVStorage) Remove(name string) error {
+	header := http.Header{}
+	if etag := s.etag(name); etag != "" {
+		header.Set("If-Match", etag)
+	}
+	response, err := s.do(http.MethodDelete, name, nil, header)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode == http.StatusPreconditionFailed {
+		return ErrRemoteChanged
+	}
+	if err := webDAVStatus(response, name, http.StatusOK, http.StatusNoContent); err != nil {
+		return err
+	}
+	s.setETag(name, "")
+	s.removeCache(name)
+	return nil
+}
+
+func (s *WebDAVStorage) Rename(oldName string, newName string) error {
+	header := http.Header{}
+	header.Set("Destination", s.url(newName).String())
+	header.Set("Overwrite", "T")
+	response, err := s.do("MOVE", oldName, nil, header)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if err := webDAVStatus(response, oldName, http.StatusCreated, http.StatusNoContent); err != nil {
+		return err
+	}
+
+	// The ETags stay with the content
+	s.mu.Lock()
+	oldPrefix := filepath.Clean(oldName) + string(filepath.Separator)
+	for name, etag := range s.etags {
+		switch {
+		case name == filepath.Clean(oldName):
+			delete(s.etags, name)
+			s.etags[filepath.Clean(newName)] = etag
+		case strings.HasPrefix(name, oldPrefix):
+			delete(s.etags, name)
+			s.etags[filepath.Join(newName, name[len(oldPrefix):])] = etag
+		}
+	}
+	s.mu.Unlock()
+	s.renameCache(oldName, newName)
+	return nil
+}
+
+func (s *WebDAVStorage) Lock(name string) (func() error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name = filepath.Clean(name)
+	if s.locks[name] {
+		return nil, fmt.Errorf("wallet %s is already being written", name)
+	}
+	s.locks[name] = true
+	return func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.locks, name)
+		return nil
+	}, nil
+}
+
+// url returns the URL of the name below the configured URL
+func (s *WebDAVStorage) url(name string) *url.URL {
+	u := *s.baseURL
+	u.Path = path.Join("/", u.Path, filepath.ToSlash(name))
+	u.RawPath = ""
+	return &u
+}
+
+// do sends a request and records whether the server was reachable
+func (s *WebDAVStorage) do(method string, name string, body io.Reader, header http.Header) (*http.Response, error) {
+	request, err := http.NewRequest(method, s.url(name).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if s.config.Username != "" || s.config.Password != "" {
+		request.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+	response, err := s.client.Do(request)
+
+	s.mu.Lock()
+	s.offline = err != nil
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach the WebDAV server: %v", err)
+	}
+	return response, nil
+}
+
+// webDAVResponse is a resource listed by PROPFIND
+type webDAVResponse struct {
+	path string
+	info StorageInfo
+	etag string
+}
+
+// propfind returns the properties of the name and, for depth 1, of what
+// is in it
+func (s *WebDAVStorage) propfind(name string, depth string) ([]webDAVResponse, error) {
+	header := http.Header{}
+	header.Set("Depth", depth)
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+	response, err := s.do("PROPFIND", name, strings.NewReader(webDAVPropfind), header)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if err := webDAVStatus(response, name, http.StatusMultiStatus); err != nil {
+		return nil, err
+	}
+
+	var multistatus struct {
+		Responses []struct {
+			Href  string `xml:"DAV: href"`
+			Props []struct {
+				Collection *struct{} `xml:"DAV: resourcetype>collection"`
+				Length     int64     `xml:"DAV: getcontentlength"`
+				Modified   string    `xml:"DAV: getlastmodified"`
+				ETag       string    `xml:"DAV: getetag"`
+			} `xml:"DAV: propstat>prop"`
+		} `xml:"DAV: response"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(response.Body, 16<<20)).Decode(&multistatus); err != nil {
+		return nil, fmt.Errorf("invalid WebDAV response: %v", err)
+	}
+
+	var responses []webDAVResponse
+	for _, r := range multistatus.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		result := webDAVResponse{path: strings.TrimSuffix(href.Path, "/")}
+		for _, prop := range r.Props {
+			result.info.IsDir = result.info.IsDir || prop.Collection != nil
+			if prop.Length > 0 {
+				result.info.Size = prop.Length
+			}
+			if modified, err := http.ParseTime(prop.Modified); err == nil {
+				result.info.ModTime = modified
+			}
+			if prop.ETag != "" {
+				result.etag = prop.ETag
+			}
+		}
+		responses = append(responses, result)
+	}
+	return responses, nil
+}
+
+// webDAVStatus returns an error unless the response has one of the codes.
+// A missing file gives an error that satisfies os.IsNotExist.
+func webDAVStatus(response *http.Response, name string, codes ...int) error {
+	for _, code := range codes {
+		if response.StatusCode == code {
+			return nil
+		}
+	}
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return notExist(response.Request.Method, name)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("WebDAV server refused access to %s, check the username and password", name)
+	default:
+		return fmt.Errorf("WebDAV %s %s: %s", response.Request.Method, name, response.Status)
+	}
+}
+
+func (s *WebDAVStorage) etag(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.etags[filepath.Clean(name)]
+}
+
+func (s *WebDAVStorage) setETag(name string, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if etag == "" {
+		delete(s.etags, filepath.Clean(name))
+	} else {
+		s.etags[filepath.Clean(name)] = etag
+	}
+}
+
+// The cache holds the encrypted files as downloaded, each under its escaped
+// name, next to its ETag. Directories are recorded by an empty marker.
+
+func (s *WebDAVStorage) cacheFile(name string) string {
+	return filepath.Join(s.config.CacheDir, url.PathEscape(filepath.ToSlash(filepath.Clean(name))))
+}
+
+// readCache returns the cached file and takes its ETag, so changes made on
+// the server meanwhile are still detected when saving
+func (s *WebDAVStorage) readCache(name string) ([]byte, error) {
+	if s.config.CacheDir == "" {
+		return nil, notExist("read", name)
+	}
+	data, err := os.ReadFile(s.cacheFile(name))
+	if err != nil {
+		return nil, err
+	}
+	if etag, err := os.ReadFile(s.cacheFile(name) + ".etag"); err == nil {
+		s.setETag(name, string(etag))
+	}
+	return data, nil
+}
+
+func (s *WebDAVStorage) writeCache(name string, data []byte, etag string) {
+	if s.config.CacheDir == "" {
+		return
+	}
+	// The cache is only a fallback, failing to write it is not an error
+	os.WriteFile(s.cacheFile(name), data, 0600)
+	os.WriteFile(s.cacheFile(name)+".etag", []byte(etag), 0600)
+}
+
+func (s *WebDAVStorage) writeCacheDir(name string) {
+	if s.config.CacheDir != "" {
+		os.WriteFile(s.cacheFile(name)+".dir", nil, 0600)
+	}
+}
+
+func (s *WebDAVStorage) removeCache(name string) {
+	if s.config.CacheDir != "" {
+		os.Remove(s.cacheFile(name))
+		os.Remove(s.cacheFile(name) + ".etag")
+	}
+}
+
+// renameCache moves the cached copies of the name and of what is below it
+func (s *WebDAVStorage) renameCache(oldName string, newName string) {
+	if s.config.CacheDir == "" {
+		return
+	}
+	items, err := os.ReadDir(s.config.CacheDir)
+	if err != nil {
+		return
+	}
+	oldPath := filepath.ToSlash(filepath.Clean(oldName))
+	newPath := filepath.ToSlash(filepath.Clean(newName))
+	for _, item := range items {
+		name, err := url.PathUnescape(item.Name())
+		if err != nil {
+			continue
+		}
+		file := strings.TrimSuffix(strings.TrimSuffix(name, ".etag"), ".dir")
+		if file != oldPath && !strings.HasPrefix(file, oldPath+"/") {
+			continue
+		}
+		renamed := url.PathEscape(newPath + name[len(oldPath):])
+		os.Rename(filepath.Join(s.config.CacheDir, item.Name()), filepath.Join(s.config.CacheDir, renamed))
+	}
+}
+
+// statCache describes the cached copy of the name after the server could
+// not be reached with err
+func (s *WebDAVStorage) statCache(name string, err error) (StorageInfo, error) {
+	if s.config.CacheDir == "" {
+		return StorageInfo{}, err
+	}
+	if _, dirErr := os.Stat(s.cacheFile(name) + ".dir"); dirErr == nil {
+		return StorageInfo{IsDir: true}, nil
+	}
+	info, statErr := os.Stat(s.cacheFile(name))
+	if statErr != nil {
+		return StorageInfo{}, err
+	}
+	return StorageInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
@@ -0,0 +1,350 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeWebDAV is a WebDAV server with the methods and conditional requests
+// WebDAVStorage uses
+type fakeWebDAV struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+	etags map[string]int
+	next  int
+}
+
+func newFakeWebDAV(t *testing.T) (*fakeWebDAV, *httptest.Server) {
+	fake := &fakeWebDAV{
+		files: make(map[string][]byte),
+		dirs:  map[string]bool{"/dav": true},
+		etags: make(map[string]int),
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeWebDAV) etag(name string) string {
+	return fmt.Sprintf(`"%d"`, f.etags[name])
+}
+
+// put changes a file as another client would
+func (f *fakeWebDAV) put(name string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.next++
+	f.files[name] = data
+	f.etags[name] = f.next
+}
+
+func (f *fakeWebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, password, _ := r.BasicAuth(); user != "alice" || password != "app-password" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	name := strings.TrimSuffix(r.URL.Path, "/")
+	_, exists := f.files[name]
+
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", f.etag(name))
+		w.Write(f.files[name])
+
+	case http.MethodPut:
+		if match := r.Header.Get("If-Match"); match != "" && (!exists || match != f.etag(name)) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if !f.dirs[path.Dir(name)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.next++
+		f.files[name] = data
+		f.etags[name] = f.next
+		w.Header().Set("ETag", f.etag(name))
+		w.WriteHeader(http.StatusCreated)
+
+	case http.MethodDelete:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && match != f.etag(name) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		delete(f.files, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	case "MKCOL":
+		if f.dirs[name] || exists {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		f.dirs[name] = true
+		w.WriteHeader(http.StatusCreated)
+
+	case "PROPFIND":
+		names := []string{name}
+		switch {
+		case f.dirs[name]:
+			if r.Header.Get("Depth") == "1" {
+				for child := range f.files {
+					if path.Dir(child) == name {
+						names = append(names, child)
+					}
+				}
+				for child := range f.dirs {
+					if child != name && path.Dir(child) == name {
+						names = append(names, child)
+					}
+				}
+				sort.Strings(names[1:])
+			}
+		case !exists:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+		for _, n := range names {
+			if f.dirs[n] {
+				fmt.Fprintf(w, `<d:response><d:href>%s/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop></d:propstat></d:response>`, n)
+			} else {
+				fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype/><d:getcontentlength>%d</d:getcontentlength><d:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</d:getlastmodified><d:getetag>%s</d:getetag></d:prop></d:propstat></d:response>`, n, len(f.files[n]), f.etag(n))
+			}
+		}
+		fmt.Fprint(w, `</d:multistatus>`)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// unreachable fails every request while it is set, as if the network was
+// down
+type unreachable struct {
+	mu   sync.Mutex
+	down bool
+}
+
+func (u *unreachable) set(down bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.down = down
+}
+
+func (u *unreachable) RoundTrip(request *http.Request) (*http.Response, error) {
+	u.mu.Lock()
+	down := u.down
+	u.mu.Unlock()
+	if down {
+		return nil, errors.New("network is unreachable")
+	}
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func newTestWebDAVStorage(t *testing.T, server *httptest.Server, cacheDir string) *WebDAVStorage {
+	return newTestWebDAVStorageWithClient(t, server, cacheDir, nil)
+}
+
+func newTestWebDAVStorageWithClient(t *testing.T, server *httptest.Server, cacheDir string, client *http.Client) *WebDAVStorage {
+	storage, err := NewWebDAVStorage(WebDAVConfig{
+		URL:      server.URL + "/dav/",
+		Username: "alice",
+		Password: "app-password",
+		CacheDir: cacheDir,
+		Client:   client,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+func TestWebDAVStorageReadWrite(t *testing.T) {
+	_, server := newFakeWebDAV(t)
+	storage := newTestWebDAVStorage(t, server, "")
+
+	if _, err := storage.ReadFile("wallet.dat"); !os.IsNotExist(err) {
+		t.Fatalf("ReadFile of a missing file: %v", err)
+	}
+	if err := storage.WriteFile("wallet.dat", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.WriteFile("wallet.dat", []byte("v2")); err != nil {
+		t.Fatalf("WriteFile with the ETag of the last write: %v", err)
+	}
+	data, err := storage.ReadFile("wallet.dat")
+	if err != nil || string(data) != "v2" {
+		t.Fatalf("ReadFile = %q, %v", data, err)
+	}
+	info, err := storage.Stat("wallet.dat")
+	if err != nil || info.IsDir || info.Size != 2 {
+		t.Errorf("Stat = %+v, %v", info, err)
+	}
+
+	if err := storage.Mkdir("vault/entries"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.WriteFile("vault/entries/a.swlt", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	names, err := storage.ReadDir("vault")
+	if err != nil || len(names) != 1 || names[0] != "entries" {
+		t.Errorf("ReadDir = %v, %v", names, err)
+	}
+	if err := storage.Remove("vault/entries/a.swlt"); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong, err := NewWebDAVStorage(WebDAVConfig{URL: server.URL + "/dav/", Username: "alice", Password: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.ReadFile("wallet.dat"); err == nil || os.IsNotExist(err) {
+		t.Errorf("ReadFile with a wrong password: %v", err)
+	}
+}
+
+func TestWebDAVStorageDetectsRemoteChanges(t *testing.T) {
+	fake, server := newFakeWebDAV(t)
+	storage := newTestWebDAVStorage(t, server, "")
+
+	// Created by another client, but never read here
+	fake.put("/dav/wallet.dat", []byte("theirs"))
+	if err := storage.WriteFile("wallet.dat", []byte("mine")); !errors.Is(err, ErrRemoteChanged) {
+		t.Fatalf("WriteFile over a file that was not read = %v, want ErrRemoteChanged", err)
+	}
+
+	if _, err := storage.ReadFile("wallet.dat"); err != nil {
+		t.Fatal(err)
+	}
+	// Changed by another client after it was read
+	fake.put("/dav/wallet.dat", []byte("theirs again"))
+	if err := storage.WriteFile("wallet.dat", []byte("mine")); !errors.Is(err, ErrRemoteChanged) {
+		t.Fatalf("WriteFile after a remote change = %v, want ErrRemoteChanged", err)
+	}
+	if err := storage.Remove("wallet.dat"); !errors.Is(err, ErrRemoteChanged) {
+		t.Fatalf("Remove after a remote change = %v, want ErrRemoteChanged", err)
+	}
+
+	data, err := storage.ReadFile("wallet.dat")
+	if err != nil || string(data) != "theirs again" {
+		t.Fatalf("ReadFile = %q, %v", data, err)
+	}
+	if err := storage.WriteFile("wallet.dat", []byte("mine")); err != nil {
+		t.Fatalf("WriteFile after reading the change: %v", err)
+	}
+}
+
+func TestWebDAVStorageLock(t *testing.T) {
+	_, server := newFakeWebDAV(t)
+	storage := newTestWebDAVStorage(t, server, "")
+
+	unlock, err := storage.Lock("wallet.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Lock("./wallet.dat"); err == nil {
+		t.Fatal("second Lock succeeded while the first is held")
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = storage.Lock("wallet.dat")
+	if err != nil {
+		t.Fatalf("Lock after unlock: %v", err)
+	}
+	unlock()
+}
+
+func TestWebDAVStorageOfflineCache(t *testing.T) {
+	fake, server := newFakeWebDAV(t)
+	cacheDir := t.TempDir()
+	network := &unreachable{}
+	client := &http.Client{Transport: network}
+
+	if err := newTestWebDAVStorageWithClient(t, server, cacheDir, client).WriteFile("wallet.dat", []byte("encrypted")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new program start without a connection
+	network.set(true)
+	storage := newTestWebDAVStorageWithClient(t, server, cacheDir, client)
+	data, err := storage.ReadFile("wallet.dat")
+	if err != nil || string(data) != "encrypted" {
+		t.Fatalf("ReadFile from the cache = %q, %v", data, err)
+	}
+	if !storage.Offline() {
+		t.Error("not Offline after the server could not be reached")
+	}
+	if info, err := storage.Stat("wallet.dat"); err != nil || info.Size != int64(len("encrypted")) {
+		t.Errorf("Stat from the cache = %+v, %v", info, err)
+	}
+	if _, err := storage.ReadFile("other.dat"); err == nil {
+		t.Error("ReadFile of a file that is not cached succeeded")
+	}
+	if err := storage.WriteFile("wallet.dat", []byte("changed")); err == nil {
+		t.Error("WriteFile succeeded without a connection")
+	}
+
+	// The cached ETag still detects changes made on the server meanwhile
+	fake.put("/dav/wallet.dat", []byte("theirs"))
+	network.set(false)
+	if err := storage.WriteFile("wallet.dat", []byte("changed")); !errors.Is(err, ErrRemoteChanged) {
+		t.Errorf("WriteFile with the cached ETag after a remote change = %v, want ErrRemoteChanged", err)
+	}
+	if storage.Offline() {
+		t.Error("Offline after the server was reached again")
+	}
+}
+
+func TestWebDAVStorageWallet(t *testing.T) {
+	_, server := newFakeWebDAV(t)
+	storage := newTestWebDAVStorage(t, server, t.TempDir())
+
+	service := NewWalletServiceWithStorage(storage, "wallet.dat", "password")
+	if err := service.CreateNew(); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddGroup(Path{}, &Group{Name: "Email"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Save(); err != nil {
+		t.Fatal(err)
+	}
+	service.Close()
+
+	reopened := NewWalletServiceWithStorage(newTestWebDAVStorage(t, server, ""), "wallet.dat", "password")
+	defer reopened.Close()
+	if err := reopened.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if groups := reopened.GetWallet().Groups; len(groups) != 1 || groups[0].Name != "Email" {
+		t.Errorf("groups = %+v", groups)
+	}
+}